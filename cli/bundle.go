@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"chrisper/pkg/config"
+	"chrisper/pkg/dictation"
+)
+
+// runExportBundle implements `chrisper export-bundle`, writing recordings
+// from the history with their transcripts and a manifest to a zip file.
+func runExportBundle(args []string) {
+	fs := flag.NewFlagSet("export-bundle", flag.ExitOnError)
+	out := fs.String("o", "", "zip file to write (default <session>.zip)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: chrisper export-bundle [-o file.zip] <id | YYYY-MM-DD | tag>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	session := fs.Arg(0)
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	dir := cfg.HistoryPath()
+	key, err := cfg.HistoryKey()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	all, err := dictation.ListHistory(dir, key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	entries := sessionEntries(all, session)
+	if len(entries) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no recordings in the history match %s (give an ID, a date or a tag)\n", session)
+		os.Exit(1)
+	}
+
+	path := *out
+	if path == "" {
+		path = session + ".zip"
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	w := bufio.NewWriter(f)
+	err = dictation.WriteBundle(w, dir, key, session, entries)
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%d recording(s) written to %s\n", len(entries), path)
+}
+
+// sessionEntries picks the recordings a session names: one history entry
+// by ID, every recording made on a date, or every one with a tag.
+func sessionEntries(entries []dictation.HistoryEntry, session string) []dictation.HistoryEntry {
+	for _, e := range entries {
+		if e.ID == session {
+			return []dictation.HistoryEntry{e}
+		}
+	}
+	if _, err := time.Parse(time.DateOnly, session); err == nil {
+		var matched []dictation.HistoryEntry
+		for _, e := range entries {
+			if e.At.Local().Format(time.DateOnly) == session {
+				matched = append(matched, e)
+			}
+		}
+		return matched
+	}
+	return withTag(entries, session)
+}
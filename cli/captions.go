@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"chrisper/pkg/config"
+	"chrisper/pkg/dictation"
+)
+
+// runCaptions implements `chrisper captions`, which prints live captions of
+// what the microphone hears, optionally translated, until Enter is pressed.
+// With -i it captions an audio file or piped audio instead, to the end.
+func runCaptions(args []string) {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fs := flag.NewFlagSet("captions", flag.ExitOnError)
+	to := fs.String("to", cfg.CaptionLanguage, "translate captions into this language, e.g. en or de")
+	input := fs.String("i", "", "caption this audio file, or - for WAV or raw 16 kHz PCM on stdin, instead of the microphone")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: chrisper captions [-to language] [-i file]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if *to != "" && !cfg.UsesGemini() {
+		fmt.Fprintln(os.Stderr, "Warning: only the gemini backend translates; captions stay in the spoken language.")
+	}
+
+	var src dictation.AudioSource
+	switch *input {
+	case "":
+	case "-":
+		src, err = dictation.NewReaderSource(os.Stdin)
+	default:
+		src, err = dictation.OpenAudioFile(*input)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	s, err := cfg.NewService()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer s.Close()
+
+	started := false
+	finished := make(chan struct{}, 1)
+	s.OnStart = func() {
+		started = true
+		if src == nil {
+			fmt.Println("Captioning... press Enter to stop.")
+		}
+	}
+	s.OnPartial = func(text string) { fmt.Printf("\r%s", text) }
+	s.OnCaption = func(r dictation.Result) { fmt.Printf("\r%s\n", r.Text) }
+	s.OnError = func(err error) { fmt.Fprintf(os.Stderr, "\nError: %v\n", err) }
+	s.OnFinish = func() {
+		select {
+		case finished <- struct{}{}:
+		default:
+		}
+	}
+
+	if src != nil {
+		s.StartSource(context.Background(), dictation.ModeCaption, dictation.Profile{Continuous: true, Translate: *to}, src)
+	} else {
+		s.ToggleCaptions(*to)
+	}
+	if !started {
+		fmt.Fprintln(os.Stderr, "Error: could not start recording")
+		os.Exit(1)
+	}
+	if src == nil {
+		bufio.NewScanner(os.Stdin).Scan()
+		s.StopRecording(context.Background())
+	}
+	<-finished
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"chrisper/pkg/config"
+)
+
+// runDevices implements `chrisper devices`, listing the microphones that
+// input_device and -device can select.
+func runDevices(args []string) {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "usage: chrisper devices")
+		os.Exit(2)
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	s, err := cfg.NewService()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer s.Close()
+
+	devs, err := s.ListInputDevices()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(devs) == 0 {
+		fmt.Println("No microphones found.")
+		return
+	}
+	for _, d := range devs {
+		mark := " "
+		if d.Selected {
+			mark = "*"
+		}
+		note := ""
+		if d.Default {
+			note = "  (default)"
+		}
+		fmt.Printf("%s %3d  %-40s %s, %d ch, %.0f Hz%s\n", mark, d.Index, d.Name, d.Host, d.Channels, d.SampleRate, note)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"chrisper/pkg/config"
+	"chrisper/pkg/doctor"
+)
+
+// runDoctor implements `chrisper doctor`, checking the microphone,
+// permissions and API key. It exits non-zero if any check fails.
+func runDoctor(args []string) {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	results := doctor.Run(context.Background(), cfg)
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Printf("✗ %s: %v\n", r.Name, r.Err)
+		} else {
+			fmt.Printf("✓ %s\n", r.Name)
+		}
+	}
+	if len(doctor.Problems(results)) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"chrisper/pkg/config"
+	"chrisper/pkg/dictation"
+)
+
+const historyUsage = "usage: chrisper history list [-n N] [-tag t] | show <id> | diff <id> [a b] | export <id> | export -tag t | reprocess <id> [-profile name] | sync"
+
+// ANSI escapes for the colored diff.
+const (
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiReset = "\x1b[0m"
+)
+
+// runHistory implements `chrisper history`, listing recordings kept with
+// "history": true and transcribing them again with the current settings.
+func runHistory(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, historyUsage)
+		os.Exit(2)
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	dir := cfg.HistoryPath()
+	key, err := cfg.HistoryKey()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list":
+		fs := flag.NewFlagSet("history list", flag.ExitOnError)
+		n := fs.Int("n", 20, "number of recordings to show")
+		tag := fs.String("tag", "", "only show recordings with this tag")
+		fs.Parse(args[1:])
+
+		entries, err := dictation.ListHistory(dir, key)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(entries) == 0 {
+			fmt.Println("No recordings in the history. Set \"history\": true to keep them.")
+			return
+		}
+		if *tag != "" {
+			if entries = withTag(entries, *tag); len(entries) == 0 {
+				fmt.Printf("No recordings tagged %s.\n", *tag)
+				return
+			}
+		}
+		for _, e := range entries[:min(*n, len(entries))] {
+			fmt.Printf("%-18s %s  %6s  %d version(s)  %s%s\n", e.ID, e.At.Format("2006-01-02 15:04"),
+				e.Duration.Round(time.Second), len(e.Versions), truncate(e.Latest().Text, 50), tagList(e))
+		}
+
+	case "show":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "usage: chrisper history show <id>")
+			os.Exit(2)
+		}
+		e, err := dictation.LoadHistory(dir, key, args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s, %s recorded in %s%s\n", e.At.Format("2006-01-02 15:04:05"), e.Duration.Round(time.Second), orNone(e.App), tagList(e))
+		for i, v := range e.Versions {
+			fmt.Printf("\n#%d %s\n%s\n", i+1, describeVersion(v), v.Text)
+		}
+
+	case "diff":
+		// Compare the first and latest version unless two are given.
+		if len(args) != 2 && len(args) != 4 {
+			fmt.Fprintln(os.Stderr, "usage: chrisper history diff <id> [a b]")
+			os.Exit(2)
+		}
+		e, err := dictation.LoadHistory(dir, key, args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		a, b := 1, len(e.Versions)
+		if len(args) == 4 {
+			a, b = parseVersion(args[2], e), parseVersion(args[3], e)
+		}
+		if a == b {
+			fmt.Printf("%s has only one version.\n", e.ID)
+			return
+		}
+		fmt.Printf("#%d %s -> #%d %s\n", a, describeVersion(e.Versions[a-1]), b, describeVersion(e.Versions[b-1]))
+		color := term(os.Stdout)
+		for _, op := range dictation.DiffWords(e.Versions[a-1].Text, e.Versions[b-1].Text) {
+			switch {
+			case op.Kind == dictation.DiffEqual:
+				fmt.Print(op.Text)
+			case color && op.Kind == dictation.DiffDelete:
+				fmt.Print(ansiRed + op.Text + ansiReset)
+			case color:
+				fmt.Print(ansiGreen + op.Text + ansiReset)
+			default:
+				fmt.Print(wordDiff(op))
+			}
+			fmt.Print(" ")
+		}
+		fmt.Println()
+
+	case "export":
+		if len(args) == 3 && args[1] == "-tag" {
+			entries, err := dictation.ListHistory(dir, key)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			// Oldest first, like a journal.
+			entries = withTag(entries, args[2])
+			for i := len(entries) - 1; i >= 0; i-- {
+				exportMarkdown(entries[i])
+				if i > 0 {
+					fmt.Println()
+				}
+			}
+			return
+		}
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "usage: chrisper history export <id> | -tag t")
+			os.Exit(2)
+		}
+		e, err := dictation.LoadHistory(dir, key, args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		exportMarkdown(e)
+
+	case "sync":
+		store, err := cfg.HistoryStore()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if store == nil {
+			fmt.Fprintln(os.Stderr, "Error: history_sync is not configured")
+			os.Exit(1)
+		}
+		stats, err := dictation.SyncHistory(context.Background(), dir, key, store)
+		fmt.Printf("%d uploaded, %d downloaded\n", stats.Uploaded, stats.Downloaded)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+	case "reprocess":
+		// Accept flags after the ID, as in `reprocess <id> -profile code`.
+		if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+			fmt.Fprintln(os.Stderr, "usage: chrisper history reprocess <id> [-profile name]")
+			os.Exit(2)
+		}
+		id := args[1]
+		fs := flag.NewFlagSet("history reprocess", flag.ExitOnError)
+		profile := fs.String("profile", "", "transcribe with this profile")
+		fs.Parse(args[2:])
+
+		var p dictation.Profile
+		if *profile != "" {
+			if p, err = cfg.Profile(*profile); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		cfg.History = true
+		s, err := cfg.NewService()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer s.Close()
+		s.LiveFile = ""
+
+		v, err := s.Reprocess(context.Background(), id, p)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(v.Text)
+
+	default:
+		fmt.Fprintln(os.Stderr, historyUsage)
+		os.Exit(2)
+	}
+}
+
+// exportMarkdown prints every version of e as Markdown, each with a word
+// diff against the one before it.
+func exportMarkdown(e dictation.HistoryEntry) {
+	fmt.Printf("# Recording %s\n\n", e.ID)
+	fmt.Printf("Recorded %s in %s, %s long.\n", e.At.Format("2006-01-02 15:04:05"), orNone(e.App), e.Duration.Round(time.Second))
+	if len(e.Tags) > 0 {
+		fmt.Printf("\nTags: %s\n", strings.Join(e.Tags, ", "))
+	}
+	for i, v := range e.Versions {
+		fmt.Printf("\n## Version %d: %s\n\n%s\n", i+1, describeVersion(v), v.Text)
+		if i == 0 {
+			continue
+		}
+		var diff []string
+		for _, op := range dictation.DiffWords(e.Versions[i-1].Text, v.Text) {
+			diff = append(diff, wordDiff(op))
+		}
+		fmt.Printf("\nChanges from version %d:\n\n    %s\n", i, strings.Join(diff, " "))
+	}
+}
+
+// wordDiff renders op in git's word diff notation, [-removed-] {+added+}.
+func wordDiff(op dictation.DiffOp) string {
+	switch op.Kind {
+	case dictation.DiffDelete:
+		return "[-" + op.Text + "-]"
+	case dictation.DiffInsert:
+		return "{+" + op.Text + "+}"
+	}
+	return op.Text
+}
+
+// describeVersion summarizes where a transcript came from.
+func describeVersion(v dictation.TranscriptVersion) string {
+	desc := v.At.Format("2006-01-02 15:04") + ", " + v.Backend
+	if v.Model != "" {
+		desc += " (" + v.Model + ")"
+	}
+	if v.Profile != "" {
+		desc += ", profile " + v.Profile
+	}
+	switch {
+	case v.Reprocessed:
+		desc += ", reprocessed"
+	case v.Verified:
+		desc += ", verification"
+	}
+	return desc
+}
+
+// parseVersion reads a 1-based version number of e, exiting if it is out
+// of range.
+func parseVersion(s string, e dictation.HistoryEntry) int {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > len(e.Versions) {
+		fmt.Fprintf(os.Stderr, "Error: %s has versions 1 to %d\n", e.ID, len(e.Versions))
+		os.Exit(2)
+	}
+	return n
+}
+
+// term reports whether f is a terminal, so the diff can be colored.
+func term(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0 && os.Getenv("NO_COLOR") == ""
+}
+
+// truncate shortens s to n runes on one line.
+func truncate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
+
+// withTag returns the entries tagged with tag.
+func withTag(entries []dictation.HistoryEntry, tag string) []dictation.HistoryEntry {
+	var tagged []dictation.HistoryEntry
+	for _, e := range entries {
+		if e.HasTag(tag) {
+			tagged = append(tagged, e)
+		}
+	}
+	return tagged
+}
+
+// tagList formats e's tags to follow a line, e.g. "  #work #alpha".
+func tagList(e dictation.HistoryEntry) string {
+	var s string
+	for _, t := range e.Tags {
+		s += " #" + t
+	}
+	if s != "" {
+		s = " " + s
+	}
+	return s
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
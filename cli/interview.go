@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"chrisper/pkg/config"
+	"chrisper/pkg/dictation"
+	"chrisper/pkg/interview"
+	"chrisper/pkg/voice"
+)
+
+// cliInterview puts the questions in the terminal and reads them out.
+type cliInterview struct {
+	voice string
+	quiet bool
+}
+
+func (ui cliInterview) Ask(n, total int, question string) {
+	fmt.Printf("\nQuestion %d of %d: %s\n", n, total, question)
+	if ui.quiet {
+		return
+	}
+	if err := voice.Say(ui.voice, question); err != nil {
+		fmt.Printf("(could not read the question out: %v)\n", err)
+	}
+}
+
+func (cliInterview) Answered(n, total int, a interview.Answer) {
+	switch {
+	case a.Err != nil:
+		fmt.Printf("Not transcribed: %v\n", a.Err)
+	case a.Text == "":
+		fmt.Println("No answer heard.")
+	}
+}
+
+// runInterview implements `chrisper interview`, which reads out each
+// prepared question, records the answer and writes the questions and
+// answers to a document. Enter ends an answer.
+func runInterview(args []string) {
+	fs := flag.NewFlagSet("interview", flag.ExitOnError)
+	out := fs.String("o", "", "file to write (default interview-<date>.md)")
+	asJSON := fs.Bool("json", false, "write JSON instead of Markdown")
+	quiet := fs.Bool("quiet", false, "show the questions without reading them out")
+	pause := fs.Float64("auto-stop", 0, "end an answer after this many seconds of silence instead of Enter")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: chrisper interview [-o file] [-json] [-quiet] [-auto-stop seconds] <questions file>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	questions, err := interview.LoadQuestions(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	cfg.AutoStopSeconds = *pause
+	s, err := cfg.NewService()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer s.Close()
+	s.LiveFile = ""
+	s.Lock()
+
+	s.OnStart = func() {
+		if *pause > 0 {
+			fmt.Println("Recording... pause to finish your answer.")
+		} else {
+			fmt.Println("Recording... press Enter when you have answered.")
+		}
+	}
+	s.OnProcessing = func() { fmt.Println("Processing...") }
+	s.OnResult = func(r dictation.Result) { fmt.Printf("Answer: %s\n", r.Text) }
+	iv := interview.Attach(s)
+
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			s.StopRecording(context.Background())
+		}
+	}()
+	answers, _ := iv.Run(context.Background(), questions, cliInterview{voice: cfg.Accessibility.Voice, quiet: *quiet})
+
+	path := *out
+	if path == "" {
+		path = "interview-" + time.Now().Format("2006-01-02-1504") + ".md"
+		if *asJSON {
+			path = strings.TrimSuffix(path, ".md") + ".json"
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *asJSON {
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(answers)
+	} else {
+		err = interview.WriteMarkdown(f, "Interview", answers)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("\n%d answer(s) written to %s\n", len(answers), path)
+}
@@ -1,20 +1,114 @@
 package main
 
 import (
-"bufio"
-"fmt"
-"log"
-"os"
-"chrisper/pkg/dictation"
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"chrisper/pkg/config"
+	"chrisper/pkg/dictation"
+	"chrisper/pkg/hooks"
+	"chrisper/pkg/voice"
 )
 
 func main() {
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	if apiKey == "" {
-		log.Fatal("GEMINI_API_KEY is not set")
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "status":
+			runStatus(os.Args[2:])
+			return
+		case "models":
+			runModels(os.Args[2:])
+			return
+		case "doctor":
+			runDoctor(os.Args[2:])
+			return
+		case "usage":
+			runUsage(os.Args[2:])
+			return
+		case "history":
+			runHistory(os.Args[2:])
+			return
+		case "transcribe":
+			runTranscribe(os.Args[2:])
+			return
+		case "serve":
+			runServe(os.Args[2:])
+			return
+		case "interview":
+			runInterview(os.Args[2:])
+			return
+		case "export-bundle":
+			runExportBundle(os.Args[2:])
+			return
+		case "captions":
+			runCaptions(os.Args[2:])
+			return
+		case "devices":
+			runDevices(os.Args[2:])
+			return
+		case "presets":
+			runPresets(os.Args[2:])
+			return
+		case "tutorial":
+			runTutorial(os.Args[2:])
+			return
+		}
 	}
+	runDictation()
+}
 
-	s, err := dictation.New(apiKey)
+// runDictation is the default interactive mode: Enter toggles recording.
+func runDictation() {
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Flags override the config file and environment.
+	flag.StringVar(&cfg.Backend, "backend", cfg.Backend, "speech backend: gemini, apple, whisper, vosk or http")
+	flag.StringVar(&cfg.WhisperModel, "whisper-model", cfg.WhisperModel, "whisper.cpp model name or file (default base.en)")
+	flag.IntVar(&cfg.Whisper.Threads, "whisper-threads", cfg.Whisper.Threads, "CPU threads for the whisper backend (default: probed)")
+	flag.StringVar(&cfg.Whisper.GPU, "whisper-gpu", cfg.Whisper.GPU, "GPU acceleration for the whisper backend: auto, on or off")
+	flag.StringVar(&cfg.VerifyBackend, "verify-backend", cfg.VerifyBackend, "re-check each dictation with this backend in the background")
+	flag.BoolVar(&cfg.AutoCorrect, "auto-correct", cfg.AutoCorrect, "replace typed text when the verify backend disagrees")
+	flag.StringVar(&cfg.Gemini.Model, "model", cfg.Gemini.Model, "Gemini model name")
+	flag.BoolVar(&cfg.Structured, "structured", cfg.Structured, "request a JSON transcript with confidence and language")
+	flag.Float64Var(&cfg.MinConfidence, "min-confidence", cfg.MinConfidence, "discard structured transcripts below this confidence (0-1)")
+	flag.StringVar(&cfg.Prompt, "prompt", cfg.Prompt, "custom transcription instruction")
+	flag.StringVar(&cfg.PromptFile, "prompt-file", cfg.PromptFile, "read the transcription instruction from this file")
+	flag.StringVar(&cfg.Language, "language", cfg.Language, "spoken language as a BCP-47 code (e.g. en, de), or auto")
+	flag.BoolVar(&cfg.CodeSwitch, "code-switch", cfg.CodeSwitch, "expect speech that switches languages mid-sentence")
+	flag.StringVar((*string)(&cfg.Script), "script", string(cfg.Script), "script for non-Latin languages: native, roman or both")
+	flag.StringVar((*string)(&cfg.Injection), "inject", string(cfg.Injection), "how to enter transcripts: auto, type or paste")
+	flag.StringVar(&cfg.Output.Type, "output", cfg.Output.Type, "where transcripts go: keyboard, clipboard, stdout or file")
+	flag.StringVar(&cfg.Output.File, "output-file", cfg.Output.File, "file to append transcripts to with -output file")
+	flag.BoolVar(&cfg.HumanTyping, "human-typing", cfg.HumanTyping, "type at an uneven, human pace")
+	flag.StringVar(&cfg.Speaker.Accent, "accent", cfg.Speaker.Accent, "speaker accent hint, e.g. \"Indian English\"")
+	flag.StringVar(&cfg.VoskModelDir, "vosk-model", cfg.VoskModelDir, "vosk model directory (default vosk in the models directory)")
+	flag.StringVar(&cfg.HTTP.URL, "http-url", cfg.HTTP.URL, "custom speech-to-text endpoint for the http backend")
+	flag.BoolVar(&cfg.Live, "live", cfg.Live, "stream audio to the Gemini Live API and type text as it arrives")
+	flag.BoolVar(&cfg.Locked, "locked", cfg.Locked, "start locked: show transcripts without typing them")
+	flag.BoolVar(&cfg.Reminders, "reminders", cfg.Reminders, "turn \"remind me to ...\" dictations into reminders")
+	flag.StringVar(&cfg.ReminderWebhook, "reminder-webhook", cfg.ReminderWebhook, "POST reminders as JSON to this URL instead of the Reminders app")
+	flag.StringVar(&cfg.InputDevice, "device", cfg.InputDevice, "microphone to record from, by index or name (see chrisper devices)")
+	flag.StringVar(&cfg.LoopbackDevice, "loopback", cfg.LoopbackDevice, "loopback device that records system audio for meetings")
+	flag.Float64Var(&cfg.AutoStopSeconds, "auto-stop", cfg.AutoStopSeconds, "stop recording after this many seconds of silence")
+	flag.IntVar(&cfg.ConfirmAboveSeconds, "confirm-above", cfg.ConfirmAboveSeconds, "ask before transcribing recordings longer than this many seconds")
+	flag.StringVar(&cfg.Glossary, "glossary", cfg.Glossary, "JSON or YAML file of terms to spell correctly")
+	flag.StringVar(&cfg.Contacts, "contacts", cfg.Contacts, "contact names for spelling: a file with one name per line, or \"macos\"")
+	presetNames := flag.String("presets", strings.Join(cfg.Presets, ","), "comma-separated domain presets to apply (see chrisper presets)")
+	flag.Parse()
+	if *presetNames != "" {
+		cfg.Presets = strings.Split(*presetNames, ",")
+	}
+
+	s, err := cfg.NewService()
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -22,12 +116,123 @@ func main() {
 
 	s.OnStart = func() { fmt.Println("Recording started...") }
 	s.OnStop = func() { fmt.Println("Recording stopped...") }
+	s.OnAutoStop = func() { fmt.Println("(silence detected)") }
 	s.OnProcessing = func() { fmt.Println("Processing...") }
+	s.OnPartial = func(text string) { fmt.Printf("\r%s", text) }
+	s.OnResult = func(r dictation.Result) { fmt.Printf("\r%s\n", r.Text) }
+	s.OnNote = func(path string) { fmt.Printf("Note saved: %s\n", path) }
+	s.OnHold = func(held bool) {
+		if held {
+			fmt.Println("Typing held, say \"go\" to resume")
+		} else {
+			fmt.Println("Typing resumed")
+		}
+	}
+	s.OnReminder = func(r dictation.Reminder) { fmt.Printf("Reminder created: %s\n", r.Title) }
+	s.OnCorrection = func(typed, verified string) { fmt.Printf("Verified: %s\n", verified) }
+	s.OnMicSwitch = func(name string) { fmt.Printf("Microphone disconnected, recording with %s\n", name) }
 	s.OnError = func(err error) { fmt.Printf("Error: %v\n", err) }
+	s.OnSpooled = func(path string) { fmt.Printf("Offline, recording saved: %s\n", path) }
+	s.OnReplay = func(text string) { fmt.Printf("Copied to clipboard: %s\n", text) }
+	s.OnConnectivity = func(online bool) {
+		if online {
+			fmt.Println("Backend is back online")
+		} else {
+			fmt.Println("Backend offline, pausing requests")
+		}
+	}
+
+	if cfg.Hooks.Enabled() {
+		hooks.New(cfg.Hooks).Attach(s)
+	}
+	if err := cfg.CheckAccessibility(); err != nil {
+		fmt.Printf("Accessibility mode off: %v\n", err)
+	} else if cfg.Accessibility.Enabled {
+		speech := voice.New(s, cfg.Accessibility)
+		defer speech.Stop()
+		speech.Start()
+	}
+	s.WatchSleep()
+	s.StartPreRecord()
+	s.ReplaySpool()
+	s.CheckBackend()
 
-	fmt.Println("Press Enter to toggle recording. Ctrl+C to exit.")
+	// Confirmation prompts share stdin with the toggle loop below, which
+	// hands lines over while a prompt is pending.
+	var confirming atomic.Bool
+	answers := make(chan string)
+	s.Confirm = func(est dictation.Estimate) bool {
+		confirming.Store(true)
+		defer confirming.Store(false)
+		fmt.Printf("Transcribe %s? [y/N] ", est)
+		answer := strings.ToLower(<-answers)
+		return answer == "y" || answer == "yes"
+	}
+
+	fmt.Println("Press Enter to toggle recording, type n + Enter for a voice note, c + Enter for continuous dictation, m + Enter to record a meeting as a note, a + Enter to transcribe the last recording again, e + Enter to say a correction for the last dictation, x + Enter to cancel the recording and pending transcriptions, or p <profile> + Enter to record with a profile. Ctrl+C to exit.")
+	if cfg.PreRecordSeconds > 0 {
+		fmt.Printf("Type r + Enter to transcribe the last %d seconds.\n", cfg.PreRecordSeconds)
+	}
+	if s.Locked() {
+		fmt.Println("Locked: transcripts are shown but not typed. Type unlock [PIN] to unlock.")
+	}
 	scanner := bufio.NewScanner(os.Stdin)
 	for scanner.Scan() {
+		if confirming.Load() {
+			answers <- strings.TrimSpace(scanner.Text())
+			continue
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "n" {
+			s.ToggleNote()
+			continue
+		}
+		if line == "c" {
+			s.ToggleContinuous()
+			continue
+		}
+		if line == "m" {
+			s.Toggle(context.Background(), dictation.ModeNote, dictation.Profile{Capture: dictation.CaptureMeeting})
+			continue
+		}
+		if line == "r" {
+			s.TranscribeRecent(context.Background())
+			continue
+		}
+		if line == "a" {
+			s.TranscribeLast(context.Background())
+			continue
+		}
+		if line == "e" {
+			s.Toggle(context.Background(), dictation.ModeCorrect, dictation.Profile{})
+			continue
+		}
+		if line == "x" {
+			s.Cancel()
+			continue
+		}
+		if name, ok := strings.CutPrefix(line, "p "); ok {
+			p, err := cfg.Profile(strings.TrimSpace(name))
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+				continue
+			}
+			s.Toggle(context.Background(), dictation.ModeDictate, p)
+			continue
+		}
+		if line == "lock" {
+			s.Lock()
+			fmt.Println("Locked")
+			continue
+		}
+		if pin, ok := strings.CutPrefix(line, "unlock"); ok {
+			if s.Unlock(strings.TrimSpace(pin)) {
+				fmt.Println("Unlocked")
+			} else {
+				fmt.Println("Wrong PIN")
+			}
+			continue
+		}
 		s.ToggleRecording()
 	}
 }
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"chrisper/pkg/config"
+	"chrisper/pkg/dictation"
+	"chrisper/pkg/models"
+)
+
+const modelsUsage = "usage: chrisper models list | pull <name> | remove <name>"
+
+// runModels manages the offline model cache in config.ModelsDir.
+func runModels(args []string) {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, modelsUsage)
+		os.Exit(2)
+	}
+
+	dir := config.ModelsDir()
+	switch args[0] {
+	case "list":
+		list, err := models.List(dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		var total int64
+		for _, m := range list {
+			switch {
+			case !m.Installed:
+				fmt.Printf("  %-16s\n", m.Name)
+			case m.Checksum == "":
+				fmt.Printf("* %-16s %8s  (unverified)\n", m.Name, formatSize(m.Size))
+			default:
+				fmt.Printf("* %-16s %8s  sha256:%s\n", m.Name, formatSize(m.Size), m.Checksum[:12])
+			}
+			total += m.Size
+		}
+		fmt.Printf("\n%s used in %s\n", formatSize(total), dir)
+
+	case "pull":
+		if len(args) != 2 {
+			fmt.Fprintf(os.Stderr, "usage: chrisper models pull <name>\navailable: %s\n", strings.Join(models.Names, ", "))
+			os.Exit(2)
+		}
+		path, err := models.Pull(context.Background(), dir, args[1], func(done, total int64) {
+			if total > 0 {
+				fmt.Printf("\r%s: %d%% of %s", args[1], done*100/total, formatSize(total))
+			} else {
+				fmt.Printf("\r%s: %s", args[1], formatSize(done))
+			}
+		})
+		fmt.Println()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Verified %s\n", path)
+
+		caps := dictation.ProbeWhisper()
+		if caps.GPU != "" {
+			fmt.Printf("GPU acceleration available: %s\n", caps.GPU)
+		} else {
+			fmt.Printf("No GPU acceleration available; whisper will use %d CPUs\n", caps.CPUs)
+		}
+
+	case "remove":
+		if len(args) != 2 {
+			fmt.Fprintln(os.Stderr, "usage: chrisper models remove <name>")
+			os.Exit(2)
+		}
+		if err := models.Remove(dir, args[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Removed %s\n", args[1])
+
+	default:
+		fmt.Fprintln(os.Stderr, modelsUsage)
+		os.Exit(2)
+	}
+}
+
+// formatSize renders a byte count as MB or GB.
+func formatSize(n int64) string {
+	if n >= 1<<30 {
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	}
+	return fmt.Sprintf("%d MB", n>>20)
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"chrisper/pkg/config"
+	"chrisper/pkg/presets"
+)
+
+// runPresets implements `chrisper presets`, listing the domain presets
+// that presets and -presets can select.
+func runPresets(args []string) {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "usage: chrisper presets")
+		os.Exit(2)
+	}
+	packs, err := presets.List(config.PresetsDir())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	for _, p := range packs {
+		fmt.Printf("%-12s %s (%d terms, %d rules)\n", p.Name, p.Description, len(p.Vocabulary), len(p.Rules))
+	}
+}
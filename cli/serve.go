@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+
+	"chrisper/pkg/config"
+	"chrisper/pkg/dictation"
+	"chrisper/pkg/server"
+)
+
+// defaultServeAddr is where `chrisper serve` listens unless told
+// otherwise: only this machine can connect.
+const defaultServeAddr = "127.0.0.1:8178"
+
+// runServe implements `chrisper serve`, which answers OpenAI-style
+// transcription requests with the configured backend.
+func runServe(args []string) {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", cfg.Server.Addr, "address to listen on (default "+defaultServeAddr+")")
+	profile := fs.String("profile", "", "transcribe with this profile")
+	fs.StringVar(&cfg.Server.Token, "token", cfg.Server.Token, "API key clients must send as a bearer token")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: chrisper serve [-addr host:port] [-token key] [-profile name]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *addr == "" {
+		*addr = defaultServeAddr
+	}
+
+	var p dictation.Profile
+	if *profile != "" {
+		if p, err = cfg.Profile(*profile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	s, err := cfg.NewBatchService()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	s.LiveFile = ""
+
+	srv := &http.Server{
+		Addr:    *addr,
+		Handler: server.New(s, server.Options{Token: cfg.Server.Token, Profile: p}),
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		<-ctx.Done()
+		// A second Ctrl+C abandons the requests in progress.
+		stop()
+		srv.Shutdown(context.Background())
+	}()
+
+	fmt.Printf("Serving http://%s%s\n", *addr, server.TranscriptionsPath)
+	err = srv.ListenAndServe()
+	if errors.Is(err, http.ErrServerClosed) {
+		// Let the requests in progress finish with the service.
+		<-shutdown
+	}
+	stop()
+	s.Close()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"chrisper/pkg/config"
+	"chrisper/pkg/dictation"
+)
+
+// runStatus implements `chrisper status`, printing the state of the
+// running app for status bars such as waybar, polybar and xbar.
+func runStatus(args []string) {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	format := fs.String("format", "plain", "output format: plain or json")
+	follow := fs.Bool("follow", false, "keep printing whenever the status changes")
+	fs.Parse(args)
+	if *format != "plain" && *format != "json" {
+		log.Fatalf("unknown format %q", *format)
+	}
+
+	path := config.StatusFilePath()
+	var last string
+	for {
+		line := statusLine(path, *format)
+		if line != last || !*follow {
+			fmt.Println(line)
+			last = line
+		}
+		if !*follow {
+			return
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+func statusLine(path, format string) string {
+	st, err := dictation.ReadStatus(path)
+	running := err == nil
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Failed to read status: %v", err)
+	}
+
+	// Only active states have a meaningful elapsed time. Whole seconds keep
+	// --follow to at most one line a second.
+	var elapsed time.Duration
+	if st.State == dictation.StateRecording || st.State == dictation.StateProcessing {
+		elapsed = st.Elapsed().Truncate(time.Second)
+	}
+	if format == "json" {
+		data, _ := json.Marshal(struct {
+			Running        bool   `json:"running"`
+			State          string `json:"state"`
+			Elapsed        int    `json:"elapsed"`
+			LastTranscript string `json:"last_transcript,omitempty"`
+			Queued         int    `json:"queued,omitempty"`
+		}{running, string(st.State), int(elapsed.Seconds()), st.LastTranscript, st.Queued})
+		return string(data)
+	}
+
+	if !running {
+		return "not running"
+	}
+	if st.State != dictation.StateIdle {
+		line := fmt.Sprintf("%s %d:%02d", st.State, int(elapsed.Minutes()), int(elapsed.Seconds())%60)
+		if st.Queued > 1 || st.Queued > 0 && st.State == dictation.StateRecording {
+			line += fmt.Sprintf(" (%d queued)", st.Queued)
+		}
+		return line
+	}
+	if st.LastTranscript != "" {
+		return fmt.Sprintf("%s: %s", st.State, st.LastTranscript)
+	}
+	return string(st.State)
+}
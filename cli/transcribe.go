@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"chrisper/pkg/config"
+	"chrisper/pkg/dictation"
+)
+
+// runTranscribe implements `chrisper transcribe`, which transcribes audio
+// files in parallel and writes each transcript to a text file next to it,
+// or into -o. With -chapters the transcripts are Markdown documents divided
+// into chapters.
+func runTranscribe(args []string) {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fs := flag.NewFlagSet("transcribe", flag.ExitOnError)
+	outDir := fs.String("o", "", "directory for the transcripts (default next to each file)")
+	profile := fs.String("profile", "", "transcribe with this profile")
+	force := fs.Bool("force", false, "transcribe files again that an earlier run finished")
+	chapters := fs.Bool("chapters", false, "divide transcripts into titled, timestamped chapters, written as Markdown")
+	fs.IntVar(&cfg.Batch.Workers, "j", cfg.Batch.Workers, "files to transcribe at once (default 2)")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: chrisper transcribe [-j workers] [-o dir] [-profile name] [-chapters] [-force] <file>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	paths := fs.Args()
+	total := len(paths)
+
+	var p dictation.Profile
+	if *profile != "" {
+		if p, err = cfg.Profile(*profile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if *outDir != "" {
+		if err := os.MkdirAll(*outDir, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	// Files finished by an earlier, interrupted run are skipped.
+	progress, err := dictation.LoadBatchProgress(config.BatchProgressPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if !*force {
+		paths = slices.DeleteFunc(paths, func(path string) bool {
+			return progress.Done(path, transcriptPath(path, *outDir, *chapters), *profile)
+		})
+		if skipped := total - len(paths); skipped > 0 {
+			fmt.Printf("Skipping %d file(s) transcribed before (-force to redo them)\n", skipped)
+		}
+		if len(paths) == 0 {
+			return
+		}
+	}
+
+	s, err := cfg.NewBatchService()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer s.Close()
+	s.LiveFile = ""
+	s.BatchChapters = *chapters
+
+	// Ctrl+C abandons the files in progress, keeping what was transcribed
+	// of them in a .partial file; running the same command again picks up
+	// from there.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	render := func(r dictation.FileResult) string {
+		if *chapters {
+			title := strings.TrimSuffix(filepath.Base(r.Path), filepath.Ext(r.Path))
+			return dictation.ChaptersMarkdown(title, r.Chapters)
+		}
+		return r.Text + "\n"
+	}
+	done, failed := 0, 0
+	s.TranscribeFiles(ctx, paths, p, func(r dictation.FileResult) {
+		out := transcriptPath(r.Path, *outDir, *chapters)
+		partial := partialPath(out)
+		if r.Partial {
+			if err := os.WriteFile(partial, []byte(render(r)), 0644); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to save partial transcript: %v\n", err)
+			} else {
+				fmt.Printf("%s: interrupted, partial transcript in %s\n", r.Path, partial)
+			}
+			return
+		}
+		if ctx.Err() != nil && errors.Is(r.Err, context.Canceled) {
+			return
+		}
+		done++
+		if r.Err == nil {
+			r.Err = os.WriteFile(out, []byte(render(r)), 0644)
+		}
+		if r.Err == nil {
+			os.Remove(partial)
+			if err := progress.Record(r.Path, out, *profile); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to save progress: %v\n", err)
+			}
+		}
+		if r.Err != nil {
+			failed++
+			fmt.Printf("[%d/%d] %s: %v\n", done, len(paths), r.Path, r.Err)
+			return
+		}
+		fmt.Printf("[%d/%d] %s\n", done, len(paths), out)
+	})
+	if ctx.Err() != nil {
+		fmt.Fprintf(os.Stderr, "Interrupted after %d of %d file(s); run the same command again to resume\n", done, len(paths))
+		os.Exit(130)
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d file(s) failed\n", failed, len(paths))
+		os.Exit(1)
+	}
+}
+
+// partialPath is where the partial transcript of an interrupted file goes,
+// e.g. talk.partial.txt for talk.txt.
+func partialPath(transcript string) string {
+	ext := filepath.Ext(transcript)
+	return strings.TrimSuffix(transcript, ext) + ".partial" + ext
+}
+
+// transcriptPath is where the transcript of an audio file goes: the same
+// name with a .txt extension, or .md with chapters, in dir or else next to
+// it.
+func transcriptPath(path, dir string, chapters bool) string {
+	ext := ".txt"
+	if chapters {
+		ext = ".md"
+	}
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + ext
+	if dir == "" {
+		dir = filepath.Dir(path)
+	}
+	return filepath.Join(dir, name)
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+
+	"chrisper/pkg/config"
+	"chrisper/pkg/dictation"
+	"chrisper/pkg/tutorial"
+)
+
+// cliTutorial shows the tutorial in the terminal.
+type cliTutorial struct{}
+
+func (cliTutorial) Step(n, total int, s tutorial.Step) {
+	fmt.Printf("\nStep %d of %d: %s\n%s\n", n, total, s.Title, s.Instruction)
+}
+
+func (cliTutorial) Result(s tutorial.Step, a tutorial.Attempt, passed bool) {
+	switch {
+	case passed:
+		fmt.Println("Well done!")
+	case a.Err != nil:
+		fmt.Printf("That failed: %v\nTry again.\n", a.Err)
+	default:
+		fmt.Printf("%s\n", s.Hint)
+	}
+}
+
+// runTutorial implements `chrisper tutorial`, a guided first dictation.
+// Enter stands in for the hotkey, and transcripts are shown rather than
+// typed into the terminal.
+func runTutorial(args []string) {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "usage: chrisper tutorial")
+		os.Exit(2)
+	}
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	s, err := cfg.NewService()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer s.Close()
+	s.LiveFile = ""
+	s.HistoryDir = ""
+	s.Lock()
+
+	s.OnStart = func() { fmt.Println("Recording... press Enter to stop.") }
+	s.OnProcessing = func() { fmt.Println("Processing...") }
+	s.OnResult = func(r dictation.Result) { fmt.Printf("Heard: %s\n", r.Text) }
+	t := tutorial.Attach(s)
+
+	fmt.Println("Welcome to Chrisper! In this tutorial, Enter is the hotkey: press it to start and stop recording.")
+	done := make(chan error, 1)
+	go func() { done <- t.Run(context.Background(), cliTutorial{}) }()
+
+	lines := make(chan struct{})
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			lines <- struct{}{}
+		}
+		close(lines)
+	}()
+	for {
+		select {
+		case <-done:
+			fmt.Println("\nThat's it! Run chrisper (or the menu bar app) to dictate for real.")
+			return
+		case _, ok := <-lines:
+			if !ok {
+				return
+			}
+			s.ToggleRecording()
+		}
+	}
+}
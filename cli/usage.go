@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"chrisper/pkg/config"
+	"chrisper/pkg/dictation"
+)
+
+// runUsage implements `chrisper usage`, printing the Gemini tokens and
+// approximate cost per day.
+func runUsage(args []string) {
+	fs := flag.NewFlagSet("usage", flag.ExitOnError)
+	days := fs.Int("days", 7, "number of days to show")
+	fs.Parse(args)
+
+	usage, err := dictation.ReadUsage(config.UsageFilePath())
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Println("No usage recorded yet.")
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var total dictation.TokenUsage
+	for i := *days - 1; i >= 0; i-- {
+		day := time.Now().AddDate(0, 0, -i).Format("2006-01-02")
+		u, ok := usage[day]
+		if !ok {
+			continue
+		}
+		fmt.Printf("%s  %s\n", day, u)
+		total.Requests += u.Requests
+		total.InputTokens += u.InputTokens
+		total.OutputTokens += u.OutputTokens
+		total.Cost += u.Cost
+	}
+	fmt.Printf("Last %d days: %s\n", *days, total)
+}
@@ -1,31 +1,51 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
 
+	"chrisper/pkg/config"
 	"chrisper/pkg/dictation"
+	"chrisper/pkg/doctor"
+	"chrisper/pkg/hooks"
+	"chrisper/pkg/hotkey"
+	"chrisper/pkg/logfile"
+	"chrisper/pkg/tutorial"
+	"chrisper/pkg/voice"
 
 	"github.com/getlantern/systray"
-	hook "github.com/robotn/gohook"
 )
 
 var (
-	service *dictation.Service
+	service  *dictation.Service
+	usage    *dictation.UsageTracker
+	lessons  *tutorial.Tutorial
+	speech   *voice.Controller // Accessibility mode, if enabled
+	captions string            // Language Live Captions are translated into
+	mDictate *systray.MenuItem
+	logPath  string // The log file, if logging to one
 	// embeddedAPIKey can be set via -ldflags "-X main.embeddedAPIKey=..."
 	embeddedAPIKey string
+	// cancelKey binds Escape to cancelling, for the hotkey listener.
+	cancelKey escapeKey
 )
 
 func main() {
 	// Setup logging to file for debugging app bundle launch
-	logFile := "/tmp/chrisper.log"
-	f, err := os.OpenFile(logFile, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
+	if w, err := openLogFile(); err != nil {
 		// If we can't open log file, we can't do much.
 	} else {
-		log.SetOutput(f)
-		defer f.Close()
+		log.SetOutput(w)
+		logPath = w.Path()
+		defer w.Close()
 	}
 	log.Println("Chrisper Application Started")
 	log.Printf("Environment: %v\n", os.Environ())
@@ -38,79 +58,616 @@ func onReady() {
 	systray.SetTitle("")
 	systray.SetTooltip("Real-time Dictation")
 
+	mDictate = systray.AddMenuItem("Start Dictation", "Toggle recording without the hotkey")
+	mDictate.Disable()
+	mAgain := systray.AddMenuItem("Transcribe Again", "Transcribe the last recording again, e.g. after an error")
+	mAgain.Disable()
+	mLock := systray.AddMenuItem("Lock", "Stop typing transcripts into other apps")
+	mLock.Disable()
+	mUsage := systray.AddMenuItem("Usage", "Show Gemini tokens and cost")
+	mMeeting := systray.AddMenuItem("Record Meeting", "Record the microphone and system audio as a voice note")
+	mMeeting.Disable()
+	mCaptions := systray.AddMenuItem("Live Captions", "Show captions of what the microphone hears in the menu bar")
+	mCaptions.Disable()
+	mTutorial := systray.AddMenuItem("Tutorial", "Learn to dictate step by step")
+	mLog := systray.AddMenuItem("Open Log", "Show the log, for troubleshooting")
+	if logPath == "" {
+		mLog.Hide()
+	}
+	mConfigure := systray.AddMenuItem("Configure…", "Open the config file")
+	mRetry := systray.AddMenuItem("Retry", "Reload the config and start dictation")
+	mConfigure.Hide()
+	mRetry.Hide()
+	systray.AddSeparator()
 	mQuit := systray.AddMenuItem("Quit", "Quit the application")
 
-	// 1. Initialize Dictation Service
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	if apiKey == "" {
-		if embeddedAPIKey != "" {
-			apiKey = embeddedAPIKey
-			log.Printf("Using embedded API Key\n")
+	// Lock / Unlock
+	setLockTitle := func() {
+		if service.Locked() {
+			mLock.SetTitle("Unlock...")
 		} else {
-			log.Fatal("Please set GEMINI_API_KEY environment variable.")
+			mLock.SetTitle("Lock")
+		}
+	}
+
+	// 1. Initialize Dictation Service. On failure the tray stays up in an
+	// error state so the config can be fixed and retried.
+	ready := func() bool {
+		cfg, err := startService()
+		if err != nil {
+			log.Printf("Failed to start: %v", err)
+			systray.SetTitle("Chrisper: Setup needed")
+			systray.SetTooltip(err.Error())
+			notify("Chrisper could not start", err.Error())
+			mConfigure.Show()
+			mRetry.Show()
+			return false
 		}
+		systray.SetTitle("")
+		systray.SetTooltip("Real-time Dictation")
+		mConfigure.Hide()
+		mRetry.Hide()
+		mDictate.Enable()
+		mAgain.Enable()
+		mLock.Enable()
+		mMeeting.Enable()
+		mCaptions.Enable()
+		setLockTitle()
+
+		// 2. Start Hotkey Listener
+		go startHotkeyListener(cfg)
+		go healthCheck(cfg)
+		return true
+	}
+	if !ready() {
+		go func() {
+			for {
+				select {
+				case <-mConfigure.ClickedCh:
+					if err := openConfig(); err != nil {
+						log.Printf("Failed to open config: %v", err)
+					}
+				case <-mRetry.ClickedCh:
+					if ready() {
+						return
+					}
+				}
+			}
+		}()
 	}
 
-	var err error
-	service, err = dictation.New(apiKey)
+	go func() {
+		for range mDictate.ClickedCh {
+			service.ToggleRecording()
+		}
+	}()
+
+	go func() {
+		for range mAgain.ClickedCh {
+			service.TranscribeLast(context.Background())
+		}
+	}()
+
+	go func() {
+		for range mLock.ClickedCh {
+			if !service.Locked() {
+				service.Lock()
+			} else if service.PIN == "" {
+				service.Unlock("")
+			} else if pin, ok := pinDialog(); ok {
+				if !service.Unlock(pin) {
+					notify("Chrisper", "Wrong PIN, dictation stays locked.")
+				}
+			}
+			setLockTitle()
+		}
+	}()
+
+	go func() {
+		for range mUsage.ClickedCh {
+			showUsage()
+		}
+	}()
+
+	go func() {
+		for range mMeeting.ClickedCh {
+			service.Toggle(context.Background(), dictation.ModeNote, dictation.Profile{Capture: dictation.CaptureMeeting})
+		}
+	}()
+
+	go func() {
+		for range mCaptions.ClickedCh {
+			service.ToggleCaptions(captions)
+		}
+	}()
+
+	go func() {
+		for range mTutorial.ClickedCh {
+			if lessons == nil {
+				continue
+			}
+			mTutorial.Disable()
+			if err := lessons.Run(context.Background(), trayTutorial{}); err != nil {
+				log.Printf("Tutorial: %v", err)
+			}
+			notify("Chrisper tutorial", "All done! You are ready to dictate.")
+			mTutorial.Enable()
+		}
+	}()
+
+	go func() {
+		for range mLog.ClickedCh {
+			if err := openPath(logPath); err != nil {
+				log.Printf("Failed to open log: %v", err)
+			}
+		}
+	}()
+
+	// 3. Handle Quit
+	go func() {
+		<-mQuit.ClickedCh
+		systray.Quit()
+	}()
+}
+
+// startService loads the config and creates the dictation service.
+func startService() (*config.Config, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if cfg.APIKey == "" && len(cfg.APIKeys) == 0 && embeddedAPIKey != "" {
+		cfg.APIKey = embeddedAPIKey
+		log.Printf("Using embedded API Key\n")
+	}
+
+	s, err := cfg.NewService()
 	if err != nil {
-		log.Fatalf("Failed to initialize dictation service: %v", err)
+		return nil, fmt.Errorf("failed to initialize dictation service: %w", err)
 	}
-	
+
 	// Setup Callbacks
-	service.OnStart = func() {
+	s.OnStart = func() {
 		fmt.Println("Recording Started")
 		systray.SetTitle("")
 		systray.SetIcon(iconRecording)
+		mDictate.SetTitle("Stop Dictation")
 	}
-	service.OnStop = func() {
+	s.OnStop = func() {
 		fmt.Println("Recording Stopped")
 		systray.SetTitle("")
 		systray.SetIcon(iconIdle)
+		mDictate.SetTitle("Start Dictation")
+	}
+	s.OnMeter = func(m dictation.Meter) {
+		// How much has been said, to keep clear of the limits.
+		systray.SetTitle(m.String())
+	}
+	s.OnAutoStop = func() {
+		log.Printf("Recording stopped after silence")
 	}
-	service.OnProcessing = func() {
+	s.OnProcessing = func() {
 		systray.SetTitle("Processing...")
 	}
-	service.OnFinish = func() {
+	s.OnFinish = func() {
 		systray.SetTitle("")
 	}
-	service.OnError = func(err error) {
+	s.OnQueue = func(n int) {
+		// Recordings made while others are transcribed wait in line.
+		if n > 1 {
+			systray.SetTitle(fmt.Sprintf("Processing %d...", n))
+		} else if n == 1 {
+			systray.SetTitle("Processing...")
+		}
+	}
+	s.OnHold = func(held bool) {
+		if held {
+			systray.SetTitle("Held: say \"go\"")
+		} else {
+			systray.SetTitle("")
+		}
+	}
+	s.OnCaption = func(r dictation.Result) {
+		systray.SetTitle(caption(r.Text))
+	}
+	s.OnNote = func(path string) {
+		log.Printf("Note saved: %s", path)
+	}
+	s.OnReminder = func(r dictation.Reminder) {
+		log.Printf("Reminder created: %s", r.Title)
+	}
+	s.OnCorrection = func(typed, verified string) {
+		log.Printf("Corrected %q to %q", typed, verified)
+	}
+	s.OnSpooled = func(path string) {
+		systray.SetTitle("Offline: saved")
+	}
+	s.OnConnectivity = func(online bool) {
+		if online {
+			systray.SetTitle("")
+		} else {
+			systray.SetTitle("Offline")
+		}
+	}
+	s.OnReplay = func(text string) {
+		notify("Chrisper", "Dictation was copied to the clipboard")
+	}
+	s.Confirm = func(est dictation.Estimate) bool {
+		return confirmDialog(fmt.Sprintf("Transcribe this recording?\n\n%s", est))
+	}
+	s.OnMicSwitch = func(name string) {
+		// Called from the recording loop, which must not wait for it.
+		go notify("Microphone disconnected", "Recording continues with "+name)
+	}
+	s.OnError = func(err error) {
 		log.Printf("Dictation Error: %v", err)
 		systray.SetTitle("Dictation: Error")
 	}
+	s.Preflight = func() error {
+		if err := doctor.PermissionError(); err != nil {
+			doctor.RequestPermissions()
+			go notify("Chrisper cannot record", "Allow Chrisper in System Settings > Privacy & Security, then try again.")
+			return fmt.Errorf("missing permissions: %w", err)
+		}
+		return nil
+	}
 
-	// 2. Start Hotkey Listener
-	go startHotkeyListener()
+	if cfg.Hooks.Enabled() {
+		hooks.New(cfg.Hooks).Attach(s)
+	}
+	lessons = tutorial.Attach(s)
+	cancelKey.watch(s)
+	s.WatchSleep()
+	s.StartPreRecord()
+	if err := cfg.CheckAccessibility(); err != nil {
+		log.Printf("Accessibility mode off: %v", err)
+		go notify("Accessibility mode is off", err.Error())
+	} else if cfg.Accessibility.Enabled {
+		speech = voice.New(s, cfg.Accessibility)
+		go speech.Start()
+	}
+	s.ReplaySpool()
+	s.CheckBackend()
+	service = s
+	usage = cfg.Usage()
+	captions = cfg.CaptionLanguage
+	return cfg, nil
+}
 
-	// 3. Handle Quit
-	go func() {
-		<-mQuit.ClickedCh
-		systray.Quit()
-	}()
+// captionWidth is how many characters of a caption fit in the menu bar.
+const captionWidth = 60
+
+// caption returns the end of text that fits in the menu bar.
+func caption(text string) string {
+	r := []rune(text)
+	if len(r) <= captionWidth {
+		return text
+	}
+	return "…" + string(r[len(r)-captionWidth+1:])
+}
+
+// trayTutorial shows the tutorial as notifications.
+type trayTutorial struct{}
+
+func (trayTutorial) Step(n, total int, s tutorial.Step) {
+	log.Printf("Tutorial step %d of %d: %s", n, total, s.Title)
+	text := s.Instruction
+	if n == 1 {
+		text = "Open a text editor first, so there is somewhere to type. " + text
+	}
+	notify(fmt.Sprintf("Tutorial %d/%d: %s", n, total, s.Title), text)
+}
+
+func (trayTutorial) Result(s tutorial.Step, a tutorial.Attempt, passed bool) {
+	switch {
+	case passed:
+		notify("Well done!", s.Title+" worked.")
+	case a.Err != nil:
+		notify("That failed", a.Err.Error()+" Try again.")
+	default:
+		notify(s.Title, s.Hint)
+	}
+}
+
+// showUsage shows the token usage and cost of this session and today.
+func showUsage() {
+	var session, today dictation.TokenUsage
+	if usage != nil {
+		session, today = usage.Session(), usage.Today()
+	}
+	message := fmt.Sprintf("This session: %s\n\nToday: %s", session, today)
+	log.Printf("Usage: %s", strings.ReplaceAll(message, "\n\n", "; "))
+	if runtime.GOOS != "darwin" {
+		return
+	}
+	script := `on run argv
+	display dialog (item 1 of argv) with title "Chrisper Usage" buttons {"OK"} default button "OK"
+end run`
+	cmd := exec.Command("osascript", "-", message)
+	cmd.Stdin = strings.NewReader(script)
+	cmd.Run()
+}
+
+// openConfig opens the config file in a text editor, creating it first if
+// needed.
+func openConfig() error {
+	path := config.Path()
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte("{\n  \"api_key\": \"\"\n}\n"), 0600); err != nil {
+			return err
+		}
+	}
+	if runtime.GOOS == "darwin" {
+		return exec.Command("open", "-t", path).Run()
+	}
+	return exec.Command("xdg-open", path).Run()
+}
+
+// openLogFile opens the rotated log file the config names, or the default
+// one if the config cannot be read; startService reports that error.
+func openLogFile() (*logfile.Writer, error) {
+	var l config.Log
+	if cfg, err := config.Load(); err == nil {
+		l = cfg.Log
+	}
+	return logfile.Open(l.Path(), l.Options())
+}
+
+// openPath opens a file in the default app for it, Console for logs on
+// macOS.
+func openPath(path string) error {
+	if runtime.GOOS == "darwin" {
+		return exec.Command("open", path).Run()
+	}
+	return exec.Command("xdg-open", path).Run()
+}
+
+// healthCheck runs the doctor checks and shows one notification listing any
+// problems, since the app bundle's log is out of sight.
+func healthCheck(cfg *config.Config) {
+	if doctor.PermissionsReset(config.PermissionsFilePath()) {
+		// macOS forgets the permissions of an app whose signature changes.
+		log.Printf("Permissions were reset by an update, asking again")
+		notify("Chrisper was updated", "macOS has reset its permissions. Allow Chrisper again when asked; if it is already listed in System Settings > Privacy & Security, remove it and add it again.")
+		doctor.RequestPermissions()
+	}
+	results := doctor.Run(context.Background(), cfg)
+	for _, r := range doctor.Problems(results) {
+		log.Printf("Health check %s: %v", r.Name, r.Err)
+	}
+	if summary := doctor.Summary(results); summary != "" {
+		notify("Chrisper needs attention", summary)
+	}
+}
+
+// notify shows a desktop notification on macOS.
+func notify(title, message string) {
+	if runtime.GOOS != "darwin" {
+		return
+	}
+	script := `on run argv
+	display notification (item 2 of argv) with title (item 1 of argv)
+end run`
+	cmd := exec.Command("osascript", "-", title, message)
+	cmd.Stdin = strings.NewReader(script)
+	if err := cmd.Run(); err != nil {
+		log.Printf("Failed to show notification: %v", err)
+	}
+}
+
+// confirmDialog shows a Transcribe/Discard dialog and reports whether the
+// user chose Transcribe. Without a dialog (non-macOS) it always confirms.
+func confirmDialog(message string) bool {
+	if runtime.GOOS != "darwin" {
+		return true
+	}
+	script := `on run argv
+	display dialog (item 1 of argv) with title "Chrisper" buttons {"Discard", "Transcribe"} default button "Transcribe"
+end run`
+	cmd := exec.Command("osascript", "-", message)
+	cmd.Stdin = strings.NewReader(script)
+	out, err := cmd.Output()
+	// Pressing Discard (or Esc) makes display dialog fail with "User canceled".
+	return err == nil && strings.Contains(string(out), "Transcribe")
+}
+
+// pinPrompt is the text of the unlock PIN dialog.
+const pinPrompt = "Enter the PIN to unlock dictation:"
+
+// pinDialog asks for the unlock PIN: with osascript on macOS, zenity or
+// kdialog on Linux and PowerShell on Windows. It reports false if the user
+// cancels or there is no way to ask.
+func pinDialog() (string, bool) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := `display dialog "` + pinPrompt + `" with title "Chrisper" default answer "" with hidden answer
+text returned of result`
+		cmd = exec.Command("osascript", "-")
+		cmd.Stdin = strings.NewReader(script)
+	case "windows":
+		script := `Add-Type -AssemblyName Microsoft.VisualBasic
+[Microsoft.VisualBasic.Interaction]::InputBox('` + pinPrompt + `', 'Chrisper')`
+		cmd = exec.Command("powershell", "-NoProfile", "-Command", "-")
+		cmd.Stdin = strings.NewReader(script)
+	default:
+		if _, err := exec.LookPath("zenity"); err == nil {
+			cmd = exec.Command("zenity", "--password", "--title=Chrisper")
+		} else if _, err := exec.LookPath("kdialog"); err == nil {
+			cmd = exec.Command("kdialog", "--title", "Chrisper", "--password", pinPrompt)
+		} else {
+			log.Printf("Cannot ask for the PIN: install zenity or kdialog")
+			return "", false
+		}
+	}
+	out, err := cmd.Output()
+	pin := strings.TrimSpace(string(out))
+	if err != nil || pin == "" {
+		// InputBox returns nothing when cancelled.
+		return "", false
+	}
+	return pin, true
 }
 
 func onExit() {
+	if speech != nil {
+		speech.Stop()
+	}
 	if service != nil {
 		service.Close()
 	}
 }
 
-func startHotkeyListener() {
+func startHotkeyListener(cfg *config.Config) {
+	keys, err := hotkey.New(cfg.HotkeyBackend)
+	if err != nil {
+		log.Printf("Hotkeys unavailable: %v", err)
+		notify("Chrisper hotkeys unavailable", err.Error())
+		return
+	}
+	register := func(combo []string, fn func()) func() {
+		remove, err := keys.Register(combo, fn)
+		if err != nil {
+			log.Printf("Hotkey %s: %v", strings.Join(combo, "+"), err)
+			return func() {}
+		}
+		return remove
+	}
+	// record binds combo to recording in mode with p: toggled by each
+	// press, or only while the keys are held.
+	record := func(combo []string, hold bool, mode dictation.Mode, p dictation.Profile) {
+		if !hold {
+			register(combo, func() {
+				if service != nil {
+					service.Toggle(context.Background(), mode, p)
+				}
+			})
+			return
+		}
+		_, err := keys.RegisterHold(combo, func() {
+			if service != nil {
+				service.Start(context.Background(), mode, p)
+			}
+		}, func() {
+			if service != nil {
+				service.StopRecording(context.Background())
+			}
+		})
+		if err != nil {
+			log.Printf("Hotkey %s: %v", strings.Join(combo, "+"), err)
+		}
+	}
+
 	fmt.Println("Listening for hotkeys...")
 	// Toggle: Cmd + Shift + Space
-	hook.Register(hook.KeyDown, []string{"space", "shift", "command"}, func(e hook.Event) {
-		if service != nil {
-			service.ToggleRecording()
-		}
-	})
+	record([]string{"space", "shift", "command"}, cfg.HoldToTalk, dictation.ModeDictate, dictation.Profile{})
 
-	// Cancel: Escape
-	hook.Register(hook.KeyDown, []string{"esc"}, func(e hook.Event) {
-		if service != nil {
-			service.StopRecording()
+	// Voice note: Cmd + Shift + N
+	record([]string{"n", "shift", "command"}, cfg.HoldToTalk, dictation.ModeNote, dictation.Profile{})
+
+	// Configured hotkeys, e.g. dictation in another language
+	for _, hk := range cfg.Hotkeys {
+		if hk.Recent {
+			register(hk.Keys, func() {
+				if service != nil {
+					service.TranscribeRecent(context.Background())
+				}
+			})
+			continue
+		}
+		var p dictation.Profile
+		if hk.Profile != "" {
+			var err error
+			if p, err = cfg.Profile(hk.Profile); err != nil {
+				log.Printf("Hotkey %s: %v", strings.Join(hk.Keys, "+"), err)
+				continue
+			}
 		}
-	})
+		p.Continuous = p.Continuous || hk.Continuous
+		record(hk.Keys, hk.Hold, hk.Mode(), p)
+	}
+
+	// Cancel: Escape discards the recording and anything still being
+	// transcribed. Backends that take the key away from other apps only
+	// get it while there is something to cancel; gohook cannot register
+	// hotkeys once it runs, so it has Escape all along.
+	if hotkey.Consumes(keys) {
+		cancelKey.attach(func() func() {
+			return register([]string{"esc"}, func() {
+				if service != nil {
+					service.Cancel()
+				}
+			})
+		})
+	} else {
+		register([]string{"esc"}, func() {
+			if service != nil && cancelKey.busy() {
+				service.Cancel()
+			}
+		})
+	}
+
+	if err := keys.Run(); err != nil {
+		log.Printf("Hotkeys stopped: %v", err)
+		notify("Chrisper hotkeys stopped", err.Error())
+	}
+}
 
-	s := hook.Start()
-	<-hook.Process(s)
+// escapeKey tracks whether there is anything for Escape to cancel, and
+// binds it only then for backends that consume it.
+type escapeKey struct {
+	mu        sync.Mutex
+	recording bool
+	queued    int
+	bind      func() (remove func()) // Set by attach
+	remove    func()
+}
+
+// watch wraps the callbacks of s that tell when there is something to
+// cancel. It must be called before s can record.
+func (e *escapeKey) watch(s *dictation.Service) {
+	onStart, onStop, onQueue := s.OnStart, s.OnStop, s.OnQueue
+	s.OnStart = func() {
+		onStart()
+		e.set(func() { e.recording = true })
+	}
+	s.OnStop = func() {
+		e.set(func() { e.recording = false })
+		onStop()
+	}
+	s.OnQueue = func(n int) {
+		onQueue(n)
+		e.set(func() { e.queued = n })
+	}
+}
+
+// attach binds Escape with bind whenever there is something to cancel,
+// and removes it again when there is not.
+func (e *escapeKey) attach(bind func() func()) {
+	e.set(func() { e.bind = bind })
+}
+
+// busy reports whether there is something to cancel.
+func (e *escapeKey) busy() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.recording || e.queued > 0
+}
+
+// set applies change and binds or removes Escape to match.
+func (e *escapeKey) set(change func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	change()
+	switch busy := e.recording || e.queued > 0; {
+	case e.bind == nil:
+	case busy && e.remove == nil:
+		e.remove = e.bind()
+	case !busy && e.remove != nil:
+		e.remove()
+		e.remove = nil
+	}
 }
@@ -0,0 +1,962 @@
+// Package config loads Chrisper settings from ~/.chrisper/config.json and
+// the environment, and builds a dictation.Service from them.
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"time"
+
+	"chrisper/pkg/dictation"
+	"chrisper/pkg/hooks"
+	"chrisper/pkg/logfile"
+	"chrisper/pkg/models"
+	"chrisper/pkg/paths"
+	"chrisper/pkg/presets"
+	"chrisper/pkg/schedule"
+	"chrisper/pkg/voice"
+)
+
+// Config holds all user settings. Zero values mean "use the default".
+type Config struct {
+	// Backend is gemini, apple, whisper, vosk or http. When empty, gemini is used if
+	// an API key is available and apple otherwise (on macOS).
+	Backend string `json:"backend,omitempty"`
+	// Backends, when set, replaces Backend with an ordered fallback chain,
+	// e.g. ["gemini", "http", "vosk"]. Audio that fails on one backend with
+	// a 429, 5xx or timeout is retried on the next.
+	Backends []string `json:"backends,omitempty"`
+	// Ensemble sends all audio to every one of Backends at once instead and
+	// merges their transcripts by a confidence-weighted vote.
+	Ensemble bool `json:"ensemble,omitempty"`
+	// BackendTimeout bounds each attempt in the chain, in seconds.
+	BackendTimeout int `json:"backend_timeout,omitempty"`
+	// VerifyBackend re-transcribes each dictation in the background, e.g.
+	// gemini behind a fast local whisper. With AutoCorrect, typed text is
+	// replaced when the results differ by CorrectThreshold or more.
+	VerifyBackend    string  `json:"verify_backend,omitempty"`
+	AutoCorrect      bool    `json:"auto_correct,omitempty"`
+	CorrectThreshold float64 `json:"correct_threshold,omitempty"`
+	// RetranscribeBackend is used to transcribe the last recording again
+	// from the menu, e.g. gemini to retry what a local whisper got wrong.
+	// Empty uses the usual backend.
+	RetranscribeBackend string `json:"retranscribe_backend,omitempty"`
+	// APIKey is the Gemini API key. APIKeys adds more keys to rotate
+	// between; see dictation.GeminiOptions.KeyRotation.
+	APIKey  string   `json:"api_key,omitempty"`
+	APIKeys []string `json:"api_keys,omitempty"`
+	// Gemini sets the model and generation parameters.
+	Gemini dictation.GeminiOptions `json:"gemini,omitzero"`
+	// Structured asks Gemini for a JSON transcript with its confidence and
+	// the detected language. Transcripts below MinConfidence are discarded
+	// instead of typed.
+	Structured    bool    `json:"structured,omitempty"`
+	MinConfidence float64 `json:"min_confidence,omitempty"`
+	// Prompt replaces the built-in transcription instruction. PromptFile
+	// reads it from a file instead. Either may use the {{app}},
+	// {{language}} and {{glossary}} placeholders.
+	Prompt     string `json:"prompt,omitempty"`
+	PromptFile string `json:"prompt_file,omitempty"`
+
+	// Language is the expected spoken language as a BCP-47 code such as
+	// "en" or "de", or "auto" to detect it.
+	Language string `json:"language,omitempty"`
+	// Profiles are named overrides, such as another language, that
+	// hotkeys can start recordings with.
+	Profiles map[string]dictation.Profile `json:"profiles,omitempty"`
+	// Schedule switches the profile used by recordings without one by time
+	// of day, weekday or calendar events. The first matching rule wins.
+	Schedule []schedule.Rule `json:"schedule,omitempty"`
+	// Hotkeys adds key combinations to the menu bar app.
+	Hotkeys []Hotkey `json:"hotkeys,omitempty"`
+	// HotkeyBackend is gohook (the default), carbon on macOS, or x11 or
+	// evdev on Linux.
+	HotkeyBackend string `json:"hotkey_backend,omitempty"`
+	// HoldToTalk makes the built-in dictation and note hotkeys record only
+	// while held down, instead of toggling.
+	HoldToTalk bool `json:"hold_to_talk,omitempty"`
+	// Speaker describes the speaker's accent, style and domain.
+	Speaker dictation.SpeakerHints `json:"speaker,omitzero"`
+	// CodeSwitch expects dictations that switch languages mid-sentence.
+	CodeSwitch bool `json:"code_switch,omitempty"`
+	// Script is native (the default), roman or both, for languages not
+	// written in the Latin alphabet.
+	Script dictation.Script `json:"script,omitempty"`
+	// Injection is auto (the default), type or paste. Auto pastes while a
+	// CJK input method is active so it cannot mangle the text.
+	Injection dictation.Injection `json:"injection,omitempty"`
+	// Output sends transcripts somewhere other than the focused window.
+	Output Output `json:"output,omitzero"`
+	// HumanTyping types at an uneven, human pace for apps that block
+	// instant synthetic input.
+	HumanTyping bool `json:"human_typing,omitempty"`
+	// BidiMarks wraps right-to-left transcripts in direction marks.
+	BidiMarks bool `json:"bidi_marks,omitempty"`
+
+	NotesDir string `json:"notes_dir,omitempty"`
+	// ArchiveDir keeps the audio of every recording, as WAV or in
+	// ArchiveFormat ("flac", or "opus", which needs ffmpeg).
+	ArchiveDir    string                  `json:"archive_dir,omitempty"`
+	ArchiveFormat dictation.ArchiveFormat `json:"archive_format,omitempty"`
+	// SpoolDir keeps recordings made while offline until they can be
+	// transcribed (default ~/.chrisper/spool). "none" discards them.
+	SpoolDir string `json:"spool_dir,omitempty"`
+	// History keeps every transcribed recording in HistoryDir (default
+	// ~/.chrisper/history) so it can be reprocessed with new settings.
+	History    bool   `json:"history,omitempty"`
+	HistoryDir string `json:"history_dir,omitempty"`
+	// HistoryEncryption encrypts the history at rest: "keychain" keeps a
+	// random key in the OS keychain, "passphrase" derives one from
+	// CHRISPER_HISTORY_PASSPHRASE.
+	HistoryEncryption string `json:"history_encryption,omitempty"`
+	// SpokenTags tags history entries with a closing "tag ..." sentence.
+	SpokenTags bool `json:"spoken_tags,omitempty"`
+	// HistorySync syncs the encrypted history with an S3 bucket or WebDAV
+	// folder shared by your machines. CHRISPER_SYNC_PASSWORD overrides its
+	// password.
+	HistorySync dictation.SyncConfig `json:"history_sync,omitzero"`
+
+	Contacts string `json:"contacts,omitempty"`
+	// Glossary is a JSON or YAML file of technical terms and names to spell
+	// correctly. Defaults to ~/.chrisper/glossary.json or glossary.yaml when
+	// present.
+	Glossary string `json:"glossary,omitempty"`
+	// Presets are domain preset packs to apply, by name: built-in ones
+	// such as "medical", or JSON files in ~/.chrisper/presets.
+	Presets []string `json:"presets,omitempty"`
+
+	Reminders       bool   `json:"reminders,omitempty"`
+	ReminderWebhook string `json:"reminder_webhook,omitempty"`
+	// Locked starts the service in locked mode, where nothing is typed;
+	// see dictation.Service.Lock. Setting PIN also starts it locked and
+	// requires the PIN to unlock.
+	Locked bool   `json:"locked,omitempty"`
+	PIN    string `json:"pin,omitempty"`
+	// Power scales features back on battery or in low power mode.
+	Power dictation.PowerPolicy `json:"power,omitzero"`
+	// RetryAttempts is how many times a transcription is retried after a
+	// rate limit, server or network error (default 2). Negative disables
+	// retries. RetryBackoffSeconds is the wait before the first retry
+	// (default 1), doubled for each one after.
+	RetryAttempts       int     `json:"retry_attempts,omitempty"`
+	RetryBackoffSeconds float64 `json:"retry_backoff_seconds,omitempty"`
+	// BreakAfter pauses requests after this many consecutive failures
+	// (default 3) and probes the backend every ProbeSeconds (default 30)
+	// until it recovers. Negative disables the circuit breaker.
+	BreakAfter   int `json:"break_after,omitempty"`
+	ProbeSeconds int `json:"probe_seconds,omitempty"`
+	// ChunkSeconds splits recordings longer than one and a half times this
+	// (default 60) into chunks transcribed in parallel by up to
+	// ChunkWorkers (default 4) requests. Negative disables chunking.
+	ChunkSeconds int `json:"chunk_seconds,omitempty"`
+	ChunkWorkers int `json:"chunk_workers,omitempty"`
+	// InputDevice is the microphone to record from, by index or (part of)
+	// its name as shown by `chrisper devices`. Empty uses the default.
+	InputDevice string `json:"input_device,omitempty"`
+	// InputChannel records one channel of a multi-channel audio
+	// interface, counting from 1, instead of mixing them down.
+	InputChannel int `json:"input_channel,omitempty"`
+	// LoopbackDevice records system audio for meetings, e.g. "blackhole".
+	// Empty picks the first input that looks like a loopback device.
+	LoopbackDevice string `json:"loopback_device,omitempty"`
+	// NoiseSuppression filters rumble and steady background noise out of
+	// recordings before they are transcribed.
+	NoiseSuppression bool `json:"noise_suppression,omitempty"`
+	// GainMin and GainMax bound the automatic microphone gain (default 1
+	// and 32). Set both the same for a fixed gain.
+	GainMin float64 `json:"gain_min,omitempty"`
+	GainMax float64 `json:"gain_max,omitempty"`
+	// AutoStopSeconds stops recording after this many seconds of silence
+	// once speech has been heard. Zero waits for the hotkey.
+	AutoStopSeconds float64 `json:"auto_stop_seconds,omitempty"`
+	// MaxRecordingMinutes stops a recording that has gone on this long
+	// (default 60). Negative is unlimited.
+	MaxRecordingMinutes int `json:"max_recording_minutes,omitempty"`
+	// PreRecordSeconds keeps the last this many seconds heard while not
+	// recording, for a hotkey with "recent" set to transcribe. The
+	// microphone stays open while idle.
+	PreRecordSeconds int `json:"pre_record_seconds,omitempty"`
+	// PaceControl lets a spoken "hold" and "go" pause and resume typing of
+	// long transcripts.
+	PaceControl bool `json:"pace_control,omitempty"`
+	// SegmentSilenceSeconds is the pause that ends an utterance in
+	// continuous dictation (default 0.8).
+	SegmentSilenceSeconds float64 `json:"segment_silence_seconds,omitempty"`
+	// AudioIdleSeconds releases the audio subsystem after this many
+	// seconds without a recording (default 60). Negative keeps it open.
+	AudioIdleSeconds int `json:"audio_idle_seconds,omitempty"`
+	// ConfirmAboveSeconds asks before transcribing recordings longer than
+	// this many seconds.
+	ConfirmAboveSeconds int `json:"confirm_above_seconds,omitempty"`
+	// Live streams audio to the Gemini Live API while recording and types
+	// text as it arrives.
+	Live bool `json:"live,omitempty"`
+	// LiveFile appends every transcript to ~/.chrisper/live.txt.
+	LiveFile bool `json:"live_file,omitempty"`
+	// CaptionLanguage translates live captions into this language, a
+	// BCP-47 code. Empty captions in the spoken language. Gemini only.
+	CaptionLanguage string `json:"caption_language,omitempty"`
+
+	// WhisperModel is a model name pulled with `chrisper models pull`, or a
+	// whisper.cpp ggml model file.
+	WhisperModel string                   `json:"whisper_model,omitempty"`
+	Whisper      dictation.WhisperOptions `json:"whisper,omitzero"`
+	VoskModelDir string                   `json:"vosk_model_dir,omitempty"`
+	HTTP         dictation.HTTPConfig     `json:"http,omitzero"`
+
+	// Network sets a proxy, extra CA bundle and client certificate for the
+	// Gemini and http backends.
+	Network dictation.Network `json:"network,omitzero"`
+
+	Hooks hooks.Config `json:"hooks,omitzero"`
+
+	// Batch configures file transcription with `chrisper transcribe`.
+	Batch Batch `json:"batch,omitzero"`
+
+	// Server configures the OpenAI-compatible endpoint of `chrisper
+	// serve`. CHRISPER_SERVER_TOKEN overrides its token.
+	Server Server `json:"server,omitzero"`
+
+	// Log sets where the app logs to and how the log is rotated.
+	Log Log `json:"log,omitzero"`
+
+	// Accessibility operates Chrisper by voice: a wake word and spoken
+	// commands instead of the keyboard, and spoken feedback.
+	Accessibility voice.Config `json:"accessibility,omitzero"`
+
+	usage *dictation.UsageTracker
+	batch bool // Apply Batch.Limits; see NewBatchService
+}
+
+// Server configures `chrisper serve`.
+type Server struct {
+	// Addr is the address to listen on (default 127.0.0.1:8178).
+	Addr string `json:"addr,omitempty"`
+	// Token, if set, is the API key clients must send.
+	Token string `json:"token,omitempty"`
+}
+
+// Batch configures file transcription.
+type Batch struct {
+	// Workers is how many files are transcribed at once (default 2).
+	Workers int `json:"workers,omitempty"`
+	// Limits caps the requests in flight per backend, counting the chunks
+	// of long files, e.g. {"gemini": 4, "http": 2}, so large batches do
+	// not trip rate limits. Backends without a limit are not capped.
+	Limits map[string]int `json:"limits,omitempty"`
+}
+
+// Log configures the app's log file.
+type Log struct {
+	// File is the log (default LogFilePath).
+	File string `json:"file,omitempty"`
+	// MaxSizeMB rotates the log once it reaches this size (default 10).
+	MaxSizeMB int `json:"max_size_mb,omitempty"`
+	// MaxAgeDays deletes rotated logs older than this (default 14).
+	MaxAgeDays int `json:"max_age_days,omitempty"`
+	// Backups is how many rotated logs are kept (default 3).
+	Backups int `json:"backups,omitempty"`
+}
+
+// Output is where dictated transcripts go.
+type Output struct {
+	// Type is keyboard (the default), clipboard, stdout or file.
+	Type string `json:"type,omitempty"`
+	// File is appended to with Type file, one transcript per line.
+	File string `json:"file,omitempty"`
+}
+
+// Sink returns the OutputSink for o, or nil for the keyboard, which the
+// service types or pastes into itself.
+func (o Output) Sink() (dictation.OutputSink, error) {
+	switch o.Type {
+	case "", "keyboard":
+		return nil, nil
+	case "clipboard":
+		return dictation.ClipboardSink{}, nil
+	case "stdout":
+		return dictation.WriterSink{W: os.Stdout}, nil
+	case "file":
+		if o.File == "" {
+			return nil, fmt.Errorf("output file is required")
+		}
+		return dictation.FileSink{Path: o.File}, nil
+	}
+	return nil, fmt.Errorf("unknown output %q (use keyboard, clipboard, stdout or file)", o.Type)
+}
+
+// Path returns the log file.
+func (l Log) Path() string {
+	if l.File != "" {
+		return l.File
+	}
+	return LogFilePath()
+}
+
+// Options returns how the log is rotated.
+func (l Log) Options() logfile.Options {
+	return logfile.Options{
+		MaxSize: int64(l.MaxSizeMB) << 20,
+		MaxAge:  time.Duration(l.MaxAgeDays) * 24 * time.Hour,
+		Backups: l.Backups,
+	}
+}
+
+// Hotkey binds a key combination to a recording mode and profile.
+type Hotkey struct {
+	// Keys are gohook key names, e.g. ["command", "shift", "g"].
+	Keys []string `json:"keys"`
+	// Note records a voice note instead of dictating.
+	Note bool `json:"note,omitempty"`
+	// Profile names an entry in Profiles.
+	Profile string `json:"profile,omitempty"`
+	// Continuous keeps dictating utterance by utterance until the hotkey
+	// is pressed again.
+	Continuous bool `json:"continuous,omitempty"`
+	// Hold records only while the keys are held down (push-to-talk).
+	Hold bool `json:"hold,omitempty"`
+	// Recent transcribes what was said before the keys were pressed,
+	// kept with PreRecordSeconds, instead of recording.
+	Recent bool `json:"recent,omitempty"`
+	// Correct records a short phrase that replaces the words of the last
+	// dictation that sound most like it ("correct that").
+	Correct bool `json:"correct,omitempty"`
+}
+
+// Mode returns the recording mode for h.
+func (h Hotkey) Mode() dictation.Mode {
+	switch {
+	case h.Note:
+		return dictation.ModeNote
+	case h.Correct:
+		return dictation.ModeCorrect
+	}
+	return dictation.ModeDictate
+}
+
+// Dir returns the Chrisper data directory, ~/.chrisper.
+func Dir() string {
+	return paths.Home()
+}
+
+// Path returns the config file path: CHRISPER_CONFIG if set, otherwise
+// ~/.chrisper/config.json.
+func Path() string {
+	if p := os.Getenv("CHRISPER_CONFIG"); p != "" {
+		return p
+	}
+	return filepath.Join(Dir(), "config.json")
+}
+
+// ModelsDir returns where offline models are kept; see paths.Models.
+func ModelsDir() string {
+	return paths.Models()
+}
+
+// LiveFilePath returns the well-known live transcript file,
+// ~/.chrisper/live.txt.
+func LiveFilePath() string {
+	return filepath.Join(Dir(), "live.txt")
+}
+
+// LogFilePath returns where the app logs to by default, chrisper.log in
+// paths.Logs.
+func LogFilePath() string {
+	return filepath.Join(paths.Logs(), "chrisper.log")
+}
+
+// PermissionsFilePath returns the file that remembers which build of the
+// app last ran and whether it had its permissions.
+func PermissionsFilePath() string {
+	return filepath.Join(Dir(), "permissions.json")
+}
+
+// PresetsDir returns the directory of domain preset packs,
+// ~/.chrisper/presets.
+func PresetsDir() string {
+	return filepath.Join(Dir(), "presets")
+}
+
+// UsageFilePath returns the file with daily token usage totals.
+func UsageFilePath() string {
+	return filepath.Join(Dir(), "usage.json")
+}
+
+// BatchProgressPath returns the file that records which files `chrisper
+// transcribe` has finished.
+func BatchProgressPath() string {
+	return filepath.Join(Dir(), "batch.json")
+}
+
+// HistoryPath returns the directory recordings are kept in when History is
+// on.
+func (c *Config) HistoryPath() string {
+	if c.HistoryDir != "" {
+		return c.HistoryDir
+	}
+	return filepath.Join(Dir(), "history")
+}
+
+// saltSyncTimeout bounds fetching the passphrase salt of a synced history.
+const saltSyncTimeout = 15 * time.Second
+
+// HistoryStore returns the store the history is synced with, or nil if
+// sync is not configured.
+func (c *Config) HistoryStore() (dictation.HistoryStore, error) {
+	if c.HistorySync.Type == "" {
+		return nil, nil
+	}
+	if c.HistoryEncryption == "" {
+		return nil, errors.New("history_sync needs history_encryption, so only encrypted history leaves this machine")
+	}
+	return dictation.NewHistoryStore(c.HistorySync, c.Network)
+}
+
+// HistoryKey returns the key the history is encrypted with, or nil if
+// HistoryEncryption is off.
+func (c *Config) HistoryKey() (*[32]byte, error) {
+	switch c.HistoryEncryption {
+	case "":
+		return nil, nil
+	case "keychain":
+		return keychainKey()
+	case "passphrase":
+		pass := os.Getenv("CHRISPER_HISTORY_PASSPHRASE")
+		if pass == "" {
+			return nil, errors.New("history_encryption is passphrase but CHRISPER_HISTORY_PASSPHRASE is not set")
+		}
+		if store, err := c.HistoryStore(); err != nil {
+			return nil, err
+		} else if store != nil {
+			ctx, cancel := context.WithTimeout(context.Background(), saltSyncTimeout)
+			defer cancel()
+			// Offline, a salt synced before is as good.
+			if err := dictation.SyncSalt(ctx, c.HistoryPath(), store); err != nil {
+				if _, statErr := os.Stat(filepath.Join(c.HistoryPath(), "salt")); statErr != nil {
+					return nil, fmt.Errorf("failed to sync the history salt: %w", err)
+				}
+				log.Printf("Failed to sync the history salt: %v", err)
+			}
+		}
+		return dictation.PassphraseKey(c.HistoryPath(), pass)
+	default:
+		return nil, fmt.Errorf("unknown history_encryption %q (want keychain or passphrase)", c.HistoryEncryption)
+	}
+}
+
+// StatusFilePath returns the file where the running app publishes its
+// state for `chrisper status`.
+func StatusFilePath() string {
+	return filepath.Join(Dir(), "status.json")
+}
+
+// Load reads the config file, if it exists, and applies environment
+// overrides on top.
+func Load() (*Config, error) {
+	c := &Config{}
+	data, err := os.ReadFile(Path())
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, c); err != nil {
+			return nil, fmt.Errorf("invalid config %s: %w", Path(), err)
+		}
+	}
+	c.applyEnv()
+
+	c.NotesDir = expandHome(c.NotesDir)
+	c.ArchiveDir = expandHome(c.ArchiveDir)
+	c.SpoolDir = expandHome(c.SpoolDir)
+	c.HistoryDir = expandHome(c.HistoryDir)
+	c.Contacts = expandHome(c.Contacts)
+	c.Glossary = expandHome(c.Glossary)
+	c.PromptFile = expandHome(c.PromptFile)
+	c.Log.File = expandHome(c.Log.File)
+	c.Output.File = expandHome(c.Output.File)
+	c.WhisperModel = expandHome(c.WhisperModel)
+	c.VoskModelDir = expandHome(c.VoskModelDir)
+	c.Network.CACert = expandHome(c.Network.CACert)
+	c.Network.ClientCert = expandHome(c.Network.ClientCert)
+	c.Network.ClientKey = expandHome(c.Network.ClientKey)
+	for i := range c.Schedule {
+		c.Schedule[i].Calendar = expandHome(c.Schedule[i].Calendar)
+	}
+	return c, nil
+}
+
+// expandHome replaces a leading ~/ with the user's home directory.
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		home, _ := os.UserHomeDir()
+		return filepath.Join(home, rest)
+	}
+	return path
+}
+
+func (c *Config) applyEnv() {
+	setString := func(dst *string, name string) {
+		if v := os.Getenv(name); v != "" {
+			*dst = v
+		}
+	}
+	setString(&c.APIKey, "GEMINI_API_KEY")
+	setString(&c.Backend, "CHRISPER_BACKEND")
+	setString(&c.VerifyBackend, "CHRISPER_VERIFY_BACKEND")
+	setString(&c.RetranscribeBackend, "CHRISPER_RETRANSCRIBE_BACKEND")
+	setString(&c.HotkeyBackend, "CHRISPER_HOTKEY_BACKEND")
+	setString((*string)(&c.Injection), "CHRISPER_INJECTION")
+	setString(&c.Output.Type, "CHRISPER_OUTPUT")
+	setString(&c.Output.File, "CHRISPER_OUTPUT_FILE")
+	setString(&c.InputDevice, "CHRISPER_INPUT_DEVICE")
+	setString(&c.HistorySync.Password, "CHRISPER_SYNC_PASSWORD")
+	setString(&c.Server.Token, "CHRISPER_SERVER_TOKEN")
+	setString(&c.Gemini.Model, "CHRISPER_MODEL")
+	setString(&c.Prompt, "CHRISPER_PROMPT")
+	setString(&c.PromptFile, "CHRISPER_PROMPT_FILE")
+	setString(&c.Language, "CHRISPER_LANGUAGE")
+	setString(&c.NotesDir, "CHRISPER_NOTES_DIR")
+	setString(&c.ArchiveDir, "CHRISPER_ARCHIVE_DIR")
+	setString(&c.Contacts, "CHRISPER_CONTACTS")
+	setString(&c.Glossary, "CHRISPER_GLOSSARY")
+	setString(&c.ReminderWebhook, "CHRISPER_REMINDER_WEBHOOK")
+	setString(&c.WhisperModel, "WHISPER_MODEL")
+	setString(&c.VoskModelDir, "VOSK_MODEL_DIR")
+	setString(&c.HTTP.URL, "CHRISPER_HTTP_URL")
+	setString(&c.HTTP.APIKey, "CHRISPER_HTTP_API_KEY")
+	if v := os.Getenv("GEMINI_API_KEYS"); v != "" {
+		c.APIKeys = strings.Split(v, ",")
+	}
+	if v := os.Getenv("CHRISPER_BACKENDS"); v != "" {
+		c.Backends = strings.Split(v, ",")
+	}
+	if v := os.Getenv("CHRISPER_PRESETS"); v != "" {
+		c.Presets = strings.Split(v, ",")
+	}
+	if v := os.Getenv("CHRISPER_REMINDERS"); v != "" {
+		c.Reminders = v == "1"
+	}
+	if v := os.Getenv("CHRISPER_LOCKED"); v != "" {
+		c.Locked = v == "1"
+	}
+	if v := os.Getenv("CHRISPER_ENSEMBLE"); v != "" {
+		c.Ensemble = v == "1"
+	}
+	if v := os.Getenv("CHRISPER_LIVE"); v != "" {
+		c.Live = v == "1"
+	}
+	if v := os.Getenv("CHRISPER_LIVE_FILE"); v != "" {
+		c.LiveFile = v == "1"
+	}
+}
+
+// Transcriber creates the configured speech backend, fallback chain or
+// ensemble.
+func (c *Config) Transcriber() (dictation.Transcriber, error) {
+	if len(c.Backends) == 0 {
+		if c.Ensemble {
+			return nil, fmt.Errorf("ensemble needs at least two backends")
+		}
+		return c.limited(c.Backend)
+	}
+
+	var backends []dictation.Transcriber
+	for _, name := range c.Backends {
+		t, err := c.limited(name)
+		if err != nil {
+			return nil, fmt.Errorf("backend %s: %w", name, err)
+		}
+		backends = append(backends, t)
+	}
+	if c.Ensemble {
+		if len(backends) < 2 {
+			return nil, fmt.Errorf("ensemble needs at least two backends")
+		}
+		e := dictation.NewEnsemble(backends...)
+		e.Timeout = time.Duration(c.BackendTimeout) * time.Second
+		return e, nil
+	}
+	chain := dictation.NewFallback(backends...)
+	chain.Timeout = time.Duration(c.BackendTimeout) * time.Second
+	return chain, nil
+}
+
+// limited creates the named backend, capped by Batch.Limits when creating
+// a batch service.
+func (c *Config) limited(name string) (dictation.Transcriber, error) {
+	t, err := c.backend(name)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" && len(c.GeminiKeys()) > 0 {
+		name = "gemini"
+	}
+	if n := c.Batch.Limits[name]; c.batch && n > 0 {
+		t = dictation.Limit(t, n)
+	}
+	return t, nil
+}
+
+func (c *Config) backend(name string) (dictation.Transcriber, error) {
+	switch name {
+	case "apple":
+		return dictation.NewAppleSpeech()
+	case "whisper":
+		path := c.WhisperModel
+		if path == "" {
+			path = "base.en"
+		}
+		if models.IsName(path) {
+			name := path
+			path = models.Path(ModelsDir(), name)
+			if _, err := os.Stat(path); err != nil {
+				return nil, fmt.Errorf("whisper model %s not found; run `chrisper models pull %s`", name, name)
+			}
+		}
+		return dictation.NewWhisper(path, c.Whisper)
+	case "vosk":
+		dir := c.VoskModelDir
+		if dir == "" {
+			dir = filepath.Join(ModelsDir(), "vosk")
+		}
+		return dictation.NewVosk(dir)
+	case "http":
+		return dictation.NewHTTPEndpoint(c.HTTP, c.Network)
+	case "", "gemini":
+		keys := c.GeminiKeys()
+		if len(keys) == 0 {
+			if name == "" && runtime.GOOS == "darwin" {
+				log.Printf("No API key set, using on-device Apple Speech\n")
+				return dictation.NewAppleSpeech()
+			}
+			return nil, fmt.Errorf("please set GEMINI_API_KEY environment variable")
+		}
+		g, err := dictation.NewGemini(c.Network, keys...)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.Gemini.Validate(); err != nil {
+			return nil, err
+		}
+		g.GeminiOptions = c.Gemini
+		g.Usage = c.Usage()
+		if g.Prompt, err = c.prompt(); err != nil {
+			return nil, err
+		}
+		return g, nil
+	default:
+		return nil, fmt.Errorf("unknown backend %q", name)
+	}
+}
+
+// GeminiKeys returns APIKey and APIKeys without blanks or duplicates.
+func (c *Config) GeminiKeys() []string {
+	var keys []string
+	for _, k := range append([]string{c.APIKey}, c.APIKeys...) {
+		k = strings.TrimSpace(k)
+		if k != "" && !slices.Contains(keys, k) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// Usage returns the token usage tracker shared by all Gemini backends.
+func (c *Config) Usage() *dictation.UsageTracker {
+	if c.usage == nil {
+		c.usage = dictation.NewUsageTracker(UsageFilePath())
+	}
+	return c.usage
+}
+
+// UsesGemini reports whether any configured backend talks to Gemini.
+func (c *Config) UsesGemini() bool {
+	if c.VerifyBackend == "gemini" || c.RetranscribeBackend == "gemini" {
+		return true
+	}
+	if len(c.Backends) > 0 {
+		return slices.Contains(c.Backends, "gemini")
+	}
+	switch c.Backend {
+	case "gemini":
+		return true
+	case "":
+		// Without a key the default backend is Apple Speech on macOS.
+		return len(c.GeminiKeys()) > 0 || runtime.GOOS != "darwin"
+	}
+	return false
+}
+
+// LocalBackends reports whether every configured speech backend runs on
+// this machine, so no audio is sent away to be transcribed.
+func (c *Config) LocalBackends() bool {
+	names := c.Backends
+	if len(names) == 0 {
+		names = []string{c.Backend}
+	}
+	for _, name := range names {
+		switch name {
+		case "whisper", "vosk", "apple":
+		case "":
+			// Without a key the default backend is Apple Speech on macOS.
+			if len(c.GeminiKeys()) > 0 || runtime.GOOS != "darwin" {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// CheckAccessibility reports why accessibility mode should not start:
+// listening for the wake word with a cloud backend would send everything
+// said near the microphone away, request by request, unless the config
+// allows it.
+func (c *Config) CheckAccessibility() error {
+	if !c.Accessibility.Enabled || c.Accessibility.AllowCloud || c.LocalBackends() {
+		return nil
+	}
+	return errors.New("accessibility mode transcribes everything it hears, so it needs a local backend (whisper, vosk or apple); set accessibility.allow_cloud to use this one anyway")
+}
+
+// Profile returns the named profile.
+func (c *Config) Profile(name string) (dictation.Profile, error) {
+	p, ok := c.Profiles[name]
+	if !ok {
+		return dictation.Profile{}, fmt.Errorf("unknown profile %q", name)
+	}
+	p.Name = name
+	return p, nil
+}
+
+// prompt returns the custom transcription prompt, or "" for the default.
+func (c *Config) prompt() (string, error) {
+	if c.PromptFile == "" {
+		return strings.TrimSpace(c.Prompt), nil
+	}
+	data, err := os.ReadFile(c.PromptFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read prompt file: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// glossaryPath returns the configured glossary, or the default one if it
+// exists.
+func (c *Config) glossaryPath() string {
+	if c.Glossary != "" {
+		return c.Glossary
+	}
+	for _, name := range []string{"glossary.json", "glossary.yaml", "glossary.yml"} {
+		path := filepath.Join(Dir(), name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// NewBatchService creates a service for transcribing files, with the Batch
+// settings applied on top of NewService's.
+func (c *Config) NewBatchService() (*dictation.Service, error) {
+	c.batch = true
+	defer func() { c.batch = false }()
+	s, err := c.NewService()
+	if err != nil {
+		return nil, err
+	}
+	s.BatchWorkers = c.Batch.Workers
+	return s, nil
+}
+
+// NewService creates a dictation service with every setting applied.
+func (c *Config) NewService() (_ *dictation.Service, err error) {
+	t, err := c.Transcriber()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize speech backend: %w", err)
+	}
+	s, err := dictation.NewWithTranscriber(t)
+	if err != nil {
+		return nil, err
+	}
+	// The service holds audio from here on, e.g. for the tray's retries.
+	defer func() {
+		if err != nil {
+			s.Close()
+		}
+	}()
+	if c.VerifyBackend != "" {
+		if s.Verifier, err = c.backend(c.VerifyBackend); err != nil {
+			return nil, fmt.Errorf("failed to initialize verify backend: %w", err)
+		}
+		s.AutoCorrect = c.AutoCorrect
+		s.CorrectThreshold = c.CorrectThreshold
+	}
+	if c.RetranscribeBackend != "" {
+		if s.Retranscriber, err = c.backend(c.RetranscribeBackend); err != nil {
+			return nil, fmt.Errorf("failed to initialize retranscribe backend: %w", err)
+		}
+	}
+
+	if c.NotesDir != "" {
+		s.NotesDir = c.NotesDir
+	}
+	if err := c.ArchiveFormat.Validate(); err != nil {
+		return nil, err
+	}
+	s.ArchiveDir = c.ArchiveDir
+	s.ArchiveFormat = c.ArchiveFormat
+	if c.Contacts != "" {
+		names, err := dictation.LoadContacts(c.Contacts)
+		if err != nil {
+			log.Printf("Failed to load contacts: %v", err)
+		} else {
+			log.Printf("Loaded %d contact names", len(names))
+			s.Vocabulary = append(s.Vocabulary, names...)
+		}
+	}
+	if path := c.glossaryPath(); path != "" {
+		terms, err := dictation.LoadGlossary(path)
+		if err != nil {
+			log.Printf("Failed to load glossary: %v", err)
+		} else {
+			log.Printf("Loaded %d glossary terms", len(terms))
+			s.Vocabulary = append(s.Vocabulary, terms...)
+		}
+	}
+	for _, name := range c.Presets {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		pack, err := presets.Load(PresetsDir(), name)
+		if err == nil {
+			err = pack.Apply(s)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("preset %s: %w", name, err)
+		}
+	}
+	s.Language = c.Language
+	s.Speaker = c.Speaker
+	s.CodeSwitch = c.CodeSwitch
+	if err := c.Script.Validate(); err != nil {
+		return nil, err
+	}
+	for name, p := range c.Profiles {
+		if err := p.Script.Validate(); err != nil {
+			return nil, fmt.Errorf("profile %s: %w", name, err)
+		}
+		if err := p.Injection.Validate(); err != nil {
+			return nil, fmt.Errorf("profile %s: %w", name, err)
+		}
+	}
+	if len(c.Schedule) > 0 {
+		sched, err := schedule.New(c.Schedule)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range c.Schedule {
+			if _, err := c.Profile(r.Profile); err != nil {
+				return nil, fmt.Errorf("schedule: %w", err)
+			}
+		}
+		s.DefaultProfile = func() dictation.Profile {
+			p, _ := c.Profile(sched.Profile(time.Now()))
+			return p
+		}
+	}
+	s.Script = c.Script
+	if err := c.Injection.Validate(); err != nil {
+		return nil, err
+	}
+	s.Injection = c.Injection
+	if s.Output, err = c.Output.Sink(); err != nil {
+		return nil, err
+	}
+	s.HumanTyping = c.HumanTyping
+	s.BidiMarks = c.BidiMarks
+	s.Structured = c.Structured
+	if c.MinConfidence > 0 {
+		s.Accept = func(t dictation.Transcript) bool {
+			return t.Confidence >= c.MinConfidence
+		}
+	}
+	s.Reminders = c.Reminders
+	s.SpokenTags = c.SpokenTags
+	s.ReminderWebhook = c.ReminderWebhook
+	s.ConfirmAbove = time.Duration(c.ConfirmAboveSeconds) * time.Second
+	switch {
+	case c.RetryAttempts == 0:
+		s.Retries = 2
+	case c.RetryAttempts > 0:
+		s.Retries = c.RetryAttempts
+	}
+	s.RetryBackoff = time.Duration(c.RetryBackoffSeconds * float64(time.Second))
+	switch {
+	case c.BreakAfter == 0:
+		s.BreakAfter = 3
+	case c.BreakAfter > 0:
+		s.BreakAfter = c.BreakAfter
+	}
+	s.ProbeInterval = time.Duration(c.ProbeSeconds) * time.Second
+	s.InputDevice = c.InputDevice
+	s.InputChannel = c.InputChannel
+	s.LoopbackDevice = c.LoopbackDevice
+	s.MinGain, s.MaxGain = c.GainMin, c.GainMax
+	s.Denoise = c.NoiseSuppression
+	s.AutoStopAfter = time.Duration(c.AutoStopSeconds * float64(time.Second))
+	s.PaceControl = c.PaceControl
+	s.MaxRecording = time.Duration(c.MaxRecordingMinutes) * time.Minute
+	s.PreRecord = time.Duration(c.PreRecordSeconds) * time.Second
+	s.SegmentSilence = time.Duration(c.SegmentSilenceSeconds * float64(time.Second))
+	switch {
+	case c.ChunkSeconds == 0:
+		s.ChunkLength = time.Minute
+	case c.ChunkSeconds > 0:
+		s.ChunkLength = time.Duration(c.ChunkSeconds) * time.Second
+	}
+	s.ChunkWorkers = c.ChunkWorkers
+	switch {
+	case c.AudioIdleSeconds == 0:
+		s.SuspendAfter = time.Minute
+	case c.AudioIdleSeconds > 0:
+		s.SuspendAfter = time.Duration(c.AudioIdleSeconds) * time.Second
+	}
+	s.Live = c.Live
+	s.Power = c.Power
+	s.PIN = c.PIN
+	if c.Locked || c.PIN != "" {
+		s.Lock()
+	}
+	switch c.SpoolDir {
+	case "":
+		s.SpoolDir = filepath.Join(Dir(), "spool")
+	case "none":
+	default:
+		s.SpoolDir = c.SpoolDir
+	}
+	if c.History {
+		s.HistoryDir = c.HistoryPath()
+		if s.HistoryKey, err = c.HistoryKey(); err != nil {
+			return nil, err
+		}
+		if s.HistorySync, err = c.HistoryStore(); err != nil {
+			return nil, err
+		}
+	}
+	s.StatusFile = StatusFilePath()
+	if c.LiveFile {
+		s.LiveFile = LiveFilePath()
+	}
+	return s, nil
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+const (
+	keychainService = "chrisper"
+	keychainAccount = "history-key"
+)
+
+// keychainKey returns the history key kept in the OS keychain (the macOS
+// login keychain or the Secret Service on Linux), creating a random one on
+// first use.
+func keychainKey() (*[32]byte, error) {
+	secret, err := keychainLookup()
+	if err != nil {
+		return nil, err
+	}
+	if secret == "" {
+		var key [32]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return nil, err
+		}
+		if err := keychainStore(hex.EncodeToString(key[:])); err != nil {
+			return nil, fmt.Errorf("failed to store the history key in the keychain: %w", err)
+		}
+		return &key, nil
+	}
+
+	b, err := hex.DecodeString(secret)
+	if err != nil || len(b) != 32 {
+		return nil, errors.New("history key in the keychain is invalid")
+	}
+	var key [32]byte
+	copy(key[:], b)
+	return &key, nil
+}
+
+// keychainLookup returns the stored key, or "" if there is none yet.
+func keychainLookup() (string, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", keychainService, "-a", keychainAccount, "-w")
+	case "linux":
+		cmd = exec.Command("secret-tool", "lookup", "service", keychainService, "account", keychainAccount)
+	default:
+		return "", fmt.Errorf("keychain history encryption is not supported on %s", runtime.GOOS)
+	}
+	out, err := cmd.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return "", nil // Not found
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read the keychain: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func keychainStore(secret string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "add-generic-password", "-s", keychainService, "-a", keychainAccount, "-w", secret)
+	default:
+		cmd = exec.Command("secret-tool", "store", "--label=Chrisper history key", "service", keychainService, "account", keychainAccount)
+		cmd.Stdin = strings.NewReader(secret)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
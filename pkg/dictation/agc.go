@@ -0,0 +1,67 @@
+package dictation
+
+import "math"
+
+const (
+	// defaultMinGain and defaultMaxGain bound the automatic gain when
+	// MinGain and MaxGain are unset. 32 was the fixed gain before.
+	defaultMinGain = 1.0
+	defaultMaxGain = 32.0
+	// agcTarget is the RMS level speech is brought to, leaving headroom
+	// for peaks.
+	agcTarget = 3000.0
+	// agcRelease is how much the tracked level decays per buffer once the
+	// input gets quieter, so the gain rises again over a few seconds.
+	agcRelease = 0.995
+)
+
+// agc is an automatic gain control: it follows the input level and
+// amplifies it towards agcTarget within [min, max], reacting at once to
+// loud input so it does not clip.
+type agc struct {
+	min, max float64
+	level    float64 // Envelope of the input RMS
+	last     float64 // Gain applied at the end of the previous buffer
+}
+
+// newAGC returns a gain control for the service's gain range.
+func (s *Service) newAGC() *agc {
+	a := &agc{min: s.MinGain, max: s.MaxGain}
+	if a.min <= 0 {
+		a.min = defaultMinGain
+	}
+	if a.max <= 0 {
+		a.max = defaultMaxGain
+	}
+	a.max = max(a.max, a.min)
+	a.last = max(a.min, min(a.max, defaultMaxGain))
+	a.level = agcTarget / a.last
+	return a
+}
+
+// process appends in, amplified, to out. The gain moves smoothly across
+// the buffer from the previous one's.
+func (a *agc) process(in []int16, out []int16) []int16 {
+	if len(in) == 0 {
+		return out
+	}
+	var sum, peak float64
+	for _, v := range in {
+		f := float64(v)
+		sum += f * f
+		peak = max(peak, math.Abs(f))
+	}
+	rms := math.Sqrt(sum / float64(len(in)))
+	a.level = max(a.level*agcRelease, rms)
+
+	gain := max(a.min, min(a.max, agcTarget/a.level))
+	if peak > 0 {
+		gain = min(gain, 32767/peak)
+	}
+	for i, v := range in {
+		g := a.last + (gain-a.last)*float64(i+1)/float64(len(in))
+		out = append(out, int16(max(-32768, min(32767, float64(v)*g))))
+	}
+	a.last = gain
+	return out
+}
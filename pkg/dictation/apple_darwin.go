@@ -0,0 +1,198 @@
+//go:build darwin
+
+package dictation
+
+/*
+#cgo CFLAGS: -x objective-c -fobjc-arc
+#cgo LDFLAGS: -framework Foundation -framework Speech
+
+#import <Foundation/Foundation.h>
+#import <Speech/Speech.h>
+#include <stdlib.h>
+
+// chrisperSpeechAuthorize blocks until the user has answered the speech
+// recognition permission prompt and reports whether access was granted.
+static int chrisperSpeechAuthorize(void) {
+	__block SFSpeechRecognizerAuthorizationStatus status = [SFSpeechRecognizer authorizationStatus];
+	if (status == SFSpeechRecognizerAuthorizationStatusNotDetermined) {
+		dispatch_semaphore_t sem = dispatch_semaphore_create(0);
+		[SFSpeechRecognizer requestAuthorization:^(SFSpeechRecognizerAuthorizationStatus s) {
+			status = s;
+			dispatch_semaphore_signal(sem);
+		}];
+		dispatch_semaphore_wait(sem, DISPATCH_TIME_FOREVER);
+	}
+	return status == SFSpeechRecognizerAuthorizationStatusAuthorized;
+}
+
+// chrisperSpeechCancel sets the flag that makes chrisperSpeechTranscribe
+// give up.
+static void chrisperSpeechCancel(int *cancelled) {
+	__atomic_store_n(cancelled, 1, __ATOMIC_SEQ_CST);
+}
+
+// chrisperSpeechTranscribe recognizes the audio file at path entirely
+// on-device. hints is a newline-separated list of contextual strings. It
+// returns a malloc'd UTF-8 transcript, or NULL with *err set to a malloc'd
+// message. Once *cancelled is set by chrisperSpeechCancel, it cancels the
+// recognition and returns NULL with *err left NULL.
+static char *chrisperSpeechTranscribe(const char *path, const char *locale, const char *hints, int *cancelled, char **err) {
+	@autoreleasepool {
+		NSLocale *loc = [NSLocale localeWithLocaleIdentifier:[NSString stringWithUTF8String:locale]];
+		SFSpeechRecognizer *recognizer = [[SFSpeechRecognizer alloc] initWithLocale:loc];
+		if (recognizer == nil || !recognizer.isAvailable) {
+			*err = strdup("speech recognizer is not available for this locale");
+			return NULL;
+		}
+		if (!recognizer.supportsOnDeviceRecognition) {
+			*err = strdup("on-device recognition is not supported for this locale");
+			return NULL;
+		}
+		// Deliver results off the main queue, which is owned by the tray run loop.
+		recognizer.queue = [[NSOperationQueue alloc] init];
+
+		NSURL *url = [NSURL fileURLWithPath:[NSString stringWithUTF8String:path]];
+		SFSpeechURLRecognitionRequest *request = [[SFSpeechURLRecognitionRequest alloc] initWithURL:url];
+		request.requiresOnDeviceRecognition = YES;
+		request.shouldReportPartialResults = NO;
+		if (strlen(hints) > 0) {
+			request.contextualStrings = [[NSString stringWithUTF8String:hints] componentsSeparatedByString:@"\n"];
+		}
+
+		// The result handler runs on the recognizer's queue, and may still
+		// run after a cancelled wait has returned.
+		__block NSString *text = nil;
+		__block NSString *message = nil;
+		__block BOOL done = NO;
+		NSObject *lock = [[NSObject alloc] init];
+		dispatch_semaphore_t sem = dispatch_semaphore_create(0);
+		SFSpeechRecognitionTask *task = [recognizer recognitionTaskWithRequest:request resultHandler:^(SFSpeechRecognitionResult *result, NSError *error) {
+			@synchronized (lock) {
+				if (done) {
+					return;
+				}
+				if (result != nil) {
+					text = result.bestTranscription.formattedString;
+				}
+				if (error != nil || result.isFinal) {
+					if (error != nil && text == nil) {
+						message = error.localizedDescription;
+					}
+					done = YES;
+					dispatch_semaphore_signal(sem);
+				}
+			}
+		}];
+		while (dispatch_semaphore_wait(sem, dispatch_time(DISPATCH_TIME_NOW, 100 * NSEC_PER_MSEC)) != 0) {
+			if (__atomic_load_n(cancelled, __ATOMIC_SEQ_CST)) {
+				@synchronized (lock) {
+					done = YES;
+				}
+				[task cancel];
+				return NULL;
+			}
+		}
+
+		@synchronized (lock) {
+			if (message != nil) {
+				*err = strdup([message UTF8String]);
+				return NULL;
+			}
+			return strdup(text != nil ? [text UTF8String] : "");
+		}
+	}
+}
+*/
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"unsafe"
+
+	"chrisper/pkg/paths"
+)
+
+const maxContextualStrings = 100
+
+// AppleSpeech transcribes audio on-device with the macOS Speech framework.
+// It needs no API key or network connection.
+type AppleSpeech struct {
+	// Locale is the recognition locale, e.g. "en-US". A request language
+	// takes precedence; Apple Speech cannot detect the language itself.
+	Locale string
+}
+
+// NewAppleSpeech creates an on-device transcriber, prompting for speech
+// recognition permission if it has not been granted yet.
+func NewAppleSpeech() (*AppleSpeech, error) {
+	if C.chrisperSpeechAuthorize() == 0 {
+		return nil, fmt.Errorf("speech recognition permission denied")
+	}
+	return &AppleSpeech{Locale: "en-US"}, nil
+}
+
+// Transcribe implements Transcriber.
+func (a *AppleSpeech) Transcribe(ctx context.Context, r Request) (string, error) {
+	wav, err := encodeWAV(r.Samples, sampleRate)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode WAV: %w", err)
+	}
+
+	f, err := paths.CreateTemp("chrisper-*.wav")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(wav); err != nil {
+		f.Close()
+		return "", err
+	}
+	f.Close()
+
+	cPath := C.CString(f.Name())
+	defer C.free(unsafe.Pointer(cPath))
+	locale := a.Locale
+	if r.Language != "" {
+		locale = r.Language
+	}
+	cLocale := C.CString(locale)
+	defer C.free(unsafe.Pointer(cLocale))
+
+	// Apple recommends keeping contextual strings to around a hundred.
+	hints := r.Vocabulary
+	if len(hints) > maxContextualStrings {
+		hints = hints[:maxContextualStrings]
+	}
+	cHints := C.CString(strings.Join(hints, "\n"))
+	defer C.free(unsafe.Pointer(cHints))
+
+	// The recognition is cancelled when ctx is done, which includes its
+	// deadline. The flag is C memory, as C reads it while Go writes it.
+	cancelled := (*C.int)(C.calloc(1, C.sizeof_int))
+	cancel := make(chan struct{})
+	stop := context.AfterFunc(ctx, func() {
+		C.chrisperSpeechCancel(cancelled)
+		close(cancel)
+	})
+	defer func() {
+		if !stop() {
+			<-cancel
+		}
+		C.free(unsafe.Pointer(cancelled))
+	}()
+
+	var cErr *C.char
+	cText := C.chrisperSpeechTranscribe(cPath, cLocale, cHints, cancelled, &cErr)
+	if cText == nil {
+		if cErr == nil {
+			return "", ctx.Err()
+		}
+		defer C.free(unsafe.Pointer(cErr))
+		return "", fmt.Errorf("apple speech: %s", C.GoString(cErr))
+	}
+	defer C.free(unsafe.Pointer(cText))
+	return C.GoString(cText), nil
+}
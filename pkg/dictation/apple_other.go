@@ -0,0 +1,23 @@
+//go:build !darwin
+
+package dictation
+
+import (
+	"context"
+	"fmt"
+)
+
+// AppleSpeech is only available on macOS.
+type AppleSpeech struct {
+	Locale string
+}
+
+// NewAppleSpeech always fails on platforms other than macOS.
+func NewAppleSpeech() (*AppleSpeech, error) {
+	return nil, fmt.Errorf("apple speech backend is only available on macOS")
+}
+
+// Transcribe implements Transcriber.
+func (a *AppleSpeech) Transcribe(ctx context.Context, r Request) (string, error) {
+	return "", fmt.Errorf("apple speech backend is only available on macOS")
+}
@@ -0,0 +1,74 @@
+package dictation
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// ArchiveFormat is the audio format recordings are archived in.
+type ArchiveFormat string
+
+const (
+	// ArchiveWAV keeps the recording as it was captured. It is the default.
+	ArchiveWAV ArchiveFormat = "wav"
+	// ArchiveFLAC compresses losslessly to about half the size.
+	ArchiveFLAC ArchiveFormat = "flac"
+	// ArchiveOpus compresses to a small fraction at speech quality.
+	ArchiveOpus ArchiveFormat = "opus"
+)
+
+// codecArchiveOpus keeps more detail than uploads, for transcribing again
+// later.
+var codecArchiveOpus = codec{"opus", "audio/ogg", []string{"-c:a", "libopus", "-b:a", "24k", "-f", "ogg"}}
+
+// Validate reports an unknown archive format.
+func (f ArchiveFormat) Validate() error {
+	switch f {
+	case "", ArchiveWAV, ArchiveFLAC, ArchiveOpus:
+		return nil
+	}
+	return fmt.Errorf("unknown archive format %q (use wav, flac or opus)", f)
+}
+
+// archive saves a recording that started at to a new timestamped file in
+// ArchiveDir, in ArchiveFormat. Opus needs ffmpeg; without it the
+// recording is saved as FLAC.
+func (s *Service) archive(samples []int16, at time.Time) {
+	if err := os.MkdirAll(s.ArchiveDir, 0755); err != nil {
+		log.Printf("Failed to archive recording: %v", err)
+		return
+	}
+	audio, ext, err := encodeArchive(samples, s.ArchiveFormat)
+	if err != nil {
+		log.Printf("Failed to archive recording: %v", err)
+		return
+	}
+	path, err := writeNewFile(s.ArchiveDir, at.Format("2006-01-02_150405"), ext, audio)
+	if err != nil {
+		log.Printf("Failed to archive recording: %v", err)
+		return
+	}
+	log.Printf("Recording archived to %s", path)
+}
+
+// encodeArchive encodes samples in format f and returns the audio and its
+// file extension.
+func encodeArchive(samples []int16, f ArchiveFormat) ([]byte, string, error) {
+	c := codecFLAC
+	switch f {
+	case "", ArchiveWAV:
+		audio, err := encodeWAV(samples, sampleRate)
+		return audio, ".wav", err
+	case ArchiveOpus:
+		if _, err := exec.LookPath("ffmpeg"); err == nil {
+			c = codecArchiveOpus
+		} else {
+			log.Printf("Archiving as FLAC, %s needs ffmpeg", f)
+		}
+	}
+	audio, err := encode(samples, c)
+	return audio, "." + c.name, err
+}
@@ -0,0 +1,110 @@
+package dictation
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// acquireAudio makes sure PortAudio is initialized and keeps it from being
+// suspended until the matching releaseAudio.
+func (s *Service) acquireAudio() error {
+	s.audioMu.Lock()
+	defer s.audioMu.Unlock()
+
+	if s.suspendTimer != nil {
+		s.suspendTimer.Stop()
+		s.suspendTimer = nil
+	}
+	if s.audioActive && s.audioStale && s.audioUsers == 0 {
+		portaudio.Terminate()
+		s.audioActive = false
+		s.audioStale = false
+	}
+	if !s.audioActive {
+		if err := portaudio.Initialize(); err != nil {
+			return fmt.Errorf("portaudio init error: %w", err)
+		}
+		s.audioActive = true
+	}
+	s.audioUsers++
+	return nil
+}
+
+// releaseAudio ends a use of PortAudio. Once nothing uses it for
+// SuspendAfter, it is terminated to free the audio device.
+func (s *Service) releaseAudio() {
+	s.audioMu.Lock()
+	defer s.audioMu.Unlock()
+
+	s.audioUsers--
+	if s.audioUsers > 0 || s.SuspendAfter <= 0 || s.closed {
+		return
+	}
+	s.suspendTimer = time.AfterFunc(s.SuspendAfter, s.suspendAudio)
+}
+
+func (s *Service) suspendAudio() {
+	s.audioMu.Lock()
+	defer s.audioMu.Unlock()
+
+	if s.audioUsers > 0 || !s.audioActive {
+		return
+	}
+	portaudio.Terminate()
+	s.audioActive = false
+	log.Printf("Audio suspended after %s idle", s.SuspendAfter)
+}
+
+// refreshAudio re-initializes PortAudio so its device list is current, e.g.
+// after a microphone was unplugged. It does nothing while anything but the
+// caller uses PortAudio, as their streams would be closed.
+func (s *Service) refreshAudio() {
+	s.audioMu.Lock()
+	defer s.audioMu.Unlock()
+
+	if s.audioUsers != 1 || !s.audioActive {
+		return
+	}
+	portaudio.Terminate()
+	if err := portaudio.Initialize(); err != nil {
+		log.Printf("Failed to restart PortAudio: %v", err)
+		s.audioActive = false
+	}
+}
+
+// restartAudio re-initializes PortAudio after the system woke up, at once
+// if nothing uses it or else once the last use ends.
+func (s *Service) restartAudio() {
+	s.audioMu.Lock()
+	defer s.audioMu.Unlock()
+
+	if !s.audioActive {
+		return
+	}
+	if s.audioUsers > 0 {
+		s.audioStale = true
+		return
+	}
+	portaudio.Terminate()
+	s.audioActive = false
+	log.Printf("Audio is re-initialized after waking up")
+}
+
+// closeAudio terminates PortAudio for good.
+func (s *Service) closeAudio() {
+	s.audioMu.Lock()
+	defer s.audioMu.Unlock()
+
+	s.closed = true
+	if s.suspendTimer != nil {
+		s.suspendTimer.Stop()
+		s.suspendTimer = nil
+	}
+	if s.audioActive {
+		portaudio.Terminate()
+		s.audioActive = false
+	}
+}
@@ -0,0 +1,87 @@
+package dictation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// defaultBatchWorkers is how many files TranscribeFiles works on at once
+// when BatchWorkers is unset.
+const defaultBatchWorkers = 2
+
+// FileResult is the outcome of transcribing one file of a batch.
+type FileResult struct {
+	Path string
+	Result
+	Chapters []Chapter // Instead of Text with BatchChapters
+	// Partial is set when the batch was cancelled while the file was being
+	// transcribed. Text or Chapters hold the parts that finished, and Err
+	// wraps ErrPartial.
+	Partial bool
+	Err     error
+}
+
+// TranscribeFile transcribes an audio file with the overrides in p. Long
+// files are split into chunks like long recordings; if ctx is cancelled
+// part way, the chunks that finished are returned with ErrPartial.
+func (s *Service) TranscribeFile(ctx context.Context, path string, p Profile) (Result, error) {
+	samples, err := ReadAudioFile(path)
+	if err != nil {
+		return Result{}, err
+	}
+	if s.Denoise {
+		samples = denoise(samples)
+	}
+	r, err := s.transcribeWithRetry(ctx, s.request(samples, "", p))
+	r.AudioRef = path
+	if errors.Is(err, ErrPartial) {
+		return r, fmt.Errorf("%s: %w", path, err)
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("%s: transcription failed: %w", path, err)
+	}
+	return r, nil
+}
+
+// TranscribeFiles transcribes paths, BatchWorkers files at a time, and
+// reports each to done as it finishes. done is never called concurrently.
+// Files not started when ctx is cancelled are reported with its error.
+func (s *Service) TranscribeFiles(ctx context.Context, paths []string, p Profile, done func(FileResult)) {
+	workers := s.BatchWorkers
+	if workers <= 0 {
+		workers = defaultBatchWorkers
+	}
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		jobs = make(chan string)
+	)
+	for range min(workers, len(paths)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				r := FileResult{Path: path}
+				switch r.Err = ctx.Err(); {
+				case r.Err != nil:
+				case s.BatchChapters:
+					r.Chapters, r.Err = s.TranscribeChapters(ctx, path, p)
+				default:
+					r.Result, r.Err = s.TranscribeFile(ctx, path, p)
+				}
+				r.Partial = errors.Is(r.Err, ErrPartial)
+				mu.Lock()
+				done(r)
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, path := range paths {
+		jobs <- path
+	}
+	close(jobs)
+	wg.Wait()
+}
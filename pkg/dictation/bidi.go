@@ -0,0 +1,47 @@
+package dictation
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	rlm = "\u200f" // Right-to-left mark
+	lrm = "\u200e" // Left-to-right mark
+)
+
+// rtlScripts are the scripts written right to left.
+var rtlScripts = []*unicode.RangeTable{
+	unicode.Arabic, unicode.Hebrew, unicode.Syriac, unicode.Thaana, unicode.Nko,
+	unicode.Samaritan, unicode.Mandaic, unicode.Adlam,
+}
+
+// isRTL reports whether the first letter of text is from a right-to-left
+// script, which makes it the base direction of the text.
+func isRTL(text string) bool {
+	for _, r := range text {
+		if unicode.IsLetter(r) {
+			return unicode.In(r, rtlScripts...)
+		}
+	}
+	return false
+}
+
+// addBidiMarks marks the direction of each line so it displays correctly
+// in left-to-right fields: lines starting in a right-to-left script are
+// wrapped in RLMs, keeping punctuation and trailing Latin words or numbers
+// on the correct side, and other lines that contain right-to-left text
+// are wrapped in LRMs.
+func addBidiMarks(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		switch {
+		case strings.TrimSpace(line) == "":
+		case isRTL(line):
+			lines[i] = rlm + line + rlm
+		case strings.IndexFunc(line, func(r rune) bool { return unicode.In(r, rtlScripts...) }) >= 0:
+			lines[i] = lrm + line + lrm
+		}
+	}
+	return strings.Join(lines, "\n")
+}
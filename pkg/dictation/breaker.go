@@ -0,0 +1,144 @@
+package dictation
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+const (
+	// defaultProbeInterval is how often an unavailable backend is probed
+	// when ProbeInterval is unset.
+	defaultProbeInterval = 30 * time.Second
+	// pingTimeout bounds each health ping.
+	pingTimeout = 10 * time.Second
+)
+
+// ErrBackendUnavailable is returned instead of sending a request while the
+// circuit breaker is open.
+var ErrBackendUnavailable = errors.New("speech backend unavailable, waiting for it to recover")
+
+// Pinger is implemented by backends that can cheaply check that they are
+// reachable without transcribing anything.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+func (s *Service) probeInterval() time.Duration {
+	if s.ProbeInterval > 0 {
+		return s.ProbeInterval
+	}
+	return defaultProbeInterval
+}
+
+// allowRequest reports whether a request may be sent to the backend. While
+// the breaker is open, backends without Ping get one trial request per
+// probe interval instead.
+func (s *Service) allowRequest() bool {
+	if s.BreakAfter <= 0 {
+		return true
+	}
+	s.breakerMu.Lock()
+	defer s.breakerMu.Unlock()
+	if !s.breakerOpen {
+		return true
+	}
+	if _, ok := s.transcriber.(Pinger); !ok && time.Since(s.breakerSince) >= s.probeInterval() {
+		s.breakerSince = time.Now()
+		return true
+	}
+	return false
+}
+
+// recordOutcome updates the breaker with the result of a request. Only
+// transient failures count; a success closes the breaker.
+func (s *Service) recordOutcome(err error) {
+	if s.BreakAfter <= 0 {
+		return
+	}
+	if err == nil {
+		s.closeBreaker()
+		return
+	}
+	if !isTransient(err) {
+		return
+	}
+	s.breakerMu.Lock()
+	s.failures++
+	trip := s.failures >= s.BreakAfter
+	s.breakerMu.Unlock()
+	if trip {
+		s.openBreaker(err)
+	}
+}
+
+func (s *Service) openBreaker(err error) {
+	s.breakerMu.Lock()
+	if s.breakerOpen {
+		s.breakerMu.Unlock()
+		return
+	}
+	s.breakerOpen = true
+	s.breakerSince = time.Now()
+	s.breakerMu.Unlock()
+
+	log.Printf("Speech backend unavailable (%v), pausing requests", err)
+	if s.OnConnectivity != nil {
+		s.OnConnectivity(false)
+	}
+	if p, ok := s.transcriber.(Pinger); ok {
+		go s.probe(p)
+	}
+}
+
+func (s *Service) closeBreaker() {
+	s.breakerMu.Lock()
+	s.failures = 0
+	wasOpen := s.breakerOpen
+	s.breakerOpen = false
+	s.breakerMu.Unlock()
+
+	if wasOpen {
+		log.Printf("Speech backend is back")
+		if s.OnConnectivity != nil {
+			s.OnConnectivity(true)
+		}
+		s.ReplaySpool()
+	}
+}
+
+// probe pings the backend every probe interval until it answers.
+func (s *Service) probe(p Pinger) {
+	for {
+		select {
+		case <-time.After(s.probeInterval()):
+		case <-s.done:
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+		err := p.Ping(ctx)
+		cancel()
+		if err == nil {
+			s.closeBreaker()
+			return
+		}
+	}
+}
+
+// CheckBackend pings the backend once in the background and opens the
+// circuit breaker straight away if it cannot be reached, so the first
+// dictation after launching offline does not wait for timeouts.
+func (s *Service) CheckBackend() {
+	p, ok := s.transcriber.(Pinger)
+	if !ok || s.BreakAfter <= 0 {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+		defer cancel()
+		if err := p.Ping(ctx); err != nil && isTransient(err) {
+			s.openBreaker(err)
+		}
+	}()
+}
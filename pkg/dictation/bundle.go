@@ -0,0 +1,82 @@
+package dictation
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+// BundleManifest is the manifest.json of a bundle written by WriteBundle.
+type BundleManifest struct {
+	Session    string            `json:"session"`
+	Created    time.Time         `json:"created"`
+	Recordings []BundleRecording `json:"recordings"`
+}
+
+// BundleRecording is a recording in a bundle: its history entry with every
+// transcript version, and where its files are in the bundle.
+type BundleRecording struct {
+	HistoryEntry
+	// Audio is the recording as 16 kHz mono WAV, e.g.
+	// "audio/20251014-093000.wav".
+	Audio string `json:"audio"`
+	// Transcript is the latest transcript as plain text, e.g.
+	// "transcripts/20251014-093000.txt".
+	Transcript string `json:"transcript"`
+}
+
+// WriteBundle writes history entries from dir to w as a zip archive for
+// archiving or annotation: the audio of each recording under audio/, its
+// latest transcript under transcripts/, and a manifest.json describing
+// them, oldest first. session names the bundle in the manifest. Encrypted
+// recordings are decrypted with key.
+func WriteBundle(w io.Writer, dir string, key *[32]byte, session string, entries []HistoryEntry) error {
+	entries = slices.Clone(entries)
+	slices.SortFunc(entries, func(a, b HistoryEntry) int {
+		return a.At.Compare(b.At)
+	})
+
+	z := zip.NewWriter(w)
+	m := BundleManifest{Session: session, Created: time.Now()}
+	for _, e := range entries {
+		r := BundleRecording{
+			HistoryEntry: e,
+			Audio:        "audio/" + e.ID + ".wav",
+			Transcript:   "transcripts/" + e.ID + ".txt",
+		}
+		wav, err := historyAudio(dir, key, e.ID)
+		if err != nil {
+			return err
+		}
+		if err := writeZipFile(z, r.Audio, e.At, wav); err != nil {
+			return err
+		}
+		if err := writeZipFile(z, r.Transcript, e.Latest().At, []byte(e.Latest().Text+"\n")); err != nil {
+			return err
+		}
+		m.Recordings = append(m.Recordings, r)
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeZipFile(z, "manifest.json", m.Created, data); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+func writeZipFile(z *zip.Writer, name string, modified time.Time, data []byte) error {
+	f, err := z.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return fmt.Errorf("failed to add %s to the bundle: %w", name, err)
+	}
+	if _, err := f.Write(data); err != nil {
+		return fmt.Errorf("failed to add %s to the bundle: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package dictation
+
+import "time"
+
+const (
+	// captureBlock is the size of the blocks a recording is kept in, 10
+	// seconds.
+	captureBlock = sampleRate * 10
+	// defaultMaxRecording stops a forgotten recording when MaxRecording is
+	// unset.
+	defaultMaxRecording = time.Hour
+)
+
+// capture holds the audio of a recording in fixed-size blocks, so it
+// grows without copying what has been recorded, up to a limit. Blocks
+// are reused after reset.
+type capture struct {
+	blocks [][]int16 // All full except the last
+	free   [][]int16
+	n      int // Samples held
+	limit  int // Most samples held; 0 for no limit
+	tail   []int16
+}
+
+// newCapture returns a buffer for at most max of audio, or unlimited if
+// max is negative. The first block is allocated straight away.
+func newCapture(max time.Duration) *capture {
+	c := &capture{free: [][]int16{make([]int16, 0, captureBlock)}}
+	if max >= 0 {
+		c.limit = int(max.Seconds() * sampleRate)
+	}
+	return c
+}
+
+// maxRecording is the longest recording, or continuous-mode utterance,
+// captured before it is stopped. Negative is unlimited.
+func (s *Service) maxRecording() time.Duration {
+	if s.MaxRecording != 0 {
+		return s.MaxRecording
+	}
+	return defaultMaxRecording
+}
+
+// write adds samples, dropping what does not fit under the limit.
+func (c *capture) write(samples []int16) {
+	if c.limit > 0 {
+		samples = samples[:min(len(samples), c.limit-c.n)]
+	}
+	for len(samples) > 0 {
+		if len(c.blocks) == 0 || len(c.blocks[len(c.blocks)-1]) == captureBlock {
+			c.blocks = append(c.blocks, c.block())
+		}
+		b := &c.blocks[len(c.blocks)-1]
+		n := min(len(samples), captureBlock-len(*b))
+		*b = append(*b, samples[:n]...)
+		samples = samples[n:]
+		c.n += n
+	}
+}
+
+func (c *capture) block() []int16 {
+	if n := len(c.free); n > 0 {
+		b := c.free[n-1]
+		c.free = c.free[:n-1]
+		return b[:0]
+	}
+	return make([]int16, 0, captureBlock)
+}
+
+// full reports whether the limit has been reached.
+func (c *capture) full() bool {
+	return c.limit > 0 && c.n >= c.limit
+}
+
+// len returns the number of samples held.
+func (c *capture) len() int {
+	return c.n
+}
+
+// samples returns a copy of everything held, in one slice.
+func (c *capture) samples() []int16 {
+	return c.appendRange(make([]int16, 0, c.n), 0, c.n)
+}
+
+// appendRange appends samples from to to of the recording to out.
+func (c *capture) appendRange(out []int16, from, to int) []int16 {
+	for _, b := range c.blocks {
+		if from < len(b) && to > 0 {
+			out = append(out, b[max(from, 0):min(to, len(b))]...)
+		}
+		from -= len(b)
+		to -= len(b)
+	}
+	return out
+}
+
+// reset empties the buffer, keeping its blocks for reuse.
+func (c *capture) reset() {
+	c.free = append(c.free, c.blocks...)
+	c.blocks = c.blocks[:0]
+	c.n = 0
+}
+
+// keepLast drops all but the last n samples.
+func (c *capture) keepLast(n int) {
+	if c.n <= n {
+		return
+	}
+	c.tail = c.appendRange(c.tail[:0], c.n-n, c.n)
+	c.reset()
+	c.write(c.tail)
+}
@@ -0,0 +1,240 @@
+package dictation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// passageLength is how much audio each timestamped passage of a
+	// chaptered transcript covers at least. It ends at the next pause, or
+	// at twice the length without one.
+	passageLength = time.Minute
+	// passagePause is the silence that ends a passage.
+	passagePause = 400 * time.Millisecond
+	// chapterPassages is how many passages make a chapter when the backend
+	// cannot divide the transcript itself.
+	chapterPassages = 10
+	// chapterTitleWords is how many of its first words title a chapter
+	// when the backend cannot.
+	chapterTitleWords = 8
+)
+
+// Chapter is a section of a long transcript.
+type Chapter struct {
+	Title string
+	Start time.Duration // Offset into the recording
+	Text  string
+}
+
+// ChapterBreak starts a chapter at a passage of a transcript.
+type ChapterBreak struct {
+	Passage int    `json:"passage"` // Index of the chapter's first passage
+	Title   string `json:"title"`
+}
+
+// Chapterizer is implemented by backends that can divide a transcript
+// into chapters and title them.
+type Chapterizer interface {
+	// Chapters groups passages, consecutive parts of one transcript, into
+	// chapters, in order.
+	Chapters(ctx context.Context, passages []string) ([]ChapterBreak, error)
+}
+
+// passage is a timestamped part of a recording.
+type passage struct {
+	start time.Duration
+	text  string
+}
+
+// TranscribeChapters transcribes an audio file with the overrides in p and
+// divides the transcript into chapters with timestamps. Backends that are
+// Chapterizers title the chapters; with others, they are evenly sized and
+// titled with their first words. If ctx is cancelled part way, the
+// passages that finished are returned with ErrPartial, in chapters of the
+// latter kind.
+func (s *Service) TranscribeChapters(ctx context.Context, path string, p Profile) ([]Chapter, error) {
+	samples, err := ReadAudioFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if s.Denoise {
+		samples = denoise(samples)
+	}
+	starts, parts := splitPassages(samples)
+	passages, err := s.transcribePassages(ctx, starts, parts, p)
+	partial := errors.Is(err, ErrPartial)
+	switch {
+	case partial:
+		err = fmt.Errorf("%s: %w", path, err)
+	case err != nil:
+		return nil, fmt.Errorf("%s: transcription failed: %w", path, err)
+	}
+	if len(passages) == 0 {
+		return nil, err
+	}
+
+	texts := make([]string, len(passages))
+	for i, passage := range passages {
+		texts[i] = passage.text
+	}
+	var breaks []ChapterBreak
+	if c, ok := s.transcriber.(Chapterizer); ok && !partial {
+		var cerr error
+		breaks, cerr = c.Chapters(ctx, texts)
+		if cerr != nil && !errors.Is(cerr, errors.ErrUnsupported) {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			log.Printf("Failed to divide %s into chapters, using equal parts: %v", path, cerr)
+		}
+		breaks = validBreaks(breaks, len(passages))
+	}
+	if len(breaks) == 0 {
+		for i := 0; i < len(passages); i += chapterPassages {
+			breaks = append(breaks, ChapterBreak{Passage: i, Title: firstWords(texts[i], chapterTitleWords)})
+		}
+	}
+
+	chapters := make([]Chapter, len(breaks))
+	for i, b := range breaks {
+		end := len(passages)
+		if i+1 < len(breaks) {
+			end = breaks[i+1].Passage
+		}
+		chapters[i] = Chapter{
+			Title: b.Title,
+			Start: passages[b.Passage].start,
+			Text:  strings.Join(texts[b.Passage:end], " "),
+		}
+	}
+	return chapters, err
+}
+
+// splitPassages cuts samples into parts of passageLength or more, each
+// ending at a pause where possible, and returns their offsets in samples
+// along with them.
+func splitPassages(samples []int16) (starts []int, parts [][]int16) {
+	minLen := int(passageLength.Seconds() * sampleRate)
+	detector := &vad{}
+	start := 0
+	for i := 0; i < len(samples); i += audioBufferSize {
+		detector.frame(samples[i:min(i+audioBufferSize, len(samples))])
+		end := min(i+audioBufferSize, len(samples))
+		if n := end - start; n >= minLen && detector.silence >= passagePause || n >= 2*minLen {
+			starts, parts = append(starts, start), append(parts, samples[start:end])
+			start = end
+			detector.reset()
+		}
+	}
+	if start < len(samples) {
+		starts, parts = append(starts, start), append(parts, samples[start:])
+	}
+	return starts, parts
+}
+
+// transcribePassages transcribes the parts of a recording, ChunkWorkers at
+// a time, and returns those with speech in order. If ctx is cancelled, the
+// parts that finished are returned with ErrPartial.
+func (s *Service) transcribePassages(ctx context.Context, starts []int, parts [][]int16, p Profile) ([]passage, error) {
+	texts := make([]string, len(parts))
+	done, err := s.transcribeParts(ctx, len(parts), func(ctx context.Context, i int) error {
+		r, err := s.transcribeWithRetry(ctx, s.request(parts[i], "", p))
+		texts[i] = r.Text
+		return err
+	})
+	if err != nil && !errors.Is(err, ErrPartial) {
+		return nil, err
+	}
+
+	var passages []passage
+	for i, text := range texts {
+		if !done[i] {
+			continue
+		}
+		if text = strings.TrimSpace(text); text != "" {
+			passages = append(passages, passage{
+				start: time.Duration(starts[i]) * time.Second / sampleRate,
+				text:  text,
+			})
+		}
+	}
+	return passages, err
+}
+
+// validBreaks returns breaks if they divide n passages into chapters, in
+// order and starting with the first, or else nil.
+func validBreaks(breaks []ChapterBreak, n int) []ChapterBreak {
+	for i, b := range breaks {
+		if b.Passage >= n || i == 0 && b.Passage != 0 || i > 0 && b.Passage <= breaks[i-1].Passage {
+			return nil
+		}
+		if strings.TrimSpace(b.Title) == "" {
+			return nil
+		}
+	}
+	return breaks
+}
+
+// firstWords returns up to n words of text, with an ellipsis if there are
+// more.
+func firstWords(text string, n int) string {
+	words := strings.Fields(text)
+	if len(words) <= n {
+		return strings.Join(words, " ")
+	}
+	title := strings.Join(words[:n], " ")
+	return strings.TrimRightFunc(title, unicode.IsPunct) + "…"
+}
+
+// ChaptersMarkdown formats chapters as a Markdown document with a linked
+// table of contents and a timestamp under each heading.
+func ChaptersMarkdown(title string, chapters []Chapter) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n## Contents\n\n", title)
+	seen := map[string]int{markdownAnchor(title): 1, "contents": 1}
+	for i, c := range chapters {
+		anchor := markdownAnchor(c.Title)
+		if n := seen[anchor]; n > 0 {
+			seen[anchor]++
+			anchor = fmt.Sprintf("%s-%d", anchor, n)
+		} else {
+			seen[anchor] = 1
+		}
+		fmt.Fprintf(&b, "%d. [%s](#%s) (%s)\n", i+1, c.Title, anchor, timestamp(c.Start))
+	}
+	for _, c := range chapters {
+		fmt.Fprintf(&b, "\n## %s\n\n*%s*\n\n%s\n", c.Title, timestamp(c.Start), c.Text)
+	}
+	return b.String()
+}
+
+// markdownAnchor returns the link target GitHub and most Markdown viewers
+// give a heading.
+func markdownAnchor(heading string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(heading) {
+		switch {
+		case unicode.IsLetter(r), unicode.IsDigit(r), r == '-', r == '_':
+			b.WriteRune(r)
+		case r == ' ':
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
+
+// timestamp formats an offset into a recording as m:ss, or h:mm:ss from an
+// hour.
+func timestamp(d time.Duration) string {
+	sec := int(d.Seconds())
+	if sec >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", sec/3600, sec/60%60, sec%60)
+	}
+	return fmt.Sprintf("%d:%02d", sec/60, sec%60)
+}
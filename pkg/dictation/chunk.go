@@ -0,0 +1,323 @@
+package dictation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	// defaultChunkOverlap is the audio neighbouring chunks share when
+	// ChunkOverlap is unset, so no word is lost at a boundary.
+	defaultChunkOverlap = 2 * time.Second
+	// defaultChunkWorkers bounds concurrent chunk requests when
+	// ChunkWorkers is unset.
+	defaultChunkWorkers = 4
+	// maxOverlapWords bounds the search for repeated words between chunks.
+	maxOverlapWords = 20
+	// maxEdgeWords is how many words at a chunk edge may be dropped to
+	// find the overlap, as the cut can split a word.
+	maxEdgeWords = 2
+	// partialGap stands in for the chunks missing from a partial
+	// transcript.
+	partialGap = "[…]"
+)
+
+// ErrPartial is returned, wrapping the cancellation, when a chunked
+// transcription is cancelled after some of its chunks finished. The
+// transcript returned with it holds those chunks.
+var ErrPartial = errors.New("transcription cancelled part way")
+
+// chunked reports whether req is long enough to be split into chunks.
+func (s *Service) chunked(req Request) bool {
+	chunk := int(s.ChunkLength.Seconds() * sampleRate)
+	return chunk > 0 && len(req.Samples) > chunk*3/2
+}
+
+// transcribeChunked splits req into overlapping chunks, transcribes them
+// concurrently and stitches the results back together. Text is reported
+// to OnPartial as leading chunks finish. If ctx is cancelled, the chunks
+// that finished are returned with ErrPartial.
+func (s *Service) transcribeChunked(ctx context.Context, req Request) (Transcript, error) {
+	overlap := s.ChunkOverlap
+	if overlap <= 0 {
+		overlap = defaultChunkOverlap
+	}
+	chunks := splitChunks(req.Samples, int(s.ChunkLength.Seconds()*sampleRate), int(overlap.Seconds()*sampleRate))
+	log.Printf("Transcribing in %d chunks", len(chunks))
+
+	var (
+		mu      sync.Mutex
+		results = make([]Transcript, len(chunks))
+		ready   = make([]bool, len(chunks))
+		next    int
+		sofar   Transcript
+	)
+	done, err := s.transcribeParts(ctx, len(chunks), func(ctx context.Context, i int) error {
+		r := req
+		r.Samples = chunks[i]
+		t, err := s.transcribeChunk(ctx, r)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		results[i], ready[i] = t, true
+		grew := false
+		for ; next < len(chunks) && ready[next]; next++ {
+			sofar = mergeTranscripts(sofar, results[next], next == 0)
+			grew = true
+		}
+		if grew && next < len(chunks) && s.OnPartial != nil {
+			s.OnPartial(sofar.Text)
+		}
+		return nil
+	})
+	switch {
+	case errors.Is(err, ErrPartial):
+		return partialTranscript(results, done), err
+	case err != nil:
+		return Transcript{}, err
+	}
+	return sofar, nil
+}
+
+// transcribeParts calls fn for parts 0 to n-1 of a recording, ChunkWorkers
+// at a time, and cancels the rest once one fails. It reports which parts
+// finished. If ctx is cancelled after some did, the error wraps
+// ErrPartial; otherwise it is the failure that cancelled the rest, not
+// the cancellations.
+func (s *Service) transcribeParts(ctx context.Context, n int, fn func(ctx context.Context, i int) error) ([]bool, error) {
+	workers := s.ChunkWorkers
+	if workers <= 0 {
+		workers = defaultChunkWorkers
+	}
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		errs = make([]error, n)
+		done = make([]bool, n)
+		sem  = make(chan struct{}, workers)
+		wg   sync.WaitGroup
+	)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				errs[i] = ctx.Err()
+				return
+			}
+			defer func() { <-sem }()
+			if errs[i] = fn(ctx, i); errs[i] != nil {
+				cancel()
+				return
+			}
+			done[i] = true
+		}()
+	}
+	wg.Wait()
+
+	// A cancelled job keeps the parts that finished.
+	if err := parent.Err(); err != nil && slices.Contains(done, true) {
+		return done, fmt.Errorf("%w: %w", ErrPartial, err)
+	}
+	var first error
+	for _, err := range errs {
+		if err != nil && !errors.Is(err, context.Canceled) {
+			return done, err
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return done, first
+}
+
+// partialTranscript stitches the chunks that finished, marking each run of
+// missing ones with partialGap. The confidence is the lowest of the chunks
+// and the language the first one detected.
+func partialTranscript(results []Transcript, done []bool) Transcript {
+	var (
+		t     Transcript
+		parts []string
+		seen  bool // A chunk with text was merged
+	)
+	for i := 0; i < len(results); {
+		if !done[i] {
+			for i < len(results) && !done[i] {
+				i++
+			}
+			parts = append(parts, partialGap)
+			continue
+		}
+		run := results[i]
+		for i++; i < len(results) && done[i]; i++ {
+			run = mergeTranscripts(run, results[i], false)
+		}
+		if run.Text == "" {
+			continue
+		}
+		if t.Language == "" {
+			t.Language = run.Language
+		}
+		if !seen || run.Confidence < t.Confidence {
+			t.Confidence = run.Confidence
+		}
+		seen = true
+		parts = append(parts, run.Text)
+	}
+	t.Text = strings.Join(slices.Compact(parts), " ")
+	return t
+}
+
+// transcribeChunk transcribes one chunk, structured if requested.
+func (s *Service) transcribeChunk(ctx context.Context, req Request) (Transcript, error) {
+	if sb, ok := s.backend(req).(StructuredTranscriber); ok && s.Structured {
+		return sb.TranscribeStructured(ctx, req)
+	}
+	text, err := s.backend(req).Transcribe(ctx, req)
+	return Transcript{Text: strings.TrimSpace(text)}, err
+}
+
+// splitChunks cuts samples into windows of chunk samples plus overlap.
+// The last window takes the remainder, between half and one and a half
+// chunks, or a little more when the overlap alone would reach the end.
+// Without a chunk length samples stay whole.
+func splitChunks(samples []int16, chunk, overlap int) [][]int16 {
+	if chunk <= 0 {
+		return [][]int16{samples}
+	}
+	overlap = max(overlap, 0)
+	var chunks [][]int16
+	for start := 0; ; start += chunk {
+		end := start + chunk + overlap
+		if len(samples)-start <= chunk*3/2 || end >= len(samples) {
+			return append(chunks, samples[start:])
+		}
+		chunks = append(chunks, samples[start:end])
+	}
+}
+
+// mergeTranscripts appends the transcript of the next chunk to t. The
+// merged confidence is the lowest of the chunks and the language is the
+// first one detected.
+func mergeTranscripts(t, next Transcript, first bool) Transcript {
+	if first {
+		return next
+	}
+	switch {
+	case t.Text == "":
+		t.Confidence = next.Confidence
+	case next.Text != "":
+		t.Confidence = min(t.Confidence, next.Confidence)
+	}
+	t.Text = stitch(t.Text, next.Text)
+	if t.Language == "" {
+		t.Language = next.Language
+	}
+
+	segments := slices.Clone(next.Segments)
+	if n := len(t.Segments); n > 0 && len(segments) > 0 {
+		last := &t.Segments[n-1]
+		last.Text, segments[0].Text = trimOverlap(last.Text, segments[0].Text)
+		if last.Language == segments[0].Language {
+			last.Text = stitch(last.Text, segments[0].Text)
+			segments = segments[1:]
+		}
+	}
+	t.Segments = slices.DeleteFunc(append(t.Segments, segments...), func(seg Segment) bool {
+		return seg.Text == ""
+	})
+	return t
+}
+
+// stitch joins the transcripts of neighbouring chunks, removing the words
+// both contain because of the overlap.
+func stitch(a, b string) string {
+	a, b = trimOverlap(a, b)
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	}
+	return a + " " + b
+}
+
+// trimOverlap finds the longest run of words (at least two) at the end of
+// a that is repeated at the start of b, and removes it from b. Up to
+// maxEdgeWords words either side of the repeat are dropped too, as they
+// come from audio cut mid-word. Without a repeat a and b are returned
+// unchanged.
+func trimOverlap(a, b string) (string, string) {
+	wa, wb := wordSpans(a), wordSpans(b)
+	na, nb := normalizeSpans(a, wa), normalizeSpans(b, wb)
+
+	best, dropA, dropB := 1, 0, 0
+	for i := 0; i <= maxEdgeWords && i < len(na); i++ {
+		for j := 0; j <= maxEdgeWords && j < len(nb); j++ {
+			for k := min(len(na)-i, len(nb)-j, maxOverlapWords); k > best; k-- {
+				if slices.Equal(na[len(na)-i-k:len(na)-i], nb[j:j+k]) {
+					best, dropA, dropB = k, i, j
+					break
+				}
+			}
+		}
+	}
+	if best < 2 {
+		return a, b
+	}
+	if dropA > 0 {
+		a = a[:wa[len(wa)-dropA-1][1]]
+	}
+	if rest := dropB + best; rest < len(wb) {
+		b = b[wb[rest][0]:]
+	} else {
+		b = ""
+	}
+	return a, b
+}
+
+// wordSpans returns the start and end offsets of the space-separated words
+// in s.
+func wordSpans(s string) [][2]int {
+	var spans [][2]int
+	start := -1
+	for i, r := range s {
+		switch {
+		case unicode.IsSpace(r) && start >= 0:
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		case !unicode.IsSpace(r) && start < 0:
+			start = i
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(s)})
+	}
+	return spans
+}
+
+// normalizeSpans returns the words of s in lower case without surrounding
+// punctuation, for comparison.
+func normalizeSpans(s string, spans [][2]int) []string {
+	words := make([]string, len(spans))
+	for i, sp := range spans {
+		words[i] = strings.ToLower(strings.TrimFunc(s[sp[0]:sp[1]], func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		}))
+	}
+	return words
+}
@@ -0,0 +1,47 @@
+package dictation
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ContactsMacOS is the LoadContacts source that reads names from the macOS
+// Contacts app. macOS asks for Contacts permission the first time.
+const ContactsMacOS = "macos"
+
+// LoadContacts returns the contact names from source, which is either
+// ContactsMacOS or the path to a text file with one name per line. Blank
+// lines and lines starting with # are ignored.
+func LoadContacts(source string) ([]string, error) {
+	var raw string
+	if source == ContactsMacOS {
+		out, err := exec.Command("osascript", "-l", "JavaScript", "-e",
+			`Application("Contacts").people.name().join("\n")`).Output()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read macOS contacts: %w", err)
+		}
+		raw = string(out)
+	} else {
+		data, err := os.ReadFile(source)
+		if err != nil {
+			return nil, err
+		}
+		raw = string(data)
+	}
+
+	var names []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(strings.NewReader(raw))
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		if name == "" || strings.HasPrefix(name, "#") || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	return names, scanner.Err()
+}
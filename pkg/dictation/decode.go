@@ -0,0 +1,247 @@
+package dictation
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Audio formats recognized by sniffAudio.
+const (
+	formatWAV  = "WAV"
+	formatFLAC = "FLAC"
+	formatMP3  = "MP3"
+	formatAAC  = "AAC"
+	formatOgg  = "Ogg"
+	formatMP4  = "MP4/M4A"
+	formatAIFF = "AIFF"
+	formatWebM = "WebM/Matroska"
+	formatCAF  = "CAF"
+)
+
+// sniffAudio identifies an audio format by the first bytes of a file, or
+// returns "" if it does not recognize them.
+func sniffAudio(head []byte) string {
+	has := func(off int, magic string) bool {
+		return len(head) >= off+len(magic) && string(head[off:off+len(magic)]) == magic
+	}
+	switch {
+	case has(0, "RIFF") && has(8, "WAVE"), has(0, "RF64") && has(8, "WAVE"):
+		return formatWAV
+	case has(0, "fLaC"):
+		return formatFLAC
+	case has(0, "OggS"):
+		return formatOgg
+	case has(0, "ID3"):
+		return formatMP3
+	case len(head) >= 2 && head[0] == 0xFF && head[1]&0xE0 == 0xE0:
+		// MPEG audio frame sync; AAC in ADTS has layer bits 00.
+		if head[1]&0x06 == 0 {
+			return formatAAC
+		}
+		return formatMP3
+	case has(4, "ftyp"):
+		return formatMP4
+	case has(0, "FORM") && (has(8, "AIFF") || has(8, "AIFC")):
+		return formatAIFF
+	case has(0, "\x1a\x45\xdf\xa3"):
+		return formatWebM
+	case has(0, "caff"):
+		return formatCAF
+	}
+	return ""
+}
+
+// ReadAudioFile decodes an audio file to mono samples at 16 kHz. The
+// format is recognized by content, not the file name. Only WAV and FLAC
+// are decoded natively; other formats such as MP3, Ogg/Opus and M4A are
+// only recognized, and decoding them needs ffmpeg.
+func ReadAudioFile(path string) ([]int16, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	head := make([]byte, 12)
+	n, err := io.ReadFull(f, head)
+	f.Close()
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	format := sniffAudio(head[:n])
+	if format == formatWAV || format == formatFLAC {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var samples []int16
+		var rate int
+		if format == formatWAV {
+			samples, rate, err = decodeAnyWAV(data)
+		} else {
+			samples, rate, err = decodeFLAC(data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return resample(samples, rate), nil
+	}
+
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		if format == "" {
+			return nil, fmt.Errorf("%s: not a recognized audio file (ffmpeg, which reads more formats, is not installed)", path)
+		}
+		return nil, fmt.Errorf("%s: %s has no built-in decoder, install ffmpeg to transcribe it", path, format)
+	}
+	return ffmpegDecode(path)
+}
+
+// ffmpegDecode converts any audio file ffmpeg can read to 16 kHz mono.
+func ffmpegDecode(path string) ([]int16, error) {
+	cmd := exec.Command("ffmpeg", "-v", "error", "-i", path,
+		"-f", "s16le", "-ac", "1", "-ar", strconv.Itoa(sampleRate), "pipe:1")
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: ffmpeg error: %v, stderr: %s", path, err, strings.TrimSpace(stderr.String()))
+	}
+	data := out.Bytes()
+	samples := make([]int16, len(data)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(data[i*2:]))
+	}
+	return samples, nil
+}
+
+// resample converts a whole recording at rate to sampleRate.
+func resample(samples []int16, rate int) []int16 {
+	r := newResampler(float64(rate))
+	if r == nil {
+		return samples
+	}
+	n := int(float64(len(samples)) / r.step)
+	out := r.process(samples, make([]int16, 0, n+1))
+	out = r.process(make([]int16, r.taps+1), out) // Flush the filter
+	return out[:min(len(out), n)]
+}
+
+// WAV format tags.
+const (
+	wavPCM        = 1
+	wavFloat      = 3
+	wavExtensible = 0xFFFE
+)
+
+// wavFormat is the contents of a WAV format chunk.
+type wavFormat struct {
+	format, channels, rate, bits int
+}
+
+// parseWAVFormat reads a WAV format chunk.
+func parseWAVFormat(body []byte) (wavFormat, error) {
+	if len(body) < 16 {
+		return wavFormat{}, fmt.Errorf("invalid WAV format chunk")
+	}
+	f := wavFormat{
+		format:   int(binary.LittleEndian.Uint16(body)),
+		channels: int(binary.LittleEndian.Uint16(body[2:])),
+		rate:     int(binary.LittleEndian.Uint32(body[4:])),
+		bits:     int(binary.LittleEndian.Uint16(body[14:])),
+	}
+	if f.format == wavExtensible && len(body) >= 26 {
+		f.format = int(binary.LittleEndian.Uint16(body[24:]))
+	}
+	if f.channels < 1 || f.rate <= 0 {
+		return wavFormat{}, fmt.Errorf("invalid WAV file: %d channels at %d Hz", f.channels, f.rate)
+	}
+	return f, nil
+}
+
+// frameSize is the size in bytes of one sample of every channel.
+func (f wavFormat) frameSize() int {
+	return f.bits / 8 * f.channels
+}
+
+// mixer returns a function that mixes one frame of f down to a mono
+// sample, or an error if the encoding is not supported.
+func (f wavFormat) mixer() (func(frame []byte) int16, error) {
+	var sample func(b []byte) float64 // Scaled to 16 bits
+	switch {
+	case f.format == wavPCM && f.bits == 8:
+		sample = func(b []byte) float64 { return float64(int(b[0])-128) * 256 }
+	case f.format == wavPCM && f.bits == 16:
+		sample = func(b []byte) float64 { return float64(int16(binary.LittleEndian.Uint16(b))) }
+	case f.format == wavPCM && f.bits == 24:
+		sample = func(b []byte) float64 {
+			return float64(int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24)) / 65536
+		}
+	case f.format == wavPCM && f.bits == 32:
+		sample = func(b []byte) float64 { return float64(int32(binary.LittleEndian.Uint32(b))) / 65536 }
+	case f.format == wavFloat && f.bits == 32:
+		sample = func(b []byte) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))) * 32767 }
+	case f.format == wavFloat && f.bits == 64:
+		sample = func(b []byte) float64 { return math.Float64frombits(binary.LittleEndian.Uint64(b)) * 32767 }
+	default:
+		return nil, fmt.Errorf("unsupported WAV encoding (format %d, %d bits)", f.format, f.bits)
+	}
+	width := f.bits / 8
+	return func(frame []byte) int16 {
+		var sum float64
+		for c := range f.channels {
+			sum += sample(frame[c*width:])
+		}
+		return int16(max(math.MinInt16, min(math.MaxInt16, math.Round(sum/float64(f.channels)))))
+	}, nil
+}
+
+// decodeAnyWAV decodes an integer PCM or floating point WAV file with any
+// number of channels, mixed down to mono, and returns its sample rate.
+func decodeAnyWAV(data []byte) ([]int16, int, error) {
+	var (
+		f       wavFormat
+		pcm     []byte
+		haveFmt bool
+	)
+	for off := 12; off+8 <= len(data); {
+		id := string(data[off : off+4])
+		size := int(binary.LittleEndian.Uint32(data[off+4:]))
+		body := data[off+8:]
+		if size > len(body) {
+			size = len(body) // Truncated, or streamed without a size
+		}
+		body = body[:size]
+		switch id {
+		case "fmt ":
+			var err error
+			if f, err = parseWAVFormat(body); err != nil {
+				return nil, 0, err
+			}
+			haveFmt = true
+		case "data":
+			pcm = body
+		}
+		off += 8 + size + size%2
+	}
+	if !haveFmt || pcm == nil {
+		return nil, 0, fmt.Errorf("invalid WAV file: missing format or data")
+	}
+	mix, err := f.mixer()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	frame := f.frameSize()
+	samples := make([]int16, len(pcm)/frame)
+	for i := range samples {
+		samples[i] = mix(pcm[i*frame:])
+	}
+	return samples, f.rate, nil
+}
@@ -0,0 +1,170 @@
+package dictation
+
+import (
+	"cmp"
+	"math"
+	"math/cmplx"
+	"slices"
+)
+
+const (
+	// highPassCutoff removes rumble, hum and handling noise below the
+	// voice range.
+	highPassCutoff = 80.0
+	// gateFrame and gateHop are the spectral gate's FFT size and step in
+	// samples, 32ms and 16ms at 16 kHz.
+	gateFrame = 512
+	gateHop   = gateFrame / 2
+	// gateNoiseFrames is the share of the quietest frames the noise
+	// spectrum is measured from.
+	gateNoiseFrames = 0.1
+	// gateOverSubtract removes somewhat more than the measured noise, so
+	// noise that fluctuates is suppressed too.
+	gateOverSubtract = 1.5
+	// gateFloor keeps some of every bin (-20 dB), since silencing bins
+	// outright leaves warbling artifacts.
+	gateFloor = 0.1
+)
+
+// denoise cleans up a recording before it is transcribed: a high-pass
+// filter, then a spectral gate that attenuates frequencies where the
+// signal is not above the background noise, measured from the quietest
+// parts of the recording. It suits steady noise such as fans, traffic or a
+// café's murmur.
+func denoise(samples []int16) []int16 {
+	x := make([]float64, len(samples))
+	for i, v := range samples {
+		x[i] = float64(v)
+	}
+	highPass(x, highPassCutoff)
+	if len(x) >= 4*gateFrame {
+		x = spectralGate(x)
+	}
+	out := make([]int16, len(x))
+	for i, v := range x {
+		out[i] = int16(max(-32768, min(32767, math.Round(v))))
+	}
+	return out
+}
+
+// highPass filters x in place with a second-order Butterworth high-pass.
+func highPass(x []float64, cutoff float64) {
+	w := 2 * math.Pi * cutoff / sampleRate
+	alpha := math.Sin(w) / math.Sqrt2
+	a0 := 1 + alpha
+	b0 := (1 + math.Cos(w)) / 2 / a0
+	b1 := -(1 + math.Cos(w)) / a0
+	b2 := b0
+	a1 := -2 * math.Cos(w) / a0
+	a2 := (1 - alpha) / a0
+
+	var x1, x2, y1, y2 float64
+	for i, v := range x {
+		y := b0*v + b1*x1 + b2*x2 - a1*y1 - a2*y2
+		x2, x1 = x1, v
+		y2, y1 = y1, y
+		x[i] = y
+	}
+}
+
+// spectralGate applies the noise gate with overlapping FFT frames under a
+// square-root Hann window, which adds back up to the input unchanged where
+// nothing is attenuated.
+func spectralGate(x []float64) []float64 {
+	window := make([]float64, gateFrame)
+	for i := range window {
+		window[i] = math.Sqrt(0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/gateFrame))
+	}
+	// Pad so every sample is covered by two frames.
+	padded := make([]float64, gateHop+len(x)+gateFrame)
+	copy(padded[gateHop:], x)
+	frames := (len(padded) - gateFrame) / gateHop
+
+	spectrum := func(f int) []complex128 {
+		buf := make([]complex128, gateFrame)
+		for i := range buf {
+			buf[i] = complex(padded[f*gateHop+i]*window[i], 0)
+		}
+		fft(buf, false)
+		return buf
+	}
+
+	// Measure the noise from the quietest frames.
+	energy := make([]float64, frames)
+	for f := range energy {
+		for _, v := range padded[f*gateHop : f*gateHop+gateFrame] {
+			energy[f] += v * v
+		}
+	}
+	order := make([]int, frames)
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortFunc(order, func(a, b int) int {
+		return cmp.Compare(energy[a], energy[b])
+	})
+	quiet := max(1, int(float64(frames)*gateNoiseFrames))
+	noise := make([]float64, gateFrame/2+1)
+	for _, f := range order[:quiet] {
+		for k, c := range spectrum(f)[:len(noise)] {
+			noise[k] += cmplx.Abs(c) / float64(quiet)
+		}
+	}
+
+	out := make([]float64, len(padded))
+	for f := 0; f < frames; f++ {
+		buf := spectrum(f)
+		for k := range noise {
+			mag := cmplx.Abs(buf[k])
+			gain := 1.0
+			if mag > 0 {
+				gain = max(gateFloor, 1-gateOverSubtract*noise[k]/mag)
+			}
+			buf[k] *= complex(gain, 0)
+			if k > 0 && k < gateFrame/2 {
+				buf[gateFrame-k] *= complex(gain, 0)
+			}
+		}
+		fft(buf, true)
+		for i, c := range buf {
+			out[f*gateHop+i] += real(c) * window[i]
+		}
+	}
+	return out[gateHop : gateHop+len(x)]
+}
+
+// fft transforms x in place with a radix-2 FFT; len(x) must be a power of
+// two. The inverse transform is scaled by 1/len(x).
+func fft(x []complex128, inverse bool) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	sign := -1.0
+	if inverse {
+		sign = 1
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Rect(1, sign*2*math.Pi/float64(size))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], x[start+k+size/2]*w
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				w *= step
+			}
+		}
+	}
+	if inverse {
+		for i := range x {
+			x[i] /= complex(float64(n), 0)
+		}
+	}
+}
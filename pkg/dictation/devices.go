@@ -0,0 +1,298 @@
+package dictation
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// micReadErrors is how many reads in a row must fail before the
+// microphone is taken to be gone.
+const micReadErrors = 3
+
+// ErrMicLost is reported when the microphone stopped working mid-recording
+// and no other could be opened. What was recorded until then is still
+// transcribed.
+var ErrMicLost = errors.New("microphone disconnected")
+
+// InputDevice is a microphone that can be recorded from.
+type InputDevice struct {
+	// Index identifies the device until audio devices are added or
+	// removed.
+	Index    int
+	Name     string
+	Host     string // Host API, e.g. "Core Audio" or "ALSA"
+	Channels int
+	// SampleRate is the device's default rate in Hz.
+	SampleRate float64
+	Default    bool
+	// Selected is the device InputDevice picks.
+	Selected bool
+}
+
+// ListInputDevices returns every device that can record audio.
+func (s *Service) ListInputDevices() ([]InputDevice, error) {
+	if err := s.acquireAudio(); err != nil {
+		return nil, err
+	}
+	defer s.releaseAudio()
+
+	devs, err := portaudio.Devices()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audio devices: %w", err)
+	}
+	def, _ := portaudio.DefaultInputDevice()
+	selected, _ := s.inputDevice()
+
+	var list []InputDevice
+	for _, d := range devs {
+		if d.MaxInputChannels < 1 {
+			continue
+		}
+		dev := InputDevice{
+			Index:      d.Index,
+			Name:       d.Name,
+			Channels:   d.MaxInputChannels,
+			SampleRate: d.DefaultSampleRate,
+			Default:    def != nil && d.Index == def.Index,
+			Selected:   selected != nil && d.Index == selected.Index,
+		}
+		if d.HostApi != nil {
+			dev.Host = d.HostApi.Name
+		}
+		list = append(list, dev)
+	}
+	return list, nil
+}
+
+// inputDevice finds the microphone named by InputDevice. It returns the
+// default input device when InputDevice is empty.
+func (s *Service) inputDevice() (*portaudio.DeviceInfo, error) {
+	if s.InputDevice == "" {
+		return portaudio.DefaultInputDevice()
+	}
+	return findInput(s.InputDevice)
+}
+
+// inputs returns the devices that can record.
+func inputs() ([]*portaudio.DeviceInfo, error) {
+	devs, err := portaudio.Devices()
+	if err != nil {
+		return nil, err
+	}
+	var inputs []*portaudio.DeviceInfo
+	for _, d := range devs {
+		if d.MaxInputChannels > 0 {
+			inputs = append(inputs, d)
+		}
+	}
+	return inputs, nil
+}
+
+// findInput finds the input device named by a device index, an exact name
+// or a unique part of one, ignoring case.
+func findInput(name string) (*portaudio.DeviceInfo, error) {
+	inputs, err := inputs()
+	if err != nil {
+		return nil, err
+	}
+	if i, err := strconv.Atoi(name); err == nil {
+		for _, d := range inputs {
+			if d.Index == i {
+				return d, nil
+			}
+		}
+		return nil, fmt.Errorf("no input device with index %d", i)
+	}
+	want := strings.ToLower(name)
+	var matches []*portaudio.DeviceInfo
+	for _, d := range inputs {
+		name := strings.ToLower(d.Name)
+		if name == want {
+			return d, nil
+		}
+		if strings.Contains(name, want) {
+			matches = append(matches, d)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no input device named %q", name)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("input device %q is ambiguous: %q and %q both match", name, matches[0].Name, matches[1].Name)
+	}
+}
+
+// mic is an open input stream. The device records at its native rate,
+// since forcing 16 kHz fails or distorts on some USB and Bluetooth
+// microphones, and read resamples to sampleRate.
+type mic struct {
+	name      string
+	capture   Capture // What openInput opened this for
+	stream    *portaudio.Stream
+	buf       []int16 // Interleaved if there is more than one channel
+	channels  int
+	channel   int     // Channel to record, from 1; 0 mixes all down
+	mono      []int16 // buf as one channel
+	resampler *resampler
+	out       []int16
+	mix       *mic // Mixed into every read, e.g. system audio in a meeting
+}
+
+// openMic opens a mono input stream on the selected microphone, or its
+// InputChannel. If it is not connected, the default input device is used
+// instead.
+func (s *Service) openMic() (*mic, error) {
+	dev, err := s.inputDevice()
+	selected := err == nil
+	if err != nil && s.InputDevice != "" {
+		log.Printf("%v, using the default microphone", err)
+		dev, err = portaudio.DefaultInputDevice()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if s.InputChannel > 0 && selected {
+		return openChannels(dev, dev.MaxInputChannels, s.InputChannel)
+	}
+	return openDevice(dev)
+}
+
+// openDevice opens a mono input stream on dev. Devices that only record
+// in stereo or more, such as some audio interfaces, are opened with all
+// their channels and mixed down.
+func openDevice(dev *portaudio.DeviceInfo) (*mic, error) {
+	m, err := openChannels(dev, channelCount, 0)
+	if err != nil && dev.MaxInputChannels > channelCount {
+		log.Printf("%s cannot record in mono (%v), mixing down %d channels", dev.Name, err, dev.MaxInputChannels)
+		return openChannels(dev, dev.MaxInputChannels, 0)
+	}
+	return m, err
+}
+
+// openChannels opens an input stream with n channels on dev. Its reads are
+// the given channel, counting from 1, or else all channels mixed down.
+func openChannels(dev *portaudio.DeviceInfo, n, channel int) (*mic, error) {
+	if channel > n {
+		return nil, fmt.Errorf("%s has no channel %d, only %d", dev.Name, channel, n)
+	}
+	rate := dev.DefaultSampleRate
+	if rate <= 0 {
+		rate = sampleRate
+	}
+	// Keep the buffer the same length in time at any rate.
+	frames := int(audioBufferSize * rate / sampleRate)
+	m := &mic{
+		name:      dev.Name,
+		buf:       make([]int16, frames*n),
+		channels:  n,
+		channel:   channel,
+		resampler: newResampler(rate),
+	}
+	p := portaudio.HighLatencyParameters(dev, nil)
+	p.Input.Channels = n
+	p.SampleRate = rate
+	p.FramesPerBuffer = frames
+	var err error
+	if m.stream, err = portaudio.OpenStream(p, m.buf); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// reopenMic closes a microphone that keeps failing, e.g. a headset that
+// was unplugged or a Bluetooth dropout, and opens the selected microphone
+// again, or the default one if it is gone. failure is what went wrong.
+func (s *Service) reopenMic(old *mic, failure error) (*mic, error) {
+	log.Printf("Microphone %s stopped working (%v), reopening", old.name, failure)
+	old.Close()
+	s.refreshAudio()
+
+	m, err := s.openInput(old.capture)
+	if err == nil {
+		if err = m.start(); err != nil {
+			m.Close()
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMicLost, failure)
+	}
+	log.Printf("Recording continues with %s", m.name)
+	if s.OnMicSwitch != nil {
+		s.OnMicSwitch(m.name)
+	}
+	return m, nil
+}
+
+// start starts the stream, and the one mixed in.
+func (m *mic) start() error {
+	if err := m.stream.Start(); err != nil {
+		return err
+	}
+	if m.mix != nil {
+		if err := m.mix.stream.Start(); err != nil {
+			m.stream.Stop()
+			return err
+		}
+	}
+	return nil
+}
+
+// Close stops and closes the stream, and the one mixed in.
+func (m *mic) Close() error {
+	m.stream.Stop()
+	err := m.stream.Close()
+	if m.mix != nil {
+		m.mix.Close()
+	}
+	return err
+}
+
+// Read waits for the next buffer and returns it at sampleRate. An input
+// overflow only loses some audio, so it is not reported.
+func (m *mic) Read() ([]int16, error) {
+	err := m.stream.Read()
+	if err == portaudio.InputOverflowed {
+		err = nil
+	}
+	samples := m.buf
+	if m.channels > 1 {
+		m.mono = downmix(m.buf, m.channels, m.channel, m.mono[:0])
+		samples = m.mono
+	}
+	if m.resampler != nil {
+		m.out = m.resampler.process(samples, m.out[:0])
+		samples = m.out
+	}
+	if m.mix != nil && err == nil {
+		other, err := m.mix.Read()
+		if err != nil {
+			return samples, err
+		}
+		mixInto(samples, other)
+	}
+	return samples, err
+}
+
+// downmix appends one channel of the interleaved samples in to out, or
+// the average of all n channels if channel is 0.
+func downmix(in []int16, n, channel int, out []int16) []int16 {
+	for i := 0; i+n <= len(in); i += n {
+		if channel > 0 {
+			out = append(out, in[i+channel-1])
+			continue
+		}
+		var sum int
+		for _, v := range in[i : i+n] {
+			sum += int(v)
+		}
+		out = append(out, int16(sum/n))
+	}
+	return out
+}
@@ -1,111 +1,554 @@
 package dictation
 
 import (
-	"bytes"
 	"context"
-	"encoding/base64"
-	"encoding/binary"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
-	"net/http"
-	"os/exec"
-	"strconv"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/go-vgo/robotgo"
-	"github.com/gordonklaus/portaudio"
+	"chrisper/pkg/paths"
 )
 
 const (
 	sampleRate      = 16000
 	channelCount    = 1
 	audioBufferSize = 1024
-	modelName       = "models/gemini-2.5-flash-lite-preview-09-2025"
-	defaultGain     = 32.0
 )
 
+// Mode selects what happens to a transcript once it is ready.
+type Mode int
+
+const (
+	// ModeDictate types the transcript into the active window.
+	ModeDictate Mode = iota
+	// ModeNote files the transcript as a timestamped note without typing it.
+	ModeNote
+	// ModeCommand passes the transcript to OnCommand, for voice control.
+	// Nothing is typed, saved or spooled.
+	ModeCommand
+	// ModeCaption shows the transcript as a caption through OnCaption,
+	// usually of a continuous recording. Nothing is typed, saved or
+	// spooled.
+	ModeCaption
+	// ModeCorrect takes the transcript, a short phrase, for a correction of
+	// the last dictation: the words of it that sound most like the phrase
+	// are replaced with it in place. Nothing is saved or spooled.
+	ModeCorrect
+)
+
+// Request is a single transcription job.
+type Request struct {
+	// Samples is 16 kHz mono 16-bit PCM.
+	Samples []int16
+	// Vocabulary lists names and terms that may appear in the audio so the
+	// backend can spell them correctly.
+	Vocabulary []string
+	// App is the application that was focused when recording started.
+	App string
+	// Language is the expected spoken language as a BCP-47 code, or "" to
+	// detect it.
+	Language string
+	// Speaker describes the speaker's accent, style and domain.
+	Speaker SpeakerHints
+	// CodeSwitch expects the speaker to switch languages mid-dictation.
+	// Each part is transcribed in the language it is spoken in, and
+	// structured transcripts are split into Segments by language.
+	CodeSwitch bool
+	// Script is the writing system for languages with a non-Latin script.
+	Script Script
+	// Translate asks for the transcript translated into this language, a
+	// BCP-47 code. Only Gemini translates; other backends ignore it.
+	Translate string
+	// Instructions are added to the transcription prompt, e.g. a domain
+	// preset's. Only Gemini follows them.
+	Instructions string
+
+	backend Transcriber   // Used instead of the service's backend, if set
+	meta    *requestMeta  // Collects what the backend reports, if set
+	encoded *encodedAudio // Samples encoded while recording, if set
+	retried bool          // The service retries transient failures itself
+}
+
+// Transcriber converts recorded audio into text.
+type Transcriber interface {
+	Transcribe(ctx context.Context, req Request) (string, error)
+}
+
+// StreamingTranscriber is implemented by backends that can report the
+// transcript while it is still being generated. partial receives the text
+// so far each time it grows.
+type StreamingTranscriber interface {
+	Transcriber
+	TranscribeStream(ctx context.Context, req Request, partial func(text string)) (string, error)
+}
+
+// Transcript is a transcription with the backend's assessment of it.
+type Transcript struct {
+	Text string `json:"text"`
+	// Confidence is the backend's estimate that Text is accurate, from 0
+	// to 1.
+	Confidence float64 `json:"confidence"`
+	// Language is the detected BCP-47 language code.
+	Language string `json:"language"`
+	// Segments splits Text by language for code-switched requests.
+	Segments []Segment `json:"segments,omitempty"`
+}
+
+// Segment is a run of a transcript in one language.
+type Segment struct {
+	Text     string `json:"text"`
+	Language string `json:"language"`
+}
+
+// StructuredTranscriber is implemented by backends that can report their
+// confidence and the detected language along with the text.
+type StructuredTranscriber interface {
+	Transcriber
+	TranscribeStructured(ctx context.Context, req Request) (Transcript, error)
+}
+
 // Service handles the dictation logic.
 type Service struct {
-	apiKey string
+	transcriber Transcriber
+
+	// NotesDir is where ModeNote recordings are filed.
+	NotesDir string
+
+	// ArchiveDir, if set, keeps the audio of every recording but voice
+	// commands in a timestamped file, in ArchiveFormat (default WAV),
+	// alongside its transcription.
+	ArchiveDir    string
+	ArchiveFormat ArchiveFormat
+
+	// Retranscriber, if set, is the backend TranscribeLast uses instead of
+	// the usual one, e.g. a cloud backend to retry a local one's mistakes.
+	Retranscriber Transcriber
+
+	// LiveFile, if set, receives every transcript as it is produced, as a
+	// simple integration point for status bars and OBS text sources.
+	LiveFile string
+
+	// StatusFile, if set, is kept up to date with the service Status so
+	// other processes (e.g. `chrisper status`) can report it.
+	StatusFile string
+
+	// ConfirmAbove makes the service call Confirm before sending recordings
+	// longer than this, so a forgotten recording is not transcribed by
+	// accident. Zero disables the check.
+	ConfirmAbove time.Duration
+	// Confirm returns whether to transcribe a long recording. Returning
+	// false discards it.
+	Confirm func(Estimate) bool
+
+	// Preflight, if set, checks that the service can record from the
+	// microphone, e.g. that the OS permits it, before the first recording.
+	// If it fails, the error goes to OnError and nothing is recorded; it
+	// is called again on the next attempt until it succeeds. It is called
+	// with the service locked and should be quick.
+	Preflight   func() error
+	preflighted bool
+
+	// Live streams audio to the backend while recording and types text as
+	// it is recognized, when the backend is a LiveTranscriber.
+	Live bool
+
+	// Structured requests a Transcript from backends that support it, so
+	// Accept can vet each result. Partial text is not streamed in this
+	// mode.
+	Structured bool
+	// Accept returns whether to deliver a structured transcript. Returning
+	// false discards it, e.g. when its confidence is too low.
+	Accept func(Transcript) bool
+
+	// SpokenTags recognizes a closing "tag ..." sentence, as in "Tag
+	// project alpha.", and files its words as tags of the history entry
+	// instead of typing it.
+	SpokenTags bool
+
+	// Vocabulary is passed to the backend with every request, e.g. contact
+	// names loaded with LoadContacts.
+	Vocabulary []string
+	// Instructions are passed to the backend with every request; see
+	// Request.Instructions.
+	Instructions string
+	// Rules rewrite every transcript, in order, before it is delivered;
+	// see CompileRules. Live transcripts are typed as they arrive, and
+	// are not rewritten.
+	Rules []Rule
+
+	// Verifier, if set, re-transcribes every typed dictation in the
+	// background, typically a cloud backend checking a fast local one.
+	// Results that differ from the typed text by at least
+	// CorrectThreshold (a share of words, default 0.15) are reported to
+	// OnCorrection and, with AutoCorrect, replace the typed text.
+	Verifier         Transcriber
+	AutoCorrect      bool
+	CorrectThreshold float64
+
+	// Language is the expected spoken language as a BCP-47 code such as
+	// "en" or "de", or LanguageAuto (the same as empty) to detect it.
+	// Profiles can override it per recording.
+	Language string
+
+	// Speaker is passed to the backend with every request to adapt
+	// recognition to the speaker.
+	Speaker SpeakerHints
+
+	// CodeSwitch tells the backend the speaker mixes languages; see
+	// Request.CodeSwitch.
+	CodeSwitch bool
+
+	// Script asks for romanized transcripts, or both scripts, for languages
+	// not written in the Latin alphabet. Profiles can override it.
+	Script Script
+
+	// Output, if set, receives dictated transcripts instead of the focused
+	// window, which Injection, HumanTyping, BidiMarks, PaceControl and
+	// AutoCorrect then leave alone. Live transcripts arrive whole once
+	// the recording stops.
+	Output   OutputSink
+	outputMu sync.Mutex
+	// Injection is how transcripts are entered: typed, pasted, or (by
+	// default) pasted only while an input method is active.
+	Injection Injection
+	// HumanTyping types one key at a time with uneven, human-like pauses,
+	// for apps and sites that reject or flag instant synthetic input.
+	HumanTyping bool
+
+	// BidiMarks wraps lines of right-to-left text in direction marks so
+	// they display correctly in left-to-right fields. Profiles can turn it
+	// on per language.
+	BidiMarks bool
+
+	// ChunkLength splits recordings longer than one and a half times this
+	// into chunks that overlap by ChunkOverlap (default 2s) and are
+	// transcribed concurrently, up to ChunkWorkers (default 4) at a time.
+	// Zero sends every recording whole.
+	ChunkLength  time.Duration
+	ChunkOverlap time.Duration
+	ChunkWorkers int
+
+	// BatchWorkers is how many files TranscribeFiles transcribes at once
+	// (default 2). Long files are chunked on top of that; use Limit to cap
+	// the requests in flight per backend.
+	BatchWorkers int
+	// BatchChapters makes TranscribeFiles divide each transcript into
+	// chapters; see TranscribeChapters.
+	BatchChapters bool
+
+	// Reminders enables an intent pass that turns "remind me to ..."
+	// dictations into reminders instead of typing them. Reminders go to
+	// ReminderWebhook as JSON when set, or to the macOS Reminders app.
+	Reminders       bool
+	ReminderWebhook string
+
+	// Retries is how many times a transcription that failed with a rate
+	// limit, server or network error is retried before OnError, waiting
+	// RetryBackoff (default 1s) before the first retry and doubling it for
+	// each one after.
+	Retries      int
+	RetryBackoff time.Duration
+
+	// BreakAfter stops sending requests after this many consecutive
+	// transient failures; zero disables the circuit breaker. The backend is
+	// then probed every ProbeInterval (default 30s) until it recovers, and
+	// OnConnectivity reports both changes. Recordings made in the meantime
+	// are spooled when SpoolDir is set.
+	BreakAfter    int
+	ProbeInterval time.Duration
+	breakerMu     sync.Mutex
+	breakerOpen   bool
+	breakerSince  time.Time
+	failures      int
+
+	// SpoolDir, if set, keeps recordings that failed because the network
+	// was down and transcribes them once it is back; see ReplaySpool.
+	SpoolDir  string
+	spoolMu   sync.Mutex
+	replaying bool
+
+	// HistoryDir, if set, keeps every transcribed recording with its
+	// transcripts so it can be transcribed again later; see Reprocess.
+	HistoryDir string
+	// HistoryKey, if set, encrypts the history at rest.
+	HistoryKey *[32]byte
+	// HistorySync, if set, is synced with the history after every
+	// recording. It requires HistoryKey.
+	HistorySync HistoryStore
+	syncMu      sync.Mutex
+
+	// AutoStopAfter stops a recording once the speaker has been silent this
+	// long, as judged by an energy-based voice activity detector, and calls
+	// OnAutoStop. Zero waits for the hotkey.
+	AutoStopAfter time.Duration
+
+	// PaceControl types long transcripts a few words at a time while
+	// listening for a spoken "hold" to pause typing and "go" to resume it,
+	// e.g. when the target app cannot keep up.
+	PaceControl bool
+
+	// MaxRecording stops a recording that has gone on this long, e.g.
+	// after forgetting to stop it, and a continuous one when a single
+	// utterance has. Default one hour; negative is unlimited.
+	MaxRecording time.Duration
+
+	// PreRecord is how much audio StartPreRecord keeps for
+	// TranscribeRecent, e.g. 30 seconds.
+	PreRecord time.Duration
+
+	// SegmentSilence is the pause (default 800ms) that ends an utterance in
+	// a continuous recording; see Profile.Continuous.
+	SegmentSilence time.Duration
+
+	// DefaultProfile, if set, returns the profile for recordings started
+	// without one, e.g. by schedule.
+	DefaultProfile func() Profile
+
+	// Denoise runs recordings through a high-pass filter and a spectral
+	// noise gate before they are transcribed. Live streaming is not
+	// filtered.
+	Denoise bool
+
+	// MinGain and MaxGain bound the automatic gain control that levels the
+	// microphone input (default 1 to 32). Setting both the same fixes the
+	// gain.
+	MinGain, MaxGain float64
+
+	// InputDevice selects the microphone by index or name, as listed by
+	// ListInputDevices. Empty uses the system default.
+	InputDevice string
+	// InputChannel records only this channel of a multi-channel device,
+	// counting from 1, e.g. the input an audio interface's microphone is
+	// plugged into. Zero records in mono, mixing channels down if the
+	// device has to be opened in stereo or more.
+	InputChannel int
+	// LoopbackDevice is an input device that records what the computer
+	// plays, such as BlackHole, for profiles that capture system audio.
+	// Empty picks the first device that looks like one.
+	LoopbackDevice string
+
+	// SuspendAfter releases the audio subsystem once this long has passed
+	// since the last recording; it is re-initialized on the next one. Zero
+	// keeps it open.
+	SuspendAfter time.Duration
+
+	// Power scales features back on battery or in low power mode.
+	Power PowerPolicy
+
+	// PIN, if set, is required to Unlock the service.
+	PIN    string
+	locked atomic.Bool
 
 	isRecording  bool
+	mode         Mode
 	mu           sync.Mutex
+	asleep       bool // The system is going to sleep; see WatchSleep
+	screenLocked bool
+	recordCtx    context.Context    // The current operation
 	cancelRecord context.CancelFunc // Cancels the entire operation (emergency stop)
 	stopAudio    context.CancelFunc // Stops audio recording, triggers transcription
-	httpClient   *http.Client
+	turns        []*turn            // Recordings being made, transcribed or delivered
+	queued       int                // Of those, the ones that have stopped; see OnQueue
+	lastTurn     chan struct{}      // Closed once the last recording is delivered
+
+	audioMu      sync.Mutex
+	audioActive  bool
+	audioUsers   int
+	audioStale   bool // Re-initialize once unused, after waking up
+	suspendTimer *time.Timer
+	closed       bool
+
+	preMu   sync.Mutex
+	preRing *ring  // Audio kept for TranscribeRecent; see StartPreRecord
+	preStop func() // Stops filling preRing while something else records
+	preRun  int    // Counts resumePreRecord starts, to tell them apart
+
+	lastMu sync.Mutex
+	last   *recording // For TranscribeLast
+
+	typedMu sync.Mutex
+	typed   string // Last transcript typed, for ModeCorrect
+
+	powerMu     sync.Mutex
+	powerRead   time.Time
+	powerSaving bool
+
+	statusMu sync.Mutex
+	status   Status
+
+	done      chan struct{} // Closed by Close
+	closeOnce sync.Once
 
 	// Callbacks
-	OnStart      func()
-	OnStop       func()
-	OnProcessing func()
-	OnFinish     func()
-	OnError      func(error)
+	OnStart        func()
+	OnStop         func()
+	OnAutoStop     func() // Recording stopped by silence or MaxRecording rather than the hotkey, after OnStop
+	OnProcessing   func()
+	OnFinish       func()
+	OnQueue        func(n int)            // Number of stopped recordings not yet transcribed and delivered, whenever it changes
+	OnAudioLevel   func(rms float64)      // Microphone level from 0 to 1 before gain, 10 times a second while recording; see FeatureMeter
+	OnMeter        func(Meter)            // Words and tokens so far, once a second while recording
+	OnPartial      func(text string)      // Transcript so far, while a streaming backend generates
+	OnResult       func(Result)           // Every non-empty transcript, before it is delivered
+	OnTranscript   func(text string) bool // Dictated transcript about to be delivered; returning true (handled) takes it over and nothing is typed
+	OnNote         func(path string)
+	OnHold         func(held bool) // Typing paused (true) or resumed by a spoken "hold" or "go"
+	OnCommand      func(Result)    // Transcript of a ModeCommand recording
+	OnCaption      func(Result)    // Caption of a ModeCaption utterance; OnPartial shows it as it is generated
+	OnReminder     func(Reminder)
+	OnCorrection   func(typed, verified string) // Verifier disagreed with the typed text
+	OnSpooled      func(path string)            // Recording saved for later while offline
+	OnReplay       func(text string)            // Dictation copied to the clipboard instead of typed: spooled, or finished while the screen was locked
+	OnConnectivity func(online bool)            // Circuit breaker opened (false) or closed (true)
+	OnMicSwitch    func(name string)            // The microphone stopped working mid-recording, which goes on with name
+	OnPowerSaving  func(saving bool)            // Saving power started (true) or ended, as noticed by WatchSleep or a feature check
+	OnError        func(error)
 }
 
-// New creates a new Dictation Service.
+// New creates a new Dictation Service backed by Gemini.
 func New(apiKey string) (*Service, error) {
-	if apiKey == "" {
-		return nil, fmt.Errorf("API key is required")
+	g, err := NewGemini(Network{}, apiKey)
+	if err != nil {
+		return nil, err
 	}
+	return NewWithTranscriber(g)
+}
 
-	// Initialize PortAudio globally
-	if err := portaudio.Initialize(); err != nil {
-		return nil, fmt.Errorf("portaudio init error: %w", err)
+// NewWithTranscriber creates a new Dictation Service that uses t for
+// speech recognition.
+func NewWithTranscriber(t Transcriber) (*Service, error) {
+	if t == nil {
+		return nil, fmt.Errorf("transcriber is required")
 	}
 
 	s := &Service{
-		apiKey:     apiKey,
-		httpClient: &http.Client{Timeout: 120 * time.Second},
+		transcriber: t,
+		status:      Status{State: StateIdle, Since: time.Now()},
+		done:        make(chan struct{}),
 	}
+	s.NotesDir = filepath.Join(paths.Home(), "notes")
+
+	// Initialize PortAudio now to report problems early.
+	if err := s.acquireAudio(); err != nil {
+		return nil, err
+	}
+	s.releaseAudio()
 
 	return s, nil
 }
 
 // Close cleans up resources.
 func (s *Service) Close() {
-	s.StopRecording()
-	portaudio.Terminate()
+	s.closeOnce.Do(func() { close(s.done) })
+	s.StopRecording(context.Background())
+	s.pausePreRecord()
+	s.closeAudio()
+	if s.StatusFile != "" {
+		os.Remove(s.StatusFile)
+	}
 }
 
 // ToggleRecording starts or stops recording.
 func (s *Service) ToggleRecording() {
+	s.Toggle(context.Background(), ModeDictate, Profile{})
+}
+
+// ToggleNote starts or stops a voice note recording. The transcript is
+// saved to NotesDir instead of being typed.
+func (s *Service) ToggleNote() {
+	s.Toggle(context.Background(), ModeNote, Profile{})
+}
+
+// Start starts a recording in mode with the overrides in p, unless one is
+// already running. With StopRecording it implements push-to-talk.
+// Cancelling ctx ends the recording and discards it, or abandons its
+// transcription if it has already stopped.
+func (s *Service) Start(ctx context.Context, mode Mode, p Profile) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-
-	if s.isRecording {
-		s.stopRecordingLocked()
-	} else {
-		s.startRecordingLocked()
+	if !s.isRecording {
+		s.startRecordingLocked(ctx, mode, p, nil)
 	}
 }
 
-// StopRecording stops recording if active.
-func (s *Service) StopRecording() {
+// ToggleCaptions starts or stops live captions of what the microphone
+// hears, translated into translate if it is set, reported to OnCaption.
+func (s *Service) ToggleCaptions(translate string) {
+	s.Toggle(context.Background(), ModeCaption, Profile{Continuous: true, Translate: translate})
+}
+
+// ToggleContinuous starts or stops continuous dictation, which types each
+// utterance as soon as the speaker pauses until it is stopped.
+func (s *Service) ToggleContinuous() {
+	s.Toggle(context.Background(), ModeDictate, Profile{Continuous: true})
+}
+
+// StopRecording stops recording if active. The recording is transcribed
+// and delivered as usual unless ctx is done first, which abandons it.
+func (s *Service) StopRecording(ctx context.Context) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if s.isRecording {
 		s.stopRecordingLocked()
+		s.finishWithinLocked(ctx)
 	}
 }
 
-func (s *Service) startRecordingLocked() {
+// startRecordingLocked starts a recording from src, or the microphone if
+// src is nil, as part of ctx and reports whether it did.
+func (s *Service) startRecordingLocked(ctx context.Context, mode Mode, p Profile, src AudioSource) bool {
+	if s.asleep || s.screenLocked {
+		log.Printf("Not recording while the system sleeps or the screen is locked")
+		return false
+	}
+	if src == nil && s.Preflight != nil && !s.preflighted {
+		if err := s.Preflight(); err != nil {
+			if s.OnError != nil {
+				s.OnError(err)
+			}
+			return false
+		}
+		s.preflighted = true
+	}
+	p = s.withDefault(p)
 	if s.OnStart != nil {
 		s.OnStart()
 	}
 	s.isRecording = true
-	
+	s.mode = mode
+	s.setState(StateRecording)
+
 	// Main context for the whole operation
-	ctx, cancel := context.WithCancel(context.Background())
-	s.cancelRecord = cancel
-	
+	ctx, cancel := context.WithCancel(ctx)
+	s.recordCtx, s.cancelRecord = ctx, cancel
+
 	// Audio context to control just the audio recording
 	audioCtx, stopAudio := context.WithCancel(ctx)
 	s.stopAudio = stopAudio
-	
-	go s.runLoop(ctx, audioCtx, cancel)
+
+	go s.runLoop(ctx, audioCtx, cancel, s.nextTurnLocked(cancel), mode, p, src)
+	return true
+}
+
+// withDefault returns p, or the DefaultProfile if p is unnamed.
+func (s *Service) withDefault(p Profile) Profile {
+	if p.Name == "" && s.DefaultProfile != nil {
+		d := s.DefaultProfile()
+		d.Continuous = d.Continuous || p.Continuous
+		d.AutoStopAfter = p.AutoStopAfter
+		p = d
+		if p.Name != "" {
+			log.Printf("Using scheduled profile %s", p.Name)
+		}
+	}
+	return p
 }
 
 func (s *Service) stopRecordingLocked() {
@@ -113,7 +556,7 @@ func (s *Service) stopRecordingLocked() {
 		s.OnStop()
 	}
 	s.isRecording = false
-	
+
 	// Stop audio recording, which will trigger transcription in runLoop
 	if s.stopAudio != nil {
 		s.stopAudio()
@@ -121,8 +564,18 @@ func (s *Service) stopRecordingLocked() {
 	}
 }
 
-func (s *Service) runLoop(ctx context.Context, audioCtx context.Context, cancel context.CancelFunc) {
-	var audioData []int16
+// finishWithinLocked abandons the current operation, the transcription of
+// a recording just stopped, if ctx is done before it finishes.
+func (s *Service) finishWithinLocked(ctx context.Context) {
+	if ctx.Done() == nil || s.recordCtx == nil {
+		return
+	}
+	stop := context.AfterFunc(ctx, s.cancelRecord)
+	context.AfterFunc(s.recordCtx, func() { stop() })
+}
+
+func (s *Service) runLoop(ctx context.Context, audioCtx context.Context, cancel context.CancelFunc, t *turn, mode Mode, p Profile, src AudioSource) {
+	app := activeApp()
 
 	// Ensure we clean up
 	defer func() {
@@ -130,30 +583,96 @@ func (s *Service) runLoop(ctx context.Context, audioCtx context.Context, cancel
 			s.OnFinish()
 		}
 		cancel()
+		s.endTurn(t)
+		s.resumePreRecord()
 	}()
 
 	// Audio Setup
-	sampleRateFloat := float64(sampleRate)
-	framesPerBuffer := make([]int16, audioBufferSize)
+	var m *mic
+	if src == nil {
+		// The pre-record buffer and the recording share the microphone.
+		s.pausePreRecord()
 
-	paStream, err := portaudio.OpenDefaultStream(channelCount, 0, sampleRateFloat, len(framesPerBuffer), framesPerBuffer)
-	if err != nil {
-		if s.OnError != nil {
-			s.OnError(fmt.Errorf("failed to open PA stream: %w", err))
+		if err := s.acquireAudio(); err != nil {
+			if s.OnError != nil {
+				s.OnError(err)
+			}
+			return
 		}
-		return
+		defer s.releaseAudio()
+
+		var err error
+		if m, err = s.openInput(p.Capture); err != nil {
+			if s.OnError != nil {
+				s.OnError(fmt.Errorf("failed to open PA stream: %w", err))
+			}
+			return
+		}
+		src = m
 	}
 
-	if err := paStream.Start(); err != nil {
-		if s.OnError != nil {
-			s.OnError(fmt.Errorf("failed to start PA stream: %w", err))
+	out := s.output(p)
+	out.turn = t
+	words := s.newWordMeter()
+	live := s.startLive(ctx, mode, s.request(nil, app, p), out, words)
+
+	if m != nil {
+		if err := m.start(); err != nil {
+			if s.OnError != nil {
+				s.OnError(fmt.Errorf("failed to start PA stream: %w", err))
+			}
+			m.Close()
+			return
 		}
-		paStream.Close()
-		return
 	}
-	
+
+	gain := s.newAGC()
+	var level meter
+	if s.OnAudioLevel != nil && s.powerSaver(FeatureMeter) {
+		level.interval = lowPowerLevelInterval
+	}
+	audio := newCapture(s.maxRecording())
+	var frame []int16
+	var detector *vad
+	autoStopAfter := s.AutoStopAfter
+	if p.AutoStopAfter > 0 {
+		autoStopAfter = p.AutoStopAfter
+	}
+	if autoStopAfter > 0 || p.Continuous {
+		detector = &vad{}
+	}
+
+	// In continuous mode every utterance is sent off as a segment once the
+	// speaker pauses, and transcribed and delivered in order while
+	// recording goes on.
+	var segments chan []int16
+	var segmentsDone chan struct{}
+	if p.Continuous && live == nil {
+		segments = make(chan []int16, 16)
+		segmentsDone = make(chan struct{})
+		go func() {
+			defer close(segmentsDone)
+			n := 0
+			for seg := range segments {
+				if ctx.Err() == nil {
+					n++
+					s.process(ctx, mode, p, out, app, seg, nil, n)
+				}
+			}
+		}()
+	}
+	pause := s.SegmentSilence
+	if pause <= 0 {
+		pause = defaultSegmentSilence
+	}
+	var enc *streamEncoder
+	if segments == nil && live == nil {
+		enc = s.newStreamEncoder(ctx)
+	}
+
 	// Recording Loop
 	recording := true
+	readErrors := 0
 	for recording {
 		select {
 		case <-ctx.Done():
@@ -161,224 +680,382 @@ func (s *Service) runLoop(ctx context.Context, audioCtx context.Context, cancel
 		case <-audioCtx.Done():
 			recording = false
 		default:
-			if err := paStream.Read(); err != nil {
-				if err != portaudio.InputOverflowed {
+			samples, err := src.Read()
+			if err == io.EOF {
+				s.stopCurrent(audioCtx, "End of audio")
+				recording = false
+				continue
+			}
+			if err != nil && m == nil {
+				// Stop, but transcribe what was read so far.
+				s.stopCurrent(audioCtx, "Audio source failed")
+				if s.OnError != nil {
+					s.OnError(fmt.Errorf("failed to read audio: %w", err))
+				}
+				recording = false
+				continue
+			}
+			if err != nil {
+				readErrors++
+				if readErrors < micReadErrors {
 					log.Printf("PortAudio read error: %v", err)
+					continue
 				}
+				readErrors = 0
+				if m, err = s.reopenMic(m, err); err != nil {
+					// Stop, but transcribe what was recorded so far.
+					src = nil
+					s.stopCurrent(audioCtx, "Microphone lost")
+					if s.OnError != nil {
+						s.OnError(err)
+					}
+					recording = false
+				} else {
+					src = m
+				}
+				continue
 			}
+			readErrors = 0
 
-			// Gain Boost and Append
-			for _, sample := range framesPerBuffer {
-				boosted := float64(sample) * defaultGain
-				if boosted > 32767 {
-					boosted = 32767
-				} else if boosted < -32768 {
-					boosted = -32768
+			if s.OnAudioLevel != nil {
+				level.frame(samples, s.OnAudioLevel)
+			}
+			frame = gain.process(samples, frame[:0])
+			audio.write(frame)
+			words.frame(s, frame, audio.len())
+			enc.write(audio)
+			if audio.full() {
+				s.autoStop(audioCtx, fmt.Sprintf("Recording reached the %s limit", s.maxRecording()))
+			}
+
+			if live != nil {
+				if err := live.Write(frame); err != nil {
+					log.Printf("Live stream failed: %v", err)
+					live.Close()
+					live = nil
+				}
+			}
+
+			switch {
+			case segments != nil:
+				detector.frame(frame)
+				switch {
+				case detector.heard && detector.silence >= pause:
+					if detector.voiced >= minUtterance {
+						segments <- audio.samples()
+					}
+					audio.reset()
+					detector.reset()
+				case !detector.heard && audio.len() > segmentPreRoll:
+					// Drop the silence before an utterance, keeping a
+					// little so its first word is not cut off.
+					audio.keepLast(segmentPreRoll)
+				}
+			case detector != nil:
+				detector.frame(frame)
+				if detector.silence >= autoStopAfter {
+					s.autoStop(audioCtx, fmt.Sprintf("Silence for %s", autoStopAfter))
 				}
-				audioData = append(audioData, int16(boosted))
 			}
 		}
 	}
 
-	paStream.Stop()
-	paStream.Close()
+	if src != nil {
+		src.Close()
+	}
 
 	// If we were cancelled (emergency stop), don't transcribe
-	if ctx.Err() != nil && audioCtx.Err() == nil {
+	if ctx.Err() != nil {
+		// Nothing stopped the recording, so it is stopped here unless
+		// another has started.
+		s.mu.Lock()
+		if s.isRecording && s.recordCtx == ctx {
+			s.stopRecordingLocked()
+		}
+		s.mu.Unlock()
+		enc.stop()
+		if live != nil {
+			live.Close()
+		}
+		if segments != nil {
+			close(segments)
+			<-segmentsDone
+		}
+		return
+	}
+
+	if live != nil {
+		s.finishLive(live, mode, out)
+		return
+	}
+
+	if segments != nil {
+		// Send the last utterance, unless it was only background noise.
+		if detector.voiced >= minUtterance {
+			segments <- audio.samples()
+		}
+		close(segments)
+		<-segmentsDone
 		return
 	}
 
 	// Transcribe
-	if len(audioData) > 0 {
+	if audio.len() > 0 {
+		s.process(ctx, mode, p, out, app, audio.samples(), enc.finish(audio.len()), 0)
+	}
+}
+
+// process transcribes a finished recording, or the nth segment of a
+// continuous one, and delivers the transcript: typed, filed as a note or
+// turned into a reminder. encoded is the recording compressed while it
+// was made, or nil. segment is 0 for a whole recording.
+func (s *Service) process(ctx context.Context, mode Mode, p Profile, out output, app string, audioData []int16, encoded *encodedAudio, segment int) {
+	est := EstimateCost(audioData)
+	log.Printf("Transcribing %s", est)
+	if segment == 0 && s.ConfirmAbove > 0 && est.Duration > s.ConfirmAbove && s.Confirm != nil && !s.Confirm(est) {
+		log.Printf("Recording discarded")
+		return
+	}
+
+	// Continuous recordings keep recording while segments are processed,
+	// and the next recording may start while this one is.
+	if segment == 0 {
+		s.enqueue(out.turn)
+		s.setStateUnlessRecording(StateProcessing)
 		if s.OnProcessing != nil {
 			s.OnProcessing()
 		}
-		text, err := s.transcribeAudio(audioData)
-		if err != nil {
-			if s.OnError != nil {
-				s.OnError(fmt.Errorf("transcription failed: %w", err))
+	}
+	// Voice commands are not worth keeping.
+	if s.ArchiveDir != "" && mode != ModeCommand && mode != ModeCorrect {
+		go s.archive(audioData, time.Now().Add(-est.Duration))
+	}
+	if mode != ModeCommand && mode != ModeCaption && mode != ModeCorrect {
+		s.keepLast(mode, p, app, audioData)
+	}
+	if s.Denoise {
+		audioData = denoise(audioData)
+	}
+	req := s.request(audioData, app, p)
+	req.encoded = encoded
+	res, err := s.transcribeWithRetry(ctx, req)
+	if ctx.Err() != nil {
+		log.Printf("Transcription cancelled")
+		return
+	}
+	if err != nil && s.SpoolDir != "" && mode != ModeCommand && mode != ModeCaption && mode != ModeCorrect && isOffline(err) {
+		path, spoolErr := s.spool(mode, req, time.Now())
+		if spoolErr == nil {
+			log.Printf("Offline (%v), recording saved to %s", err, path)
+			if s.OnSpooled != nil {
+				s.OnSpooled(path)
 			}
+			s.ReplaySpool()
 			return
 		}
-
-		if text != "" {
-			// Wait a bit for keys to be released
-			time.Sleep(200 * time.Millisecond)
-			robotgo.TypeStr(text)
+		log.Printf("Failed to spool recording: %v", spoolErr)
+	}
+	if err != nil {
+		if s.OnError != nil {
+			s.OnError(fmt.Errorf("transcription failed: %w", err))
 		}
+		return
+	}
+	out.turn.wait(ctx)
+	if ctx.Err() != nil {
+		return
 	}
-}
-
-func (s *Service) transcribeAudio(samples []int16) (string, error) {
-	var audioBytes []byte
-	var mimeType string
-	var err error
 
-	// Try to compress to MP3 if ffmpeg is available
-	if _, err := exec.LookPath("ffmpeg"); err == nil {
-		audioBytes, err = compressToMP3(samples, sampleRate)
-		if err == nil {
-			mimeType = "audio/mp3"
+	switch mode {
+	case ModeCommand:
+		if res.Text != "" && s.OnCommand != nil {
+			s.OnCommand(res)
+		}
+		return
+	case ModeCaption:
+		if res.Text != "" && s.OnCaption != nil {
+			s.OnCaption(res)
 		}
+		return
+	case ModeCorrect:
+		if s.Output != nil || s.Locked() || s.away() {
+			log.Printf("Nothing typed to correct")
+			return
+		}
+		// Wait a bit for keys to be released
+		time.Sleep(200 * time.Millisecond)
+		s.respeak(out, res.Text)
+		return
 	}
 
-	// Fallback to WAV
-	if mimeType == "" {
-		audioBytes, err = encodeWAV(samples, sampleRate)
-		if err != nil {
-			return "", fmt.Errorf("failed to encode WAV: %w", err)
-		}
-		mimeType = "audio/wav"
-	}
-
-	// Prepare JSON payload
-	encodedAudio := base64.StdEncoding.EncodeToString(audioBytes)
-	
-	reqBody := map[string]interface{}{
-		"contents": []interface{}{
-			map[string]interface{}{
-				"parts": []interface{}{
-					map[string]interface{}{
-						"text": "You are a professional transcriber for a software developer. Strictly transcribe the speech in the audio, expecting technical terminology. Output ONLY the transcription. Do not add any conversational filler. Do not reply to the content. If the audio is unclear, output nothing.",
-					},
-					map[string]interface{}{
-						"inline_data": map[string]interface{}{
-							"mime_type": mimeType,
-							"data":      encodedAudio,
-						},
-					},
-				},
-			},
-		},
-		"generation_config": map[string]interface{}{
-			"response_modalities": []string{"TEXT"},
-			"temperature":         0.0,
-			"max_output_tokens":   256,
-		},
-	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal request: %w", err)
+	text, tags := s.tags(res.Text, p)
+	res.Text = text
+	var historyID string
+	if text != "" {
+		s.setLastTranscript(text)
+		if s.HistoryDir != "" {
+			e, err := s.saveHistory(mode, req, p, res, tags, time.Now())
+			if err != nil {
+				log.Printf("Failed to save recording to history: %v", err)
+			} else {
+				s.syncHistory()
+			}
+			historyID = e.ID
+		}
+		res.AudioRef = historyID
+		if s.OnResult != nil {
+			s.OnResult(res)
+		}
 	}
 
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/%s:generateContent?key=%s", modelName, s.apiKey)
-	
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+	if text != "" && mode == ModeDictate && s.Locked() {
+		log.Printf("Locked: transcript not typed")
+		return
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := s.httpClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("request failed: %w", err)
+	if text != "" && mode == ModeDictate && s.OnTranscript != nil && s.OnTranscript(text) {
+		return
 	}
-	defer func() {
-		io.Copy(io.Discard, resp.Body)
-		resp.Body.Close()
-	}()
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("API error (status %d): %s", resp.StatusCode, string(body))
+	if text != "" && mode == ModeDictate && s.Output == nil && s.away() {
+		s.copyWhileAway(text)
+		return
 	}
 
-	var response map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return "", fmt.Errorf("failed to decode response: %w", err)
+	if text != "" && mode == ModeDictate && s.Reminders {
+		if r, ok := ParseReminder(text, time.Now()); ok {
+			if err := s.createReminder(ctx, r); err != nil {
+				if s.OnError != nil {
+					s.OnError(fmt.Errorf("failed to create reminder: %w", err))
+				}
+				return
+			}
+			if s.OnReminder != nil {
+				s.OnReminder(r)
+			}
+			return
+		}
 	}
 
-	// Extract text
-	// Response structure: candidates[0].content.parts[0].text
-	if candidates, ok := response["candidates"].([]interface{}); ok && len(candidates) > 0 {
-		if candidate, ok := candidates[0].(map[string]interface{}); ok {
-			if content, ok := candidate["content"].(map[string]interface{}); ok {
-				if parts, ok := content["parts"].([]interface{}); ok && len(parts) > 0 {
-					if part, ok := parts[0].(map[string]interface{}); ok {
-						if text, ok := part["text"].(string); ok {
-							return text, nil
-						}
-					}
-				}
+	if text != "" && mode == ModeNote {
+		path, err := s.saveNote(text, time.Now())
+		if err != nil {
+			if s.OnError != nil {
+				s.OnError(fmt.Errorf("failed to save note: %w", err))
 			}
+			return
 		}
+		if s.OnNote != nil {
+			s.OnNote(path)
+		}
+		return
 	}
 
-	return "", nil
+	if text != "" {
+		var typed string
+		if s.Output != nil {
+			s.writeOutput(text)
+			typed = text
+		} else {
+			if segment <= 1 {
+				// Wait a bit for keys to be released
+				time.Sleep(200 * time.Millisecond)
+			} else {
+				// Separate the segments of a continuous recording.
+				text = " " + text
+			}
+			if segment == 0 {
+				typed = s.injectPaced(ctx, out, text)
+			} else {
+				// The microphone is still recording the next segment.
+				typed = s.inject(out, text, true)
+			}
+			s.setTyped(typed)
+		}
+
+		if s.Verifier != nil && !s.powerSaver(FeatureVerify) {
+			go s.verify(req, out, typed, historyID)
+		}
+	}
 }
 
-func compressToMP3(samples []int16, sampleRate int) ([]byte, error) {
-	cmd := exec.Command("ffmpeg", 
-		"-f", "s16le", 
-		"-ar", strconv.Itoa(sampleRate), 
-		"-ac", "1", 
-		"-i", "pipe:0", 
-		"-ar", "8000", // Downsample to 8kHz
-		"-f", "mp3", 
-		"-map_metadata", "-1", // Strip metadata
-		"-b:a", "8k", // 8kbps for maximum compression
-		"pipe:1")
-	
-	var out bytes.Buffer
-	var stderr bytes.Buffer
-	cmd.Stdout = &out
-	cmd.Stderr = &stderr
-	
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		return nil, err
+// transcribe runs req through the backend, streaming partial text to
+// OnPartial and LiveFile when the backend supports it.
+func (s *Service) transcribe(ctx context.Context, req Request) (Transcript, error) {
+	backend := s.backend(req)
+	_, structured := backend.(StructuredTranscriber)
+	structured = structured && s.Structured
+	if s.chunked(req) {
+		t, err := s.transcribeChunked(ctx, req)
+		if errors.Is(err, ErrPartial) {
+			return t, err
+		}
+		if err != nil {
+			return Transcript{}, err
+		}
+		if structured {
+			return s.accept(t), nil
+		}
+		if t.Text != "" {
+			s.appendLive(t.Text, true)
+		}
+		return t, nil
+	}
+
+	if structured {
+		t, err := backend.(StructuredTranscriber).TranscribeStructured(ctx, req)
+		if err != nil {
+			return Transcript{}, err
+		}
+		return s.accept(t), nil
 	}
-	
-	go func() {
-		defer stdin.Close()
-		// Convert []int16 to []byte (Little Endian)
-		buf := make([]byte, len(samples)*2)
-		for i, sample := range samples {
-			buf[i*2] = byte(sample)
-			buf[i*2+1] = byte(sample >> 8)
+
+	st, ok := backend.(StreamingTranscriber)
+	if !ok {
+		text, err := backend.Transcribe(ctx, req)
+		if err == nil && text != "" {
+			s.appendLive(text, true)
 		}
-		stdin.Write(buf)
-	}()
-	
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("ffmpeg error: %v, stderr: %s", err, stderr.String())
+		return Transcript{Text: text}, err
+	}
+
+	var sent string
+	text, err := st.TranscribeStream(ctx, req, func(partial string) {
+		if strings.HasPrefix(partial, sent) {
+			s.appendLive(partial[len(sent):], false)
+			sent = partial
+		}
+		if s.OnPartial != nil {
+			s.OnPartial(partial)
+		}
+	})
+	if err == nil && text != "" {
+		// Finish the live line with whatever was not streamed.
+		rest := ""
+		if strings.HasPrefix(text, sent) {
+			rest = text[len(sent):]
+		}
+		s.appendLive(rest, true)
 	}
-	
-	return out.Bytes(), nil
+	return Transcript{Text: text}, err
 }
 
-func encodeWAV(samples []int16, sampleRate int) ([]byte, error) {
-	buf := new(bytes.Buffer)
-
-	// WAV Header
-	// RIFF chunk
-	buf.WriteString("RIFF")
-	totalDataLen := len(samples) * 2
-	fileSize := 36 + totalDataLen
-	binary.Write(buf, binary.LittleEndian, int32(fileSize))
-	buf.WriteString("WAVE")
-
-	// fmt chunk
-	buf.WriteString("fmt ")
-	binary.Write(buf, binary.LittleEndian, int32(16)) // Chunk size
-	binary.Write(buf, binary.LittleEndian, int16(1))  // Audio format (1 = PCM)
-	binary.Write(buf, binary.LittleEndian, int16(1))  // Num channels
-	binary.Write(buf, binary.LittleEndian, int32(sampleRate))
-	byteRate := sampleRate * 1 * 16 / 8
-	binary.Write(buf, binary.LittleEndian, int32(byteRate))
-	blockAlign := 1 * 16 / 8
-	binary.Write(buf, binary.LittleEndian, int16(blockAlign))
-	binary.Write(buf, binary.LittleEndian, int16(16)) // Bits per sample
-
-	// data chunk
-	buf.WriteString("data")
-	binary.Write(buf, binary.LittleEndian, int32(totalDataLen))
-
-	// Write samples
-	for _, sample := range samples {
-		binary.Write(buf, binary.LittleEndian, sample)
-	}
-
-	return buf.Bytes(), nil
-}
\ No newline at end of file
+// accept vets a structured transcript with Accept and returns it, or an
+// empty one when it is rejected.
+func (s *Service) accept(t Transcript) Transcript {
+	if len(t.Segments) > 1 {
+		langs := make([]string, len(t.Segments))
+		for i, seg := range t.Segments {
+			langs[i] = seg.Language
+		}
+		log.Printf("Code-switched transcript: %s", strings.Join(langs, ", "))
+	}
+	if t.Text != "" && s.Accept != nil && !s.Accept(t) {
+		log.Printf("Transcript rejected (confidence %.2f, language %s)", t.Confidence, t.Language)
+		return Transcript{}
+	}
+	if t.Text != "" {
+		s.appendLive(t.Text, true)
+	}
+	return t
+}
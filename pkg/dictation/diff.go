@@ -0,0 +1,66 @@
+package dictation
+
+import "strings"
+
+// DiffKind says whether a run of words is in both texts or only one.
+type DiffKind int
+
+const (
+	DiffEqual  DiffKind = iota // In both texts
+	DiffDelete                 // Only in the old text
+	DiffInsert                 // Only in the new text
+)
+
+// DiffOp is a run of words in a word diff.
+type DiffOp struct {
+	Kind DiffKind
+	Text string
+}
+
+// DiffWords compares two transcripts word by word and returns the runs of
+// words that are unchanged, removed and added, in order. Whitespace
+// differences are ignored.
+func DiffWords(old, new string) []DiffOp {
+	a, b := strings.Fields(old), strings.Fields(new)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:]
+	// and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []DiffOp
+	add := func(kind DiffKind, word string) {
+		if n := len(ops); n > 0 && ops[n-1].Kind == kind {
+			ops[n-1].Text += " " + word
+			return
+		}
+		ops = append(ops, DiffOp{kind, word})
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			add(DiffEqual, a[i])
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			add(DiffDelete, a[i])
+			i++
+		default:
+			add(DiffInsert, b[j])
+			j++
+		}
+	}
+	return ops
+}
@@ -0,0 +1,174 @@
+package dictation
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// codec is an output encoding for uploads. FLAC is encoded natively,
+// everything else with ffmpeg.
+type codec struct {
+	name     string
+	mimeType string
+	args     []string
+}
+
+var (
+	codecFLAC     = codec{"flac", "audio/flac", []string{"-f", "flac"}}
+	codecMP3      = codec{"mp3", "audio/mp3", []string{"-f", "mp3", "-b:a", "32k"}}
+	codecOpus     = codec{"opus", "audio/ogg", []string{"-c:a", "libopus", "-b:a", "12k", "-application", "voip", "-f", "ogg"}}
+	codecTinyOpus = codec{"opus", "audio/ogg", []string{"-c:a", "libopus", "-b:a", "8k", "-application", "voip", "-f", "ogg"}}
+)
+
+// Compression is a preset for how recordings are compressed for upload.
+type Compression string
+
+const (
+	// CompressionBalanced picks the codec by recording length. It is the
+	// default.
+	CompressionBalanced Compression = "balanced"
+	// CompressionMaxQuality always uploads lossless FLAC, which helps soft
+	// or distant speakers at the cost of larger uploads.
+	CompressionMaxQuality Compression = "max_quality"
+	// CompressionTiny always uploads 8 kbps Opus, for slow or metered
+	// connections.
+	CompressionTiny Compression = "tiny"
+)
+
+// Validate reports an unknown compression preset.
+func (c Compression) Validate() error {
+	switch c {
+	case "", CompressionBalanced, CompressionMaxQuality, CompressionTiny:
+		return nil
+	}
+	return fmt.Errorf("unknown compression %q (use balanced, max_quality or tiny)", c)
+}
+
+// codecFor picks an encoding for a recording of length d with preset p.
+// Balanced sends short clips, which are small anyway, lossless for the
+// best accuracy, and long ones as low-bitrate Opus to keep the payload
+// down.
+func codecFor(d time.Duration, p Compression) codec {
+	switch {
+	case p == CompressionMaxQuality:
+		return codecFLAC
+	case p == CompressionTiny:
+		return codecTinyOpus
+	case d < time.Minute:
+		return codecFLAC
+	case d < 10*time.Minute:
+		return codecMP3
+	default:
+		return codecOpus
+	}
+}
+
+// encodeForUpload compresses samples with the codec preset p picks for
+// their length, or with FLAC if that needs ffmpeg and it is not installed.
+// It returns the audio and its MIME type.
+func encodeForUpload(samples []int16, p Compression) ([]byte, string, error) {
+	c := codecFor(time.Duration(len(samples))*time.Second/sampleRate, p)
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		c = codecFLAC
+	}
+	audio, err := encode(samples, c)
+	if err == nil {
+		return audio, c.mimeType, nil
+	}
+	log.Printf("%s encoding failed, sending WAV: %v", c.name, err)
+
+	audio, err = encodeWAV(samples, sampleRate)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode WAV: %w", err)
+	}
+	return audio, "audio/wav", nil
+}
+
+// encode compresses samples with codec c, in process for FLAC.
+func encode(samples []int16, c codec) ([]byte, error) {
+	if c.name == codecFLAC.name {
+		return encodeFLAC(samples, sampleRate)
+	}
+	return ffmpegEncode(samples, sampleRate, c)
+}
+
+// ffmpegEncode pipes samples through ffmpeg using codec c.
+func ffmpegEncode(samples []int16, sampleRate int, c codec) ([]byte, error) {
+	cmd := exec.Command("ffmpeg", ffmpegArgs(sampleRate, c)...)
+
+	var out bytes.Buffer
+	var stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(pcmBytes(samples))
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg error: %v, stderr: %s", err, stderr.String())
+	}
+
+	return out.Bytes(), nil
+}
+
+// ffmpegArgs are the arguments for ffmpeg to encode mono PCM from
+// standard input with codec c, to standard output.
+func ffmpegArgs(sampleRate int, c codec) []string {
+	args := []string{
+		"-f", "s16le",
+		"-ar", strconv.Itoa(sampleRate),
+		"-ac", "1",
+		"-i", "pipe:0",
+		"-map_metadata", "-1", // Strip metadata
+	}
+	args = append(args, c.args...)
+	return append(args, "pipe:1")
+}
+
+// pcmBytes converts samples to little-endian 16-bit PCM.
+func pcmBytes(samples []int16) []byte {
+	buf := make([]byte, len(samples)*2)
+	for i, sample := range samples {
+		buf[i*2] = byte(sample)
+		buf[i*2+1] = byte(sample >> 8)
+	}
+	return buf
+}
+
+func encodeWAV(samples []int16, sampleRate int) ([]byte, error) {
+	buf := new(bytes.Buffer)
+
+	// WAV Header
+	// RIFF chunk
+	buf.WriteString("RIFF")
+	totalDataLen := len(samples) * 2
+	fileSize := 36 + totalDataLen
+	binary.Write(buf, binary.LittleEndian, int32(fileSize))
+	buf.WriteString("WAVE")
+
+	// fmt chunk
+	buf.WriteString("fmt ")
+	binary.Write(buf, binary.LittleEndian, int32(16)) // Chunk size
+	binary.Write(buf, binary.LittleEndian, int16(1))  // Audio format (1 = PCM)
+	binary.Write(buf, binary.LittleEndian, int16(1))  // Num channels
+	binary.Write(buf, binary.LittleEndian, int32(sampleRate))
+	byteRate := sampleRate * 1 * 16 / 8
+	binary.Write(buf, binary.LittleEndian, int32(byteRate))
+	blockAlign := 1 * 16 / 8
+	binary.Write(buf, binary.LittleEndian, int16(blockAlign))
+	binary.Write(buf, binary.LittleEndian, int16(16)) // Bits per sample
+
+	// data chunk
+	buf.WriteString("data")
+	binary.Write(buf, binary.LittleEndian, int32(totalDataLen))
+
+	// Write samples
+	for _, sample := range samples {
+		binary.Write(buf, binary.LittleEndian, sample)
+	}
+
+	return buf.Bytes(), nil
+}
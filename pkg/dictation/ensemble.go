@@ -0,0 +1,260 @@
+package dictation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// unknownConfidence weighs the votes of backends that do not report a
+// confidence.
+const unknownConfidence = 0.5
+
+// Ensemble sends each recording to all of its backends at once and merges
+// their transcripts, trading cost and latency for accuracy. With three or
+// more transcripts every word is decided by a vote weighted by each
+// backend's confidence; with two, the more confident one wins.
+type Ensemble struct {
+	Backends []Transcriber
+	// Timeout bounds each backend's request, so a hung backend does not
+	// hold up the rest. Zero means no per-backend limit.
+	Timeout time.Duration
+}
+
+// NewEnsemble creates an ensemble of backends. Where it has to choose, an
+// earlier backend wins a tie.
+func NewEnsemble(backends ...Transcriber) *Ensemble {
+	return &Ensemble{Backends: backends}
+}
+
+// Transcribe implements Transcriber.
+func (e *Ensemble) Transcribe(ctx context.Context, r Request) (string, error) {
+	t, err := e.TranscribeStructured(ctx, r)
+	return t.Text, err
+}
+
+// TranscribeStructured implements StructuredTranscriber. Backends that
+// fail are left out of the vote; it only fails if all of them do.
+func (e *Ensemble) TranscribeStructured(ctx context.Context, r Request) (Transcript, error) {
+	if len(e.Backends) == 0 {
+		return Transcript{}, fmt.Errorf("no backends configured")
+	}
+	results := make([]Transcript, len(e.Backends))
+	errs := make([]error, len(e.Backends))
+	var wg sync.WaitGroup
+	for i, b := range e.Backends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = e.attempt(ctx, b, r)
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return Transcript{}, err
+	}
+
+	var ok []Transcript
+	failed := 0
+	for i, err := range errs {
+		switch {
+		case err != nil:
+			log.Printf("Ensemble backend %T failed: %v", e.Backends[i], err)
+			failed++
+		case results[i].Text != "":
+			ok = append(ok, results[i])
+		}
+	}
+	switch {
+	case failed == len(errs):
+		return Transcript{}, fmt.Errorf("all backends failed: %w", errors.Join(errs...))
+	case len(ok) == 0:
+		return Transcript{}, nil
+	}
+	return mergeEnsemble(ok), nil
+}
+
+func (e *Ensemble) attempt(ctx context.Context, b Transcriber, r Request) (Transcript, error) {
+	if e.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.Timeout)
+		defer cancel()
+	}
+	if sb, ok := b.(StructuredTranscriber); ok {
+		t, err := sb.TranscribeStructured(ctx, r)
+		t.Text = strings.TrimSpace(t.Text)
+		return t, err
+	}
+	text, err := b.Transcribe(ctx, r)
+	return Transcript{Text: strings.TrimSpace(text)}, err
+}
+
+// weight is how much a transcript's vote counts.
+func weight(t Transcript) float64 {
+	if t.Confidence > 0 {
+		return t.Confidence
+	}
+	return unknownConfidence
+}
+
+// mergeEnsemble merges transcripts in backend order. The most confident
+// one is the pivot the others are aligned to word by word; each of its
+// words is kept, replaced or dropped by weighted vote, and words the
+// others add are inserted if they carry the majority.
+func mergeEnsemble(ts []Transcript) Transcript {
+	pivot := 0
+	for i, t := range ts {
+		if weight(t) > weight(ts[pivot]) {
+			pivot = i
+		}
+	}
+	if len(ts) < 3 {
+		return ts[pivot]
+	}
+
+	words := make([][]string, len(ts))
+	norms := make([][]string, len(ts))
+	var total float64
+	for i, t := range ts {
+		words[i] = strings.Fields(t.Text)
+		norms[i] = make([]string, len(words[i]))
+		for j, w := range words[i] {
+			norms[i][j] = strings.Join(normalizeWords(w), "")
+		}
+		total += weight(t)
+	}
+
+	// slots[i][k] is the word of transcript i aligned with the pivot's
+	// k-th, or -1, and inserts[i][k] the words it has before it.
+	slots := make([][]int, len(ts))
+	inserts := make([][][]int, len(ts))
+	for i := range ts {
+		slots[i], inserts[i] = alignWords(norms[pivot], norms[i])
+	}
+
+	var out []string
+	vote := func(ballots map[string]*ballot) *ballot {
+		var best *ballot
+		for _, b := range ballots {
+			if best == nil || b.weight > best.weight || b.weight == best.weight && b.first < best.first {
+				best = b
+			}
+		}
+		return best
+	}
+	for k := 0; k <= len(norms[pivot]); k++ {
+		// Words inserted before the pivot's k-th word.
+		ballots := map[string]*ballot{}
+		for i := range ts {
+			var key, text []string
+			for _, j := range inserts[i][k] {
+				key, text = append(key, norms[i][j]), append(text, words[i][j])
+			}
+			ballots[strings.Join(key, " ")] = ballots[strings.Join(key, " ")].add(i, weight(ts[i]), strings.Join(text, " "))
+		}
+		if b := vote(ballots); b.text != "" && b.weight > total/2 {
+			out = append(out, b.text)
+		}
+		if k == len(norms[pivot]) {
+			break
+		}
+
+		// The pivot's k-th word itself.
+		ballots = map[string]*ballot{}
+		for i := range ts {
+			key, text := "", ""
+			if j := slots[i][k]; j >= 0 {
+				key, text = norms[i][j], words[i][j]
+			}
+			ballots[key] = ballots[key].add(i, weight(ts[i]), text)
+		}
+		if b := vote(ballots); b.text != "" {
+			out = append(out, b.text)
+		}
+	}
+
+	merged := ts[pivot]
+	merged.Text = strings.Join(out, " ")
+	merged.Segments = nil
+	return merged
+}
+
+// ballot is the votes for one word, or run of words, in a slot.
+type ballot struct {
+	weight float64
+	text   string  // As written by the most confident voter
+	top    float64 // That voter's weight
+	first  int     // First voter, for ties
+}
+
+// add returns b with a vote of weight w from transcript i, which wrote
+// text. b may be nil.
+func (b *ballot) add(i int, w float64, text string) *ballot {
+	if b == nil {
+		return &ballot{weight: w, text: text, top: w, first: i}
+	}
+	b.weight += w
+	if w > b.top {
+		b.text, b.top = text, w
+	}
+	return b
+}
+
+// alignWords aligns b to a with the fewest substitutions, insertions and
+// deletions. For each word of a it returns the index of the word of b
+// aligned with it, or -1, and for each position in a, up to len(a), the
+// indexes of the words b inserts before it.
+func alignWords(a, b []string) (slots []int, inserts [][]int) {
+	// cost[i][j] is the edit distance between a[i:] and b[j:].
+	cost := make([][]int, len(a)+1)
+	for i := range cost {
+		cost[i] = make([]int, len(b)+1)
+	}
+	for i := len(a); i >= 0; i-- {
+		for j := len(b); j >= 0; j-- {
+			switch {
+			case i == len(a):
+				cost[i][j] = len(b) - j
+			case j == len(b):
+				cost[i][j] = len(a) - i
+			default:
+				sub := cost[i+1][j+1]
+				if a[i] != b[j] {
+					sub++
+				}
+				cost[i][j] = min(sub, cost[i+1][j]+1, cost[i][j+1]+1)
+			}
+		}
+	}
+
+	slots = make([]int, len(a))
+	inserts = make([][]int, len(a)+1)
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && cost[i][j] == cost[i+1][j+1]+boolInt(a[i] != b[j]):
+			slots[i] = j
+			i++
+			j++
+		case i < len(a) && cost[i][j] == cost[i+1][j]+1:
+			slots[i] = -1
+			i++
+		default:
+			inserts[i] = append(inserts[i], j)
+			j++
+		}
+	}
+	return slots, inserts
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,40 @@
+package dictation
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// Gemini bills audio input at a flat 32 tokens per second.
+	audioTokensPerSecond = 32
+	// audioTokenPrice is the USD price per input audio token for modelName.
+	audioTokenPrice = 0.30 / 1e6
+)
+
+// Estimate describes the size and cost of a recording before it is sent.
+type Estimate struct {
+	Duration time.Duration
+	// Bytes is the uncompressed PCM size; the upload is usually smaller.
+	Bytes  int
+	Tokens int
+	// Cost is the approximate input cost in USD on Gemini.
+	Cost float64
+}
+
+func (e Estimate) String() string {
+	return fmt.Sprintf("%s of audio, %.1f MB, ~%d tokens, ~$%.4f",
+		e.Duration.Round(time.Second), float64(e.Bytes)/1e6, e.Tokens, e.Cost)
+}
+
+// EstimateCost estimates what transcribing samples will cost.
+func EstimateCost(samples []int16) Estimate {
+	d := time.Duration(len(samples)) * time.Second / sampleRate
+	tokens := int(d.Seconds() * audioTokensPerSecond)
+	return Estimate{
+		Duration: d,
+		Bytes:    len(samples) * 2,
+		Tokens:   tokens,
+		Cost:     float64(tokens) * audioTokenPrice,
+	}
+}
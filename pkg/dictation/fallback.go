@@ -0,0 +1,115 @@
+package dictation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+)
+
+// APIError is returned by HTTP-based backends when the server responds with
+// a non-200 status.
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error (status %d): %s", e.StatusCode, e.Body)
+}
+
+// Fallback tries each backend in order, retrying the same audio against the
+// next one when a backend is rate limited, fails with a 5xx or times out.
+type Fallback struct {
+	Backends []Transcriber
+	// Timeout bounds each attempt so a hung backend does not block the
+	// rest of the chain. Zero means no per-attempt limit.
+	Timeout time.Duration
+}
+
+// NewFallback creates a fallback chain over backends, in priority order.
+func NewFallback(backends ...Transcriber) *Fallback {
+	return &Fallback{Backends: backends}
+}
+
+// Transcribe implements Transcriber.
+func (f *Fallback) Transcribe(ctx context.Context, r Request) (string, error) {
+	return f.TranscribeStream(ctx, r, nil)
+}
+
+// TranscribeStream implements StreamingTranscriber, streaming from each
+// backend that supports it.
+func (f *Fallback) TranscribeStream(ctx context.Context, r Request, partial func(text string)) (string, error) {
+	if len(f.Backends) == 0 {
+		return "", fmt.Errorf("no backends configured")
+	}
+
+	var err error
+	for i, b := range f.Backends {
+		var text string
+		text, err = f.attempt(ctx, b, r, partial)
+		if err == nil {
+			return text, nil
+		}
+		if ctx.Err() != nil || !isTransient(err) {
+			return "", err
+		}
+		if i < len(f.Backends)-1 {
+			log.Printf("Backend %T failed (%v), falling back to %T", b, err, f.Backends[i+1])
+		}
+	}
+	return "", fmt.Errorf("all backends failed, last error: %w", err)
+}
+
+// Chapters implements Chapterizer with the first backend that does, falling
+// back to the next on transient failures like transcription. It returns
+// errors.ErrUnsupported if none does.
+func (f *Fallback) Chapters(ctx context.Context, passages []string) ([]ChapterBreak, error) {
+	err := errors.ErrUnsupported
+	for _, b := range f.Backends {
+		c, ok := b.(Chapterizer)
+		if !ok {
+			continue
+		}
+		breaks, cerr := c.Chapters(ctx, passages)
+		switch {
+		case cerr == nil:
+			return breaks, nil
+		case errors.Is(cerr, errors.ErrUnsupported):
+			continue
+		case ctx.Err() != nil || !isTransient(cerr):
+			return nil, cerr
+		}
+		err = cerr
+	}
+	return nil, err
+}
+
+func (f *Fallback) attempt(ctx context.Context, b Transcriber, r Request, partial func(string)) (string, error) {
+	if f.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.Timeout)
+		defer cancel()
+	}
+	if st, ok := b.(StreamingTranscriber); ok && partial != nil {
+		return st.TranscribeStream(ctx, r, partial)
+	}
+	return b.Transcribe(ctx, r)
+}
+
+// isTransient reports whether err is worth retrying, on the same or another
+// backend: rate limiting, server errors, timeouts and network failures.
+func isTransient(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
@@ -0,0 +1,85 @@
+package dictation
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+const (
+	// maxInlineBytes keeps inline audio under the 20 MB request limit with
+	// room for the prompt. Larger audio goes through the Files API.
+	maxInlineBytes = 18 << 20
+	// filePollInterval is how often an upload is checked until it is ready.
+	filePollInterval = time.Second
+)
+
+// withFiles returns contents with any inline data over maxInlineBytes
+// replaced by a Files API upload. Files belong to an API key, so client
+// must be the one that makes the request. cleanup deletes the uploads.
+func withFiles(ctx context.Context, client *genai.Client, contents []*genai.Content) ([]*genai.Content, func(), error) {
+	var uploaded []string
+	cleanup := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		for _, name := range uploaded {
+			if _, err := client.Files.Delete(ctx, name, nil); err != nil {
+				log.Printf("Failed to delete uploaded audio %s: %v", name, err)
+			}
+		}
+	}
+
+	out := make([]*genai.Content, len(contents))
+	for i, c := range contents {
+		parts := make([]*genai.Part, len(c.Parts))
+		for j, p := range c.Parts {
+			parts[j] = p
+			if p.InlineData == nil || len(p.InlineData.Data) <= maxInlineBytes {
+				continue
+			}
+			log.Printf("Uploading %.1f MB of audio via the Files API", float64(len(p.InlineData.Data))/1e6)
+			f, err := client.Files.Upload(ctx, bytes.NewReader(p.InlineData.Data), &genai.UploadFileConfig{
+				MIMEType: p.InlineData.MIMEType,
+			})
+			if err != nil {
+				cleanup()
+				return nil, nil, geminiError(err)
+			}
+			uploaded = append(uploaded, f.Name)
+			if f, err = waitActive(ctx, client, f); err != nil {
+				cleanup()
+				return nil, nil, err
+			}
+			parts[j] = genai.NewPartFromURI(f.URI, f.MIMEType)
+		}
+		out[i] = genai.NewContentFromParts(parts, genai.Role(c.Role))
+	}
+	return out, cleanup, nil
+}
+
+// waitActive polls an uploaded file until it has been processed.
+func waitActive(ctx context.Context, client *genai.Client, f *genai.File) (*genai.File, error) {
+	for f.State == genai.FileStateProcessing {
+		select {
+		case <-time.After(filePollInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		var err error
+		if f, err = client.Files.Get(ctx, f.Name, nil); err != nil {
+			return nil, geminiError(err)
+		}
+	}
+	if f.State == genai.FileStateFailed {
+		msg := "unknown error"
+		if f.Error != nil {
+			msg = f.Error.Message
+		}
+		return nil, fmt.Errorf("audio upload failed: %s", msg)
+	}
+	return f, nil
+}
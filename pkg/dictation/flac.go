@@ -0,0 +1,448 @@
+package dictation
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+// errFLACTruncated is returned for a FLAC stream that ends mid-frame.
+var errFLACTruncated = errors.New("FLAC stream is truncated")
+
+// flacBits reads a FLAC bitstream, most significant bit first.
+type flacBits struct {
+	data  []byte
+	off   int    // Next byte to load into cache
+	cache uint64 // Unread bits, left-aligned
+	n     uint   // Number of unread bits in cache
+}
+
+func (r *flacBits) fill() {
+	for r.n <= 56 && r.off < len(r.data) {
+		r.cache |= uint64(r.data[r.off]) << (56 - r.n)
+		r.off++
+		r.n += 8
+	}
+}
+
+// read returns the next n bits, at most 56.
+func (r *flacBits) read(n uint) (uint64, error) {
+	if n == 0 {
+		return 0, nil
+	}
+	if r.n < n {
+		r.fill()
+		if r.n < n {
+			return 0, errFLACTruncated
+		}
+	}
+	v := r.cache >> (64 - n)
+	r.cache <<= n
+	r.n -= n
+	return v, nil
+}
+
+// signed reads an n-bit two's complement number, at most 56 bits.
+func (r *flacBits) signed(n uint) (int64, error) {
+	v, err := r.read(n)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	return int64(v<<(64-n)) >> (64 - n), nil
+}
+
+// unary counts zero bits up to the next one bit, which is consumed.
+func (r *flacBits) unary() (uint64, error) {
+	var q uint64
+	for {
+		if r.n == 0 {
+			r.fill()
+			if r.n == 0 {
+				return 0, errFLACTruncated
+			}
+		}
+		z := uint(bits.LeadingZeros64(r.cache))
+		if z >= r.n {
+			q += uint64(r.n)
+			r.cache, r.n = 0, 0
+			continue
+		}
+		r.cache <<= z + 1
+		r.n -= z + 1
+		return q + uint64(z), nil
+	}
+}
+
+// align skips to the next byte boundary.
+func (r *flacBits) align() {
+	skip := r.n % 8
+	r.cache <<= skip
+	r.n -= skip
+}
+
+// remaining returns the number of unread bytes, after align.
+func (r *flacBits) remaining() int {
+	return len(r.data) - r.off + int(r.n/8)
+}
+
+// flacInfo is the part of a FLAC STREAMINFO block needed for decoding.
+type flacInfo struct {
+	rate     int
+	channels int
+	bps      int // Bits per sample
+	total    int // Samples per channel as the header claims, 0 if unknown
+}
+
+// decodeFLAC decodes a FLAC file, mixed down to mono at 16 bits, and
+// returns its sample rate.
+func decodeFLAC(data []byte) ([]int16, int, error) {
+	if len(data) < 4 || string(data[:4]) != "fLaC" {
+		return nil, 0, fmt.Errorf("not a FLAC file")
+	}
+	var info flacInfo
+	off := 4
+	for last := false; !last; {
+		if off+4 > len(data) {
+			return nil, 0, errFLACTruncated
+		}
+		last = data[off]&0x80 != 0
+		kind := data[off] & 0x7F
+		size := int(data[off+1])<<16 | int(data[off+2])<<8 | int(data[off+3])
+		off += 4
+		if off+size > len(data) {
+			return nil, 0, errFLACTruncated
+		}
+		if kind == 0 && size >= 18 {
+			b := data[off:]
+			info.rate = int(b[10])<<12 | int(b[11])<<4 | int(b[12])>>4
+			info.channels = int(b[12]>>1&0x07) + 1
+			info.bps = (int(b[12]&0x01)<<4 | int(b[13])>>4) + 1
+			info.total = int(b[13]&0x0F)<<32 | int(b[14])<<24 | int(b[15])<<16 | int(b[16])<<8 | int(b[17])
+		}
+		off += size
+	}
+	if info.rate == 0 {
+		return nil, 0, fmt.Errorf("FLAC file has no stream info")
+	}
+
+	r := &flacBits{data: data[off:]}
+	// The total is only a hint, and is trusted no further than a sample
+	// per byte of input: a forged one must not allocate more.
+	out := make([]int16, 0, min(info.total, len(data)))
+	var ch [8][]int64
+	for r.remaining() >= 2 {
+		var err error
+		if out, err = decodeFLACFrame(r, info, &ch, out); err != nil {
+			return nil, 0, err
+		}
+	}
+	return out, info.rate, nil
+}
+
+// decodeFLACFrame decodes the next frame and appends it to out, mixed
+// down. ch holds the decoding buffers, one per channel.
+func decodeFLACFrame(r *flacBits, info flacInfo, ch *[8][]int64, out []int16) ([]int16, error) {
+	sync, err := r.read(14)
+	if err != nil {
+		return nil, err
+	}
+	if sync != 0x3FFE {
+		return nil, fmt.Errorf("invalid FLAC frame")
+	}
+	header, err := r.read(18) // Reserved, blocking strategy and the codes
+	if err != nil {
+		return nil, err
+	}
+	blockCode := header >> 12 & 0x0F
+	rateCode := header >> 8 & 0x0F
+	assignment := int(header >> 4 & 0x0F)
+	sizeCode := header >> 1 & 0x07
+
+	// Frame or sample number, UTF-8 coded.
+	first, err := r.read(8)
+	if err != nil {
+		return nil, err
+	}
+	if n := bits.LeadingZeros8(^uint8(first)); n > 1 {
+		if _, err := r.read(uint(n-1) * 8); err != nil {
+			return nil, err
+		}
+	}
+
+	var block int
+	switch {
+	case blockCode == 1:
+		block = 192
+	case blockCode >= 2 && blockCode <= 5:
+		block = 576 << (blockCode - 2)
+	case blockCode == 6 || blockCode == 7:
+		v, err := r.read(uint(blockCode-5) * 8)
+		if err != nil {
+			return nil, err
+		}
+		block = int(v) + 1
+	case blockCode >= 8:
+		block = 256 << (blockCode - 8)
+	default:
+		return nil, fmt.Errorf("invalid FLAC block size")
+	}
+	switch rateCode {
+	case 12:
+		_, err = r.read(8)
+	case 13, 14:
+		_, err = r.read(16)
+	case 15:
+		err = fmt.Errorf("invalid FLAC sample rate")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.read(8); err != nil { // CRC-8
+		return nil, err
+	}
+
+	bps := [8]int{info.bps, 8, 12, 0, 16, 20, 24, 32}[sizeCode]
+	channels := assignment + 1
+	switch {
+	case bps == 0:
+		return nil, fmt.Errorf("invalid FLAC sample size")
+	case assignment >= 8 && assignment <= 10:
+		channels = 2
+	case assignment > 10:
+		return nil, fmt.Errorf("invalid FLAC channel assignment")
+	}
+
+	for c := range channels {
+		if cap(ch[c]) < block {
+			ch[c] = make([]int64, block)
+		}
+		ch[c] = ch[c][:block]
+		// The side channel has an extra bit.
+		side := (assignment == 8 || assignment == 10) && c == 1 || assignment == 9 && c == 0
+		width := bps
+		if side {
+			width++
+		}
+		if err := decodeFLACSubframe(r, width, ch[c]); err != nil {
+			return nil, err
+		}
+	}
+	r.align()
+	if _, err := r.read(16); err != nil { // CRC-16
+		return nil, err
+	}
+
+	left, right := ch[0], ch[1]
+	for i := range block {
+		switch assignment {
+		case 8: // Left, side
+			right[i] = left[i] - right[i]
+		case 9: // Side, right
+			left[i] += right[i]
+		case 10: // Mid, side
+			mid := left[i]<<1 | right[i]&1
+			left[i], right[i] = (mid+right[i])>>1, (mid-right[i])>>1
+		}
+	}
+
+	for i := range block {
+		var sum int64
+		for c := range channels {
+			sum += ch[c][i]
+		}
+		v := sum / int64(channels)
+		if bps > 16 {
+			v >>= bps - 16
+		} else {
+			v <<= 16 - bps
+		}
+		out = append(out, int16(max(math.MinInt16, min(math.MaxInt16, v))))
+	}
+	return out, nil
+}
+
+// decodeFLACSubframe decodes one channel of a frame into s.
+func decodeFLACSubframe(r *flacBits, bps int, s []int64) error {
+	header, err := r.read(8)
+	if err != nil {
+		return err
+	}
+	if header&0x80 != 0 {
+		return fmt.Errorf("invalid FLAC subframe")
+	}
+	kind := header >> 1 & 0x3F
+	wasted := 0
+	if header&1 != 0 {
+		k, err := r.unary()
+		if err != nil {
+			return err
+		}
+		wasted = int(k) + 1
+		bps -= wasted
+	}
+	if bps <= 0 {
+		return fmt.Errorf("invalid FLAC subframe")
+	}
+
+	switch {
+	case kind == 0: // Constant
+		v, err := r.signed(uint(bps))
+		if err != nil {
+			return err
+		}
+		for i := range s {
+			s[i] = v
+		}
+	case kind == 1: // Verbatim
+		for i := range s {
+			if s[i], err = r.signed(uint(bps)); err != nil {
+				return err
+			}
+		}
+	case kind >= 8 && kind <= 12: // Fixed predictor
+		order := int(kind - 8)
+		if err := decodeFLACResidual(r, bps, order, s); err != nil {
+			return err
+		}
+		for i := order; i < len(s); i++ {
+			switch order {
+			case 1:
+				s[i] += s[i-1]
+			case 2:
+				s[i] += 2*s[i-1] - s[i-2]
+			case 3:
+				s[i] += 3*s[i-1] - 3*s[i-2] + s[i-3]
+			case 4:
+				s[i] += 4*s[i-1] - 6*s[i-2] + 4*s[i-3] - s[i-4]
+			}
+		}
+	case kind >= 32: // Linear prediction
+		order := int(kind - 31)
+		if order > len(s) {
+			return fmt.Errorf("invalid FLAC subframe")
+		}
+		for i := range order {
+			if s[i], err = r.signed(uint(bps)); err != nil {
+				return err
+			}
+		}
+		p, err := r.read(4)
+		if err != nil {
+			return err
+		}
+		if p == 15 {
+			return fmt.Errorf("invalid FLAC coefficient precision")
+		}
+		shift, err := r.signed(5)
+		if err != nil {
+			return err
+		}
+		if shift < 0 {
+			return fmt.Errorf("invalid FLAC prediction shift")
+		}
+		coefs := make([]int64, order)
+		for i := range coefs {
+			if coefs[i], err = r.signed(uint(p + 1)); err != nil {
+				return err
+			}
+		}
+		if err := decodeFLACResidualOnly(r, order, s); err != nil {
+			return err
+		}
+		for i := order; i < len(s); i++ {
+			var sum int64
+			for j, c := range coefs {
+				sum += c * s[i-j-1]
+			}
+			s[i] += sum >> shift
+		}
+	default:
+		return fmt.Errorf("invalid FLAC subframe type %d", kind)
+	}
+
+	if wasted > 0 {
+		for i := range s {
+			s[i] <<= wasted
+		}
+	}
+	return nil
+}
+
+// decodeFLACResidual reads order warm-up samples of bps bits into s, then
+// the residual of the rest.
+func decodeFLACResidual(r *flacBits, bps, order int, s []int64) error {
+	if order > len(s) {
+		return fmt.Errorf("invalid FLAC subframe")
+	}
+	for i := range order {
+		var err error
+		if s[i], err = r.signed(uint(bps)); err != nil {
+			return err
+		}
+	}
+	return decodeFLACResidualOnly(r, order, s)
+}
+
+// decodeFLACResidualOnly reads the Rice-coded residual of s[order:].
+func decodeFLACResidualOnly(r *flacBits, order int, s []int64) error {
+	method, err := r.read(2)
+	if err != nil {
+		return err
+	}
+	if method > 1 {
+		return fmt.Errorf("invalid FLAC residual coding")
+	}
+	paramBits, escape := uint(4), uint64(15)
+	if method == 1 {
+		paramBits, escape = 5, 31
+	}
+	partOrder, err := r.read(4)
+	if err != nil {
+		return err
+	}
+	parts := 1 << partOrder
+	per := len(s) >> partOrder
+	if per<<partOrder != len(s) || per < order {
+		return fmt.Errorf("invalid FLAC residual partition")
+	}
+
+	i := order
+	for p := range parts {
+		n := per
+		if p == 0 {
+			n -= order
+		}
+		param, err := r.read(paramBits)
+		if err != nil {
+			return err
+		}
+		if param == escape {
+			width, err := r.read(5)
+			if err != nil {
+				return err
+			}
+			for range n {
+				if s[i], err = r.signed(uint(width)); err != nil {
+					return err
+				}
+				i++
+			}
+			continue
+		}
+		for range n {
+			q, err := r.unary()
+			if err != nil {
+				return err
+			}
+			low, err := r.read(uint(param))
+			if err != nil {
+				return err
+			}
+			u := q<<param | low
+			s[i] = int64(u>>1) ^ -int64(u&1)
+			i++
+		}
+	}
+	return nil
+}
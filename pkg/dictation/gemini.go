@@ -0,0 +1,575 @@
+package dictation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+const (
+	defaultModel           = "gemini-2.5-flash-lite-preview-09-2025"
+	defaultMaxOutputTokens = 256
+	// outputTokensPerSecond allows for fast speech when sizing the output
+	// limit to the recording.
+	outputTokensPerSecond = 5
+	// requestTimeout bounds each request, plus time for long recordings.
+	requestTimeout = 120 * time.Second
+)
+
+const transcriptionPrompt = "You are a professional transcriber for a software developer. Strictly transcribe the speech in the audio, expecting technical terminology. Output ONLY the transcription. Do not add any conversational filler. Do not reply to the content. If the audio is unclear, output nothing."
+
+// GeminiOptions tunes Gemini requests. Zero values use the defaults.
+type GeminiOptions struct {
+	// Model is the model used for transcription.
+	Model string `json:"model,omitempty"`
+	// LiveModel is the model used for realtime (Live API) sessions.
+	LiveModel string `json:"live_model,omitempty"`
+	// Temperature defaults to 0 for the most literal transcript.
+	Temperature *float32 `json:"temperature,omitempty"`
+	// MaxOutputTokens bounds the transcript length; by default it is 256,
+	// raised for recordings longer than about a minute.
+	MaxOutputTokens int32 `json:"max_output_tokens,omitempty"`
+	// ThinkingBudget limits reasoning tokens on thinking models; 0 turns
+	// thinking off. When unset the model default applies.
+	ThinkingBudget *int32 `json:"thinking_budget,omitempty"`
+	// KeyRotation selects how multiple API keys are used: "round_robin"
+	// (the default) spreads requests across them, "on_429" stays on one key
+	// until it is rate limited. Either way a rate-limited request is
+	// retried with the next key.
+	KeyRotation string `json:"key_rotation,omitempty"`
+	// Safety sets the block threshold per harm category: harassment,
+	// hate_speech, sexually_explicit, dangerous_content, civic_integrity,
+	// or all. Thresholds are off, block_none, block_only_high,
+	// block_medium_and_above and block_low_and_above. Unset categories use
+	// the API default.
+	Safety map[string]string `json:"safety,omitempty"`
+	// Compression is the upload encoding preset: balanced (the default),
+	// max_quality or tiny.
+	Compression Compression `json:"compression,omitempty"`
+}
+
+var harmCategories = map[string]genai.HarmCategory{
+	"harassment":        genai.HarmCategoryHarassment,
+	"hate_speech":       genai.HarmCategoryHateSpeech,
+	"sexually_explicit": genai.HarmCategorySexuallyExplicit,
+	"dangerous_content": genai.HarmCategoryDangerousContent,
+	"civic_integrity":   genai.HarmCategoryCivicIntegrity,
+}
+
+var harmThresholds = map[string]genai.HarmBlockThreshold{
+	"off":                    genai.HarmBlockThresholdOff,
+	"block_none":             genai.HarmBlockThresholdBlockNone,
+	"block_only_high":        genai.HarmBlockThresholdBlockOnlyHigh,
+	"block_medium_and_above": genai.HarmBlockThresholdBlockMediumAndAbove,
+	"block_low_and_above":    genai.HarmBlockThresholdBlockLowAndAbove,
+}
+
+// Validate reports invalid options.
+func (o GeminiOptions) Validate() error {
+	if err := o.Compression.Validate(); err != nil {
+		return err
+	}
+	_, err := o.safetySettings()
+	return err
+}
+
+// safetySettings converts Safety to request settings. A specific category
+// overrides "all".
+func (o GeminiOptions) safetySettings() ([]*genai.SafetySetting, error) {
+	if len(o.Safety) == 0 {
+		return nil, nil
+	}
+	thresholds := make(map[genai.HarmCategory]genai.HarmBlockThreshold)
+	if v, ok := o.Safety["all"]; ok {
+		t, ok := harmThresholds[strings.ToLower(v)]
+		if !ok {
+			return nil, fmt.Errorf("unknown safety threshold %q", v)
+		}
+		for _, c := range harmCategories {
+			thresholds[c] = t
+		}
+	}
+	for name, v := range o.Safety {
+		if name == "all" {
+			continue
+		}
+		c, ok := harmCategories[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown safety category %q", name)
+		}
+		t, ok := harmThresholds[strings.ToLower(v)]
+		if !ok {
+			return nil, fmt.Errorf("unknown safety threshold %q", v)
+		}
+		thresholds[c] = t
+	}
+
+	var settings []*genai.SafetySetting
+	for c, t := range thresholds {
+		settings = append(settings, &genai.SafetySetting{Category: c, Threshold: t})
+	}
+	return settings, nil
+}
+
+// Gemini transcribes audio with the Gemini API.
+type Gemini struct {
+	GeminiOptions
+	// Prompt replaces the built-in transcription instruction, e.g. to tune
+	// it for medical or legal dictation. It may use the {{app}},
+	// {{language}}, {{glossary}} and {{speaker}} placeholders.
+	Prompt string
+	// Usage, if set, records the tokens billed for each request.
+	Usage *UsageTracker
+
+	clients []*genai.Client // One per API key
+	next    atomic.Uint64   // Round-robin counter
+	current atomic.Uint64   // Key in use for "on_429" rotation
+}
+
+// NewGemini creates a Gemini transcriber using the given API keys,
+// connecting through n. With more than one key, requests rotate between
+// them per KeyRotation.
+func NewGemini(n Network, apiKeys ...string) (*Gemini, error) {
+	if len(apiKeys) == 0 {
+		return nil, fmt.Errorf("API key is required")
+	}
+	// Requests are bounded by HTTPOptions.Timeout instead, which can be
+	// raised per request for long recordings.
+	httpClient, err := n.httpClient(0)
+	if err != nil {
+		return nil, err
+	}
+
+	retry := &genai.HTTPRetryOptions{Attempts: genai.Ptr[int32](3)}
+	if len(apiKeys) > 1 {
+		// A rate-limited key is better skipped than retried.
+		retry.HTTPStatusCodes = []int32{408, 500, 502, 503, 504}
+	}
+
+	g := &Gemini{}
+	for _, key := range apiKeys {
+		if key == "" {
+			return nil, fmt.Errorf("API key is required")
+		}
+		client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
+			APIKey:     key,
+			Backend:    genai.BackendGeminiAPI,
+			HTTPClient: httpClient,
+			HTTPOptions: genai.HTTPOptions{
+				Timeout: genai.Ptr(requestTimeout),
+				// Retry 408, 429 and 5xx responses with exponential
+				// backoff, unless the service retries; see request.
+				RetryOptions: retry,
+			},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Gemini client: %w", err)
+		}
+		g.clients = append(g.clients, client)
+	}
+	return g, nil
+}
+
+// firstKey returns the index of the key to try first.
+func (g *Gemini) firstKey() int {
+	n := uint64(len(g.clients))
+	if g.KeyRotation == "on_429" {
+		return int(g.current.Load() % n)
+	}
+	return int((g.next.Add(1) - 1) % n)
+}
+
+// uploadCompression implements uploadEncoder.
+func (g *Gemini) uploadCompression() Compression {
+	return g.Compression
+}
+
+// maxOutputTokens implements outputLimiter.
+func (g *Gemini) maxOutputTokens() int {
+	return int(g.MaxOutputTokens)
+}
+
+// Ping implements Pinger by looking up the configured model.
+func (g *Gemini) Ping(ctx context.Context) error {
+	model := g.Model
+	if model == "" {
+		model = defaultModel
+	}
+	if _, err := g.clients[g.firstKey()].Models.Get(ctx, model, nil); err != nil {
+		return geminiError(err)
+	}
+	return nil
+}
+
+// CheckKeys verifies every API key by looking up the configured model.
+func (g *Gemini) CheckKeys(ctx context.Context) error {
+	model := g.Model
+	if model == "" {
+		model = defaultModel
+	}
+	for i, client := range g.clients {
+		if _, err := client.Models.Get(ctx, model, nil); err != nil {
+			if len(g.clients) > 1 {
+				return fmt.Errorf("API key %d: %w", i+1, geminiError(err))
+			}
+			return geminiError(err)
+		}
+	}
+	return nil
+}
+
+// withKeys calls fn with a client, moving on to the next key each time fn
+// fails with a rate limit (429).
+func (g *Gemini) withKeys(fn func(*genai.Client) error) error {
+	first := g.firstKey()
+	var err error
+	for i := range g.clients {
+		key := (first + i) % len(g.clients)
+		err = fn(g.clients[key])
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+			return err
+		}
+		if len(g.clients) > 1 {
+			log.Printf("Gemini API key %d is rate limited, trying the next key", key+1)
+		}
+		g.current.Store(uint64(key + 1))
+	}
+	return err
+}
+
+// Transcribe implements Transcriber.
+func (g *Gemini) Transcribe(ctx context.Context, r Request) (string, error) {
+	return g.TranscribeStream(ctx, r, nil)
+}
+
+// TranscribeStream implements StreamingTranscriber using
+// streamGenerateContent, so text arrives while the model is generating.
+func (g *Gemini) TranscribeStream(ctx context.Context, r Request, partial func(text string)) (string, error) {
+	model, contents, config, err := g.request(r)
+	if err != nil {
+		return "", err
+	}
+
+	var text strings.Builder
+	err = g.withKeys(func(client *genai.Client) error {
+		text.Reset()
+		contents, cleanup, err := withFiles(ctx, client, contents)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		var usage *genai.GenerateContentResponseUsageMetadata
+		defer func() { g.recordUsage(r.meta, model, usage) }()
+		for resp, err := range client.Models.GenerateContentStream(ctx, model, contents, config) {
+			if err != nil {
+				return geminiError(err)
+			}
+			if resp.UsageMetadata != nil {
+				usage = resp.UsageMetadata // Cumulative; the last chunk has the total
+			}
+			if err := blocked(resp); err != nil {
+				return err
+			}
+			chunk := resp.Text()
+			if chunk == "" {
+				continue
+			}
+			text.WriteString(chunk)
+			if partial != nil {
+				partial(text.String())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return text.String(), nil
+}
+
+// transcriptSchema is the response schema for TranscribeStructured.
+var transcriptSchema = &genai.Schema{
+	Type: genai.TypeObject,
+	Properties: map[string]*genai.Schema{
+		"text": {Type: genai.TypeString, Description: "The transcription, or an empty string if no speech is audible."},
+		"confidence": {
+			Type:        genai.TypeNumber,
+			Description: "How confident you are that the transcription is accurate, from 0 to 1.",
+			Minimum:     genai.Ptr[float64](0),
+			Maximum:     genai.Ptr[float64](1),
+		},
+		"language": {Type: genai.TypeString, Description: "BCP-47 code of the spoken language, e.g. en or de."},
+	},
+	Required:         []string{"text", "confidence", "language"},
+	PropertyOrdering: []string{"text", "confidence", "language"},
+}
+
+// codeSwitchSchema extends transcriptSchema with per-language segments.
+var codeSwitchSchema = &genai.Schema{
+	Type: genai.TypeObject,
+	Properties: map[string]*genai.Schema{
+		"text":       transcriptSchema.Properties["text"],
+		"confidence": transcriptSchema.Properties["confidence"],
+		"language":   {Type: genai.TypeString, Description: "BCP-47 code of the main spoken language, e.g. en or de."},
+		"segments": {
+			Type:        genai.TypeArray,
+			Description: "The transcription split into consecutive runs in one language, in order. Joined with spaces they form text.",
+			Items: &genai.Schema{
+				Type: genai.TypeObject,
+				Properties: map[string]*genai.Schema{
+					"text":     {Type: genai.TypeString},
+					"language": {Type: genai.TypeString, Description: "BCP-47 code of this run's language."},
+				},
+				Required:         []string{"text", "language"},
+				PropertyOrdering: []string{"text", "language"},
+			},
+		},
+	},
+	Required:         []string{"text", "confidence", "language", "segments"},
+	PropertyOrdering: []string{"text", "confidence", "language", "segments"},
+}
+
+// TranscribeStructured implements StructuredTranscriber by requesting a
+// JSON response with the confidence and detected language, and per-language
+// segments for code-switched requests.
+func (g *Gemini) TranscribeStructured(ctx context.Context, r Request) (Transcript, error) {
+	model, contents, config, err := g.request(r)
+	if err != nil {
+		return Transcript{}, err
+	}
+	config.ResponseMIMEType = "application/json"
+	config.ResponseSchema = transcriptSchema
+	if r.CodeSwitch {
+		config.ResponseSchema = codeSwitchSchema
+	}
+
+	var resp *genai.GenerateContentResponse
+	err = g.withKeys(func(client *genai.Client) error {
+		contents, cleanup, err := withFiles(ctx, client, contents)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		if resp, err = client.Models.GenerateContent(ctx, model, contents, config); err != nil {
+			return geminiError(err)
+		}
+		g.recordUsage(r.meta, model, resp.UsageMetadata)
+		return nil
+	})
+	if err != nil {
+		return Transcript{}, err
+	}
+	if err := blocked(resp); err != nil {
+		return Transcript{}, err
+	}
+	var t Transcript
+	if err := json.Unmarshal([]byte(resp.Text()), &t); err != nil {
+		return Transcript{}, fmt.Errorf("failed to decode response: %w", err)
+	}
+	t.Text = strings.TrimSpace(t.Text)
+	return t, nil
+}
+
+// chaptersPrompt asks for chapters of a transcript given as numbered
+// passages.
+const chaptersPrompt = "You divide long transcripts, such as podcasts, lectures and meetings, into chapters. The transcript is given as numbered passages in order. Group consecutive passages into chapters where the topic changes, typically a few minutes each, and give each chapter a short, descriptive title in the language of the transcript. Reply with the number of each chapter's first passage and its title; the first chapter starts at passage 0."
+
+// chaptersSchema is the response schema for Chapters.
+var chaptersSchema = &genai.Schema{
+	Type: genai.TypeArray,
+	Items: &genai.Schema{
+		Type: genai.TypeObject,
+		Properties: map[string]*genai.Schema{
+			"passage": {Type: genai.TypeInteger, Description: "Number of the chapter's first passage."},
+			"title":   {Type: genai.TypeString, Description: "Short title of the chapter."},
+		},
+		Required:         []string{"passage", "title"},
+		PropertyOrdering: []string{"passage", "title"},
+	},
+}
+
+// Chapters implements Chapterizer.
+func (g *Gemini) Chapters(ctx context.Context, passages []string) ([]ChapterBreak, error) {
+	var transcript strings.Builder
+	for i, p := range passages {
+		fmt.Fprintf(&transcript, "[%d] %s\n", i, p)
+	}
+	config := &genai.GenerateContentConfig{
+		SystemInstruction: genai.NewContentFromText(chaptersPrompt, genai.RoleUser),
+		Temperature:       g.temperature(),
+		ResponseMIMEType:  "application/json",
+		ResponseSchema:    chaptersSchema,
+	}
+	if g.ThinkingBudget != nil {
+		config.ThinkingConfig = &genai.ThinkingConfig{ThinkingBudget: g.ThinkingBudget}
+	}
+	var err error
+	if config.SafetySettings, err = g.safetySettings(); err != nil {
+		return nil, err
+	}
+	model := g.Model
+	if model == "" {
+		model = defaultModel
+	}
+	contents := []*genai.Content{genai.NewContentFromText(transcript.String(), genai.RoleUser)}
+
+	var resp *genai.GenerateContentResponse
+	err = g.withKeys(func(client *genai.Client) error {
+		var err error
+		if resp, err = client.Models.GenerateContent(ctx, model, contents, config); err != nil {
+			return geminiError(err)
+		}
+		g.recordUsage(nil, model, resp.UsageMetadata)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := blocked(resp); err != nil {
+		return nil, err
+	}
+	var breaks []ChapterBreak
+	if err := json.Unmarshal([]byte(resp.Text()), &breaks); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return breaks, nil
+}
+
+// request builds the model name, contents and generation config for r.
+func (g *Gemini) request(r Request) (string, []*genai.Content, *genai.GenerateContentConfig, error) {
+	audio, mimeType, err := r.upload(g.Compression)
+	if err != nil {
+		return "", nil, nil, err
+	}
+
+	contents := []*genai.Content{
+		genai.NewContentFromBytes(audio, mimeType, genai.RoleUser),
+	}
+	config := &genai.GenerateContentConfig{
+		SystemInstruction:  g.systemInstruction(r),
+		ResponseModalities: []string{"TEXT"},
+		Temperature:        g.temperature(),
+		// Leave room for long recordings.
+		MaxOutputTokens: max(defaultMaxOutputTokens, int32(len(r.Samples)/sampleRate*outputTokensPerSecond)),
+	}
+	if g.MaxOutputTokens > 0 {
+		config.MaxOutputTokens = g.MaxOutputTokens
+	}
+	if d := time.Duration(len(r.Samples)) * time.Second / sampleRate; d > 4*time.Minute {
+		// Uploading and transcribing takes longer the longer the audio.
+		config.HTTPOptions = &genai.HTTPOptions{Timeout: genai.Ptr(requestTimeout + d/2)}
+	}
+	if r.retried {
+		// The service retries, with every key; retrying here as well
+		// would multiply the attempts.
+		if config.HTTPOptions == nil {
+			config.HTTPOptions = &genai.HTTPOptions{}
+		}
+		config.HTTPOptions.RetryOptions = &genai.HTTPRetryOptions{Attempts: genai.Ptr[int32](1)}
+	}
+	if g.ThinkingBudget != nil {
+		config.ThinkingConfig = &genai.ThinkingConfig{ThinkingBudget: g.ThinkingBudget}
+	}
+	if config.SafetySettings, err = g.safetySettings(); err != nil {
+		return "", nil, nil, err
+	}
+
+	model := g.Model
+	if model == "" {
+		model = defaultModel
+	}
+	return model, contents, config, nil
+}
+
+func (g *Gemini) temperature() *float32 {
+	if g.Temperature != nil {
+		return g.Temperature
+	}
+	return genai.Ptr[float32](0)
+}
+
+// systemInstruction returns the transcription prompt for r. Unless the
+// prompt places them itself, the language, the speaker hints and a spelling
+// hint for the vocabulary are appended, along with r.Instructions.
+func (g *Gemini) systemInstruction(r Request) *genai.Content {
+	prompt := transcriptionPrompt
+	if g.Prompt != "" {
+		prompt = g.Prompt
+	}
+	switch {
+	case r.CodeSwitch:
+		prompt += " The speaker switches between languages, possibly mid-sentence. Transcribe every part verbatim in the language and script it is spoken in; never translate or normalize it into one language."
+		if r.Language != "" && !strings.Contains(prompt, placeholderLanguage) {
+			prompt += " The main language is " + placeholderLanguage + "."
+		}
+	case r.Translate != "":
+		if r.Language != "" && !strings.Contains(prompt, placeholderLanguage) {
+			prompt += " The speech is in " + placeholderLanguage + "."
+		}
+	case r.Language != "" && !strings.Contains(prompt, placeholderLanguage):
+		prompt += " The speech is in " + placeholderLanguage + "; transcribe it in that language without translating."
+	}
+	if r.Translate != "" {
+		prompt += " Then translate the transcript into " + r.Translate + " and reply with the translation only."
+	}
+	if r.Speaker != (SpeakerHints{}) && !strings.Contains(prompt, placeholderSpeaker) {
+		prompt += " " + placeholderSpeaker
+	}
+	if sentence := r.Script.sentence(); sentence != "" {
+		prompt += " " + sentence
+	}
+	if r.Instructions != "" {
+		prompt += " " + r.Instructions
+	}
+	if len(r.Vocabulary) > 0 && !strings.Contains(prompt, placeholderGlossary) {
+		prompt += " The speaker may mention the following names or terms; spell them exactly as written: " + placeholderGlossary + "."
+	}
+	return genai.NewContentFromText(expandPrompt(prompt, r), genai.RoleUser)
+}
+
+// recordUsage adds a response's token usage to Usage, and reports it to
+// meta if it is set.
+func (g *Gemini) recordUsage(meta *requestMeta, model string, m *genai.GenerateContentResponseUsageMetadata) {
+	if m == nil {
+		return
+	}
+	u := geminiUsage(m)
+	if g.Usage != nil {
+		g.Usage.Add(u)
+	}
+	meta.report(model, int(u.InputTokens), int(u.OutputTokens))
+}
+
+// blocked returns an error if resp was stopped by the safety filter, which
+// would otherwise look like silence.
+func blocked(resp *genai.GenerateContentResponse) error {
+	if fb := resp.PromptFeedback; fb != nil && fb.BlockReason != "" {
+		return fmt.Errorf("request blocked by Gemini (%s); adjust gemini.safety in the config", fb.BlockReason)
+	}
+	for _, c := range resp.Candidates {
+		switch c.FinishReason {
+		case genai.FinishReasonSafety, genai.FinishReasonProhibitedContent:
+			return fmt.Errorf("response blocked by Gemini (%s); adjust gemini.safety in the config", c.FinishReason)
+		}
+	}
+	return nil
+}
+
+// geminiError converts SDK API errors to *APIError so the fallback chain
+// can tell transient failures apart.
+func geminiError(err error) error {
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		return &APIError{StatusCode: apiErr.Code, Body: apiErr.Message}
+	}
+	return fmt.Errorf("request failed: %w", err)
+}
@@ -0,0 +1,89 @@
+package dictation
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LoadGlossary returns the terms in the user dictionary at path, which the
+// backends use to spell technical terms and names correctly. JSON files
+// hold a list of terms or an object with a "terms" list:
+//
+//	{"terms": ["kubectl", "Chrisper", "Siobhán"]}
+//
+// YAML files (.yaml or .yml) use the same layout, as a plain list of
+// "- term" lines, optionally under "terms:".
+func LoadGlossary(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var terms []string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		terms, err = parseYAMLList(string(data))
+	default:
+		terms, err = parseJSONTerms(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid glossary %s: %w", path, err)
+	}
+	return dedupe(terms), nil
+}
+
+func parseJSONTerms(data []byte) ([]string, error) {
+	var list []string
+	if err := json.Unmarshal(data, &list); err == nil {
+		return list, nil
+	}
+	var obj struct {
+		Terms []string `json:"terms"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return nil, err
+	}
+	return obj.Terms, nil
+}
+
+// parseYAMLList reads the "- item" entries of a YAML list, which is all a
+// glossary needs, without pulling in a YAML library.
+func parseYAMLList(data string) ([]string, error) {
+	var terms []string
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || line == "terms:" || line == "---":
+			continue
+		case strings.HasPrefix(line, "- "):
+			term := strings.TrimSpace(line[2:])
+			if i := strings.Index(term, " #"); i >= 0 {
+				term = strings.TrimSpace(term[:i])
+			}
+			terms = append(terms, strings.Trim(term, `"'`))
+		default:
+			return nil, fmt.Errorf("line %d: expected a \"- term\" list entry", n)
+		}
+	}
+	return terms, scanner.Err()
+}
+
+// dedupe drops empty and repeated entries, keeping the first occurrence.
+func dedupe(terms []string) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, t := range terms {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	return out
+}
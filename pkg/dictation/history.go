@@ -0,0 +1,232 @@
+package dictation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// historyIDFormat names history entries by the time they were recorded.
+const historyIDFormat = "20060102-150405"
+
+// HistoryEntry is a recording kept in HistoryDir with every transcript
+// made of it, oldest first.
+type HistoryEntry struct {
+	ID       string              `json:"id"`
+	At       time.Time           `json:"at"`
+	Mode     Mode                `json:"mode"`
+	App      string              `json:"app,omitempty"`
+	Duration time.Duration       `json:"duration"`
+	Tags     []string            `json:"tags,omitempty"`
+	Versions []TranscriptVersion `json:"versions"`
+}
+
+// Latest returns the most recent transcript of the recording.
+func (e HistoryEntry) Latest() TranscriptVersion {
+	if len(e.Versions) == 0 {
+		return TranscriptVersion{}
+	}
+	return e.Versions[len(e.Versions)-1]
+}
+
+// TranscriptVersion is one transcript of a recording.
+type TranscriptVersion struct {
+	At   time.Time `json:"at"`
+	Text string    `json:"text"`
+	// Backend is the speech backend that produced the text, e.g. "gemini".
+	Backend string `json:"backend"`
+	// Model is the model the backend used, if it reports it.
+	Model string `json:"model,omitempty"`
+	// Profile is the profile the recording was transcribed with.
+	Profile string `json:"profile,omitempty"`
+	// Reprocessed is set for transcripts made later with Reprocess.
+	Reprocessed bool `json:"reprocessed,omitempty"`
+	// Verified is set for transcripts by the Verifier that differed from
+	// the typed text.
+	Verified bool `json:"verified,omitempty"`
+}
+
+// backendName describes t for the history, e.g. "gemini" for *Gemini.
+func backendName(t Transcriber) string {
+	name := fmt.Sprintf("%T", t)
+	return strings.ToLower(name[strings.LastIndex(name, ".")+1:])
+}
+
+// saveHistory keeps a transcribed recording in HistoryDir.
+func (s *Service) saveHistory(mode Mode, req Request, p Profile, r Result, tags []string, at time.Time) (HistoryEntry, error) {
+	if err := os.MkdirAll(s.HistoryDir, 0700); err != nil {
+		return HistoryEntry{}, err
+	}
+	wav, err := encodeWAV(req.Samples, sampleRate)
+	if err != nil {
+		return HistoryEntry{}, fmt.Errorf("failed to encode WAV: %w", err)
+	}
+
+	// Two recordings within a second get a numbered ID.
+	id := at.Format(historyIDFormat)
+	for n := 2; ; n++ {
+		if _, err := os.Stat(filepath.Join(s.HistoryDir, id+".json")); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		id = fmt.Sprintf("%s-%d", at.Format(historyIDFormat), n)
+	}
+
+	e := HistoryEntry{
+		ID:       id,
+		At:       at,
+		Mode:     mode,
+		App:      req.App,
+		Duration: time.Duration(len(req.Samples)) * time.Second / sampleRate,
+		Tags:     tags,
+		Versions: []TranscriptVersion{{
+			At:      at,
+			Text:    r.Text,
+			Backend: r.Provider,
+			Model:   r.Model,
+			Profile: p.Name,
+		}},
+	}
+	if wav, err = seal(wav, s.HistoryKey); err != nil {
+		return HistoryEntry{}, err
+	}
+	if err := os.WriteFile(filepath.Join(s.HistoryDir, id+".wav"), wav, 0600); err != nil {
+		return HistoryEntry{}, err
+	}
+	if err := writeHistory(s.HistoryDir, s.HistoryKey, e); err != nil {
+		os.Remove(filepath.Join(s.HistoryDir, id+".wav"))
+		return HistoryEntry{}, err
+	}
+	return e, nil
+}
+
+// Reprocess transcribes a recording from the history again with the
+// current backend and settings and profile p, and adds the result to the
+// entry as a new version. Nothing is typed.
+func (s *Service) Reprocess(ctx context.Context, id string, p Profile) (TranscriptVersion, error) {
+	if s.HistoryDir == "" {
+		return TranscriptVersion{}, fmt.Errorf("history is not enabled")
+	}
+	e, err := LoadHistory(s.HistoryDir, s.HistoryKey, id)
+	if err != nil {
+		return TranscriptVersion{}, err
+	}
+	data, err := historyAudio(s.HistoryDir, s.HistoryKey, id)
+	if err != nil {
+		return TranscriptVersion{}, err
+	}
+	samples, err := decodeWAV(data, filepath.Join(s.HistoryDir, id+".wav"))
+	if err != nil {
+		return TranscriptVersion{}, err
+	}
+
+	r, err := s.transcribeWithRetry(ctx, s.request(samples, e.App, p))
+	if err != nil {
+		return TranscriptVersion{}, fmt.Errorf("transcription failed: %w", err)
+	}
+	v := TranscriptVersion{
+		At:          time.Now(),
+		Text:        r.Text,
+		Backend:     r.Provider,
+		Model:       r.Model,
+		Profile:     p.Name,
+		Reprocessed: true,
+	}
+	e.Versions = append(e.Versions, v)
+	return v, writeHistory(s.HistoryDir, s.HistoryKey, e)
+}
+
+// historyAudio reads the WAV file of the history entry id, decrypting it
+// with key if it is encrypted.
+func historyAudio(dir string, key *[32]byte, id string) ([]byte, error) {
+	path := filepath.Join(dir, id+".wav")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = unseal(data, key); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return data, nil
+}
+
+// addHistoryVersion records another transcript of the history entry id,
+// e.g. from the Verifier.
+func (s *Service) addHistoryVersion(id string, v TranscriptVersion) error {
+	e, err := LoadHistory(s.HistoryDir, s.HistoryKey, id)
+	if err != nil {
+		return err
+	}
+	e.Versions = append(e.Versions, v)
+	if err := writeHistory(s.HistoryDir, s.HistoryKey, e); err != nil {
+		return err
+	}
+	s.syncHistory()
+	return nil
+}
+
+// LoadHistory reads one history entry, decrypting it with key if it is
+// encrypted.
+func LoadHistory(dir string, key *[32]byte, id string) (HistoryEntry, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return HistoryEntry{}, fmt.Errorf("invalid history ID %q", id)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, id+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return HistoryEntry{}, fmt.Errorf("no recording %s in the history", id)
+	}
+	if err != nil {
+		return HistoryEntry{}, err
+	}
+	if data, err = unseal(data, key); err != nil {
+		return HistoryEntry{}, fmt.Errorf("history entry %s: %w", id, err)
+	}
+	var e HistoryEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return HistoryEntry{}, fmt.Errorf("invalid history entry %s: %w", id, err)
+	}
+	return e, nil
+}
+
+// ListHistory returns every entry in the history, newest first.
+func ListHistory(dir string, key *[32]byte) ([]HistoryEntry, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var entries []HistoryEntry
+	for _, path := range paths {
+		e, err := LoadHistory(dir, key, strings.TrimSuffix(filepath.Base(path), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(a, b HistoryEntry) int {
+		return b.At.Compare(a.At)
+	})
+	return entries, nil
+}
+
+// writeHistory atomically replaces an entry's metadata, encrypted with key
+// if it is set.
+func writeHistory(dir string, key *[32]byte, e HistoryEntry) error {
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	if data, err = seal(data, key); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, e.ID+".json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,160 @@
+package dictation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// HTTPConfig describes a custom speech-to-text endpoint.
+type HTTPConfig struct {
+	// URL is the endpoint. For the "openai" format this is the API base,
+	// e.g. http://localhost:8000/v1, and /audio/transcriptions is appended
+	// unless already present.
+	URL string `json:"url"`
+	// Format is "openai" (multipart upload, the default) or "raw" (WAV
+	// request body).
+	Format string `json:"format,omitempty"`
+	// Model is sent as the model form field in "openai" format.
+	Model string `json:"model,omitempty"`
+	// APIKey is substituted for {{api_key}} in Auth and Headers.
+	APIKey string `json:"api_key,omitempty"`
+	// Auth is the Authorization header template, e.g. "Bearer {{api_key}}".
+	Auth string `json:"auth,omitempty"`
+	// Headers are extra request headers; values may use {{api_key}}.
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// HTTPEndpoint transcribes audio with an OpenAI-compatible or custom HTTP
+// speech-to-text server, such as a self-hosted faster-whisper.
+type HTTPEndpoint struct {
+	cfg        HTTPConfig
+	httpClient *http.Client
+}
+
+// NewHTTPEndpoint creates a transcriber for the endpoint described by cfg,
+// connecting through n.
+func NewHTTPEndpoint(cfg HTTPConfig, n Network) (*HTTPEndpoint, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("endpoint URL is required")
+	}
+	switch cfg.Format {
+	case "":
+		cfg.Format = "openai"
+	case "openai", "raw":
+	default:
+		return nil, fmt.Errorf("unknown endpoint format %q", cfg.Format)
+	}
+	if cfg.Format == "openai" && !strings.HasSuffix(cfg.URL, "/audio/transcriptions") {
+		cfg.URL = strings.TrimRight(cfg.URL, "/") + "/audio/transcriptions"
+	}
+	httpClient, err := n.httpClient(120 * time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return &HTTPEndpoint{cfg: cfg, httpClient: httpClient}, nil
+}
+
+// Ping implements Pinger. Any response short of a server error means the
+// endpoint is reachable.
+func (h *HTTPEndpoint) Ping(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", h.cfg.URL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return &APIError{StatusCode: resp.StatusCode, Body: resp.Status}
+	}
+	return nil
+}
+
+// Transcribe implements Transcriber.
+func (h *HTTPEndpoint) Transcribe(ctx context.Context, r Request) (string, error) {
+	wav, err := encodeWAV(r.Samples, sampleRate)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode WAV: %w", err)
+	}
+
+	var body bytes.Buffer
+	contentType := "audio/wav"
+	if h.cfg.Format == "openai" {
+		mw := multipart.NewWriter(&body)
+		fw, err := mw.CreateFormFile("file", "audio.wav")
+		if err != nil {
+			return "", err
+		}
+		fw.Write(wav)
+		if h.cfg.Model != "" {
+			mw.WriteField("model", h.cfg.Model)
+		}
+		if len(r.Vocabulary) > 0 {
+			// Whisper uses the prompt as spelling context.
+			mw.WriteField("prompt", strings.Join(r.Vocabulary, ", "))
+		}
+		if r.Language != "" {
+			// OpenAI expects ISO-639-1.
+			mw.WriteField("language", baseLanguage(r.Language))
+		}
+		mw.WriteField("response_format", "json")
+		if err := mw.Close(); err != nil {
+			return "", err
+		}
+		contentType = mw.FormDataContentType()
+	} else {
+		body.Write(wav)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", h.cfg.URL, &body)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if h.cfg.Auth != "" {
+		req.Header.Set("Authorization", h.expand(h.cfg.Auth))
+	}
+	for k, v := range h.cfg.Headers {
+		req.Header.Set(k, h.expand(v))
+	}
+
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", &APIError{StatusCode: resp.StatusCode, Body: string(data)}
+	}
+	r.meta.report(h.cfg.Model, 0, 0)
+
+	// Accept both {"text": "..."} and plain-text responses.
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		var res struct {
+			Text string `json:"text"`
+		}
+		if err := json.Unmarshal(data, &res); err != nil {
+			return "", fmt.Errorf("failed to decode response: %w", err)
+		}
+		return strings.TrimSpace(res.Text), nil
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (h *HTTPEndpoint) expand(tmpl string) string {
+	return strings.ReplaceAll(tmpl, "{{api_key}}", h.cfg.APIKey)
+}
@@ -0,0 +1,31 @@
+//go:build darwin
+
+package dictation
+
+/*
+#cgo LDFLAGS: -framework Carbon
+
+#include <Carbon/Carbon.h>
+
+// chrisperInputMethodActive reports whether the current input source is an
+// input method mode rather than a plain keyboard layout.
+static int chrisperInputMethodActive(void) {
+	TISInputSourceRef source = TISCopyCurrentKeyboardInputSource();
+	if (source == NULL) {
+		return 0;
+	}
+	CFStringRef type = TISGetInputSourceProperty(source, kTISPropertyInputSourceType);
+	int active = type != NULL && CFEqual(type, kTISTypeKeyboardInputMode);
+	CFRelease(source);
+	return active;
+}
+*/
+import "C"
+
+const pasteModifier = "cmd"
+
+// inputMethodActive reports whether an input method such as Kotoeri or
+// Pinyin is the current input source.
+func inputMethodActive() bool {
+	return C.chrisperInputMethodActive() != 0
+}
@@ -0,0 +1,27 @@
+//go:build linux
+
+package dictation
+
+import (
+	"os/exec"
+	"strings"
+)
+
+const pasteModifier = "ctrl"
+
+// inputMethodActive reports whether fcitx is composing or IBus has a
+// non-keyboard engine selected. Neither running counts as inactive.
+func inputMethodActive() bool {
+	for _, name := range []string{"fcitx5-remote", "fcitx-remote"} {
+		// Prints 2 while an input method is active, 1 while it is off.
+		if out, err := exec.Command(name).Output(); err == nil {
+			return strings.TrimSpace(string(out)) == "2"
+		}
+	}
+	out, err := exec.Command("ibus", "engine").Output()
+	if err != nil {
+		return false
+	}
+	engine := strings.TrimSpace(string(out))
+	return engine != "" && !strings.HasPrefix(engine, "xkb:")
+}
@@ -0,0 +1,11 @@
+//go:build !darwin && !linux
+
+package dictation
+
+const pasteModifier = "ctrl"
+
+// inputMethodActive always reports false; use InjectPaste to paste with
+// an input method.
+func inputMethodActive() bool {
+	return false
+}
@@ -0,0 +1,115 @@
+package dictation
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-vgo/robotgo"
+)
+
+// Injection selects how transcripts are entered into the focused window.
+type Injection string
+
+const (
+	// InjectAuto pastes while an input method editor (e.g. for Chinese,
+	// Japanese or Korean) is active and for right-to-left text, and types
+	// otherwise. The default.
+	InjectAuto Injection = "auto"
+	// InjectType always sends the text as key presses.
+	InjectType Injection = "type"
+	// InjectPaste always pastes the text via the clipboard, which is
+	// quicker than typing long transcripts and reliable in apps that drop
+	// synthetic key presses, such as some Electron apps.
+	InjectPaste Injection = "paste"
+)
+
+const (
+	// pasteDelay gives the target app time to see the new clipboard
+	// contents before the paste shortcut arrives.
+	pasteDelay = 50 * time.Millisecond
+	// clipboardRestoreDelay gives the target app time to read a pasted
+	// transcript before the clipboard gets back what it held.
+	clipboardRestoreDelay = 300 * time.Millisecond
+)
+
+// Validate reports an unknown injection method.
+func (i Injection) Validate() error {
+	switch i {
+	case "", InjectAuto, InjectType, InjectPaste:
+		return nil
+	}
+	return fmt.Errorf("unknown injection %q (use auto, type or paste)", i)
+}
+
+// output is how the transcripts of a recording are entered, from the
+// service settings and the recording's profile, and when: after those of
+// the recordings before it.
+type output struct {
+	injection Injection
+	bidiMarks bool
+	turn      *turn // Waited for before delivering, if set
+}
+
+// output merges the service's and profile p's output settings.
+func (s *Service) output(p Profile) output {
+	o := output{injection: s.Injection, bidiMarks: s.BidiMarks || p.BidiMarks}
+	if p.Injection != "" {
+		o.injection = p.Injection
+	}
+	return o
+}
+
+// inject enters text into the focused window and returns what was entered.
+// An active input method would treat typed keys as composition input and
+// mangle the text, and some apps reorder right-to-left text typed one
+// character at a time, so in those cases it is pasted unless typing was
+// asked for. Streamed pieces of a transcript pass marks = false, as
+// direction marks only make sense around whole lines.
+func (s *Service) inject(o output, text string, marks bool) string {
+	if marks && o.bidiMarks {
+		text = addBidiMarks(text)
+	}
+	if !s.pastes(o, text) {
+		s.typeText(text)
+		return text
+	}
+	if err := paste(text); err != nil {
+		log.Printf("Failed to paste, typing instead: %v", err)
+		s.typeText(text)
+	}
+	return text
+}
+
+// paste enters text with the paste shortcut, then puts back the text the
+// clipboard held unless something else has been copied meanwhile. Other
+// clipboard contents, such as images, are not restored.
+func paste(text string) error {
+	prev, err := robotgo.ReadAll()
+	if err != nil {
+		prev = ""
+	}
+	if err := robotgo.WriteAll(text); err != nil {
+		return err
+	}
+	time.Sleep(pasteDelay)
+	robotgo.KeyTap("v", pasteModifier)
+	if prev == "" || prev == text {
+		return nil
+	}
+	time.Sleep(clipboardRestoreDelay)
+	if now, err := robotgo.ReadAll(); err == nil && now == text {
+		if err := robotgo.WriteAll(prev); err != nil {
+			log.Printf("Failed to restore the clipboard: %v", err)
+		}
+	}
+	return nil
+}
+
+// pastes reports whether inject pastes text rather than typing it.
+func (s *Service) pastes(o output, text string) bool {
+	if o.injection == "" || o.injection == InjectAuto {
+		return inputMethodActive() || isRTL(text)
+	}
+	return o.injection == InjectPaste
+}
@@ -0,0 +1,36 @@
+package dictation
+
+import "math"
+
+// levelInterval is how many samples each OnAudioLevel call covers, so it
+// is called 10 times a second.
+const levelInterval = sampleRate / 10
+
+// lowPowerLevelInterval replaces levelInterval while saving power, for
+// two calls a second.
+const lowPowerLevelInterval = sampleRate / 2
+
+// meter measures the input level reported to OnAudioLevel.
+type meter struct {
+	sum      float64
+	n        int
+	interval int // Samples per call; levelInterval if zero
+}
+
+// frame adds samples and calls fn with their RMS level, from 0 to 1,
+// every levelInterval samples.
+func (m *meter) frame(samples []int16, fn func(rms float64)) {
+	interval := m.interval
+	if interval == 0 {
+		interval = levelInterval
+	}
+	for _, s := range samples {
+		v := float64(s) / 32768
+		m.sum += v * v
+		m.n++
+		if m.n == interval {
+			fn(math.Sqrt(m.sum / float64(interval)))
+			m.sum, m.n = 0, 0
+		}
+	}
+}
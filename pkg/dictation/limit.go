@@ -0,0 +1,86 @@
+package dictation
+
+import (
+	"context"
+	"errors"
+)
+
+// Limit returns t with at most n requests in flight at once across all
+// callers, e.g. to stay under a provider's rate limit while many files and
+// chunks are transcribed in parallel. Streaming, structured transcription
+// and chapters are passed through when t supports them.
+func Limit(t Transcriber, n int) Transcriber {
+	l := &limited{t: t, slots: make(chan struct{}, n)}
+	if _, ok := t.(StructuredTranscriber); ok {
+		return &limitedStructured{l}
+	}
+	return l
+}
+
+type limited struct {
+	t     Transcriber
+	slots chan struct{}
+}
+
+func (l *limited) acquire(ctx context.Context) error {
+	select {
+	case l.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *limited) release() {
+	<-l.slots
+}
+
+// Transcribe implements Transcriber.
+func (l *limited) Transcribe(ctx context.Context, r Request) (string, error) {
+	if err := l.acquire(ctx); err != nil {
+		return "", err
+	}
+	defer l.release()
+	return l.t.Transcribe(ctx, r)
+}
+
+// TranscribeStream implements StreamingTranscriber, streaming only if the
+// wrapped backend does.
+func (l *limited) TranscribeStream(ctx context.Context, r Request, partial func(text string)) (string, error) {
+	st, ok := l.t.(StreamingTranscriber)
+	if !ok {
+		return l.Transcribe(ctx, r)
+	}
+	if err := l.acquire(ctx); err != nil {
+		return "", err
+	}
+	defer l.release()
+	return st.TranscribeStream(ctx, r, partial)
+}
+
+// Chapters implements Chapterizer if the wrapped backend does, and returns
+// errors.ErrUnsupported otherwise.
+func (l *limited) Chapters(ctx context.Context, passages []string) ([]ChapterBreak, error) {
+	c, ok := l.t.(Chapterizer)
+	if !ok {
+		return nil, errors.ErrUnsupported
+	}
+	if err := l.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer l.release()
+	return c.Chapters(ctx, passages)
+}
+
+type limitedStructured struct {
+	*limited
+}
+
+// TranscribeStructured implements StructuredTranscriber.
+func (l *limitedStructured) TranscribeStructured(ctx context.Context, r Request) (Transcript, error) {
+	if err := l.acquire(ctx); err != nil {
+		return Transcript{}, err
+	}
+	defer l.release()
+	return l.t.(StructuredTranscriber).TranscribeStructured(ctx, r)
+}
@@ -0,0 +1,245 @@
+package dictation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+const defaultLiveModel = "gemini-live-2.5-flash-preview"
+
+// liveFlushTimeout is how long to wait after the end of the audio for the
+// last transcription messages before closing a live session.
+const liveFlushTimeout = 2 * time.Second
+
+// LiveTranscriber is implemented by backends that transcribe audio while it
+// is still being recorded.
+type LiveTranscriber interface {
+	// StartLive opens a realtime session. emit receives each new piece of
+	// text as it is recognized.
+	StartLive(ctx context.Context, req Request, emit func(text string)) (LiveSession, error)
+}
+
+// LiveSession is a realtime transcription in progress.
+type LiveSession interface {
+	// Write sends samples as they are captured.
+	Write(samples []int16) error
+	// Close ends the audio stream, waits for the remaining text and returns
+	// the whole transcript.
+	Close() (string, error)
+}
+
+// StartLive implements LiveTranscriber with the Gemini Live API. Audio is
+// streamed over a websocket and the server's input transcription is
+// reported as it arrives.
+func (g *Gemini) StartLive(ctx context.Context, r Request, emit func(text string)) (LiveSession, error) {
+	model := g.LiveModel
+	if model == "" {
+		model = defaultLiveModel
+	}
+	transcription := &genai.AudioTranscriptionConfig{}
+	if r.Language != "" && !r.CodeSwitch {
+		transcription.LanguageCodes = []string{r.Language}
+	}
+	session, err := g.clients[g.firstKey()].Live.Connect(ctx, model, &genai.LiveConnectConfig{
+		ResponseModalities:      []genai.Modality{genai.ModalityText},
+		SystemInstruction:       g.systemInstruction(r),
+		InputAudioTranscription: transcription,
+		Temperature:             g.temperature(),
+	})
+	if err != nil {
+		return nil, geminiError(err)
+	}
+
+	l := &geminiLive{
+		session:  session,
+		emit:     emit,
+		received: make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	go l.receive()
+	return l, nil
+}
+
+type geminiLive struct {
+	session *genai.Session
+	emit    func(text string)
+
+	received chan struct{} // Signalled on every server message
+	done     chan struct{} // Closed when the receive loop exits
+
+	mu   sync.Mutex
+	text strings.Builder
+	err  error
+}
+
+func (l *geminiLive) receive() {
+	defer close(l.done)
+	for {
+		msg, err := l.session.Receive()
+		if err != nil {
+			l.mu.Lock()
+			l.err = err
+			l.mu.Unlock()
+			return
+		}
+		select {
+		case l.received <- struct{}{}:
+		default:
+		}
+
+		if msg.ServerContent == nil || msg.ServerContent.InputTranscription == nil {
+			continue
+		}
+		chunk := msg.ServerContent.InputTranscription.Text
+		l.mu.Lock()
+		if l.text.Len() == 0 {
+			chunk = strings.TrimLeft(chunk, " ")
+		}
+		l.text.WriteString(chunk)
+		l.mu.Unlock()
+		if chunk != "" && l.emit != nil {
+			l.emit(chunk)
+		}
+	}
+}
+
+// Write implements LiveSession.
+func (l *geminiLive) Write(samples []int16) error {
+	return l.session.SendRealtimeInput(genai.LiveRealtimeInput{
+		Audio: &genai.Blob{
+			Data:     pcmBytes(samples),
+			MIMEType: "audio/pcm;rate=16000",
+		},
+	})
+}
+
+// Close implements LiveSession.
+func (l *geminiLive) Close() (string, error) {
+	err := l.session.SendRealtimeInput(genai.LiveRealtimeInput{AudioStreamEnd: true})
+
+	// The server sends no explicit end of transcription, so wait until it
+	// goes quiet.
+	if err == nil {
+		idle := time.NewTimer(liveFlushTimeout)
+	flush:
+		for {
+			select {
+			case <-l.received:
+				idle.Reset(liveFlushTimeout)
+			case <-l.done:
+				break flush
+			case <-idle.C:
+				break flush
+			}
+		}
+		idle.Stop()
+	}
+
+	// A receive loop that exited before we closed the session lost its
+	// connection.
+	select {
+	case <-l.done:
+		l.mu.Lock()
+		if err == nil {
+			err = l.err
+		}
+		l.mu.Unlock()
+	default:
+	}
+	l.session.Close()
+	<-l.done
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err != nil {
+		return strings.TrimSpace(l.text.String()), geminiError(err)
+	}
+	return strings.TrimSpace(l.text.String()), nil
+}
+
+// startLive opens a live session for a new recording, or returns nil when
+// live mode is off or unsupported by the backend. The transcript so far
+// goes to words.
+func (s *Service) startLive(ctx context.Context, mode Mode, req Request, o output, words *wordMeter) LiveSession {
+	lt, ok := s.transcriber.(LiveTranscriber)
+	if !s.Live || !ok || mode == ModeCommand || mode == ModeCaption || mode == ModeCorrect || (mode == ModeDictate && s.Locked()) || s.powerSaver(FeatureLive) {
+		return nil
+	}
+
+	var sent strings.Builder
+	live, err := lt.StartLive(ctx, req, func(text string) {
+		sent.WriteString(text)
+		words.transcribed(sent.String())
+		s.appendLive(text, false)
+		if s.OnPartial != nil {
+			s.OnPartial(sent.String())
+		}
+		if mode == ModeDictate && s.Output == nil && s.OnTranscript == nil {
+			s.inject(o, text, false)
+		}
+	})
+	if err != nil {
+		// Record as usual and transcribe at the end instead.
+		log.Printf("Live session failed, falling back to batch: %v", err)
+		return nil
+	}
+	return live
+}
+
+// finishLive waits for the rest of a live transcript. Dictated text has
+// already been typed, unless it goes to Output or OnTranscript, which get
+// it now; notes are filed now that the transcript is complete.
+func (s *Service) finishLive(live LiveSession, mode Mode, o output) {
+	s.setStateUnlessRecording(StateProcessing)
+	if s.OnProcessing != nil {
+		s.OnProcessing()
+	}
+	text, err := live.Close()
+	if text != "" {
+		s.appendLive("", true)
+	}
+	if err != nil {
+		if s.OnError != nil {
+			s.OnError(fmt.Errorf("live transcription failed: %w", err))
+		}
+		return
+	}
+	if text == "" {
+		return
+	}
+
+	s.setLastTranscript(text)
+	if s.OnResult != nil {
+		s.OnResult(Result{Text: text, Provider: backendName(s.transcriber)})
+	}
+	if mode == ModeDictate && !s.Locked() {
+		switch {
+		case s.OnTranscript != nil && s.OnTranscript(text):
+		case s.Output != nil:
+			s.writeOutput(text)
+		case s.OnTranscript != nil:
+			// Held back while it streamed in, in case it was handled.
+			s.setTyped(s.inject(o, text, true))
+		default:
+			s.setTyped(text)
+		}
+	}
+	if mode == ModeNote {
+		path, err := s.saveNote(text, time.Now())
+		if err != nil {
+			if s.OnError != nil {
+				s.OnError(fmt.Errorf("failed to save note: %w", err))
+			}
+			return
+		}
+		if s.OnNote != nil {
+			s.OnNote(path)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package dictation
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// appendLive appends text to LiveFile so other programs can tail it.
+// Streaming backends append each new chunk as it arrives, and the final
+// call ends the line, giving one line per dictation.
+func (s *Service) appendLive(text string, final bool) {
+	if s.LiveFile == "" || (text == "" && !final) {
+		return
+	}
+	if final {
+		text += "\n"
+	}
+	if err := os.MkdirAll(filepath.Dir(s.LiveFile), 0755); err != nil {
+		log.Printf("Live file error: %v", err)
+		return
+	}
+	f, err := os.OpenFile(s.LiveFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		log.Printf("Live file error: %v", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.WriteString(text); err != nil {
+		log.Printf("Live file error: %v", err)
+	}
+}
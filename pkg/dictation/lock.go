@@ -0,0 +1,31 @@
+package dictation
+
+import (
+	"crypto/subtle"
+	"log"
+)
+
+// Lock puts the service in locked mode for shared machines: transcripts
+// are still produced and reported to OnResult, but nothing is typed into
+// other applications, auto-correct does not erase text, and reminders are
+// not created. Voice notes are still saved.
+func (s *Service) Lock() {
+	s.locked.Store(true)
+	log.Printf("Dictation locked")
+}
+
+// Unlock leaves locked mode. When PIN is set, pin must match it.
+func (s *Service) Unlock(pin string) bool {
+	if s.PIN != "" && subtle.ConstantTimeCompare([]byte(pin), []byte(s.PIN)) != 1 {
+		log.Printf("Unlock failed: wrong PIN")
+		return false
+	}
+	s.locked.Store(false)
+	log.Printf("Dictation unlocked")
+	return true
+}
+
+// Locked reports whether the service is in locked mode.
+func (s *Service) Locked() bool {
+	return s.locked.Load()
+}
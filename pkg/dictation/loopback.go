@@ -0,0 +1,93 @@
+package dictation
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// Capture is what a recording captures.
+type Capture string
+
+const (
+	CaptureMicrophone Capture = ""        // The microphone only
+	CaptureSystem     Capture = "system"  // What the computer plays
+	CaptureMeeting    Capture = "meeting" // The microphone and system audio mixed
+)
+
+// loopbackNames are parts of the names of common loopback devices, which
+// record what the computer plays, for finding one when LoopbackDevice is
+// unset.
+var loopbackNames = []string{"blackhole", "loopback", "soundflower", "monitor", "stereo mix"}
+
+// errNoLoopback explains how to get system audio when there is no
+// loopback device.
+var errNoLoopback = errors.New("no loopback device found for system audio; install one such as BlackHole on macOS or snd-aloop on Linux, and set loopback_device to it")
+
+// loopbackDevice finds the device named by LoopbackDevice, or else the
+// first input that looks like a loopback device.
+func (s *Service) loopbackDevice() (*portaudio.DeviceInfo, error) {
+	if s.LoopbackDevice != "" {
+		return findInput(s.LoopbackDevice)
+	}
+	inputs, err := inputs()
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range inputs {
+		name := strings.ToLower(d.Name)
+		for _, l := range loopbackNames {
+			if strings.Contains(name, l) {
+				return d, nil
+			}
+		}
+	}
+	return nil, errNoLoopback
+}
+
+// openInput opens what a recording with capture c records from: the
+// microphone, system audio from a loopback device, or both mixed.
+func (s *Service) openInput(c Capture) (*mic, error) {
+	switch c {
+	case CaptureMicrophone:
+		return s.openMic()
+	case CaptureSystem, CaptureMeeting:
+	default:
+		return nil, fmt.Errorf("unknown capture %q (want system or meeting)", c)
+	}
+	dev, err := s.loopbackDevice()
+	if err != nil {
+		return nil, err
+	}
+	if c == CaptureSystem {
+		m, err := openDevice(dev)
+		if err != nil {
+			return nil, err
+		}
+		m.capture = c
+		return m, nil
+	}
+
+	m, err := s.openMic()
+	if err != nil {
+		return nil, err
+	}
+	if m.mix, err = openDevice(dev); err != nil {
+		m.stream.Close()
+		return nil, fmt.Errorf("failed to open %s: %w", dev.Name, err)
+	}
+	m.capture = c
+	m.name += " and " + dev.Name
+	return m, nil
+}
+
+// mixInto adds src to dst, clipping at full scale.
+func mixInto(dst, src []int16) {
+	for i := range min(len(dst), len(src)) {
+		v := int32(dst[i]) + int32(src[i])
+		dst[i] = int16(max(math.MinInt16, min(math.MaxInt16, v)))
+	}
+}
@@ -0,0 +1,67 @@
+package dictation
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Network configures how the transcription backends reach their servers,
+// for corporate proxies and TLS-inspecting firewalls.
+type Network struct {
+	// Proxy is an http, https or socks5 proxy URL. When empty the standard
+	// HTTPS_PROXY, HTTP_PROXY and NO_PROXY variables apply.
+	Proxy string `json:"proxy,omitempty"`
+	// CACert is a PEM bundle trusted in addition to the system roots, e.g.
+	// the certificate of an inspecting firewall.
+	CACert string `json:"ca_cert,omitempty"`
+	// ClientCert and ClientKey are PEM files presented for mutual TLS.
+	ClientCert string `json:"client_cert,omitempty"`
+	ClientKey  string `json:"client_key,omitempty"`
+}
+
+// httpClient returns a client with the given timeout that uses n.
+func (n Network) httpClient(timeout time.Duration) (*http.Client, error) {
+	if n == (Network{}) {
+		return &http.Client{Timeout: timeout}, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if n.Proxy != "" {
+		proxy, err := url.Parse(n.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	tlsConfig := &tls.Config{}
+	if n.CACert != "" {
+		pem, err := os.ReadFile(n.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", n.CACert)
+		}
+		tlsConfig.RootCAs = roots
+	}
+	if n.ClientCert != "" || n.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(n.ClientCert, n.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
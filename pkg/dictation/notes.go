@@ -0,0 +1,50 @@
+package dictation
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// saveNote writes text to a new timestamped Markdown file in NotesDir and
+// returns its path. Notes from the same second get a numbered suffix,
+// e.g. 2006-01-02_150405-2.md.
+func (s *Service) saveNote(text string, at time.Time) (string, error) {
+	if s.NotesDir == "" {
+		return "", fmt.Errorf("notes directory is not configured")
+	}
+	if err := os.MkdirAll(s.NotesDir, 0755); err != nil {
+		return "", err
+	}
+
+	body := fmt.Sprintf("# %s\n\n%s\n", at.Format("2006-01-02 15:04:05"), strings.TrimSpace(text))
+	return writeNewFile(s.NotesDir, at.Format("2006-01-02_150405"), ".md", []byte(body))
+}
+
+// writeNewFile writes data to name+ext in dir, or to name-2+ext and so on
+// if that exists, and returns the path. Files are created exclusively, so
+// two writers never share one.
+func writeNewFile(dir, name, ext string, data []byte) (string, error) {
+	for n := 1; ; n++ {
+		path := filepath.Join(dir, name+ext)
+		if n > 1 {
+			path = filepath.Join(dir, fmt.Sprintf("%s-%d%s", name, n, ext))
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		if _, err := f.Write(data); err != nil {
+			f.Close()
+			return "", err
+		}
+		return path, f.Close()
+	}
+}
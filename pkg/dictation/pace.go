@@ -0,0 +1,215 @@
+package dictation
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/go-vgo/robotgo"
+)
+
+const (
+	// paceMinLength is the shortest transcript typed with pace control;
+	// shorter ones are over before anyone could say "hold".
+	paceMinLength = 200
+	// paceChunk is roughly how many characters are typed between checks
+	// for a hold.
+	paceChunk = 40
+	// paceSilence ends a spoken command.
+	paceSilence = 400 * time.Millisecond
+	// maxPaceWord is the longest utterance taken as a command, so speech
+	// that is not meant for Chrisper is not transcribed.
+	maxPaceWord = 1500 * time.Millisecond
+	// paceHoldTimeout gives up on a held transcript, copying what was not
+	// typed yet to the clipboard.
+	paceHoldTimeout = 2 * time.Minute
+)
+
+var errHoldTimeout = errors.New("held for too long")
+
+// pacer pauses typing between chunks while the user has said "hold".
+type pacer struct {
+	mu     sync.Mutex
+	held   bool
+	resume chan struct{} // Closed by "go"
+}
+
+func (p *pacer) hold() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.held {
+		return false
+	}
+	p.held = true
+	p.resume = make(chan struct{})
+	return true
+}
+
+func (p *pacer) release() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.held {
+		return false
+	}
+	p.held = false
+	close(p.resume)
+	return true
+}
+
+// wait returns once typing may go on.
+func (p *pacer) wait(ctx context.Context) error {
+	p.mu.Lock()
+	held, resume := p.held, p.resume
+	p.mu.Unlock()
+	if !held {
+		return nil
+	}
+	select {
+	case <-resume:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(paceHoldTimeout):
+		return errHoldTimeout
+	}
+}
+
+// injectPaced enters a transcript like inject, but with PaceControl long
+// transcripts are typed a few words at a time while the microphone
+// listens for a spoken "hold" and "go", so typing can be paused when the
+// target app falls behind. It returns what was typed.
+func (s *Service) injectPaced(ctx context.Context, o output, text string) string {
+	if !s.PaceControl || len(text) < paceMinLength {
+		return s.inject(o, text, true)
+	}
+	if o.bidiMarks {
+		text = addBidiMarks(text)
+	}
+	if s.pastes(o, text) {
+		return s.inject(o, text, false)
+	}
+
+	p := &pacer{}
+	stop := s.listenForPace(ctx, p)
+	defer stop()
+
+	var typed strings.Builder
+	for chunk := range chunks(text, paceChunk) {
+		if err := p.wait(ctx); err != nil {
+			rest := text[typed.Len():]
+			log.Printf("Typing stopped (%v), copying the rest to the clipboard", err)
+			if err := robotgo.WriteAll(rest); err != nil {
+				log.Printf("Failed to copy to clipboard: %v", err)
+			}
+			break
+		}
+		s.typeText(chunk)
+		typed.WriteString(chunk)
+	}
+	return typed.String()
+}
+
+// chunks splits text into pieces of about n bytes that end after a space.
+func chunks(text string, n int) func(yield func(string) bool) {
+	return func(yield func(string) bool) {
+		for len(text) > n {
+			i := strings.IndexByte(text[n:], ' ')
+			if i < 0 {
+				break
+			}
+			if !yield(text[:n+i+1]) {
+				return
+			}
+			text = text[n+i+1:]
+		}
+		if text != "" {
+			yield(text)
+		}
+	}
+}
+
+// listenForPace records short utterances until stop is called and holds or
+// releases p when they are "hold" or "go".
+func (s *Service) listenForPace(ctx context.Context, p *pacer) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m, err := s.openMic()
+		if err != nil {
+			log.Printf("Pace control unavailable: %v", err)
+			return
+		}
+		defer m.stream.Close()
+		if err := m.stream.Start(); err != nil {
+			log.Printf("Pace control unavailable: %v", err)
+			return
+		}
+		defer m.stream.Stop()
+
+		gain := s.newAGC()
+		detector := &vad{}
+		var audio []int16
+		for ctx.Err() == nil {
+			samples, err := m.Read()
+			if err != nil {
+				log.Printf("PortAudio read error: %v", err)
+				return
+			}
+			audio = gain.process(samples, audio)
+			detector.frame(audio[len(audio)-len(samples):])
+			switch {
+			case detector.heard && detector.silence >= paceSilence:
+				if detector.voiced >= minUtterance && detector.voiced <= maxPaceWord {
+					s.paceCommand(ctx, p, audio)
+				}
+				audio = nil
+				detector.reset()
+			case !detector.heard && len(audio) > segmentPreRoll:
+				audio = append(audio[:0], audio[len(audio)-segmentPreRoll:]...)
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// paceCommand transcribes a short utterance and acts on it if it is
+// "hold" or "go".
+func (s *Service) paceCommand(ctx context.Context, p *pacer, audio []int16) {
+	if !s.allowRequest() {
+		return
+	}
+	text, err := s.transcriber.Transcribe(ctx, Request{Samples: audio, Language: s.Language})
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("Pace control: %v", err)
+		}
+		return
+	}
+	word := strings.Join(strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}), " ")
+	switch word {
+	case "hold", "hold on", "wait", "pause":
+		if p.hold() {
+			log.Printf("Typing held")
+			if s.OnHold != nil {
+				s.OnHold(true)
+			}
+		}
+	case "go", "go on", "continue", "resume":
+		if p.release() {
+			log.Printf("Typing resumed")
+			if s.OnHold != nil {
+				s.OnHold(false)
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package dictation
+
+import (
+	"log"
+	"slices"
+	"time"
+
+	"chrisper/pkg/power"
+)
+
+// Features that a PowerPolicy scales back while saving power.
+const (
+	FeatureLive      = "live"      // Live streaming; recordings are sent when they end
+	FeatureVerify    = "verify"    // Background verification by the Verifier
+	FeaturePreRecord = "prerecord" // The pre-record buffer, which keeps the microphone open
+	FeatureWakeWord  = "wake_word" // Listening for a wake word; see SavingPower
+	FeatureMeter     = "meter"     // Full rate OnAudioLevel; it is called twice a second instead
+)
+
+// powerCheckInterval is how long a power state reading is reused.
+const powerCheckInterval = 30 * time.Second
+
+// PowerPolicy selects lighter behaviour on battery or in low power mode.
+type PowerPolicy struct {
+	// When is "auto" (the default: on battery or in low power mode),
+	// "always" or "never".
+	When string `json:"when,omitempty"`
+	// Keep lists features to leave on while saving power, e.g. ["live"].
+	Keep []string `json:"keep,omitempty"`
+}
+
+// SavingPower reports whether feature should be skipped to save power,
+// for features run on top of the service such as FeatureWakeWord.
+// OnPowerSaving tells when the answer may have changed.
+func (s *Service) SavingPower(feature string) bool {
+	return s.powerSaver(feature)
+}
+
+// powerSaver reports whether feature should be skipped to save power.
+func (s *Service) powerSaver(feature string) bool {
+	if slices.Contains(s.Power.Keep, feature) {
+		return false
+	}
+	switch s.Power.When {
+	case "never":
+		return false
+	case "always":
+		return true
+	}
+	saving, changed := s.readPower(powerCheckInterval)
+	if changed {
+		go s.powerChanged(saving)
+	}
+	return saving
+}
+
+// readPower reads the power state unless the last reading is younger
+// than maxAge, and reports whether energy is being saved and whether that
+// changed.
+func (s *Service) readPower(maxAge time.Duration) (saving, changed bool) {
+	s.powerMu.Lock()
+	defer s.powerMu.Unlock()
+	if time.Since(s.powerRead) > maxAge {
+		saving := power.Read().Saving()
+		if saving != s.powerSaving {
+			log.Printf("Power saving: %v", saving)
+			changed = !s.powerRead.IsZero()
+		}
+		s.powerSaving = saving
+		s.powerRead = time.Now()
+	}
+	return s.powerSaving, changed
+}
+
+// watchPower reads the power state every powerCheckInterval until the
+// service is closed, so features that run while idle are paused and
+// resumed when saving starts and ends.
+func (s *Service) watchPower() {
+	switch s.Power.When {
+	case "never", "always":
+		return
+	}
+	t := time.NewTicker(powerCheckInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+		}
+		if saving, changed := s.readPower(0); changed {
+			s.powerChanged(saving)
+		}
+	}
+}
+
+// powerChanged pauses or resumes the pre-record buffer when saving power
+// starts or ends, and tells OnPowerSaving.
+func (s *Service) powerChanged(saving bool) {
+	if saving && s.powerSaver(FeaturePreRecord) {
+		s.pausePreRecord()
+	} else if !saving {
+		s.resumePreRecord()
+	}
+	if s.OnPowerSaving != nil {
+		s.OnPowerSaving(saving)
+	}
+}
@@ -0,0 +1,194 @@
+package dictation
+
+import (
+	"context"
+	"log"
+	"slices"
+)
+
+// ring keeps the most recent samples written to it.
+type ring struct {
+	buf  []int16
+	next int  // Where the next sample goes
+	full bool // buf has wrapped around at least once
+}
+
+func newRing(n int) *ring {
+	return &ring{buf: make([]int16, n)}
+}
+
+func (r *ring) write(samples []int16) {
+	for len(samples) > 0 {
+		n := copy(r.buf[r.next:], samples)
+		samples = samples[n:]
+		r.next += n
+		if r.next == len(r.buf) {
+			r.next = 0
+			r.full = true
+		}
+	}
+}
+
+// samples returns a copy of the buffered samples, oldest first.
+func (r *ring) samples() []int16 {
+	if !r.full {
+		return slices.Clone(r.buf[:r.next])
+	}
+	out := make([]int16, 0, len(r.buf))
+	out = append(out, r.buf[r.next:]...)
+	return append(out, r.buf[:r.next]...)
+}
+
+func (r *ring) reset() {
+	r.next = 0
+	r.full = false
+}
+
+// StartPreRecord keeps the last PreRecord of microphone audio in memory
+// whenever nothing is being recorded, for TranscribeRecent. The microphone
+// stays open, so audio standby does not apply. It is paused while the
+// system sleeps or the screen is locked. Call it once.
+func (s *Service) StartPreRecord() {
+	if s.PreRecord <= 0 {
+		return
+	}
+	s.preMu.Lock()
+	s.preRing = newRing(int(s.PreRecord.Seconds() * sampleRate))
+	s.preMu.Unlock()
+	log.Printf("Keeping the last %s of audio", s.PreRecord)
+	s.resumePreRecord()
+}
+
+// TranscribeRecent transcribes the audio kept by StartPreRecord, what was
+// said just before, and delivers it like a dictation unless ctx is done
+// first. It does nothing while recording.
+func (s *Service) TranscribeRecent(ctx context.Context) {
+	s.mu.Lock()
+	if s.isRecording || s.asleep || s.screenLocked {
+		s.mu.Unlock()
+		return
+	}
+	p := s.withDefault(Profile{})
+	ctx, cancel := context.WithCancel(ctx)
+	s.recordCtx, s.cancelRecord = ctx, cancel
+	t := s.nextTurnLocked(cancel)
+	s.mu.Unlock()
+
+	s.preMu.Lock()
+	var audio []int16
+	if s.preRing != nil {
+		audio = s.preRing.samples()
+		s.preRing.reset()
+	}
+	s.preMu.Unlock()
+	detector := &vad{}
+	for frame := range slices.Chunk(audio, audioBufferSize) {
+		detector.frame(frame)
+	}
+	if detector.voiced < minUtterance {
+		log.Printf("No recent speech to transcribe")
+		cancel()
+		s.endTurn(t)
+		return
+	}
+
+	go func() {
+		defer func() {
+			if s.OnFinish != nil {
+				s.OnFinish()
+			}
+			cancel()
+			s.endTurn(t)
+		}()
+		out := s.output(p)
+		out.turn = t
+		s.process(ctx, ModeDictate, p, out, activeApp(), audio, nil, 0)
+	}()
+}
+
+// resumePreRecord starts filling the pre-record buffer, unless it is
+// already or something else is recording.
+func (s *Service) resumePreRecord() {
+	s.preMu.Lock()
+	defer s.preMu.Unlock()
+	if s.preRing == nil || s.preStop != nil || s.powerSaver(FeaturePreRecord) {
+		return
+	}
+	select {
+	case <-s.done:
+		return
+	default:
+	}
+	// Checked with preMu held, so a recording starting now pauses what is
+	// started here.
+	s.mu.Lock()
+	busy := s.isRecording || s.asleep || s.screenLocked
+	s.mu.Unlock()
+	if busy {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	s.preStop = func() {
+		cancel()
+		<-done
+	}
+	s.preRun++
+	run := s.preRun
+	go func() {
+		defer close(done)
+		defer func() {
+			// Stopped by a failure rather than pausePreRecord: let
+			// the next resumePreRecord open the microphone again.
+			s.preMu.Lock()
+			if s.preRun == run && ctx.Err() == nil {
+				s.preStop = nil
+			}
+			s.preMu.Unlock()
+			cancel()
+		}()
+		if err := s.acquireAudio(); err != nil {
+			log.Printf("Pre-record unavailable: %v", err)
+			return
+		}
+		defer s.releaseAudio()
+		m, err := s.openMic()
+		if err != nil {
+			log.Printf("Pre-record unavailable: %v", err)
+			return
+		}
+		defer m.stream.Close()
+		if err := m.stream.Start(); err != nil {
+			log.Printf("Pre-record unavailable: %v", err)
+			return
+		}
+		defer m.stream.Stop()
+
+		gain := s.newAGC()
+		var frame []int16
+		for ctx.Err() == nil {
+			samples, err := m.Read()
+			if err != nil {
+				log.Printf("Pre-record stopped: %v", err)
+				return
+			}
+			frame = gain.process(samples, frame[:0])
+			s.preMu.Lock()
+			s.preRing.write(frame)
+			s.preMu.Unlock()
+		}
+	}()
+}
+
+// pausePreRecord stops filling the pre-record buffer and waits until the
+// microphone is closed. What was buffered is kept.
+func (s *Service) pausePreRecord() {
+	s.preMu.Lock()
+	stop := s.preStop
+	s.preStop = nil
+	s.preMu.Unlock()
+	if stop != nil {
+		stop()
+	}
+}
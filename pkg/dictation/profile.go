@@ -0,0 +1,94 @@
+package dictation
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// LanguageAuto asks the backend to detect the spoken language.
+const LanguageAuto = "auto"
+
+// Profile overrides service settings for a recording, e.g. one started
+// from a dedicated hotkey. Empty fields keep the service setting.
+type Profile struct {
+	Name string `json:"-"`
+	// Language is a BCP-47 code such as "de" or "pt-BR", or "auto".
+	Language string `json:"language,omitempty"`
+	// CodeSwitch turns on code-switched transcription for the recording.
+	CodeSwitch bool `json:"code_switch,omitempty"`
+	// Script is native, roman or both.
+	Script Script `json:"script,omitempty"`
+	// Injection overrides how transcripts are entered: auto, type or paste.
+	Injection Injection `json:"injection,omitempty"`
+	// BidiMarks adds direction marks to right-to-left transcripts.
+	BidiMarks bool `json:"bidi_marks,omitempty"`
+	// Continuous keeps listening until the recording is stopped,
+	// transcribing and delivering each utterance as soon as the speaker
+	// pauses.
+	Continuous bool `json:"continuous,omitempty"`
+	// AutoStopAfter replaces the service's AutoStopAfter for the
+	// recording, e.g. for one started by voice.
+	AutoStopAfter time.Duration `json:"-"`
+	// Translate translates transcripts into this language, a BCP-47 code
+	// such as "de". Only Gemini translates.
+	Translate string `json:"translate,omitempty"`
+	// Capture records system audio or a meeting instead of only the
+	// microphone; see LoopbackDevice.
+	Capture Capture `json:"capture,omitempty"`
+	// Tags are added to the history entry of every recording made with the
+	// profile, e.g. ["work"].
+	Tags []string `json:"tags,omitempty"`
+
+	backend Transcriber // Replaces the service's backend; see TranscribeLast
+}
+
+// Toggle starts or stops a recording in mode with the overrides in p. ctx
+// is used as by Start or StopRecording.
+func (s *Service) Toggle(ctx context.Context, mode Mode, p Profile) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.isRecording {
+		s.stopRecordingLocked()
+		s.finishWithinLocked(ctx)
+	} else {
+		s.startRecordingLocked(ctx, mode, p, nil)
+	}
+}
+
+// request builds the transcription request for samples recorded in app
+// with profile p.
+func (s *Service) request(samples []int16, app string, p Profile) Request {
+	language := s.Language
+	if p.Language != "" {
+		language = p.Language
+	}
+	if strings.EqualFold(language, LanguageAuto) {
+		language = ""
+	}
+	script := s.Script
+	if p.Script != "" {
+		script = p.Script
+	}
+	return Request{
+		Samples:    samples,
+		Vocabulary: s.Vocabulary,
+		App:        app,
+		Language:   language,
+		Speaker:    s.Speaker,
+		CodeSwitch: s.CodeSwitch || p.CodeSwitch,
+		Script:     script,
+		Translate:  p.Translate,
+
+		Instructions: s.Instructions,
+		backend:      p.backend,
+	}
+}
+
+// baseLanguage returns the language subtag of a BCP-47 code, e.g. "pt" for
+// "pt-BR".
+func baseLanguage(code string) string {
+	base, _, _ := strings.Cut(code, "-")
+	return strings.ToLower(base)
+}
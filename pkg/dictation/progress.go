@@ -0,0 +1,119 @@
+package dictation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// BatchProgress remembers which files have been transcribed, in a JSON
+// file, so a batch that was interrupted skips them when it is run again.
+type BatchProgress struct {
+	path  string
+	mu    sync.Mutex
+	files map[string]batchDone // By absolute audio path
+}
+
+// batchDone is a transcribed file as it was when transcribed.
+type batchDone struct {
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mod_time"`
+	Transcript string    `json:"transcript"`
+	Profile    string    `json:"profile,omitempty"`
+	At         time.Time `json:"at"`
+}
+
+// LoadBatchProgress reads the progress kept in path, which need not exist
+// yet.
+func LoadBatchProgress(path string) (*BatchProgress, error) {
+	b := &BatchProgress{path: path, files: make(map[string]batchDone)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return b, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &b.files); err != nil {
+		return nil, fmt.Errorf("invalid batch progress file %s: %w", path, err)
+	}
+	return b, nil
+}
+
+// Done reports whether audio was transcribed to transcript with profile,
+// the transcript is still there and the audio has not changed since.
+func (b *BatchProgress) Done(audio, transcript, profile string) bool {
+	key, info, err := stat(audio)
+	if err != nil {
+		return false
+	}
+	b.mu.Lock()
+	d, ok := b.files[key]
+	b.mu.Unlock()
+	if !ok || d.Profile != profile || d.Size != info.Size() || !d.ModTime.Equal(info.ModTime()) {
+		return false
+	}
+	if t, err := filepath.Abs(transcript); err != nil || t != d.Transcript {
+		return false
+	}
+	_, err = os.Stat(transcript)
+	return err == nil
+}
+
+// Record notes that audio has been transcribed to transcript with profile
+// and saves the progress.
+func (b *BatchProgress) Record(audio, transcript, profile string) error {
+	key, info, err := stat(audio)
+	if err != nil {
+		return err
+	}
+	if transcript, err = filepath.Abs(transcript); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.files[key] = batchDone{
+		Size:       info.Size(),
+		ModTime:    info.ModTime(),
+		Transcript: transcript,
+		Profile:    profile,
+		At:         time.Now(),
+	}
+	return b.save()
+}
+
+// save atomically replaces the progress file, forgetting files that no
+// longer exist. b.mu must be held.
+func (b *BatchProgress) save() error {
+	for path := range b.files {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			delete(b.files, path)
+		}
+	}
+	data, err := json.MarshalIndent(b.files, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(b.path), 0755); err != nil {
+		return err
+	}
+	tmp := b.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, b.path)
+}
+
+// stat returns the absolute path of a file and its info.
+func stat(path string) (string, os.FileInfo, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", nil, err
+	}
+	info, err := os.Stat(abs)
+	return abs, info, err
+}
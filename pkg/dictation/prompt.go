@@ -0,0 +1,108 @@
+package dictation
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/go-vgo/robotgo"
+)
+
+// Prompt templates may use these placeholders, which are filled in for
+// every request.
+const (
+	placeholderApp      = "{{app}}"      // Application that was focused when recording started
+	placeholderLanguage = "{{language}}" // Request.Language, or "the spoken language"
+	placeholderGlossary = "{{glossary}}" // Request.Vocabulary, comma separated
+	placeholderSpeaker  = "{{speaker}}"  // Request.Speaker as a sentence
+)
+
+// Script selects how transcripts in languages with a non-Latin script are
+// written.
+type Script string
+
+const (
+	ScriptNative Script = "native" // The language's own script (the default)
+	ScriptRoman  Script = "roman"  // Latin-alphabet transliteration
+	ScriptBoth   Script = "both"   // Native script, each sentence followed by its transliteration
+)
+
+// Validate reports an unknown script.
+func (sc Script) Validate() error {
+	switch sc {
+	case "", ScriptNative, ScriptRoman, ScriptBoth:
+		return nil
+	}
+	return fmt.Errorf("unknown script %q (use native, roman or both)", sc)
+}
+
+// sentence renders sc as a prompt sentence, or "" for the native script.
+func (sc Script) sentence() string {
+	switch sc {
+	case ScriptRoman:
+		return "If the language is not normally written in the Latin alphabet, write the transcript romanized with its standard transliteration (e.g. Hepburn for Japanese, pinyin with tone marks for Mandarin) instead of the native script."
+	case ScriptBoth:
+		return "If the language is not normally written in the Latin alphabet, write each sentence in its native script followed by its standard romanization in parentheses."
+	}
+	return ""
+}
+
+// SpeakerHints describe the speaker to improve recognition, particularly
+// for non-native speakers. Empty fields are omitted.
+type SpeakerHints struct {
+	// Accent, e.g. "Indian English" or "strong German".
+	Accent string `json:"accent,omitempty"`
+	// Style, e.g. "fast and informal" or "slow, with long pauses".
+	Style string `json:"style,omitempty"`
+	// Domain is the usual subject matter, e.g. "cardiology".
+	Domain string `json:"domain,omitempty"`
+}
+
+// sentence renders h as a prompt sentence, or "" when no hint is set.
+func (h SpeakerHints) sentence() string {
+	var parts []string
+	if h.Accent != "" {
+		parts = append(parts, "has a "+h.Accent+" accent")
+	}
+	if h.Style != "" {
+		parts = append(parts, "speaks "+h.Style)
+	}
+	if h.Domain != "" {
+		parts = append(parts, "usually talks about "+h.Domain)
+	}
+	switch len(parts) {
+	case 0:
+		return ""
+	case 1:
+		return "The speaker " + parts[0] + "."
+	default:
+		return "The speaker " + strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1] + "."
+	}
+}
+
+// expandPrompt fills the placeholders in tmpl from r.
+func expandPrompt(tmpl string, r Request) string {
+	app := r.App
+	if app == "" {
+		app = "an unknown application"
+	}
+	language := r.Language
+	if language == "" {
+		language = "the spoken language"
+	}
+	return strings.NewReplacer(
+		placeholderApp, app,
+		placeholderLanguage, language,
+		placeholderGlossary, strings.Join(r.Vocabulary, ", "),
+		placeholderSpeaker, r.Speaker.sentence(),
+	).Replace(tmpl)
+}
+
+// activeApp returns the name of the focused application, or "" if it
+// cannot be determined.
+func activeApp() string {
+	name, err := robotgo.FindName(robotgo.GetPid())
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSuffix(name, ".exe")
+}
@@ -0,0 +1,112 @@
+package dictation
+
+import (
+	"context"
+	"log"
+	"slices"
+)
+
+// turn is a recording's place in the queue of transcriptions. Each is
+// delivered, typed or filed, only after those before it, so one started
+// while the last is still being transcribed comes out after it.
+type turn struct {
+	prev   <-chan struct{} // Closed once the recording before is delivered
+	done   chan struct{}
+	cancel context.CancelFunc // Abandons the recording; see Cancel
+	queued bool               // Counted in Service.queued
+}
+
+// nextTurnLocked returns the turn of a recording starting now, which
+// cancel abandons. s.mu must be held.
+func (s *Service) nextTurnLocked(cancel context.CancelFunc) *turn {
+	t := &turn{prev: s.lastTurn, done: make(chan struct{}), cancel: cancel}
+	s.lastTurn = t.done
+	s.turns = append(s.turns, t)
+	return t
+}
+
+// enqueue counts the recording of t as waiting to be transcribed and
+// delivered, now that it has stopped. t may be nil.
+func (s *Service) enqueue(t *turn) {
+	if t == nil || t.queued {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t.queued = true
+	s.setQueuedLocked(s.queued + 1)
+}
+
+// wait blocks until the recordings before t have been delivered, or ctx
+// is done. t may be nil.
+func (t *turn) wait(ctx context.Context) {
+	if t == nil || t.prev == nil {
+		return
+	}
+	select {
+	case <-t.prev:
+	case <-ctx.Done():
+	}
+}
+
+// endTurn lets the recording after t deliver, and returns to idle once
+// nothing records or transcribes.
+func (s *Service) endTurn(t *turn) {
+	close(t.done)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.turns = slices.DeleteFunc(s.turns, func(o *turn) bool { return o == t })
+	if t.queued {
+		s.setQueuedLocked(s.queued - 1)
+	}
+	// A new recording may already have started.
+	switch {
+	case s.isRecording:
+	case len(s.turns) > 0:
+		s.setState(StateProcessing)
+	default:
+		s.setState(StateIdle)
+	}
+}
+
+// Cancel abandons the recording, if one is running, and every recording
+// not yet delivered, aborting requests already sent to the backend.
+// Nothing more is typed or saved; text already typed stays.
+func (s *Service) Cancel() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.turns) == 0 {
+		return
+	}
+	log.Printf("Cancelling %d recording(s)", len(s.turns))
+	for _, t := range s.turns {
+		t.cancel()
+	}
+	if s.isRecording {
+		s.stopRecordingLocked()
+	}
+}
+
+// setQueuedLocked sets the length of the queue and reports it. s.mu must
+// be held, so reports arrive in order.
+func (s *Service) setQueuedLocked(n int) {
+	s.queued = n
+	s.statusMu.Lock()
+	s.status.Queued = n
+	st := s.status
+	s.statusMu.Unlock()
+	s.writeStatus(st)
+	if s.OnQueue != nil {
+		s.OnQueue(n)
+	}
+}
+
+// setStateUnlessRecording sets state unless the next recording has
+// already started.
+func (s *Service) setStateUnlessRecording(state State) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.isRecording {
+		s.setState(state)
+	}
+}
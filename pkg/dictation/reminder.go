@@ -0,0 +1,180 @@
+package dictation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Reminder is a "remind me to ..." request recognized in a transcript.
+type Reminder struct {
+	Title string    `json:"title"`
+	Due   time.Time `json:"due,omitzero"` // Zero when no time was spoken
+}
+
+var (
+	reminderRe = regexp.MustCompile(`(?i)^\s*(?:hey\s+)?(?:please\s+)?remind me\s+(?:to\s+)?(.+?)[\s.!?]*$`)
+	inRe       = regexp.MustCompile(`(?i)\s+in\s+(\d+|an?|one|two|three|four|five|ten|fifteen|twenty|thirty)\s+(minutes?|hours?|days?)$`)
+	atRe       = regexp.MustCompile(`(?i)(?:\s+(today|tonight|tomorrow))?\s+at\s+(noon|midnight|\d{1,2}(?::\d{2})?(?:\s*[ap]\.?\s*m\.?)?)$`)
+	dayRe      = regexp.MustCompile(`(?i)\s+(today|tonight|tomorrow)$`)
+	clockRe    = regexp.MustCompile(`(?i)^(\d{1,2})(?::(\d{2}))?\s*(?:([ap])\.?\s*m\.?)?$`)
+)
+
+var numberWords = map[string]int{
+	"a": 1, "an": 1, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5,
+	"ten": 10, "fifteen": 15, "twenty": 20, "thirty": 30,
+}
+
+// ParseReminder recognizes dictations such as "remind me to call Sam at 5pm"
+// or "remind me to stretch in 20 minutes". It reports false for anything
+// that is not a reminder request.
+func ParseReminder(text string, now time.Time) (Reminder, bool) {
+	m := reminderRe.FindStringSubmatch(text)
+	if m == nil {
+		return Reminder{}, false
+	}
+	body := m[1]
+
+	var due time.Time
+	if m := inRe.FindStringSubmatch(body); m != nil {
+		n, ok := numberWords[strings.ToLower(m[1])]
+		if !ok {
+			n, _ = strconv.Atoi(m[1])
+		}
+		unit := time.Minute
+		switch strings.ToLower(m[2])[0] {
+		case 'h':
+			unit = time.Hour
+		case 'd':
+			unit = 24 * time.Hour
+		}
+		due = now.Add(time.Duration(n) * unit)
+		body = body[:len(body)-len(m[0])]
+	} else if m := atRe.FindStringSubmatch(body); m != nil {
+		// An impossible time such as "at 25" stays part of the title.
+		var ok bool
+		if due, ok = resolveDue(strings.ToLower(m[1]), strings.ToLower(m[2]), now); ok {
+			body = body[:len(body)-len(m[0])]
+		}
+	} else if m := dayRe.FindStringSubmatch(body); m != nil {
+		due, _ = resolveDue(strings.ToLower(m[1]), "", now)
+		body = body[:len(body)-len(m[0])]
+	}
+
+	title := strings.TrimSpace(strings.TrimRight(body, ", "))
+	if title == "" {
+		return Reminder{}, false
+	}
+	return Reminder{Title: title, Due: due}, true
+}
+
+// resolveDue turns a spoken day ("", "today", "tonight", "tomorrow") and
+// clock ("", "noon", "5", "5:30 pm") into the next matching time. A time
+// that has passed today is taken for tomorrow. It reports false for a
+// clock that is not a time of day.
+func resolveDue(day, clock string, now time.Time) (time.Time, bool) {
+	hour, min, meridiem := 9, 0, ""
+	switch {
+	case clock == "noon":
+		hour = 12
+	case clock == "midnight":
+		hour = 0
+	case clock != "":
+		m := clockRe.FindStringSubmatch(clock)
+		if m == nil {
+			return time.Time{}, false
+		}
+		hour, _ = strconv.Atoi(m[1])
+		min, _ = strconv.Atoi(m[2])
+		meridiem = strings.ToLower(m[3])
+		if hour > 23 || min > 59 || (meridiem != "" && (hour < 1 || hour > 12)) {
+			return time.Time{}, false
+		}
+	case day == "tonight":
+		hour = 20
+	}
+	if meridiem == "p" && hour < 12 {
+		hour += 12
+	} else if meridiem == "a" && hour == 12 {
+		hour = 0
+	}
+
+	due := time.Date(now.Year(), now.Month(), now.Day(), hour, min, 0, 0, now.Location())
+	if day == "tomorrow" {
+		return due.AddDate(0, 0, 1), true
+	}
+	// A bare "at 5" said in the afternoon means 5pm.
+	if meridiem == "" && hour < 12 && due.Before(now) && due.Add(12*time.Hour).After(now) {
+		due = due.Add(12 * time.Hour)
+	}
+	if due.Before(now) {
+		due = due.AddDate(0, 0, 1)
+	}
+	return due, true
+}
+
+// createReminder hands r to ReminderWebhook if set, or to the macOS
+// Reminders app otherwise.
+func (s *Service) createReminder(ctx context.Context, r Reminder) error {
+	if s.ReminderWebhook != "" {
+		body, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, "POST", s.ReminderWebhook, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := (&http.Client{Timeout: 10 * time.Second}).Do(req)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+		}
+		return nil
+	}
+
+	if runtime.GOOS != "darwin" {
+		return fmt.Errorf("no reminder webhook configured")
+	}
+
+	// Build the date field by field; AppleScript date strings are locale
+	// dependent.
+	script := `on run argv
+	set props to {name:item 1 of argv}
+	if (count of argv) > 1 then
+		set d to current date
+		set day of d to 1
+		set year of d to (item 2 of argv) as integer
+		set month of d to (item 3 of argv) as integer
+		set day of d to (item 4 of argv) as integer
+		set time of d to (item 5 of argv) as integer
+		set props to props & {remind me date:d}
+	end if
+	tell application "Reminders" to make new reminder with properties props
+end run`
+	args := []string{"-", r.Title}
+	if !r.Due.IsZero() {
+		secs := r.Due.Hour()*3600 + r.Due.Minute()*60 + r.Due.Second()
+		args = append(args,
+			strconv.Itoa(r.Due.Year()), strconv.Itoa(int(r.Due.Month())),
+			strconv.Itoa(r.Due.Day()), strconv.Itoa(secs))
+	}
+	cmd := exec.CommandContext(ctx, "osascript", args...)
+	cmd.Stdin = strings.NewReader(script)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("osascript error: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
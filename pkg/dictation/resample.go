@@ -0,0 +1,72 @@
+package dictation
+
+import "math"
+
+// resampleZeroCrossings is the half-width of the resampling filter in
+// zero crossings of its sinc; more is sharper but slower.
+const resampleZeroCrossings = 8
+
+// resampler converts a stream of samples at one rate to sampleRate with a
+// windowed-sinc filter, which also removes frequencies above the new
+// Nyquist limit when downsampling so they do not alias.
+type resampler struct {
+	step   float64 // Input samples per output sample
+	cutoff float64 // Filter cutoff relative to the input Nyquist frequency
+	taps   int     // Filter half-width in input samples
+
+	buf []float64 // Input not consumed yet, including filter history
+	pos float64   // Position of the next output sample in buf
+}
+
+// newResampler returns a resampler from rate to sampleRate, or nil if rate
+// already is sampleRate.
+func newResampler(rate float64) *resampler {
+	if rate == sampleRate {
+		return nil
+	}
+	r := &resampler{step: rate / sampleRate, cutoff: 1}
+	if r.step > 1 {
+		r.cutoff = 1 / r.step
+	}
+	r.taps = int(math.Ceil(resampleZeroCrossings / r.cutoff))
+	return r
+}
+
+// process appends the resampled output for in to out. Output lags the
+// input by the filter's half-width.
+func (r *resampler) process(in []int16, out []int16) []int16 {
+	for _, v := range in {
+		r.buf = append(r.buf, float64(v))
+	}
+	for r.pos+float64(r.taps) < float64(len(r.buf)) {
+		center := int(r.pos)
+		var sum float64
+		for k := max(center-r.taps+1, 0); k <= center+r.taps; k++ {
+			sum += r.buf[k] * r.kernel(float64(k)-r.pos)
+		}
+		out = append(out, int16(max(-32768, min(32767, math.Round(sum)))))
+		r.pos += r.step
+	}
+
+	// Keep only the history the next output samples need.
+	if drop := int(r.pos) - r.taps; drop > 0 {
+		r.buf = append(r.buf[:0], r.buf[drop:]...)
+		r.pos -= float64(drop)
+	}
+	return out
+}
+
+// kernel is the filter's impulse response at x input samples from the
+// output position: a low-pass sinc under a Blackman window.
+func (r *resampler) kernel(x float64) float64 {
+	w := x / float64(r.taps)
+	if w <= -1 || w >= 1 {
+		return 0
+	}
+	window := 0.42 + 0.5*math.Cos(math.Pi*w) + 0.08*math.Cos(2*math.Pi*w)
+	t := math.Pi * r.cutoff * x
+	if t == 0 {
+		return r.cutoff * window
+	}
+	return r.cutoff * math.Sin(t) / t * window
+}
@@ -0,0 +1,130 @@
+package dictation
+
+import (
+	"log"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-vgo/robotgo"
+)
+
+// maxRespeakDistance is the largest share of characters a span of the
+// last dictation may differ by from a spoken correction and still be
+// taken for the words it corrects.
+const maxRespeakDistance = 0.5
+
+// setTyped remembers the transcript last typed into the focused window,
+// for ModeCorrect.
+func (s *Service) setTyped(text string) {
+	s.typedMu.Lock()
+	s.typed = text
+	s.typedMu.Unlock()
+}
+
+// respeak replaces the words of the last typed transcript that sound most
+// like phrase, the transcript of a ModeCorrect recording, with phrase.
+// Like AutoCorrect, it assumes the cursor is still right after the
+// transcript: it backspaces to the words and types the rest again.
+func (s *Service) respeak(o output, phrase string) {
+	s.typedMu.Lock()
+	typed := s.typed
+	s.typedMu.Unlock()
+	phrase = strings.TrimFunc(phrase, func(r rune) bool {
+		return unicode.IsPunct(r) || unicode.IsSpace(r)
+	})
+	if typed == "" || phrase == "" {
+		log.Printf("Nothing to correct")
+		return
+	}
+	start, end, ok := matchSpan(typed, phrase)
+	if !ok {
+		log.Printf("Nothing in the last dictation sounds like %q", phrase)
+		return
+	}
+	replacement := matchCase(phrase, typed[start:end])
+	log.Printf("Correcting %q to %q", typed[start:end], replacement)
+
+	for range utf8.RuneCountInString(typed[start:]) {
+		robotgo.KeyTap("backspace")
+	}
+	s.inject(o, replacement+typed[end:], false)
+	corrected := typed[:start] + replacement + typed[end:]
+	s.setTyped(corrected)
+	s.setLastTranscript(corrected)
+}
+
+// matchSpan returns the byte offsets in text of the words that sound most
+// like phrase, allowing one word more or fewer than it has, without the
+// punctuation around them. Words that already read as phrase are not the
+// mistake, and are skipped; later words win ties, as the mistake was more
+// likely just noticed. It fails if nothing is close enough.
+func matchSpan(text, phrase string) (start, end int, ok bool) {
+	words := wordSpans(text)
+	for i, sp := range words {
+		words[i] = trimSpan(text, sp)
+	}
+	target := []rune(strings.Join(normalizeWords(phrase), " "))
+	n := len(normalizeWords(phrase))
+	best := maxRespeakDistance
+	for size := max(1, n-1); size <= n+1; size++ {
+		for i := 0; i+size <= len(words); i++ {
+			from, to := words[i][0], words[i+size-1][1]
+			cand := []rune(strings.Join(normalizeWords(text[from:to]), " "))
+			d := editDistance(cand, target)
+			if d == 0 {
+				continue
+			}
+			if share := float64(d) / float64(max(len(cand), len(target))); share <= best {
+				best, start, end, ok = share, from, to, true
+			}
+		}
+	}
+	return start, end, ok
+}
+
+// trimSpan returns the offsets of the span sp of s without the
+// punctuation around it.
+func trimSpan(s string, sp [2]int) [2]int {
+	word := s[sp[0]:sp[1]]
+	isPunct := func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsNumber(r) }
+	start := sp[0] + len(word) - len(strings.TrimLeftFunc(word, isPunct))
+	end := sp[0] + len(strings.TrimRightFunc(word, isPunct))
+	if start >= end {
+		return sp
+	}
+	return [2]int{start, end}
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b []rune) int {
+	row := make([]int, len(b)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		prev := row[0]
+		row[0] = i
+		for j := 1; j <= len(b); j++ {
+			cur := row[j]
+			if a[i-1] == b[j-1] {
+				row[j] = prev
+			} else {
+				row[j] = 1 + min(prev, row[j], row[j-1])
+			}
+			prev = cur
+		}
+	}
+	return row[len(b)]
+}
+
+// matchCase gives phrase the case of the first letter of the words it
+// replaces, since backends capitalize a short utterance as a sentence.
+func matchCase(phrase, replaced string) string {
+	first, _ := utf8.DecodeRuneInString(replaced)
+	r, size := utf8.DecodeRuneInString(phrase)
+	if unicode.IsUpper(first) {
+		return string(unicode.ToUpper(r)) + phrase[size:]
+	}
+	return string(unicode.ToLower(r)) + phrase[size:]
+}
@@ -0,0 +1,75 @@
+package dictation
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Result is a finished transcription with what is known about how it was
+// made. Fields the backend does not report are left empty.
+type Result struct {
+	Text string
+	// Segments splits Text by language for code-switched requests.
+	Segments []Segment
+	// Language is the detected BCP-47 language code.
+	Language string
+	// Confidence is the backend's estimate that Text is accurate, from 0
+	// to 1, or 0 if it gives none.
+	Confidence float64
+	// Duration is the length of the audio.
+	Duration time.Duration
+	// Provider is the backend, e.g. "gemini", and Model the model it used.
+	Provider string
+	Model    string
+	// TokensIn and TokensOut are the tokens billed for the request.
+	TokensIn  int
+	TokensOut int
+	// Latency is the time from sending the audio to receiving the
+	// transcript, retries included.
+	Latency time.Duration
+	// AudioRef is where the audio can be found again: the path of a
+	// transcribed file, or the ID of the recording's history entry.
+	AudioRef string
+}
+
+// requestMeta collects what backends report about a request, from every
+// chunk and attempt.
+type requestMeta struct {
+	mu        sync.Mutex
+	model     string
+	tokensIn  int
+	tokensOut int
+}
+
+// report records a response from model that billed the given tokens. m
+// may be nil.
+func (m *requestMeta) report(model string, tokensIn, tokensOut int) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.model = model
+	m.tokensIn += tokensIn
+	m.tokensOut += tokensOut
+}
+
+// result builds the Result of transcribing req into t in latency.
+func (s *Service) result(req Request, t Transcript, latency time.Duration) Result {
+	r := Result{
+		Text:       strings.TrimSpace(s.rewrite(t.Text)),
+		Segments:   t.Segments,
+		Language:   t.Language,
+		Confidence: t.Confidence,
+		Duration:   time.Duration(len(req.Samples)) * time.Second / sampleRate,
+		Provider:   backendName(s.backend(req)),
+		Latency:    latency,
+	}
+	if m := req.meta; m != nil {
+		m.mu.Lock()
+		r.Model, r.TokensIn, r.TokensOut = m.model, m.tokensIn, m.tokensOut
+		m.mu.Unlock()
+	}
+	return r
+}
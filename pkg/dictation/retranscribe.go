@@ -0,0 +1,75 @@
+package dictation
+
+import (
+	"context"
+	"log"
+)
+
+// recording is a recording kept for TranscribeLast.
+type recording struct {
+	mode    Mode
+	p       Profile
+	app     string
+	samples []int16
+}
+
+// keepLast remembers a recording for TranscribeLast, replacing the one
+// before it.
+func (s *Service) keepLast(mode Mode, p Profile, app string, samples []int16) {
+	p.backend = nil
+	s.lastMu.Lock()
+	s.last = &recording{mode: mode, p: p, app: app, samples: samples}
+	s.lastMu.Unlock()
+}
+
+// TranscribeLast transcribes the last dictation or note again, with
+// Retranscriber if it is set, and delivers the result like the original:
+// typed into the focused window, or saved as a new note. It is for
+// retrying a recording the backend failed on or got wrong. Voice commands
+// and captions are not kept. Nothing happens while recording, and nothing
+// is delivered if ctx is done first.
+func (s *Service) TranscribeLast(ctx context.Context) {
+	s.lastMu.Lock()
+	last := s.last
+	s.lastMu.Unlock()
+	if last == nil {
+		log.Printf("No recording to transcribe again")
+		return
+	}
+
+	s.mu.Lock()
+	if s.isRecording || s.asleep || s.screenLocked {
+		s.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	s.recordCtx, s.cancelRecord = ctx, cancel
+	t := s.nextTurnLocked(cancel)
+	s.mu.Unlock()
+
+	p, backend := last.p, s.transcriber
+	if s.Retranscriber != nil {
+		p.backend, backend = s.Retranscriber, s.Retranscriber
+	}
+	log.Printf("Transcribing the last recording again with %s", backendName(backend))
+	go func() {
+		defer func() {
+			if s.OnFinish != nil {
+				s.OnFinish()
+			}
+			cancel()
+			s.endTurn(t)
+		}()
+		out := s.output(p)
+		out.turn = t
+		s.process(ctx, last.mode, p, out, last.app, last.samples, nil, 0)
+	}()
+}
+
+// backend returns the backend that transcribes req.
+func (s *Service) backend(req Request) Transcriber {
+	if req.backend != nil {
+		return req.backend
+	}
+	return s.transcriber
+}
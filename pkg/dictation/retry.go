@@ -0,0 +1,56 @@
+package dictation
+
+import (
+	"context"
+	"log"
+	"math/rand/v2"
+	"time"
+)
+
+// defaultRetryBackoff is the wait before the first retry when RetryBackoff
+// is unset.
+const defaultRetryBackoff = time.Second
+
+// transcribeWithRetry calls transcribe, retrying transient failures up to
+// Retries times with exponential backoff and jitter. The outcome feeds the
+// circuit breaker, which fails fast while it is open.
+func (s *Service) transcribeWithRetry(ctx context.Context, req Request) (Result, error) {
+	req.meta = &requestMeta{}
+	start := time.Now()
+	if req.backend != nil {
+		// The circuit breaker only watches the usual backend.
+		t, err := s.retry(ctx, req)
+		return s.result(req, t, time.Since(start)), err
+	}
+	if !s.allowRequest() {
+		return Result{}, ErrBackendUnavailable
+	}
+	t, err := s.retry(ctx, req)
+	if ctx.Err() == nil {
+		// A cancelled request says nothing about the backend.
+		s.recordOutcome(err)
+	}
+	return s.result(req, t, time.Since(start)), err
+}
+
+func (s *Service) retry(ctx context.Context, req Request) (Transcript, error) {
+	backoff := s.RetryBackoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+	req.retried = s.Retries > 0
+	for attempt := 0; ; attempt++ {
+		t, err := s.transcribe(ctx, req)
+		if err == nil || attempt >= s.Retries || ctx.Err() != nil || !isTransient(err) {
+			return t, err
+		}
+
+		wait := backoff<<attempt + rand.N(backoff/2+1)
+		log.Printf("Transcription failed (%v), retrying in %s", err, wait.Round(time.Millisecond))
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return Transcript{}, err
+		}
+	}
+}
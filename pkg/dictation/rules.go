@@ -0,0 +1,41 @@
+package dictation
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// Rule rewrites transcripts: every match of the regular expression Match
+// is replaced with Replace, in which $1 stands for the first group. Add
+// (?i) to Match to ignore case.
+type Rule struct {
+	Match   string `json:"match"`
+	Replace string `json:"replace"`
+
+	re *regexp.Regexp
+}
+
+// CompileRules returns rules ready for Service.Rules, which skips rules
+// that were not compiled.
+func CompileRules(rules []Rule) ([]Rule, error) {
+	compiled := make([]Rule, len(rules))
+	for i, r := range rules {
+		re, err := regexp.Compile(r.Match)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule %q: %w", r.Match, err)
+		}
+		r.re = re
+		compiled[i] = r
+	}
+	return compiled, nil
+}
+
+// rewrite applies Rules to text.
+func (s *Service) rewrite(text string) string {
+	for _, r := range s.Rules {
+		if r.re != nil {
+			text = r.re.ReplaceAllString(text, r.Replace)
+		}
+	}
+	return text
+}
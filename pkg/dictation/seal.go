@@ -0,0 +1,96 @@
+package dictation
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+// sealedMagic starts every file encrypted by seal.
+const sealedMagic = "chrisper-sealed-1\n"
+
+// saltFile is the name of the passphrase salt in the history directory.
+const saltFile = "salt"
+
+// errNoKey is returned for encrypted files when no key is configured.
+var errNoKey = errors.New("history is encrypted; set history_encryption to read it")
+
+// seal encrypts data with NaCl secretbox under key, or returns it unchanged
+// when key is nil.
+func seal(data []byte, key *[32]byte) ([]byte, error) {
+	if key == nil {
+		return data, nil
+	}
+	var nonce [24]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+	out := append([]byte(sealedMagic), nonce[:]...)
+	return secretbox.Seal(out, data, &nonce, key), nil
+}
+
+// unseal decrypts data written by seal. Data that was never encrypted is
+// returned unchanged, so history kept before encryption was turned on
+// stays readable.
+func unseal(data []byte, key *[32]byte) ([]byte, error) {
+	rest, sealed := strings.CutPrefix(string(data), sealedMagic)
+	if !sealed {
+		return data, nil
+	}
+	if key == nil {
+		return nil, errNoKey
+	}
+	if len(rest) < 24 {
+		return nil, errors.New("encrypted file is truncated")
+	}
+	var nonce [24]byte
+	copy(nonce[:], rest)
+	out, ok := secretbox.Open(nil, []byte(rest[24:]), &nonce, key)
+	if !ok {
+		return nil, errors.New("failed to decrypt; wrong key or passphrase?")
+	}
+	return out, nil
+}
+
+// PassphraseKey derives a history key from passphrase with scrypt. The
+// salt is kept in dir and created on first use.
+func PassphraseKey(dir, passphrase string) (*[32]byte, error) {
+	if passphrase == "" {
+		return nil, errors.New("empty passphrase")
+	}
+	salt, err := historySalt(dir)
+	if err != nil {
+		return nil, fmt.Errorf("history salt: %w", err)
+	}
+
+	b, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	var key [32]byte
+	copy(key[:], b)
+	return &key, nil
+}
+
+// historySalt returns the salt kept in dir, creating it if needed.
+func historySalt(dir string) ([]byte, error) {
+	path := filepath.Join(dir, saltFile)
+	salt, err := os.ReadFile(path)
+	if !errors.Is(err, os.ErrNotExist) {
+		return salt, err
+	}
+	salt = make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return salt, os.WriteFile(path, salt, 0644)
+}
@@ -0,0 +1,85 @@
+package dictation
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/go-vgo/robotgo"
+)
+
+// OutputSink receives dictated transcripts in place of the focused
+// window. Set one as Service.Output to use the service without keystroke
+// injection.
+type OutputSink interface {
+	// Write delivers a transcript: of a recording, or of an utterance in
+	// continuous mode. Calls do not overlap.
+	Write(text string) error
+}
+
+// KeyboardSink types each transcript into the focused window. Unlike the
+// service's own output, used when Output is unset, it never pastes and
+// typing cannot be held or corrected.
+type KeyboardSink struct{}
+
+func (KeyboardSink) Write(text string) error {
+	robotgo.TypeStr(text)
+	return nil
+}
+
+// ClipboardSink copies each transcript to the clipboard, replacing the
+// last.
+type ClipboardSink struct{}
+
+func (ClipboardSink) Write(text string) error {
+	return robotgo.WriteAll(text)
+}
+
+// WriterSink writes each transcript to W on a line of its own, e.g. to
+// os.Stdout.
+type WriterSink struct {
+	W io.Writer
+}
+
+func (w WriterSink) Write(text string) error {
+	_, err := fmt.Fprintln(w.W, text)
+	return err
+}
+
+// FileSink appends each transcript to the file at Path on a line of its
+// own, creating the file and its directory if needed.
+type FileSink struct {
+	Path string
+}
+
+func (f FileSink) Write(text string) error {
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(file, text); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// FuncSink calls a function with each transcript.
+type FuncSink func(text string) error
+
+func (f FuncSink) Write(text string) error {
+	return f(text)
+}
+
+// writeOutput delivers text to Output, reporting a failure to OnError.
+func (s *Service) writeOutput(text string) {
+	s.outputMu.Lock()
+	defer s.outputMu.Unlock()
+	if err := s.Output.Write(text); err != nil && s.OnError != nil {
+		s.OnError(fmt.Errorf("failed to deliver transcript: %w", err))
+	}
+}
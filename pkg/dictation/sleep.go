@@ -0,0 +1,75 @@
+package dictation
+
+import (
+	"fmt"
+	"log"
+
+	"chrisper/pkg/power"
+
+	"github.com/go-vgo/robotgo"
+)
+
+// WatchSleep stops recording when the system goes to sleep or the screen
+// is locked, and re-initializes audio after waking up, since streams
+// opened before sleeping hang or deliver garbage. A recording stopped
+// this way is transcribed as usual, but copied to the clipboard rather
+// than typed while the screen stays locked, and no new recordings start
+// until it is unlocked. Call it once.
+func (s *Service) WatchSleep() {
+	power.Watch(s.powerEvent)
+	go s.watchPower()
+}
+
+func (s *Service) powerEvent(e power.Event) {
+	log.Printf("Power event: %s", e)
+	s.mu.Lock()
+	switch e {
+	case power.Sleep:
+		s.asleep = true
+	case power.Wake:
+		s.asleep = false
+	case power.ScreenLocked:
+		s.screenLocked = true
+	case power.ScreenUnlocked:
+		s.screenLocked = false
+	}
+	if (s.asleep || s.screenLocked) && s.isRecording {
+		log.Printf("Stopping recording: %s", e)
+		s.stopRecordingLocked()
+	}
+	away := s.asleep || s.screenLocked
+	s.mu.Unlock()
+
+	if away {
+		s.pausePreRecord()
+	}
+	if e == power.Wake {
+		s.restartAudio()
+	}
+	if !away {
+		s.resumePreRecord()
+	}
+}
+
+// away reports whether the system is going to sleep or the screen is
+// locked.
+func (s *Service) away() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.asleep || s.screenLocked
+}
+
+// copyWhileAway copies a transcript that finished while the screen was
+// locked to the clipboard, as typing it would go to the lock screen.
+func (s *Service) copyWhileAway(text string) {
+	log.Printf("Screen locked: transcript copied to the clipboard instead of typed")
+	if err := robotgo.WriteAll(text); err != nil {
+		if s.OnError != nil {
+			s.OnError(fmt.Errorf("failed to copy to clipboard: %w", err))
+		}
+		return
+	}
+	if s.OnReplay != nil {
+		s.OnReplay(text)
+	}
+}
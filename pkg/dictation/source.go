@@ -0,0 +1,193 @@
+package dictation
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// AudioSource is what a recording reads from: the microphone, an audio
+// file, or audio piped in from another program.
+type AudioSource interface {
+	// Read returns the next buffer of mono samples at 16 kHz, or io.EOF
+	// once there is no more audio. The result is only valid until the next
+	// call.
+	Read() ([]int16, error)
+	Close() error
+}
+
+// StartSource starts a recording in mode like Start, but records from src
+// instead of the microphone. The recording stops by itself at the end of
+// src, and src is closed when it does, or straight away if another
+// recording is already running.
+func (s *Service) StartSource(ctx context.Context, mode Mode, p Profile, src AudioSource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.isRecording || !s.startRecordingLocked(ctx, mode, p, src) {
+		src.Close()
+	}
+}
+
+// samplesSource reads samples from memory.
+type samplesSource struct {
+	samples []int16
+}
+
+// NewSamplesSource returns a source that reads samples, mono at 16 kHz,
+// e.g. canned audio in tests.
+func NewSamplesSource(samples []int16) AudioSource {
+	return &samplesSource{samples: samples}
+}
+
+func (s *samplesSource) Read() ([]int16, error) {
+	if len(s.samples) == 0 {
+		return nil, io.EOF
+	}
+	n := min(audioBufferSize, len(s.samples))
+	buf := s.samples[:n]
+	s.samples = s.samples[n:]
+	return buf, nil
+}
+
+func (s *samplesSource) Close() error {
+	return nil
+}
+
+// OpenAudioFile returns a source that reads an audio file in any format
+// ReadAudioFile decodes.
+func OpenAudioFile(path string) (AudioSource, error) {
+	samples, err := ReadAudioFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewSamplesSource(samples), nil
+}
+
+// readerSource reads a WAV or raw PCM stream.
+type readerSource struct {
+	r         io.Reader
+	closer    io.Closer // r, if it can be closed
+	remaining int64     // Bytes of audio left, or -1 until the end of r
+	frame     int       // Bytes per frame
+	mix       func(frame []byte) int16
+	resampler *resampler
+	buf       []byte
+	mono      []int16
+	out       []int16
+}
+
+// NewReaderSource returns a source that reads a stream of audio from r,
+// e.g. standard input, as it arrives. The stream is WAV in any encoding
+// ReadAudioFile accepts, or raw 16-bit little-endian mono PCM at 16 kHz if
+// it has no WAV header. Closing the source closes r if it is an io.Closer.
+func NewReaderSource(r io.Reader) (AudioSource, error) {
+	br := bufio.NewReader(r)
+	src := &readerSource{r: br, remaining: -1}
+	src.closer, _ = r.(io.Closer)
+
+	head, err := br.Peek(12)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	f := wavFormat{format: wavPCM, channels: channelCount, rate: sampleRate, bits: 16}
+	switch format := sniffAudio(head); format {
+	case formatWAV:
+		if f, err = src.readWAVHeader(); err != nil {
+			return nil, err
+		}
+	case "":
+	default:
+		return nil, fmt.Errorf("cannot stream %s audio, only WAV or raw 16-bit PCM", format)
+	}
+
+	if src.mix, err = f.mixer(); err != nil {
+		return nil, err
+	}
+	src.frame = f.frameSize()
+	src.buf = make([]byte, audioBufferSize*src.frame)
+	src.resampler = newResampler(float64(f.rate))
+	return src, nil
+}
+
+// readWAVHeader reads the chunks of a WAV stream up to its audio.
+func (r *readerSource) readWAVHeader() (wavFormat, error) {
+	var f wavFormat
+	haveFmt := false
+	if _, err := io.CopyN(io.Discard, r.r, 12); err != nil {
+		return f, err
+	}
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r.r, header[:]); err != nil {
+			return f, fmt.Errorf("invalid WAV stream: %w", err)
+		}
+		size := int64(binary.LittleEndian.Uint32(header[4:]))
+		switch string(header[:4]) {
+		case "fmt ":
+			body := make([]byte, size+size%2)
+			if _, err := io.ReadFull(r.r, body); err != nil {
+				return f, fmt.Errorf("invalid WAV stream: %w", err)
+			}
+			var err error
+			if f, err = parseWAVFormat(body); err != nil {
+				return f, err
+			}
+			haveFmt = true
+		case "data":
+			if !haveFmt {
+				return f, fmt.Errorf("invalid WAV stream: missing format")
+			}
+			// Programs writing to a pipe cannot know the size.
+			if size != 0 && size != 0xFFFFFFFF {
+				r.remaining = size
+			}
+			return f, nil
+		default:
+			if _, err := io.CopyN(io.Discard, r.r, size+size%2); err != nil {
+				return f, fmt.Errorf("invalid WAV stream: %w", err)
+			}
+		}
+	}
+}
+
+func (r *readerSource) Read() ([]int16, error) {
+	buf := r.buf
+	if r.remaining >= 0 {
+		buf = buf[:min(int64(len(buf)), r.remaining)]
+	}
+	if len(buf) == 0 {
+		return nil, io.EOF
+	}
+	n, err := io.ReadFull(r.r, buf)
+	switch {
+	case errors.Is(err, io.ErrUnexpectedEOF) && n >= r.frame:
+		// The rest is returned now, io.EOF next time.
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return nil, io.EOF
+	case err != nil:
+		return nil, err
+	}
+	if r.remaining >= 0 {
+		r.remaining -= int64(n)
+	}
+
+	r.mono = r.mono[:0]
+	for i := 0; i+r.frame <= n; i += r.frame {
+		r.mono = append(r.mono, r.mix(buf[i:]))
+	}
+	if r.resampler == nil {
+		return r.mono, nil
+	}
+	r.out = r.resampler.process(r.mono, r.out[:0])
+	return r.out, nil
+}
+
+func (r *readerSource) Close() error {
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,215 @@
+package dictation
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-vgo/robotgo"
+)
+
+const (
+	// spoolRetryInterval is how often spooled recordings are retried while
+	// the network stays down.
+	spoolRetryInterval = 30 * time.Second
+	// spoolTimeout bounds each replay attempt.
+	spoolTimeout = 2 * time.Minute
+)
+
+// spoolEntry is the metadata saved next to a spooled recording.
+type spoolEntry struct {
+	Mode       Mode         `json:"mode"`
+	At         time.Time    `json:"at"`
+	App        string       `json:"app,omitempty"`
+	Language   string       `json:"language,omitempty"`
+	Speaker    SpeakerHints `json:"speaker,omitzero"`
+	CodeSwitch bool         `json:"code_switch,omitempty"`
+	Script     Script       `json:"script,omitempty"`
+}
+
+// isOffline reports whether err means the server could not be reached, as
+// opposed to the server rejecting the request.
+func isOffline(err error) bool {
+	if errors.Is(err, ErrBackendUnavailable) {
+		return true
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return false
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// spool saves a recording that could not be transcribed to SpoolDir as WAV
+// with its request metadata, and returns the WAV path.
+func (s *Service) spool(mode Mode, req Request, at time.Time) (string, error) {
+	if err := os.MkdirAll(s.SpoolDir, 0755); err != nil {
+		return "", err
+	}
+	wav, err := encodeWAV(req.Samples, sampleRate)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode WAV: %w", err)
+	}
+	meta, err := json.Marshal(spoolEntry{
+		Mode:       mode,
+		At:         at,
+		App:        req.App,
+		Language:   req.Language,
+		Speaker:    req.Speaker,
+		CodeSwitch: req.CodeSwitch,
+		Script:     req.Script,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	base := filepath.Join(s.SpoolDir, at.Format("2006-01-02_150405.000"))
+	if err := os.WriteFile(base+".json", meta, 0644); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(base+".wav", wav, 0644); err != nil {
+		os.Remove(base + ".json")
+		return "", err
+	}
+	return base + ".wav", nil
+}
+
+// ReplaySpool transcribes recordings spooled while offline, in order,
+// retrying every 30 seconds until the network is back. Dictations are
+// copied to the clipboard and reported to OnReplay, notes are saved as
+// usual. It returns immediately; only one replay runs at a time.
+func (s *Service) ReplaySpool() {
+	if s.SpoolDir == "" {
+		return
+	}
+	s.spoolMu.Lock()
+	defer s.spoolMu.Unlock()
+	if s.replaying {
+		return
+	}
+	s.replaying = true
+	go s.replayLoop()
+}
+
+func (s *Service) replayLoop() {
+	defer func() {
+		s.spoolMu.Lock()
+		s.replaying = false
+		s.spoolMu.Unlock()
+	}()
+
+	for {
+		paths, _ := filepath.Glob(filepath.Join(s.SpoolDir, "*.wav"))
+		if len(paths) == 0 {
+			return
+		}
+		for _, path := range paths { // Glob sorts, so oldest first
+			err := s.replay(path)
+			if isOffline(err) {
+				break
+			}
+			if err != nil {
+				log.Printf("Failed to replay %s, keeping it as .failed: %v", path, err)
+				os.Rename(path, path+".failed")
+			}
+		}
+
+		select {
+		case <-time.After(spoolRetryInterval):
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// replay transcribes and delivers one spooled recording, then removes it.
+func (s *Service) replay(path string) error {
+	base := strings.TrimSuffix(path, ".wav")
+	var entry spoolEntry
+	if data, err := os.ReadFile(base + ".json"); err == nil {
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return fmt.Errorf("invalid spool metadata: %w", err)
+		}
+	}
+	samples, err := readWAV(path)
+	if err != nil {
+		return err
+	}
+
+	if !s.allowRequest() {
+		return ErrBackendUnavailable
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), spoolTimeout)
+	defer cancel()
+	text, err := s.transcriber.Transcribe(ctx, Request{
+		Samples:    samples,
+		Vocabulary: s.Vocabulary,
+		App:        entry.App,
+		Language:   entry.Language,
+		Speaker:    entry.Speaker,
+		CodeSwitch: entry.CodeSwitch,
+		Script:     entry.Script,
+
+		Instructions: s.Instructions,
+	})
+	s.recordOutcome(err)
+	if err != nil {
+		return err
+	}
+
+	text = strings.TrimSpace(s.rewrite(text))
+	if text != "" {
+		if entry.Mode == ModeNote {
+			notePath, err := s.saveNote(text, entry.At)
+			if err != nil {
+				return fmt.Errorf("failed to save note: %w", err)
+			}
+			if s.OnNote != nil {
+				s.OnNote(notePath)
+			}
+		} else if s.Output != nil {
+			s.writeOutput(text)
+		} else {
+			if err := robotgo.WriteAll(text); err != nil {
+				return fmt.Errorf("failed to copy to clipboard: %w", err)
+			}
+			if s.OnReplay != nil {
+				s.OnReplay(text)
+			}
+		}
+	}
+	os.Remove(base + ".json")
+	return os.Remove(path)
+}
+
+// readWAV reads the samples of a WAV file written by encodeWAV.
+func readWAV(path string) ([]int16, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return decodeWAV(data, path)
+}
+
+// decodeWAV returns the samples of a WAV file written by encodeWAV. path
+// names it in errors.
+func decodeWAV(data []byte, path string) ([]int16, error) {
+	const headerSize = 44
+	if len(data) < headerSize || string(data[:4]) != "RIFF" || string(data[36:40]) != "data" {
+		return nil, fmt.Errorf("%s is not a Chrisper WAV file", path)
+	}
+	samples := make([]int16, (len(data)-headerSize)/2)
+	for i := range samples {
+		samples[i] = int16(binary.LittleEndian.Uint16(data[headerSize+i*2:]))
+	}
+	return samples, nil
+}
@@ -0,0 +1,98 @@
+package dictation
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// State is what the service is currently doing.
+type State string
+
+const (
+	StateIdle       State = "idle"
+	StateRecording  State = "recording"
+	StateProcessing State = "processing"
+)
+
+const snippetLength = 80
+
+// Status is a snapshot of the service state, as written to StatusFile.
+type Status struct {
+	State State     `json:"state"`
+	Since time.Time `json:"since"`
+	// LastTranscript is the start of the most recent transcript.
+	LastTranscript string `json:"last_transcript,omitempty"`
+	// Queued is how many stopped recordings are yet to be transcribed
+	// and delivered, in order.
+	Queued int `json:"queued,omitempty"`
+}
+
+// Elapsed returns how long the service has been in its current state.
+func (st Status) Elapsed() time.Duration {
+	return time.Since(st.Since)
+}
+
+// Status returns the current state of the service.
+func (s *Service) Status() Status {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+	return s.status
+}
+
+// ReadStatus reads a status file written by a running service.
+func ReadStatus(path string) (Status, error) {
+	var st Status
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return st, err
+	}
+	err = json.Unmarshal(data, &st)
+	return st, err
+}
+
+func (s *Service) setState(state State) {
+	s.statusMu.Lock()
+	s.status.State = state
+	s.status.Since = time.Now()
+	st := s.status
+	s.statusMu.Unlock()
+	s.writeStatus(st)
+}
+
+func (s *Service) setLastTranscript(text string) {
+	if r := []rune(text); len(r) > snippetLength {
+		text = string(r[:snippetLength]) + "…"
+	}
+	s.statusMu.Lock()
+	s.status.LastTranscript = text
+	st := s.status
+	s.statusMu.Unlock()
+	s.writeStatus(st)
+}
+
+// writeStatus atomically replaces StatusFile so readers never see a
+// partial write.
+func (s *Service) writeStatus(st Status) {
+	if s.StatusFile == "" {
+		return
+	}
+	data, err := json.Marshal(st)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(s.StatusFile), 0755); err != nil {
+		log.Printf("Status file error: %v", err)
+		return
+	}
+	tmp := s.StatusFile + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		log.Printf("Status file error: %v", err)
+		return
+	}
+	if err := os.Rename(tmp, s.StatusFile); err != nil {
+		log.Printf("Status file error: %v", err)
+	}
+}
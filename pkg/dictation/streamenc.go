@@ -0,0 +1,218 @@
+package dictation
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os/exec"
+	"time"
+)
+
+// streamBacklog is how many buffers of audio ffmpeg may fall behind the
+// recording, about four seconds, before encoding is left until it stops.
+const streamBacklog = 64
+
+// uploadEncoder is implemented by backends that compress recordings for
+// upload with encodeForUpload, so they can be encoded while recording.
+type uploadEncoder interface {
+	uploadCompression() Compression
+}
+
+// encodedAudio is a recording already compressed for upload.
+type encodedAudio struct {
+	data     []byte
+	mimeType string
+	samples  int // Length of the recording it encodes
+}
+
+// upload returns the audio of r compressed with preset p, and its MIME
+// type. Audio encoded while recording is used if it covers r.Samples,
+// which it does not for chunks.
+func (r Request) upload(p Compression) ([]byte, string, error) {
+	if e := r.encoded; e != nil && e.samples == len(r.Samples) {
+		return e.data, e.mimeType, nil
+	}
+	return encodeForUpload(r.Samples, p)
+}
+
+// streamEncoder compresses a recording for upload while it is made, so
+// the upload can start the moment it stops. It uses the codec codecFor
+// picks for the length so far, and starts over from the beginning of the
+// recording when that changes. Nothing is encoded while the codec is
+// FLAC, which is quick to encode at the end.
+type streamEncoder struct {
+	ctx     context.Context
+	preset  Compression
+	codec   codec
+	chunkAt int // Samples above which the recording is chunked, or 0
+	run     *ffmpegStream
+	n       int // Samples written to run
+	failed  bool
+}
+
+// newStreamEncoder returns an encoder for a recording that is part of
+// ctx, or nil if the backend does not upload compressed audio, ffmpeg is
+// missing or the recording will be changed before it is uploaded.
+func (s *Service) newStreamEncoder(ctx context.Context) *streamEncoder {
+	u, ok := s.transcriber.(uploadEncoder)
+	if !ok || s.Denoise {
+		return nil
+	}
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		return nil
+	}
+	return &streamEncoder{
+		ctx:     ctx,
+		preset:  u.uploadCompression(),
+		codec:   codecFLAC,
+		chunkAt: int(s.ChunkLength.Seconds()*sampleRate) * 3 / 2,
+	}
+}
+
+// write encodes what audio has gained since the last call. e may be nil.
+func (e *streamEncoder) write(audio *capture) {
+	if e == nil || e.failed {
+		return
+	}
+	if e.chunkAt > 0 && audio.len() > e.chunkAt {
+		// Chunks are encoded one by one.
+		e.stop()
+		e.failed = true
+		return
+	}
+	// Codecs of one preset all have different names.
+	if c := codecFor(time.Duration(audio.len())*time.Second/sampleRate, e.preset); c.name != e.codec.name {
+		e.stop()
+		e.codec = c
+		if c.name != codecFLAC.name {
+			run, err := startFFmpegStream(e.ctx, c)
+			if err != nil {
+				log.Printf("Failed to start %s encoding: %v", c.name, err)
+				e.failed = true
+				return
+			}
+			e.run = run
+		}
+	}
+	if e.run == nil {
+		return
+	}
+	if !e.run.write(pcmBytes(audio.appendRange(nil, e.n, audio.len()))) {
+		log.Printf("%s encoding fell behind, encoding when the recording stops", e.codec.name)
+		e.stop()
+		e.failed = true
+		return
+	}
+	e.n = audio.len()
+}
+
+// finish returns the recording of n samples encoded, or nil if it was not
+// or only in part. e may be nil.
+func (e *streamEncoder) finish(n int) *encodedAudio {
+	if e == nil || e.run == nil {
+		return nil
+	}
+	if e.n != n {
+		e.stop()
+		return nil
+	}
+	data, err := e.run.finish()
+	e.run = nil
+	if err != nil {
+		log.Printf("%s encoding failed: %v", e.codec.name, err)
+		return nil
+	}
+	return &encodedAudio{data: data, mimeType: e.codec.mimeType, samples: n}
+}
+
+// stop discards what has been encoded. e may be nil.
+func (e *streamEncoder) stop() {
+	if e == nil || e.run == nil {
+		return
+	}
+	e.run.abort()
+	e.run, e.n = nil, 0
+}
+
+// ffmpegStream is ffmpeg encoding PCM as it is written.
+type ffmpegStream struct {
+	in     chan []byte
+	cancel context.CancelFunc
+	out    bytes.Buffer
+	stderr bytes.Buffer
+	done   chan error
+}
+
+// startFFmpegStream starts ffmpeg encoding mono PCM at sampleRate with
+// codec c. It is killed if ctx is cancelled.
+func startFFmpegStream(ctx context.Context, c codec) (*ffmpegStream, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	f := &ffmpegStream{
+		in:     make(chan []byte, streamBacklog),
+		cancel: cancel,
+		done:   make(chan error, 1),
+	}
+	cmd := exec.CommandContext(ctx, "ffmpeg", ffmpegArgs(sampleRate, c)...)
+	cmd.Stdout = &f.out
+	cmd.Stderr = &f.stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// Writes go through a goroutine so a slow ffmpeg does not hold up
+	// recording.
+	go func() {
+		var werr error
+		for pcm := range f.in {
+			if werr == nil {
+				_, werr = stdin.Write(pcm)
+			}
+		}
+		stdin.Close()
+		err := cmd.Wait()
+		switch {
+		case err != nil:
+			err = fmt.Errorf("ffmpeg error: %v, stderr: %s", err, f.stderr.String())
+		case werr != nil:
+			err = fmt.Errorf("failed to write to ffmpeg: %w", werr)
+		}
+		f.done <- err
+	}()
+	return f, nil
+}
+
+// write queues pcm for ffmpeg, and reports false if too much is queued.
+func (f *ffmpegStream) write(pcm []byte) bool {
+	select {
+	case f.in <- pcm:
+		return true
+	default:
+		return false
+	}
+}
+
+// finish waits for ffmpeg to encode everything written and returns the
+// encoded audio.
+func (f *ffmpegStream) finish() ([]byte, error) {
+	close(f.in)
+	err := <-f.done
+	f.cancel()
+	if err != nil {
+		return nil, err
+	}
+	return f.out.Bytes(), nil
+}
+
+// abort kills ffmpeg and waits for it to exit.
+func (f *ffmpegStream) abort() {
+	f.cancel()
+	close(f.in)
+	<-f.done
+}
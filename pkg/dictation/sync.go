@@ -0,0 +1,200 @@
+package dictation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// syncTimeout bounds a background sync after a recording.
+const syncTimeout = 5 * time.Minute
+
+// syncIndex is the remote list of entries, so a sync only transfers what
+// changed.
+const syncIndex = "index.json"
+
+// HistoryStore is a remote copy of the history, such as an S3 bucket or a
+// WebDAV folder. Everything put there is already encrypted.
+type HistoryStore interface {
+	// Get returns the named object, or an error wrapping os.ErrNotExist.
+	Get(ctx context.Context, name string) ([]byte, error)
+	Put(ctx context.Context, name string, data []byte) error
+}
+
+// SyncStats counts the entries a sync transferred.
+type SyncStats struct {
+	Uploaded, Downloaded int
+}
+
+// SyncHistory makes the history in dir and the one in store the same. An
+// entry changed on both sides keeps whichever side has the newer latest
+// transcript. Everything uploaded is encrypted with key, so the store only
+// ever sees ciphertext.
+func SyncHistory(ctx context.Context, dir string, key *[32]byte, store HistoryStore) (SyncStats, error) {
+	var stats SyncStats
+	if key == nil {
+		return stats, errors.New("history sync needs history_encryption")
+	}
+
+	remote := make(map[string]time.Time)
+	data, err := store.Get(ctx, syncIndex)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+	case err != nil:
+		return stats, fmt.Errorf("failed to fetch the remote index: %w", err)
+	default:
+		if data, err = unseal(data, key); err != nil {
+			return stats, fmt.Errorf("remote index: %w", err)
+		}
+		if err := json.Unmarshal(data, &remote); err != nil {
+			return stats, fmt.Errorf("invalid remote index: %w", err)
+		}
+	}
+
+	entries, err := ListHistory(dir, key)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return stats, err
+	}
+	local := make(map[string]time.Time, len(entries))
+	for _, e := range entries {
+		local[e.ID] = e.Latest().At
+	}
+
+	changed := false
+	for id, at := range local {
+		if r, ok := remote[id]; ok && !at.After(r) {
+			continue
+		}
+		if err := syncUpload(ctx, dir, key, store, id); err != nil {
+			return stats, fmt.Errorf("failed to upload %s: %w", id, err)
+		}
+		remote[id] = at
+		changed = true
+		stats.Uploaded++
+	}
+	for id, at := range remote {
+		if l, ok := local[id]; ok && !at.After(l) {
+			continue
+		}
+		if err := syncDownload(ctx, dir, store, id); err != nil {
+			return stats, fmt.Errorf("failed to download %s: %w", id, err)
+		}
+		stats.Downloaded++
+	}
+
+	if !changed {
+		return stats, nil
+	}
+	if data, err = json.Marshal(remote); err != nil {
+		return stats, err
+	}
+	if data, err = seal(data, key); err != nil {
+		return stats, err
+	}
+	if err := store.Put(ctx, syncIndex, data); err != nil {
+		return stats, fmt.Errorf("failed to update the remote index: %w", err)
+	}
+	return stats, nil
+}
+
+// SyncSalt makes the passphrase salt in dir the same as the one in store,
+// so every machine derives the same key from the passphrase. The salt is
+// not secret.
+func SyncSalt(ctx context.Context, dir string, store HistoryStore) error {
+	remote, err := store.Get(ctx, saltFile)
+	if errors.Is(err, os.ErrNotExist) {
+		salt, err := historySalt(dir)
+		if err != nil {
+			return err
+		}
+		return store.Put(ctx, saltFile, salt)
+	}
+	if err != nil {
+		return err
+	}
+
+	local, err := os.ReadFile(filepath.Join(dir, saltFile))
+	if errors.Is(err, os.ErrNotExist) {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dir, saltFile), remote, 0644)
+	}
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(local, remote) {
+		return errors.New("the local history was encrypted with a different passphrase salt than the synced one; move it aside to start from the synced history")
+	}
+	return nil
+}
+
+// syncUpload puts an entry's metadata and, the first time, its audio. Files
+// kept before encryption was turned on are encrypted on the way.
+func syncUpload(ctx context.Context, dir string, key *[32]byte, store HistoryStore, id string) error {
+	for _, name := range []string{id + ".wav", id + ".json"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return err
+		}
+		if data, err = unseal(data, key); err != nil {
+			return err
+		}
+		if data, err = seal(data, key); err != nil {
+			return err
+		}
+		if err := store.Put(ctx, name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncDownload fetches an entry, and its audio if it is not here yet. The
+// downloaded files stay encrypted.
+func syncDownload(ctx context.Context, dir string, store HistoryStore, id string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	names := []string{id + ".json"}
+	if _, err := os.Stat(filepath.Join(dir, id+".wav")); err != nil {
+		names = append([]string{id + ".wav"}, names...)
+	}
+	for _, name := range names {
+		data, err := store.Get(ctx, name)
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, name)
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, data, 0600); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncHistory syncs the history with HistorySync in the background. A sync
+// still running is not repeated.
+func (s *Service) syncHistory() {
+	if s.HistorySync == nil || !s.syncMu.TryLock() {
+		return
+	}
+	go func() {
+		defer s.syncMu.Unlock()
+		ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
+		defer cancel()
+		if _, err := SyncHistory(ctx, s.HistoryDir, s.HistoryKey, s.HistorySync); err != nil {
+			log.Printf("History sync failed: %v", err)
+		}
+	}()
+}
@@ -0,0 +1,179 @@
+package dictation
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// SyncConfig describes where the history is synced to.
+type SyncConfig struct {
+	// Type is "s3" for Amazon S3 and compatible services (MinIO, R2, B2 and
+	// so on) or "webdav" (Nextcloud, ownCloud, ...).
+	Type string `json:"type"`
+	// URL is the S3 endpoint, e.g. https://s3.eu-west-1.amazonaws.com, or
+	// the WebDAV folder, which must exist.
+	URL string `json:"url"`
+	// Bucket, Region and Prefix locate the history in S3. Region defaults
+	// to us-east-1.
+	Bucket string `json:"bucket,omitempty"`
+	Region string `json:"region,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+	// User and Password are the WebDAV login or the S3 access key ID and
+	// secret.
+	User     string `json:"user,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// NewHistoryStore connects to the store described by cfg through n.
+func NewHistoryStore(cfg SyncConfig, n Network) (HistoryStore, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("sync URL is required")
+	}
+	httpClient, err := n.httpClient(2 * time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	base := strings.TrimRight(cfg.URL, "/")
+	switch cfg.Type {
+	case "s3":
+		if cfg.Bucket == "" {
+			return nil, fmt.Errorf("sync bucket is required for s3")
+		}
+		if cfg.Region == "" {
+			cfg.Region = "us-east-1"
+		}
+		base += "/" + cfg.Bucket
+		if p := strings.Trim(cfg.Prefix, "/"); p != "" {
+			base += "/" + p
+		}
+		return &s3Store{cfg: cfg, base: base, httpClient: httpClient}, nil
+	case "webdav":
+		return &webdavStore{cfg: cfg, base: base, httpClient: httpClient}, nil
+	default:
+		return nil, fmt.Errorf("unknown sync type %q (want s3 or webdav)", cfg.Type)
+	}
+}
+
+// webdavStore keeps the history in a WebDAV folder.
+type webdavStore struct {
+	cfg        SyncConfig
+	base       string
+	httpClient *http.Client
+}
+
+func (w *webdavStore) Get(ctx context.Context, name string) ([]byte, error) {
+	return w.do(ctx, "GET", name, nil)
+}
+
+func (w *webdavStore) Put(ctx context.Context, name string, data []byte) error {
+	_, err := w.do(ctx, "PUT", name, data)
+	return err
+}
+
+func (w *webdavStore) do(ctx context.Context, method, name string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, w.base+"/"+url.PathEscape(name), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if w.cfg.User != "" {
+		req.SetBasicAuth(w.cfg.User, w.cfg.Password)
+	}
+	return doStore(w.httpClient, req)
+}
+
+// s3Store keeps the history in an S3 bucket, addressed path-style so any
+// compatible service works.
+type s3Store struct {
+	cfg        SyncConfig
+	base       string
+	httpClient *http.Client
+}
+
+func (s *s3Store) Get(ctx context.Context, name string) ([]byte, error) {
+	return s.do(ctx, "GET", name, nil)
+}
+
+func (s *s3Store) Put(ctx context.Context, name string, data []byte) error {
+	_, err := s.do(ctx, "PUT", name, data)
+	return err
+}
+
+func (s *s3Store) do(ctx context.Context, method, name string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.base+"/"+url.PathEscape(name), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	s.sign(req, body, time.Now().UTC())
+	return doStore(s.httpClient, req)
+}
+
+// sign adds an AWS Signature Version 4 to req.
+func (s *s3Store) sign(req *http.Request, body []byte, now time.Time) {
+	sum := sha256.Sum256(body)
+	payload := hex.EncodeToString(sum[:])
+	stamp := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+
+	const signed = "host;x-amz-content-sha256;x-amz-date"
+	canonical := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"",
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payload,
+		"x-amz-date:" + stamp,
+		"",
+		signed,
+		payload,
+	}, "\n")
+	scope := day + "/" + s.cfg.Region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + stamp + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + s.cfg.Password)
+	for _, part := range []string{day, s.cfg.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.cfg.User, scope, signed, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// doStore sends a store request and returns the response body. A missing
+// object is reported as os.ErrNotExist.
+func doStore(c *http.Client, req *http.Request) ([]byte, error) {
+	resp, err := c.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("%s: %w", req.URL.Path, os.ErrNotExist)
+	case resp.StatusCode >= 300:
+		return nil, &APIError{StatusCode: resp.StatusCode, Body: string(data)}
+	}
+	return data, nil
+}
@@ -0,0 +1,67 @@
+package dictation
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+)
+
+var (
+	// tagSentenceRe matches a spoken "tag ..." sentence at the end of a
+	// transcript, e.g. "... all done. Tag project alpha."
+	tagSentenceRe = regexp.MustCompile(`(?i)(?:^|[.!?]\s+)tag(?:ged)?\s+(?:(?:it|this)\s+)?(?:as\s+|with\s+)?([\p{L}\p{N}][\p{L}\p{N}\s,&-]*?)[\s.!?]*$`)
+	tagSplitRe    = regexp.MustCompile(`(?i)\s*(?:,|&|\band\b)\s*`)
+)
+
+// ParseTags splits a spoken "tag ..." sentence off the end of text, such
+// as "Tag project alpha and work.", and returns the rest of the text with
+// the tags it names. Text without one is returned unchanged.
+func ParseTags(text string) (string, []string) {
+	m := tagSentenceRe.FindStringSubmatchIndex(text)
+	if m == nil {
+		return text, nil
+	}
+	var tags []string
+	for _, t := range tagSplitRe.Split(text[m[2]:m[3]], -1) {
+		if t = normalizeTag(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	if len(tags) == 0 {
+		return text, nil
+	}
+	// Keep the full stop that ended the sentence before the tags.
+	rest := text[:m[0]]
+	if m[0] > 0 {
+		rest += text[m[0] : m[0]+1]
+	}
+	return strings.TrimSpace(rest), tags
+}
+
+// normalizeTag makes a tag lower case with dashes for spaces, so "Project
+// Alpha" and "project alpha" are the same tag.
+func normalizeTag(tag string) string {
+	return strings.Join(strings.Fields(strings.ToLower(tag)), "-")
+}
+
+// tags returns text without a spoken tag sentence, if SpokenTags is on, and
+// the tags for its recording: p's defaults and the spoken ones.
+func (s *Service) tags(text string, p Profile) (string, []string) {
+	var tags []string
+	for _, t := range p.Tags {
+		tags = append(tags, normalizeTag(t))
+	}
+	if s.SpokenTags {
+		var spoken []string
+		text, spoken = ParseTags(text)
+		tags = append(tags, spoken...)
+	}
+	slices.Sort(tags)
+	return text, slices.Compact(tags)
+}
+
+// HasTag reports whether e is tagged with tag, in any spelling
+// normalizeTag accepts.
+func (e HistoryEntry) HasTag(tag string) bool {
+	return slices.Contains(e.Tags, normalizeTag(tag))
+}
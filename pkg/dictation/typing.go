@@ -0,0 +1,52 @@
+package dictation
+
+import (
+	"math"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/go-vgo/robotgo"
+)
+
+const (
+	// humanKeyDelay is the typical pause between key presses with
+	// HumanTyping, about 150 words a minute.
+	humanKeyDelay = 70 * time.Millisecond
+	// humanHesitation is the chance of a longer pause before a key.
+	humanHesitation = 0.02
+)
+
+// typeText sends text as key presses: all at once, or one key at a time
+// with uneven pauses with HumanTyping.
+func (s *Service) typeText(text string) {
+	if !s.HumanTyping {
+		robotgo.TypeStr(text)
+		return
+	}
+	var prev rune
+	for i, r := range text {
+		if i > 0 {
+			time.Sleep(keyPause(prev))
+		}
+		robotgo.TypeStr(string(r))
+		prev = r
+	}
+}
+
+// keyPause returns a random pause before the key that follows r. Pauses
+// are log-normally distributed around humanKeyDelay, longer between words
+// and after punctuation, with the occasional hesitation.
+func keyPause(r rune) time.Duration {
+	d := float64(humanKeyDelay) * math.Exp(rand.NormFloat64()*0.4)
+	switch {
+	case strings.ContainsRune(".,;:!?", r):
+		d *= 3
+	case r == ' ':
+		d *= 1.5
+	}
+	if rand.Float64() < humanHesitation {
+		d += float64(400*time.Millisecond) * rand.Float64()
+	}
+	return time.Duration(d)
+}
@@ -0,0 +1,155 @@
+package dictation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+const (
+	// textTokenPrice and outputTokenPrice are the USD prices per text input
+	// and output token for modelName; audio uses audioTokenPrice.
+	textTokenPrice   = 0.10 / 1e6
+	outputTokenPrice = 0.40 / 1e6
+)
+
+// dayFormat keys daily usage totals.
+const dayFormat = "2006-01-02"
+
+// TokenUsage counts the tokens billed for Gemini requests.
+type TokenUsage struct {
+	Requests     int   `json:"requests"`
+	InputTokens  int64 `json:"input_tokens"`
+	OutputTokens int64 `json:"output_tokens"`
+	// Cost is the approximate price in USD.
+	Cost float64 `json:"cost"`
+}
+
+func (u TokenUsage) String() string {
+	return fmt.Sprintf("%d requests, %d input and %d output tokens, ~$%.4f",
+		u.Requests, u.InputTokens, u.OutputTokens, u.Cost)
+}
+
+func (u *TokenUsage) add(o TokenUsage) {
+	u.Requests += o.Requests
+	u.InputTokens += o.InputTokens
+	u.OutputTokens += o.OutputTokens
+	u.Cost += o.Cost
+}
+
+// geminiUsage prices a response's usage metadata. Thinking tokens are
+// billed as output.
+func geminiUsage(m *genai.GenerateContentResponseUsageMetadata) TokenUsage {
+	u := TokenUsage{
+		Requests:     1,
+		InputTokens:  int64(m.PromptTokenCount),
+		OutputTokens: int64(m.CandidatesTokenCount + m.ThoughtsTokenCount),
+	}
+	var audio int64
+	for _, d := range m.PromptTokensDetails {
+		if d.Modality == genai.MediaModalityAudio {
+			audio += int64(d.TokenCount)
+		}
+	}
+	u.Cost = float64(audio)*audioTokenPrice +
+		float64(u.InputTokens-audio)*textTokenPrice +
+		float64(u.OutputTokens)*outputTokenPrice
+	return u
+}
+
+// UsageTracker adds up token usage for this session and per day. Daily
+// totals are kept in a JSON file so they survive restarts and are shared
+// with other Chrisper processes.
+type UsageTracker struct {
+	path    string
+	mu      sync.Mutex
+	session TokenUsage
+}
+
+// NewUsageTracker creates a tracker that keeps daily totals in path. An
+// empty path tracks the session only.
+func NewUsageTracker(path string) *UsageTracker {
+	return &UsageTracker{path: path}
+}
+
+// Add records the usage of one or more requests.
+func (t *UsageTracker) Add(u TokenUsage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.session.add(u)
+	if t.path == "" {
+		return
+	}
+
+	// Re-read the file so totals from other processes are kept.
+	days, err := ReadUsage(t.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Usage file error: %v", err)
+		return
+	}
+	if days == nil {
+		days = make(map[string]TokenUsage)
+	}
+	key := time.Now().Format(dayFormat)
+	day := days[key]
+	day.add(u)
+	days[key] = day
+	if err := writeUsage(t.path, days); err != nil {
+		log.Printf("Usage file error: %v", err)
+	}
+}
+
+// Session returns the usage since the tracker was created.
+func (t *UsageTracker) Session() TokenUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.session
+}
+
+// Today returns today's usage across all sessions.
+func (t *UsageTracker) Today() TokenUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.path == "" {
+		return t.session
+	}
+	days, _ := ReadUsage(t.path)
+	return days[time.Now().Format(dayFormat)]
+}
+
+// ReadUsage reads the daily totals written by a UsageTracker, keyed by
+// date (YYYY-MM-DD).
+func ReadUsage(path string) (map[string]TokenUsage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var days map[string]TokenUsage
+	if err := json.Unmarshal(data, &days); err != nil {
+		return nil, fmt.Errorf("invalid usage file %s: %w", path, err)
+	}
+	return days, nil
+}
+
+// writeUsage atomically replaces the usage file.
+func writeUsage(path string, days map[string]TokenUsage) error {
+	data, err := json.MarshalIndent(days, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,100 @@
+package dictation
+
+import (
+	"context"
+	"log"
+	"math"
+	"time"
+)
+
+const (
+	// minSpeechLevel is the quietest RMS level, after gain, counted as
+	// speech, so a silent room with a very low noise floor is not.
+	minSpeechLevel = 500
+	// speechRatio is how far above the noise floor a frame must be to count
+	// as speech, about 10 dB.
+	speechRatio = 3.0
+	// noiseAdapt is how quickly the noise floor follows non-speech frames.
+	noiseAdapt = 0.05
+	// noiseDrift lets the noise floor creep up during speech, so a noise
+	// source that starts mid-recording is eventually treated as silence.
+	noiseDrift = 1.002
+
+	// defaultSegmentSilence ends an utterance in continuous mode when
+	// SegmentSilence is unset.
+	defaultSegmentSilence = 800 * time.Millisecond
+	// segmentPreRoll is how much audio before an utterance is kept, 300ms.
+	segmentPreRoll = sampleRate * 3 / 10
+	// minUtterance is the least speech in a continuous-mode segment, so a
+	// cough or a door is not transcribed.
+	minUtterance = 200 * time.Millisecond
+)
+
+// vad is an energy-based voice activity detector. It tracks the noise
+// floor of the room and treats frames well above it as speech.
+type vad struct {
+	noise   float64
+	heard   bool          // Speech has been detected
+	voiced  time.Duration // Speech heard in total
+	silence time.Duration // Silence since the last speech
+}
+
+// reset forgets the speech heard so far, keeping the noise floor.
+func (v *vad) reset() {
+	v.heard, v.voiced, v.silence = false, 0, 0
+}
+
+// frame feeds a buffer of samples to the detector and reports whether it
+// contains speech.
+func (v *vad) frame(samples []int16) bool {
+	if len(samples) == 0 {
+		return false
+	}
+	var sum float64
+	for _, s := range samples {
+		sum += float64(s) * float64(s)
+	}
+	level := math.Sqrt(sum / float64(len(samples)))
+
+	switch {
+	case v.noise == 0 || level < v.noise:
+		v.noise = level
+	case level < v.noise*speechRatio:
+		v.noise += (level - v.noise) * noiseAdapt
+	default:
+		v.noise *= noiseDrift
+	}
+
+	speech := level >= minSpeechLevel && level >= v.noise*speechRatio
+	d := time.Duration(len(samples)) * time.Second / sampleRate
+	if speech {
+		v.heard = true
+		v.voiced += d
+		v.silence = 0
+	} else if v.heard {
+		v.silence += d
+	}
+	return speech
+}
+
+// autoStop ends the recording whose audio context is audioCtx, after
+// AutoStopAfter of silence or at MaxRecording, unless it has already been
+// stopped. why is logged.
+func (s *Service) autoStop(audioCtx context.Context, why string) {
+	if s.stopCurrent(audioCtx, why) && s.OnAutoStop != nil {
+		s.OnAutoStop()
+	}
+}
+
+// stopCurrent stops the recording whose audio context is audioCtx unless
+// it has already been stopped, logging why, and reports whether it did.
+func (s *Service) stopCurrent(audioCtx context.Context, why string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.isRecording || audioCtx.Err() != nil {
+		return false
+	}
+	log.Printf("%s, stopping recording", why)
+	s.stopRecordingLocked()
+	return true
+}
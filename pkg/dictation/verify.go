@@ -0,0 +1,107 @@
+package dictation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-vgo/robotgo"
+)
+
+// defaultCorrectThreshold is the share of words that must differ before a
+// typed transcript is corrected.
+const defaultCorrectThreshold = 0.15
+
+// verifyTimeout bounds the background verification request.
+const verifyTimeout = 60 * time.Second
+
+// verify re-transcribes req with the Verifier in the background. If the
+// result differs significantly from typed it is reported to OnCorrection
+// and added to the history entry historyID, if any, and with AutoCorrect
+// the typed text is replaced.
+func (s *Service) verify(req Request, o output, typed, historyID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), verifyTimeout)
+	defer cancel()
+
+	text, err := s.Verifier.Transcribe(ctx, req)
+	if err != nil {
+		if s.OnError != nil {
+			s.OnError(fmt.Errorf("verification failed: %w", err))
+		}
+		return
+	}
+	text = s.rewrite(text)
+	if text == "" {
+		return
+	}
+
+	threshold := s.CorrectThreshold
+	if threshold <= 0 {
+		threshold = defaultCorrectThreshold
+	}
+	d := wordDistance(typed, text)
+	if d < threshold {
+		return
+	}
+	log.Printf("Verification differs by %.0f%% of words", d*100)
+
+	s.setLastTranscript(text)
+	if historyID != "" {
+		v := TranscriptVersion{At: time.Now(), Text: text, Backend: backendName(s.Verifier), Verified: true}
+		if err := s.addHistoryVersion(historyID, v); err != nil {
+			log.Printf("Failed to add verification to history: %v", err)
+		}
+	}
+	if s.OnCorrection != nil {
+		s.OnCorrection(typed, text)
+	}
+	if !s.AutoCorrect || s.Locked() || s.Output != nil {
+		return
+	}
+
+	// Replace the typed text, assuming the cursor is still right after it.
+	for range utf8.RuneCountInString(typed) {
+		robotgo.KeyTap("backspace")
+	}
+	s.setTyped(s.inject(o, text, true))
+}
+
+// wordDistance returns the word-level edit distance between a and b as a
+// share of the longer text, ignoring case and punctuation.
+func wordDistance(a, b string) float64 {
+	wa, wb := normalizeWords(a), normalizeWords(b)
+	n := max(len(wa), len(wb))
+	if n == 0 {
+		return 0
+	}
+
+	// Levenshtein distance over words with a single row.
+	row := make([]int, len(wb)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(wa); i++ {
+		prev := row[0]
+		row[0] = i
+		for j := 1; j <= len(wb); j++ {
+			cur := row[j]
+			if wa[i-1] == wb[j-1] {
+				row[j] = prev
+			} else {
+				row[j] = 1 + min(prev, row[j], row[j-1])
+			}
+			prev = cur
+		}
+	}
+	return float64(row[len(wb)]) / float64(n)
+}
+
+func normalizeWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '\''
+	})
+}
@@ -0,0 +1,68 @@
+//go:build vosk
+
+package dictation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	vosk "github.com/alphacep/vosk-api/go"
+)
+
+// Vosk transcribes audio offline with a local Vosk model. Build with
+// -tags vosk and libvosk installed to enable it.
+type Vosk struct {
+	model *vosk.VoskModel
+}
+
+// NewVosk loads the Vosk model in modelDir.
+func NewVosk(modelDir string) (*Vosk, error) {
+	vosk.SetLogLevel(-1)
+	model, err := vosk.NewModel(modelDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load vosk model from %s: %w", modelDir, err)
+	}
+	return &Vosk{model: model}, nil
+}
+
+// Close releases the model.
+func (v *Vosk) Close() {
+	v.model.Free()
+}
+
+// Transcribe implements Transcriber.
+func (v *Vosk) Transcribe(ctx context.Context, r Request) (string, error) {
+	rec, err := vosk.NewRecognizer(v.model, float64(sampleRate))
+	if err != nil {
+		return "", fmt.Errorf("failed to create vosk recognizer: %w", err)
+	}
+	defer rec.Free()
+
+	// Feed the audio in chunks. Vosk finalizes an utterance at each pause,
+	// so collect every completed segment plus the trailing one.
+	var segments []string
+	pcm := pcmBytes(r.Samples)
+	for len(pcm) > 0 {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		n := min(len(pcm), 8000)
+		if rec.AcceptWaveform(pcm[:n]) == 1 {
+			segments = append(segments, voskText(rec.Result()))
+		}
+		pcm = pcm[n:]
+	}
+	segments = append(segments, voskText(rec.FinalResult()))
+
+	return strings.Join(strings.Fields(strings.Join(segments, " ")), " "), nil
+}
+
+func voskText(result string) string {
+	var res struct {
+		Text string `json:"text"`
+	}
+	json.Unmarshal([]byte(result), &res)
+	return res.Text
+}
@@ -0,0 +1,24 @@
+//go:build !vosk
+
+package dictation
+
+import (
+	"context"
+	"fmt"
+)
+
+// Vosk is only available in builds made with -tags vosk.
+type Vosk struct{}
+
+// NewVosk always fails in builds without the vosk tag.
+func NewVosk(modelDir string) (*Vosk, error) {
+	return nil, fmt.Errorf("vosk backend not compiled in; rebuild with -tags vosk")
+}
+
+// Close releases the model.
+func (v *Vosk) Close() {}
+
+// Transcribe implements Transcriber.
+func (v *Vosk) Transcribe(ctx context.Context, r Request) (string, error) {
+	return "", fmt.Errorf("vosk backend not compiled in; rebuild with -tags vosk")
+}
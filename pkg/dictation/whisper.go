@@ -0,0 +1,157 @@
+//go:build whisper
+
+package dictation
+
+/*
+#cgo LDFLAGS: -lwhisper -lggml -lggml-base
+#include <stdlib.h>
+#include <whisper.h>
+#include <ggml-backend.h>
+
+static struct whisper_context *chrisperWhisperInit(const char *path, bool useGPU, int device) {
+	struct whisper_context_params params = whisper_context_default_params();
+	params.use_gpu = useGPU;
+	params.gpu_device = device;
+	return whisper_init_from_file_with_params(path, params);
+}
+
+// chrisperWhisperGPU returns the description of the first GPU device ggml
+// can use, or NULL when there is none.
+static const char *chrisperWhisperGPU(void) {
+	for (size_t i = 0; i < ggml_backend_dev_count(); i++) {
+		ggml_backend_dev_t dev = ggml_backend_dev_get(i);
+		if (ggml_backend_dev_type(dev) == GGML_BACKEND_DEVICE_TYPE_GPU) {
+			return ggml_backend_dev_description(dev);
+		}
+	}
+	return NULL;
+}
+*/
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+	"sync"
+	"unsafe"
+
+	whisper "github.com/ggerganov/whisper.cpp/bindings/go"
+)
+
+// Whisper transcribes audio offline with a local whisper.cpp model. The
+// recording is handed to the model as raw PCM, so neither ffmpeg nor an
+// encoding step is involved. Build with -tags whisper and libwhisper
+// installed to enable it.
+type Whisper struct {
+	ctx     *whisper.Context
+	threads int
+	mu      sync.Mutex // The context holds a single decoder state
+}
+
+// ProbeWhisper reports the acceleration whisper.cpp can use on this machine.
+func ProbeWhisper() WhisperCapabilities {
+	caps := WhisperCapabilities{
+		CPUs:   runtime.NumCPU(),
+		System: strings.TrimSpace(C.GoString(C.whisper_print_system_info())),
+	}
+	if gpu := C.chrisperWhisperGPU(); gpu != nil {
+		caps.GPU = C.GoString(gpu)
+	}
+	return caps
+}
+
+// NewWhisper loads the ggml model file at modelPath.
+func NewWhisper(modelPath string, opts WhisperOptions) (*Whisper, error) {
+	caps := ProbeWhisper()
+	useGPU := false
+	switch opts.GPU {
+	case "", "auto":
+		useGPU = caps.GPU != ""
+	case "on":
+		if caps.GPU == "" {
+			log.Printf("whisper: no GPU available, using the CPU")
+		}
+		useGPU = caps.GPU != ""
+	case "off":
+	default:
+		return nil, fmt.Errorf("unknown whisper gpu setting %q", opts.GPU)
+	}
+
+	cPath := C.CString(modelPath)
+	defer C.free(unsafe.Pointer(cPath))
+	cctx := C.chrisperWhisperInit(cPath, C.bool(useGPU), C.int(opts.GPUDevice))
+	if cctx == nil {
+		return nil, fmt.Errorf("failed to load whisper model from %s", modelPath)
+	}
+
+	w := &Whisper{
+		ctx:     (*whisper.Context)(unsafe.Pointer(cctx)),
+		threads: opts.Threads,
+	}
+	if w.threads <= 0 {
+		w.threads = caps.threads(useGPU)
+	}
+	if useGPU {
+		log.Printf("whisper: using %s with %d threads", caps.GPU, w.threads)
+	} else {
+		log.Printf("whisper: using the CPU with %d threads", w.threads)
+	}
+	return w, nil
+}
+
+// Close releases the model.
+func (w *Whisper) Close() {
+	w.ctx.Whisper_free()
+}
+
+// Transcribe implements Transcriber.
+func (w *Whisper) Transcribe(ctx context.Context, r Request) (string, error) {
+	if len(r.Samples) == 0 {
+		return "", nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	params := w.ctx.Whisper_full_default_params(whisper.SAMPLING_GREEDY)
+	params.SetPrintSpecial(false)
+	params.SetPrintProgress(false)
+	params.SetPrintRealtime(false)
+	params.SetPrintTimestamps(false)
+	params.SetNoContext(true)
+	params.SetThreads(w.threads)
+	if w.ctx.Whisper_is_multilingual() != 0 {
+		// Default params assume English; -1 detects the language.
+		id := -1
+		if r.Language != "" {
+			if id = w.ctx.Whisper_lang_id(baseLanguage(r.Language)); id < 0 {
+				return "", fmt.Errorf("whisper does not support language %q", r.Language)
+			}
+		}
+		params.SetLanguage(id)
+	}
+	if prompt := whisperPrompt(r); prompt != "" {
+		params.SetInitialPrompt(prompt)
+	}
+
+	samples := make([]float32, len(r.Samples))
+	for i, s := range r.Samples {
+		samples[i] = float32(s) / 32768
+	}
+	// Abort before the next encoder pass once ctx is done.
+	if err := w.ctx.Whisper_full(params, samples, func() bool { return ctx.Err() == nil }, nil, nil); err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", fmt.Errorf("whisper failed: %w", err)
+	}
+
+	var segments []string
+	for i := range w.ctx.Whisper_full_n_segments() {
+		segments = append(segments, w.ctx.Whisper_full_get_segment_text(i))
+	}
+	return strings.Join(strings.Fields(strings.Join(segments, " ")), " "), nil
+}
@@ -0,0 +1,47 @@
+package dictation
+
+import "strings"
+
+// WhisperOptions tunes the local whisper.cpp backend. Zero values use the
+// defaults picked by ProbeWhisper.
+type WhisperOptions struct {
+	// Threads is the number of CPU threads used for decoding.
+	Threads int `json:"threads,omitempty"`
+	// GPU is "auto" (the default: use Metal/CUDA when available), "on" or
+	// "off".
+	GPU string `json:"gpu,omitempty"`
+	// GPUDevice selects the CUDA device on multi-GPU machines.
+	GPUDevice int `json:"gpu_device,omitempty"`
+}
+
+// WhisperCapabilities describes the hardware whisper.cpp can use.
+type WhisperCapabilities struct {
+	// GPU is the first usable GPU device, or "" when there is none.
+	GPU string
+	// CPUs is the number of logical CPUs.
+	CPUs int
+	// System is the whisper.cpp system info line (SIMD and backend flags).
+	System string
+}
+
+// threads picks a default thread count. whisper.cpp scales poorly past
+// eight threads, and with a GPU doing the encoder a few are enough.
+func (c WhisperCapabilities) threads(gpu bool) int {
+	if gpu {
+		return min(c.CPUs, 4)
+	}
+	return min(c.CPUs, 8)
+}
+
+// whisperPrompt builds the initial prompt whisper uses as context: the
+// domain, if known, followed by the vocabulary for spelling.
+func whisperPrompt(r Request) string {
+	var parts []string
+	if r.Speaker.Domain != "" {
+		parts = append(parts, "A dictation about "+r.Speaker.Domain+".")
+	}
+	if len(r.Vocabulary) > 0 {
+		parts = append(parts, strings.Join(r.Vocabulary, ", "))
+	}
+	return strings.Join(parts, " ")
+}
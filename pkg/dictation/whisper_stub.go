@@ -0,0 +1,31 @@
+//go:build !whisper
+
+package dictation
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+)
+
+// Whisper is only available in builds made with -tags whisper.
+type Whisper struct{}
+
+// ProbeWhisper reports the acceleration whisper.cpp can use on this machine.
+// Without the whisper tag only the CPU count is known.
+func ProbeWhisper() WhisperCapabilities {
+	return WhisperCapabilities{CPUs: runtime.NumCPU()}
+}
+
+// NewWhisper always fails in builds without the whisper tag.
+func NewWhisper(modelPath string, opts WhisperOptions) (*Whisper, error) {
+	return nil, fmt.Errorf("whisper backend not compiled in; rebuild with -tags whisper")
+}
+
+// Close releases the model.
+func (w *Whisper) Close() {}
+
+// Transcribe implements Transcriber.
+func (w *Whisper) Transcribe(ctx context.Context, r Request) (string, error) {
+	return "", fmt.Errorf("whisper backend not compiled in; rebuild with -tags whisper")
+}
@@ -0,0 +1,139 @@
+package dictation
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// meterInterval is how many samples each OnMeter call covers, so it is
+	// called once a second.
+	meterInterval = sampleRate
+	// wordsPerSecond of speech estimates the words in audio not yet
+	// transcribed, 150 a minute.
+	wordsPerSecond = 2.5
+	// tokensPerWord estimates the output tokens of a transcript.
+	tokensPerWord = 4.0 / 3
+	// meterWarning is the share of a limit from which Meter.String
+	// mentions it.
+	meterWarning = 0.8
+)
+
+// Meter is a running estimate of the size of a recording, reported to
+// OnMeter while recording so the speaker can tell when it nears a limit.
+type Meter struct {
+	Duration time.Duration
+	// Words is the transcript so far with a live backend, or else an
+	// estimate from the speech heard.
+	Words     int
+	Estimated bool // Words is an estimate
+	// Tokens is the input audio tokens, as in Estimate.
+	Tokens int
+	// OutputTokens estimates the tokens of the transcript.
+	OutputTokens int
+	// Bytes is the uncompressed PCM size.
+	Bytes int
+	// Limit is the share of the nearest limit used, from 0 to 1: of
+	// MaxRecording, which in continuous mode is per utterance, or of the
+	// backend's output token limit for the part of the recording sent at
+	// once.
+	Limit float64
+}
+
+func (m Meter) String() string {
+	sec := int(m.Duration.Seconds())
+	words := fmt.Sprintf("%d words", m.Words)
+	if m.Estimated {
+		words = "~" + words
+	}
+	s := fmt.Sprintf("%s, %d:%02d", words, sec/60, sec%60)
+	if m.Limit >= meterWarning {
+		s += fmt.Sprintf(" (%d%% of limit)", int(min(m.Limit, 1)*100))
+	}
+	return s
+}
+
+// outputLimiter is implemented by backends with a fixed limit on the
+// length of a transcript.
+type outputLimiter interface {
+	// maxOutputTokens returns the limit, or 0 if it grows with the
+	// recording.
+	maxOutputTokens() int
+}
+
+// wordMeter tallies a recording for OnMeter. The samples it counts are
+// all of a recording, even in continuous mode, where the capture is
+// emptied after each utterance.
+type wordMeter struct {
+	samples int
+	next    int // Samples at which to report next
+	speech  vad
+	words   atomic.Int64 // Transcribed live; see transcribed
+	live    atomic.Bool
+}
+
+// newWordMeter returns a meter for a recording, or nil if OnMeter is not
+// set.
+func (s *Service) newWordMeter() *wordMeter {
+	if s.OnMeter == nil {
+		return nil
+	}
+	return &wordMeter{next: meterInterval}
+}
+
+// transcribed records the transcript of a live session so far. m may be
+// nil.
+func (m *wordMeter) transcribed(text string) {
+	if m == nil {
+		return
+	}
+	m.words.Store(int64(len(strings.Fields(text))))
+	m.live.Store(true)
+}
+
+// frame adds samples and calls OnMeter every meterInterval samples. held
+// is how many the capture keeps, which MaxRecording limits. m may be nil.
+func (m *wordMeter) frame(s *Service, samples []int16, held int) {
+	if m == nil {
+		return
+	}
+	m.speech.frame(samples)
+	m.samples += len(samples)
+	if m.samples < m.next {
+		return
+	}
+	m.next += meterInterval
+	s.OnMeter(m.meter(s, held))
+}
+
+// meter returns the tally so far.
+func (m *wordMeter) meter(s *Service, held int) Meter {
+	d := time.Duration(m.samples) * time.Second / sampleRate
+	r := Meter{
+		Duration: d,
+		Tokens:   int(d.Seconds() * audioTokensPerSecond),
+		Bytes:    m.samples * 2,
+	}
+	if m.live.Load() {
+		r.Words = int(m.words.Load())
+	} else {
+		r.Words = int(m.speech.voiced.Seconds() * wordsPerSecond)
+		r.Estimated = true
+	}
+	r.OutputTokens = int(float64(r.Words) * tokensPerWord)
+
+	if limit := s.maxRecording(); limit > 0 {
+		r.Limit = float64(held) / sampleRate / limit.Seconds()
+	}
+	if l, ok := s.transcriber.(outputLimiter); ok && l.maxOutputTokens() > 0 {
+		out := r.OutputTokens
+		if s.ChunkLength > 0 && d > s.ChunkLength*3/2 {
+			// Each chunk has the limit to itself.
+			out = int(float64(out) * s.ChunkLength.Seconds() / d.Seconds())
+		}
+		r.Limit = max(r.Limit, float64(out)/float64(l.maxOutputTokens()))
+	}
+	return r
+}
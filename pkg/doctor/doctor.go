@@ -0,0 +1,103 @@
+// Package doctor checks that Chrisper can actually dictate: a microphone is
+// present, the OS permissions it needs are granted and the API key works.
+package doctor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"chrisper/pkg/config"
+	"chrisper/pkg/dictation"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// keyCheckTimeout bounds the API key lookup so an offline launch is not
+// held up.
+const keyCheckTimeout = 10 * time.Second
+
+// Result is the outcome of one check. Err is nil when the check passed.
+type Result struct {
+	Name string
+	Err  error
+}
+
+// Run performs every check and returns their results in order.
+func Run(ctx context.Context, cfg *config.Config) []Result {
+	results := []Result{
+		{"Microphone", checkMicrophone()},
+	}
+	results = append(results, checkPermissions()...)
+	results = append(results, Result{"API key", checkAPIKey(ctx, cfg)})
+	return results
+}
+
+// Problems returns the failed results.
+func Problems(results []Result) []Result {
+	var failed []Result
+	for _, r := range results {
+		if r.Err != nil {
+			failed = append(failed, r)
+		}
+	}
+	return failed
+}
+
+// Summary describes the failed results in one line each, for a
+// notification.
+func Summary(results []Result) string {
+	var lines []string
+	for _, r := range Problems(results) {
+		lines = append(lines, fmt.Sprintf("%s: %v", r.Name, r.Err))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func checkMicrophone() error {
+	if err := portaudio.Initialize(); err != nil {
+		return fmt.Errorf("audio system unavailable: %w", err)
+	}
+	defer portaudio.Terminate()
+
+	dev, err := portaudio.DefaultInputDevice()
+	if err != nil || dev == nil {
+		return errors.New("no microphone found")
+	}
+	return nil
+}
+
+func checkAPIKey(ctx context.Context, cfg *config.Config) error {
+	if !cfg.UsesGemini() {
+		return nil
+	}
+	keys := cfg.GeminiKeys()
+	if len(keys) == 0 {
+		return errors.New("no Gemini API key set")
+	}
+	g, err := dictation.NewGemini(cfg.Network, keys...)
+	if err != nil {
+		return err
+	}
+	g.Model = cfg.Gemini.Model
+
+	ctx, cancel := context.WithTimeout(ctx, keyCheckTimeout)
+	defer cancel()
+	err = g.CheckKeys(ctx)
+	var apiErr *dictation.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden:
+			return fmt.Errorf("Gemini rejected the key: %w", err)
+		}
+	}
+	if err != nil {
+		// Being offline or rate limited says nothing about the key.
+		log.Printf("Could not check the Gemini API key: %v", err)
+	}
+	return nil
+}
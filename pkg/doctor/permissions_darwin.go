@@ -0,0 +1,60 @@
+//go:build darwin
+
+package doctor
+
+/*
+#cgo CFLAGS: -x objective-c -fobjc-arc
+#cgo LDFLAGS: -framework Foundation -framework AVFoundation -framework ApplicationServices
+
+#import <AVFoundation/AVFoundation.h>
+#import <ApplicationServices/ApplicationServices.h>
+
+// chrisperMicrophoneDenied reports whether microphone access was refused.
+// A permission that has not been asked for yet is not a problem: macOS
+// prompts on first recording.
+static int chrisperMicrophoneDenied(void) {
+	AVAuthorizationStatus status = [AVCaptureDevice authorizationStatusForMediaType:AVMediaTypeAudio];
+	return status == AVAuthorizationStatusDenied || status == AVAuthorizationStatusRestricted;
+}
+
+static int chrisperAccessibilityTrusted(void) {
+	return AXIsProcessTrusted();
+}
+
+// chrisperRequestPermissions shows the system prompts for the microphone,
+// if it has not been asked for, and accessibility, without waiting for
+// the answers.
+static void chrisperRequestPermissions(void) {
+	if ([AVCaptureDevice authorizationStatusForMediaType:AVMediaTypeAudio] == AVAuthorizationStatusNotDetermined) {
+		[AVCaptureDevice requestAccessForMediaType:AVMediaTypeAudio completionHandler:^(BOOL granted) {}];
+	}
+	NSDictionary *options = @{(__bridge NSString *)kAXTrustedCheckOptionPrompt: @YES};
+	AXIsProcessTrustedWithOptions((__bridge CFDictionaryRef)options);
+}
+*/
+import "C"
+
+import "errors"
+
+// checkPermissions covers the microphone, and accessibility access which
+// the global hotkeys and typing need.
+func checkPermissions() []Result {
+	var mic, ax error
+	if C.chrisperMicrophoneDenied() != 0 {
+		mic = errors.New("access denied; allow Chrisper in System Settings > Privacy & Security > Microphone")
+	}
+	if C.chrisperAccessibilityTrusted() == 0 {
+		ax = errors.New("not granted; allow Chrisper in System Settings > Privacy & Security > Accessibility")
+	}
+	return []Result{
+		{"Microphone permission", mic},
+		{"Accessibility permission", ax},
+	}
+}
+
+// RequestPermissions asks macOS to prompt for the permissions that are
+// missing. A microphone permission that was refused cannot be asked for
+// again; it has to be allowed in System Settings.
+func RequestPermissions() {
+	C.chrisperRequestPermissions()
+}
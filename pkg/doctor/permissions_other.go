@@ -0,0 +1,9 @@
+//go:build !darwin
+
+package doctor
+
+// Only macOS gates the microphone and input injection behind permissions.
+func checkPermissions() []Result { return nil }
+
+// RequestPermissions does nothing outside macOS.
+func RequestPermissions() {}
@@ -0,0 +1,57 @@
+package doctor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// permissionState is what PermissionsReset remembers between launches.
+type permissionState struct {
+	Build   string `json:"build"`   // Identifies the executable
+	Granted bool   `json:"granted"` // Its permissions were all granted
+}
+
+// PermissionsReset reports whether permissions the previous build had are
+// missing now that the app has been updated or re-signed: macOS ties them
+// to the code signature and drops them when it changes, and Chrisper
+// would otherwise fail to record or type without saying why. It records
+// the build and its permissions in path for the next launch.
+func PermissionsReset(path string) bool {
+	var last permissionState
+	if data, err := os.ReadFile(path); err == nil {
+		json.Unmarshal(data, &last)
+	}
+	now := permissionState{Build: buildID(), Granted: PermissionError() == nil}
+	if data, err := json.Marshal(now); err == nil {
+		os.MkdirAll(filepath.Dir(path), 0700)
+		os.WriteFile(path, data, 0600)
+	}
+	return now.Build != "" && last.Build != "" && last.Build != now.Build && last.Granted && !now.Granted
+}
+
+// PermissionError returns the OS permissions that are missing, as one
+// error, or nil if none are.
+func PermissionError() error {
+	var errs []error
+	for _, r := range Problems(checkPermissions()) {
+		errs = append(errs, fmt.Errorf("%s: %w", r.Name, r.Err))
+	}
+	return errors.Join(errs...)
+}
+
+// buildID identifies the running executable by its size and modification
+// time, both of which an update or re-signing changes.
+func buildID() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	info, err := os.Stat(exe)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d-%d", info.Size(), info.ModTime().Unix())
+}
@@ -0,0 +1,132 @@
+// Package hooks publishes dictation events to automation tools such as
+// Hammerspoon and Keyboard Maestro, via macOS distributed notifications and
+// a URL callback.
+package hooks
+
+import (
+	"log"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"chrisper/pkg/dictation"
+)
+
+// Event names. Distributed notifications are posted as NotificationPrefix
+// followed by the event name, e.g. "com.chrislaidler.chrisper.transcript".
+const (
+	EventStarted    = "started"
+	EventStopped    = "stopped"
+	EventAutoStop   = "auto_stop"
+	EventProcessing = "processing"
+	EventFinished   = "finished"
+	EventTranscript = "transcript"
+	EventError      = "error"
+
+	NotificationPrefix = "com.chrislaidler.chrisper."
+)
+
+// Config selects which hooks are published.
+type Config struct {
+	// Notifications posts a macOS distributed notification for every event,
+	// with "event" and "text" in its userInfo.
+	Notifications bool `json:"notifications,omitempty"`
+	// CallbackURL is opened in the background for every event after
+	// replacing {{event}} and {{text}} with URL-escaped values, e.g.
+	// "hammerspoon://chrisper?event={{event}}&text={{text}}".
+	CallbackURL string `json:"callback_url,omitempty"`
+}
+
+// Enabled reports whether any hook is configured.
+func (c Config) Enabled() bool {
+	return c.Notifications || c.CallbackURL != ""
+}
+
+type event struct {
+	name, text string
+}
+
+// Publisher delivers events in order on a background goroutine so slow
+// hooks never stall dictation.
+type Publisher struct {
+	cfg    Config
+	events chan event
+}
+
+// New starts a publisher for cfg.
+func New(cfg Config) *Publisher {
+	p := &Publisher{cfg: cfg, events: make(chan event, 64)}
+	go p.run()
+	return p
+}
+
+// Publish queues an event. Events are dropped if the queue is full.
+func (p *Publisher) Publish(name, text string) {
+	select {
+	case p.events <- event{name, text}:
+	default:
+		log.Printf("hooks: dropping %s event, queue full", name)
+	}
+}
+
+// Attach wraps the service callbacks so every state change and transcript
+// is published. Call it after setting the callbacks.
+func (p *Publisher) Attach(s *dictation.Service) {
+	chain := func(prev func(), name string) func() {
+		return func() {
+			if prev != nil {
+				prev()
+			}
+			p.Publish(name, "")
+		}
+	}
+	s.OnStart = chain(s.OnStart, EventStarted)
+	s.OnStop = chain(s.OnStop, EventStopped)
+	s.OnAutoStop = chain(s.OnAutoStop, EventAutoStop)
+	s.OnProcessing = chain(s.OnProcessing, EventProcessing)
+	s.OnFinish = chain(s.OnFinish, EventFinished)
+
+	onResult := s.OnResult
+	s.OnResult = func(r dictation.Result) {
+		if onResult != nil {
+			onResult(r)
+		}
+		p.Publish(EventTranscript, r.Text)
+	}
+	onError := s.OnError
+	s.OnError = func(err error) {
+		if onError != nil {
+			onError(err)
+		}
+		p.Publish(EventError, err.Error())
+	}
+}
+
+func (p *Publisher) run() {
+	for e := range p.events {
+		if p.cfg.Notifications {
+			postNotification(NotificationPrefix+e.name, e.name, e.text)
+		}
+		if p.cfg.CallbackURL != "" {
+			if err := openURL(expandURL(p.cfg.CallbackURL, e)); err != nil {
+				log.Printf("hooks: callback URL failed: %v", err)
+			}
+		}
+	}
+}
+
+func expandURL(tmpl string, e event) string {
+	return strings.NewReplacer(
+		"{{event}}", url.QueryEscape(e.name),
+		"{{text}}", url.QueryEscape(e.text),
+	).Replace(tmpl)
+}
+
+// openURL opens u without bringing the handling app to the foreground.
+func openURL(u string) error {
+	if runtime.GOOS == "darwin" {
+		return exec.Command("open", "-g", u).Run()
+	}
+	return exec.Command("xdg-open", u).Run()
+}
@@ -0,0 +1,38 @@
+//go:build darwin
+
+package hooks
+
+/*
+#cgo CFLAGS: -x objective-c -fobjc-arc
+#cgo LDFLAGS: -framework Foundation
+
+#import <Foundation/Foundation.h>
+#include <stdlib.h>
+
+static void chrisperPostNotification(const char *name, const char *event, const char *text) {
+	@autoreleasepool {
+		NSDictionary *info = @{
+			@"event": [NSString stringWithUTF8String:event],
+			@"text": [NSString stringWithUTF8String:text],
+		};
+		[[NSDistributedNotificationCenter defaultCenter]
+			postNotificationName:[NSString stringWithUTF8String:name]
+			              object:nil
+			            userInfo:info
+			  deliverImmediately:YES];
+	}
+}
+*/
+import "C"
+
+import "unsafe"
+
+func postNotification(name, event, text string) {
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+	cEvent := C.CString(event)
+	defer C.free(unsafe.Pointer(cEvent))
+	cText := C.CString(text)
+	defer C.free(unsafe.Pointer(cText))
+	C.chrisperPostNotification(cName, cEvent, cText)
+}
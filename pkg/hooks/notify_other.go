@@ -0,0 +1,6 @@
+//go:build !darwin
+
+package hooks
+
+// Distributed notifications are macOS only.
+func postNotification(name, event, text string) {}
@@ -0,0 +1,148 @@
+//go:build darwin
+
+package hotkey
+
+/*
+#cgo CFLAGS: -x objective-c -fobjc-arc
+#cgo LDFLAGS: -framework Foundation -framework Carbon
+
+#import <Foundation/Foundation.h>
+#import <Carbon/Carbon.h>
+
+extern void chrisperHotkeyEvent(unsigned int id, int pressed);
+
+static OSStatus chrisperHotkeyHandler(EventHandlerCallRef next, EventRef event, void *data) {
+	EventHotKeyID hkID;
+	GetEventParameter(event, kEventParamDirectObject, typeEventHotKeyID, NULL, sizeof(hkID), NULL, &hkID);
+	chrisperHotkeyEvent(hkID.id, GetEventKind(event) == kEventHotKeyPressed);
+	return noErr;
+}
+
+// chrisperOnMain runs block on the main thread, where Carbon delivers hot
+// key events through the tray's run loop.
+static void chrisperOnMain(dispatch_block_t block) {
+	if ([NSThread isMainThread]) {
+		block();
+	} else {
+		dispatch_sync(dispatch_get_main_queue(), block);
+	}
+}
+
+static OSStatus chrisperRegisterHotkey(unsigned int id, unsigned int keyCode, unsigned int mods, EventHotKeyRef *ref) {
+	__block OSStatus status;
+	chrisperOnMain(^{
+		static BOOL installed = NO;
+		if (!installed) {
+			EventTypeSpec specs[] = {
+				{kEventClassKeyboard, kEventHotKeyPressed},
+				{kEventClassKeyboard, kEventHotKeyReleased},
+			};
+			InstallApplicationEventHandler(&chrisperHotkeyHandler, 2, specs, NULL, NULL);
+			installed = YES;
+		}
+		EventHotKeyID hkID = {'CHRS', id};
+		status = RegisterEventHotKey(keyCode, mods, hkID, GetApplicationEventTarget(), 0, ref);
+	});
+	return status;
+}
+
+static void chrisperUnregisterHotkey(EventHotKeyRef ref) {
+	chrisperOnMain(^{
+		UnregisterEventHotKey(ref);
+	});
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"sync"
+)
+
+// carbonKeys maps key names to macOS virtual key codes.
+var carbonKeys = map[string]C.uint{
+	"a": 0, "s": 1, "d": 2, "f": 3, "h": 4, "g": 5, "z": 6, "x": 7, "c": 8, "v": 9,
+	"b": 11, "q": 12, "w": 13, "e": 14, "r": 15, "y": 16, "t": 17,
+	"1": 18, "2": 19, "3": 20, "4": 21, "6": 22, "5": 23, "9": 25, "7": 26, "8": 28, "0": 29,
+	"o": 31, "u": 32, "i": 34, "p": 35, "l": 37, "j": 38, "k": 40, "n": 45, "m": 46,
+	"enter": 36, "tab": 48, "space": 49, "delete": 51, "esc": 53,
+	"f1": 122, "f2": 120, "f3": 99, "f4": 118, "f5": 96, "f6": 97,
+	"f7": 98, "f8": 100, "f9": 101, "f10": 109, "f11": 103, "f12": 111,
+	"left": 123, "right": 124, "down": 125, "up": 126,
+}
+
+var (
+	carbonMu       sync.Mutex
+	carbonHandlers = map[C.uint]*binding{}
+	carbonNextID   C.uint
+)
+
+// carbonBackend uses Carbon RegisterEventHotKey, which needs no input
+// monitoring permission. Registered combinations are consumed: other apps
+// do not see them.
+type carbonBackend struct{}
+
+func native(name string) (Backend, error) {
+	if name != "carbon" {
+		return nil, fmt.Errorf("unknown hotkey backend %q (use gohook or carbon)", name)
+	}
+	return carbonBackend{}, nil
+}
+
+// Register implements Backend.
+func (b carbonBackend) Register(keys []string, fn func()) (func(), error) {
+	return b.RegisterHold(keys, fn, nil)
+}
+
+// RegisterHold implements Backend.
+func (carbonBackend) RegisterHold(keys []string, down, up func()) (func(), error) {
+	c, err := Parse(keys)
+	if err != nil {
+		return nil, err
+	}
+	code, err := named(carbonKeys, c)
+	if err != nil {
+		return nil, err
+	}
+	var mods C.uint
+	if c.Mods&Shift != 0 {
+		mods |= C.shiftKey
+	}
+	if c.Mods&Control != 0 {
+		mods |= C.controlKey
+	}
+	if c.Mods&Alt != 0 {
+		mods |= C.optionKey
+	}
+	if c.Mods&Command != 0 {
+		mods |= C.cmdKey
+	}
+
+	carbonMu.Lock()
+	carbonNextID++
+	id := carbonNextID
+	carbonHandlers[id] = &binding{down: down, up: up}
+	carbonMu.Unlock()
+
+	var ref C.EventHotKeyRef
+	if status := C.chrisperRegisterHotkey(id, code, mods, &ref); status != C.noErr {
+		carbonMu.Lock()
+		delete(carbonHandlers, id)
+		carbonMu.Unlock()
+		return nil, fmt.Errorf("failed to register hotkey %s (status %d); it may be taken by another app", c, status)
+	}
+	return func() {
+		C.chrisperUnregisterHotkey(ref)
+		carbonMu.Lock()
+		delete(carbonHandlers, id)
+		carbonMu.Unlock()
+	}, nil
+}
+
+func (carbonBackend) consumes() {}
+
+// Run implements Backend. Events arrive through the main run loop, so
+// there is nothing to pump here.
+func (carbonBackend) Run() error {
+	select {}
+}
@@ -0,0 +1,25 @@
+//go:build darwin
+
+package hotkey
+
+// The export lives in its own file: cgo forbids C definitions in the
+// preamble of a file with //export.
+
+import "C"
+
+//export chrisperHotkeyEvent
+func chrisperHotkeyEvent(id C.uint, pressed C.int) {
+	var fn func()
+	carbonMu.Lock()
+	if h := carbonHandlers[id]; h != nil {
+		if pressed != 0 {
+			fn = h.press()
+		} else {
+			fn = h.release()
+		}
+	}
+	carbonMu.Unlock()
+	if fn != nil {
+		go fn()
+	}
+}
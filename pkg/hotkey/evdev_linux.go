@@ -0,0 +1,178 @@
+//go:build linux
+
+package hotkey
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// inputEvent is struct input_event from linux/input.h.
+type inputEvent struct {
+	Time  syscall.Timeval
+	Type  uint16
+	Code  uint16
+	Value int32
+}
+
+const (
+	evKey       = 1
+	keyPressed  = 1
+	keyReleased = 0
+)
+
+// evdevKeys maps key names to linux/input-event-codes.h key codes.
+var evdevKeys = map[string]uint16{
+	"esc": 1, "delete": 14, "tab": 15, "enter": 28, "space": 57,
+	"1": 2, "2": 3, "3": 4, "4": 5, "5": 6, "6": 7, "7": 8, "8": 9, "9": 10, "0": 11,
+	"q": 16, "w": 17, "e": 18, "r": 19, "t": 20, "y": 21, "u": 22, "i": 23, "o": 24, "p": 25,
+	"a": 30, "s": 31, "d": 32, "f": 33, "g": 34, "h": 35, "j": 36, "k": 37, "l": 38,
+	"z": 44, "x": 45, "c": 46, "v": 47, "b": 48, "n": 49, "m": 50,
+	"f1": 59, "f2": 60, "f3": 61, "f4": 62, "f5": 63, "f6": 64, "f7": 65, "f8": 66, "f9": 67, "f10": 68,
+	"f11": 87, "f12": 88,
+	"up": 103, "left": 105, "right": 106, "down": 108,
+}
+
+// evdevModifiers maps modifier key codes, left and right, to modifiers.
+var evdevModifiers = map[uint16]Modifier{
+	29: Control, 97: Control,
+	42: Shift, 54: Shift,
+	56: Alt, 100: Alt,
+	125: Command, 126: Command,
+}
+
+// evdevBackend reads keyboards directly from /dev/input, which works under
+// Wayland but needs read access to the devices (usually membership of the
+// input group). Key presses are observed, not consumed.
+type evdevBackend struct {
+	mu       sync.Mutex
+	held     map[uint16]bool // Modifier keys currently down
+	handlers map[evdevCombo]*binding
+}
+
+type evdevCombo struct {
+	mods Modifier
+	code uint16
+}
+
+func newEvdev() *evdevBackend {
+	return &evdevBackend{held: make(map[uint16]bool), handlers: make(map[evdevCombo]*binding)}
+}
+
+// Register implements Backend.
+func (b *evdevBackend) Register(keys []string, fn func()) (func(), error) {
+	return b.RegisterHold(keys, fn, nil)
+}
+
+// RegisterHold implements Backend.
+func (b *evdevBackend) RegisterHold(keys []string, down, up func()) (func(), error) {
+	c, err := Parse(keys)
+	if err != nil {
+		return nil, err
+	}
+	code, err := named(evdevKeys, c)
+	if err != nil {
+		return nil, err
+	}
+	combo := evdevCombo{c.Mods, code}
+	h := &binding{down: down, up: up}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[combo] = h
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.handlers[combo] == h {
+			delete(b.handlers, combo)
+		}
+	}, nil
+}
+
+// Run implements Backend.
+func (b *evdevBackend) Run() error {
+	paths, _ := filepath.Glob("/dev/input/event*")
+	var opened int
+	var lastErr error
+	var wg sync.WaitGroup
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		opened++
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer f.Close()
+			b.read(f)
+		}()
+	}
+	if opened == 0 {
+		if errors.Is(lastErr, os.ErrPermission) {
+			return fmt.Errorf("no access to /dev/input; add yourself to the input group: %w", lastErr)
+		}
+		return errors.New("no input devices found")
+	}
+	wg.Wait()
+	return errors.New("all input devices closed")
+}
+
+func (b *evdevBackend) read(r io.Reader) {
+	buf := make([]byte, unsafe.Sizeof(inputEvent{}))
+	for {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return
+		}
+		var ev inputEvent
+		if _, err := binary.Decode(buf, binary.NativeEndian, &ev); err != nil || ev.Type != evKey {
+			continue
+		}
+		b.handle(ev.Code, ev.Value)
+	}
+}
+
+func (b *evdevBackend) handle(code uint16, value int32) {
+	b.mu.Lock()
+	if _, ok := evdevModifiers[code]; ok {
+		if value == keyReleased {
+			delete(b.held, code)
+		} else {
+			b.held[code] = true
+		}
+		b.mu.Unlock()
+		return
+	}
+	var fns []func()
+	switch value {
+	case keyPressed:
+		var mods Modifier
+		for held := range b.held {
+			mods |= evdevModifiers[held]
+		}
+		if h := b.handlers[evdevCombo{mods, code}]; h != nil {
+			fns = append(fns, h.press())
+		}
+	case keyReleased:
+		// The modifiers may be let go first, so match the key alone.
+		for combo, h := range b.handlers {
+			if combo.code == code {
+				fns = append(fns, h.release())
+			}
+		}
+	}
+	b.mu.Unlock()
+	for _, fn := range fns {
+		if fn != nil {
+			go fn()
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package hotkey
+
+import (
+	"sync"
+
+	hook "github.com/robotn/gohook"
+)
+
+// gohookBackend observes all keyboard input through gohook. It never
+// consumes key presses, so other apps still see them.
+type gohookBackend struct {
+	mu       sync.Mutex
+	handlers map[Combo]*binding
+	released map[Combo]bool // Combinations hooked for key release
+}
+
+func newGohook() *gohookBackend {
+	return &gohookBackend{handlers: make(map[Combo]*binding), released: make(map[Combo]bool)}
+}
+
+// Register implements Backend.
+func (b *gohookBackend) Register(keys []string, fn func()) (func(), error) {
+	return b.RegisterHold(keys, fn, nil)
+}
+
+// RegisterHold implements Backend. gohook cannot unregister, so each
+// combination is hooked once and dispatches to its current handlers.
+// gohook reports the release of any key in the combination as its
+// release.
+func (b *gohookBackend) RegisterHold(keys []string, down, up func()) (func(), error) {
+	c, err := Parse(keys)
+	if err != nil {
+		return nil, err
+	}
+
+	dispatch := func(event func(*binding) func()) func(hook.Event) {
+		return func(hook.Event) {
+			var fn func()
+			b.mu.Lock()
+			if h := b.handlers[c]; h != nil {
+				fn = event(h)
+			}
+			b.mu.Unlock()
+			if fn != nil {
+				fn()
+			}
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, hooked := b.handlers[c]; !hooked {
+		hook.Register(hook.KeyDown, keys, dispatch((*binding).press))
+	}
+	// Release hooks share gohook state, so only add them where needed.
+	if up != nil && !b.released[c] {
+		hook.Register(hook.KeyUp, keys, dispatch((*binding).release))
+		b.released[c] = true
+	}
+	h := &binding{down: down, up: up}
+	b.handlers[c] = h
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if b.handlers[c] == h {
+			b.handlers[c] = nil
+		}
+	}, nil
+}
+
+// Run implements Backend.
+func (b *gohookBackend) Run() error {
+	s := hook.Start()
+	<-hook.Process(s)
+	return nil
+}
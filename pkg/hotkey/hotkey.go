@@ -0,0 +1,153 @@
+// Package hotkey registers global keyboard shortcuts. gohook works
+// everywhere but needs input monitoring permission and is unreliable under
+// Wayland, so platform-native backends are available as alternatives:
+// Carbon hot keys on macOS, and X11 key grabs or evdev on Linux.
+package hotkey
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Backend delivers global hotkey presses.
+type Backend interface {
+	// Register calls fn whenever the key combination is pressed. Keys use
+	// gohook names, e.g. {"space", "shift", "command"}: any number of
+	// modifiers and one other key. The returned function removes the
+	// hotkey again.
+	Register(keys []string, fn func()) (remove func(), err error)
+	// RegisterHold calls down when the key combination is pressed and up
+	// when it is released again, for push-to-talk. Key repeat while the
+	// keys are held is ignored.
+	RegisterHold(keys []string, down, up func()) (remove func(), err error)
+	// Run dispatches hotkey presses until the process exits.
+	Run() error
+}
+
+// New returns the named backend: "gohook" (the default), "carbon" on
+// macOS, or "x11" or "evdev" on Linux.
+func New(name string) (Backend, error) {
+	switch name {
+	case "", "gohook":
+		return newGohook(), nil
+	default:
+		return native(name)
+	}
+}
+
+// consumer is implemented by backends that take registered combinations
+// away from other apps.
+type consumer interface {
+	consumes()
+}
+
+// Consumes reports whether b takes registered key combinations away from
+// other apps rather than observing them, so that a key such as Escape is
+// best registered only while it is needed. Such backends can register and
+// remove hotkeys from any goroutine while Run dispatches; gohook cannot.
+func Consumes(b Backend) bool {
+	_, ok := b.(consumer)
+	return ok
+}
+
+// Modifier is a set of modifier keys.
+type Modifier uint8
+
+const (
+	Shift Modifier = 1 << iota
+	Control
+	Alt
+	Command // Cmd on macOS, Super elsewhere
+)
+
+// modifierNames are the gohook modifier names.
+var modifierNames = map[string]Modifier{
+	"shift":   Shift,
+	"ctrl":    Control,
+	"control": Control,
+	"alt":     Alt,
+	"command": Command,
+	"cmd":     Command,
+}
+
+// Combo is a parsed key combination.
+type Combo struct {
+	Mods Modifier
+	Key  string // Lower case gohook key name, e.g. "space", "n", "f5"
+}
+
+func (c Combo) String() string {
+	var parts []string
+	for _, m := range []struct {
+		mod  Modifier
+		name string
+	}{{Control, "ctrl"}, {Alt, "alt"}, {Shift, "shift"}, {Command, "command"}} {
+		if c.Mods&m.mod != 0 {
+			parts = append(parts, m.name)
+		}
+	}
+	return strings.Join(append(parts, c.Key), "+")
+}
+
+// Parse reads a key combination in gohook notation.
+func Parse(keys []string) (Combo, error) {
+	var c Combo
+	for _, k := range keys {
+		k = strings.ToLower(strings.TrimSpace(k))
+		if m, ok := modifierNames[k]; ok {
+			c.Mods |= m
+			continue
+		}
+		if c.Key != "" {
+			return Combo{}, fmt.Errorf("hotkey %s has more than one non-modifier key", strings.Join(keys, "+"))
+		}
+		c.Key = k
+	}
+	if c.Key == "" {
+		return Combo{}, fmt.Errorf("hotkey %s has no non-modifier key", strings.Join(keys, "+"))
+	}
+	return c, nil
+}
+
+// binding is a registered hotkey's handlers. Backends call press and
+// release with their lock held and run the returned handler, if any,
+// without it.
+type binding struct {
+	down, up func()
+	held     bool // Pressed and not released yet
+}
+
+// press returns the handler for a key press, or nil for key repeat of a
+// hold hotkey.
+func (b *binding) press() func() {
+	if b.held && b.up != nil {
+		return nil
+	}
+	b.held = true
+	return b.down
+}
+
+// release returns the handler for a key release, or nil if there is none.
+func (b *binding) release() func() {
+	if !b.held {
+		return nil
+	}
+	b.held = false
+	return b.up
+}
+
+// named looks up a key in a backend's key table.
+func named[T any](table map[string]T, c Combo) (T, error) {
+	code, ok := table[c.Key]
+	if !ok {
+		var zero T
+		names := make([]string, 0, len(table))
+		for name := range table {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+		return zero, fmt.Errorf("unsupported key %q in hotkey %s (supported: %s)", c.Key, c, strings.Join(names, ", "))
+	}
+	return code, nil
+}
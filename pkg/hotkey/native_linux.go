@@ -0,0 +1,16 @@
+//go:build linux
+
+package hotkey
+
+import "fmt"
+
+func native(name string) (Backend, error) {
+	switch name {
+	case "x11":
+		return newX11()
+	case "evdev":
+		return newEvdev(), nil
+	default:
+		return nil, fmt.Errorf("unknown hotkey backend %q (use gohook, x11 or evdev)", name)
+	}
+}
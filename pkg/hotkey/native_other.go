@@ -0,0 +1,9 @@
+//go:build !darwin && !linux
+
+package hotkey
+
+import "fmt"
+
+func native(name string) (Backend, error) {
+	return nil, fmt.Errorf("unknown hotkey backend %q (use gohook)", name)
+}
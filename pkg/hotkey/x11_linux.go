@@ -0,0 +1,211 @@
+//go:build linux
+
+package hotkey
+
+/*
+#cgo LDFLAGS: -lX11
+
+#include <X11/Xlib.h>
+#include <X11/XKBlib.h>
+#include <X11/keysym.h>
+#include <poll.h>
+#include <stdlib.h>
+
+static int chrisperX11Error;
+
+// chrisperX11OnError records errors instead of Xlib's default of exiting,
+// so a key already grabbed by another client is reported, not fatal.
+static int chrisperX11OnError(Display *d, XErrorEvent *e) {
+	chrisperX11Error = e->error_code;
+	return 0;
+}
+
+static void chrisperX11Init(void) {
+	XSetErrorHandler(chrisperX11OnError);
+}
+
+// chrisperX11Grab grabs the key on the root window with and without Caps
+// Lock and Num Lock, and returns the X error code (0 on success).
+static int chrisperX11Grab(Display *d, int code, unsigned int mods, int grab) {
+	unsigned int locks[] = {0, LockMask, Mod2Mask, LockMask | Mod2Mask};
+	Window root = DefaultRootWindow(d);
+	chrisperX11Error = 0;
+	for (int i = 0; i < 4; i++) {
+		if (grab) {
+			XGrabKey(d, code, mods | locks[i], root, True, GrabModeAsync, GrabModeAsync);
+		} else {
+			XUngrabKey(d, code, mods | locks[i], root);
+		}
+	}
+	XSync(d, False);
+	return chrisperX11Error;
+}
+
+// chrisperX11Next returns the keycode of the next key press or release,
+// or 0 if none is queued.
+static int chrisperX11Next(Display *d, unsigned int *state, int *pressed) {
+	while (XPending(d) > 0) {
+		XEvent ev;
+		XNextEvent(d, &ev);
+		if (ev.type == KeyPress || ev.type == KeyRelease) {
+			*state = ev.xkey.state;
+			*pressed = ev.type == KeyPress;
+			return ev.xkey.keycode;
+		}
+	}
+	return 0;
+}
+
+static void chrisperX11Wait(Display *d, int timeoutMs) {
+	struct pollfd fd = {ConnectionNumber(d), POLLIN, 0};
+	poll(&fd, 1, timeoutMs);
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"unsafe"
+)
+
+// x11Keys maps key names to X keysym names.
+var x11Keys = map[string]string{
+	"space": "space", "esc": "Escape", "enter": "Return", "tab": "Tab", "delete": "BackSpace",
+	"left": "Left", "right": "Right", "up": "Up", "down": "Down",
+	"f1": "F1", "f2": "F2", "f3": "F3", "f4": "F4", "f5": "F5", "f6": "F6",
+	"f7": "F7", "f8": "F8", "f9": "F9", "f10": "F10", "f11": "F11", "f12": "F12",
+}
+
+func init() {
+	for c := 'a'; c <= 'z'; c++ {
+		x11Keys[string(c)] = string(c)
+	}
+	for c := '0'; c <= '9'; c++ {
+		x11Keys[string(c)] = string(c)
+	}
+}
+
+// x11Grab is a grabbed keycode and modifier mask.
+type x11Grab struct {
+	code C.int
+	mods C.uint
+}
+
+// x11Mods are the modifier bits that tell hotkeys apart; lock keys are
+// ignored.
+const x11Mods = C.ShiftMask | C.ControlMask | C.Mod1Mask | C.Mod4Mask
+
+// x11Backend grabs keys on the X root window. It works without extra
+// permissions but only sees X11 and XWayland input. Grabbed combinations
+// are consumed: other apps do not see them.
+type x11Backend struct {
+	mu       sync.Mutex // Serializes all use of display
+	display  *C.Display
+	handlers map[x11Grab]*binding
+}
+
+func newX11() (*x11Backend, error) {
+	if os.Getenv("DISPLAY") == "" {
+		return nil, errors.New("x11 hotkeys need an X display; try the evdev backend")
+	}
+	C.chrisperX11Init()
+	d := C.XOpenDisplay(nil)
+	if d == nil {
+		return nil, errors.New("failed to open the X display")
+	}
+	// Report held keys as one press and release instead of a release and
+	// press for every repeat.
+	C.XkbSetDetectableAutoRepeat(d, C.True, nil)
+	return &x11Backend{display: d, handlers: make(map[x11Grab]*binding)}, nil
+}
+
+// Register implements Backend.
+func (b *x11Backend) Register(keys []string, fn func()) (func(), error) {
+	return b.RegisterHold(keys, fn, nil)
+}
+
+// RegisterHold implements Backend.
+func (b *x11Backend) RegisterHold(keys []string, down, up func()) (func(), error) {
+	c, err := Parse(keys)
+	if err != nil {
+		return nil, err
+	}
+	name, err := named(x11Keys, c)
+	if err != nil {
+		return nil, err
+	}
+	cName := C.CString(name)
+	defer C.free(unsafe.Pointer(cName))
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	g := x11Grab{code: C.int(C.XKeysymToKeycode(b.display, C.XStringToKeysym(cName)))}
+	if g.code == 0 {
+		return nil, fmt.Errorf("key %q is not on this keyboard", c.Key)
+	}
+	if c.Mods&Shift != 0 {
+		g.mods |= C.ShiftMask
+	}
+	if c.Mods&Control != 0 {
+		g.mods |= C.ControlMask
+	}
+	if c.Mods&Alt != 0 {
+		g.mods |= C.Mod1Mask
+	}
+	if c.Mods&Command != 0 {
+		g.mods |= C.Mod4Mask
+	}
+	if code := C.chrisperX11Grab(b.display, g.code, g.mods, 1); code != 0 {
+		C.chrisperX11Grab(b.display, g.code, g.mods, 0)
+		return nil, fmt.Errorf("failed to grab hotkey %s (X error %d); it may be taken by another app", c, code)
+	}
+	b.handlers[g] = &binding{down: down, up: up}
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		C.chrisperX11Grab(b.display, g.code, g.mods, 0)
+		delete(b.handlers, g)
+	}, nil
+}
+
+func (*x11Backend) consumes() {}
+
+// Run implements Backend.
+func (b *x11Backend) Run() error {
+	for {
+		b.mu.Lock()
+		var fns []func()
+		for {
+			var state C.uint
+			var pressed C.int
+			code := C.chrisperX11Next(b.display, &state, &pressed)
+			if code == 0 {
+				break
+			}
+			if pressed != 0 {
+				if h := b.handlers[x11Grab{code: code, mods: state & x11Mods}]; h != nil {
+					if fn := h.press(); fn != nil {
+						fns = append(fns, fn)
+					}
+				}
+				continue
+			}
+			// The modifiers may be let go first, so match the key alone.
+			for g, h := range b.handlers {
+				if g.code == code {
+					if fn := h.release(); fn != nil {
+						fns = append(fns, fn)
+					}
+				}
+			}
+		}
+		b.mu.Unlock()
+		for _, fn := range fns {
+			go fn()
+		}
+		C.chrisperX11Wait(b.display, 100)
+	}
+}
@@ -0,0 +1,191 @@
+// Package interview runs a self-recorded interview: prepared questions are
+// put one at a time, each answer is recorded and transcribed, and the
+// result is a question and answer document, e.g. for retrospectives or
+// practising for a job interview.
+package interview
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"chrisper/pkg/dictation"
+)
+
+// Tag is added to the history entry of every answer, so a whole interview
+// can be exported with `chrisper export-bundle interview`.
+const Tag = "interview"
+
+// Answer is the transcribed answer to a question.
+type Answer struct {
+	Question string        `json:"question"`
+	Text     string        `json:"answer"`
+	At       time.Time     `json:"at"`
+	Duration time.Duration `json:"duration"`
+	// Err is why nothing was transcribed, if anything went wrong.
+	Err error `json:"-"`
+}
+
+// UI presents the interview.
+type UI interface {
+	// Ask puts question n of total, e.g. by reading it out, and returns
+	// when the answer may be recorded.
+	Ask(n, total int, question string)
+	// Answered shows the transcribed answer.
+	Answered(n, total int, a Answer)
+}
+
+// LoadQuestions reads questions from a text or Markdown file, one per
+// line. Blank lines, headings and comments starting with # are skipped,
+// and list markers are removed.
+func LoadQuestions(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var questions []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimLeft(line, "-*+ ")
+		if i := strings.IndexAny(line, ".)"); i > 0 && strings.Trim(line[:i], "0123456789") == "" {
+			line = strings.TrimSpace(line[i+1:]) // "1. Question" or "1) Question"
+		}
+		if line != "" {
+			questions = append(questions, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(questions) == 0 {
+		return nil, fmt.Errorf("no questions in %s", path)
+	}
+	return questions, nil
+}
+
+// Interview follows a dictation service's recordings.
+type Interview struct {
+	s       *dictation.Service
+	answers chan Answer
+}
+
+// Attach wraps the service callbacks so the interview sees every
+// recording. Call it after setting the callbacks. Lock the service so
+// answers are not typed.
+func Attach(s *dictation.Service) *Interview {
+	iv := &Interview{s: s, answers: make(chan Answer, 1)}
+	var mu sync.Mutex
+	var current Answer
+	onStart := s.OnStart
+	s.OnStart = func() {
+		if onStart != nil {
+			onStart()
+		}
+		mu.Lock()
+		current = Answer{At: time.Now()}
+		mu.Unlock()
+	}
+	onStop := s.OnStop
+	s.OnStop = func() {
+		if onStop != nil {
+			onStop()
+		}
+		mu.Lock()
+		current.Duration = time.Since(current.At)
+		mu.Unlock()
+	}
+	onResult := s.OnResult
+	s.OnResult = func(r dictation.Result) {
+		if onResult != nil {
+			onResult(r)
+		}
+		mu.Lock()
+		current.Text = strings.TrimSpace(current.Text + " " + r.Text)
+		mu.Unlock()
+	}
+	onError := s.OnError
+	s.OnError = func(err error) {
+		if onError != nil {
+			onError(err)
+		}
+		mu.Lock()
+		if current.Err == nil {
+			current.Err = err
+		}
+		mu.Unlock()
+	}
+	onFinish := s.OnFinish
+	s.OnFinish = func() {
+		if onFinish != nil {
+			onFinish()
+		}
+		mu.Lock()
+		a := current
+		mu.Unlock()
+		select {
+		case iv.answers <- a:
+		default: // No question is waiting for an answer
+		}
+	}
+	return iv
+}
+
+// Run puts each question and records its answer, which ends when the
+// recording is stopped or, with AutoStopAfter, when the speaker pauses.
+// It returns the answers so far with the context's error if ctx is
+// cancelled.
+func (iv *Interview) Run(ctx context.Context, questions []string, ui UI) ([]Answer, error) {
+	var answers []Answer
+	for i, q := range questions {
+		ui.Ask(i+1, len(questions), q)
+		// Forget recordings finished while the question was put.
+		select {
+		case <-iv.answers:
+		default:
+		}
+		iv.s.Start(ctx, dictation.ModeDictate, dictation.Profile{Tags: []string{Tag}})
+
+		var a Answer
+		select {
+		case a = <-iv.answers:
+		case <-ctx.Done():
+			return answers, ctx.Err()
+		}
+		a.Question = q
+		ui.Answered(i+1, len(questions), a)
+		answers = append(answers, a)
+	}
+	return answers, nil
+}
+
+// WriteMarkdown writes the answers as a Markdown document with a section
+// per question.
+func WriteMarkdown(w io.Writer, title string, answers []Answer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n", title)
+	if len(answers) > 0 {
+		fmt.Fprintf(&b, "\nRecorded %s.\n", answers[0].At.Format("2006-01-02 15:04"))
+	}
+	for i, a := range answers {
+		text := a.Text
+		switch {
+		case a.Err != nil:
+			text = fmt.Sprintf("_Not transcribed: %v_", a.Err)
+		case text == "":
+			text = "_No answer._"
+		}
+		fmt.Fprintf(&b, "\n## %d. %s\n\n%s\n", i+1, a.Question, text)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,153 @@
+// Package logfile writes the log to a file that is rotated once it grows
+// too large, keeping a few of the old files for a while.
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxSize = 10 << 20
+	defaultMaxAge  = 14 * 24 * time.Hour
+	defaultBackups = 3
+)
+
+// Options bound the disk space the log takes. Zero fields take the
+// defaults.
+type Options struct {
+	// MaxSize rotates the log once it would grow past this many bytes
+	// (default 10 MB).
+	MaxSize int64
+	// MaxAge deletes rotated logs last written longer ago than this
+	// (default 14 days).
+	MaxAge time.Duration
+	// Backups is how many rotated logs are kept (default 3), as path.1,
+	// the newest, to path.N.
+	Backups int
+}
+
+// Writer appends to a log file, rotating it by its Options. It is safe
+// for concurrent use.
+type Writer struct {
+	path string
+	opts Options
+
+	mu   sync.Mutex
+	f    *os.File // nil once closed, or if reopening failed
+	size int64
+}
+
+// Open opens the log at path for appending, creating it and its
+// directory if needed, and deletes rotated logs that have expired.
+func Open(path string, opts Options) (*Writer, error) {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = defaultMaxSize
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = defaultMaxAge
+	}
+	if opts.Backups <= 0 {
+		opts.Backups = defaultBackups
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	w := &Writer{path: path, opts: opts}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	w.prune()
+	return w, nil
+}
+
+// Path returns the file being written.
+func (w *Writer) Path() string {
+	return w.path
+}
+
+// Write implements io.Writer. An entry that would take the log past
+// MaxSize goes to a new file.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f != nil && w.size > 0 && w.size+int64(len(p)) > w.opts.MaxSize {
+		if err := w.rotate(); err != nil {
+			// The log cannot report its own failure.
+			fmt.Fprintf(os.Stderr, "Failed to rotate log: %v\n", err)
+		}
+	}
+	if w.f == nil {
+		return 0, os.ErrClosed
+	}
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close closes the log file.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.f = nil
+	return err
+}
+
+func (w *Writer) open() error {
+	f, err := os.OpenFile(w.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.f, w.size = f, info.Size()
+	return nil
+}
+
+// rotate moves the log to path.1, shifting the older ones up, and starts
+// a new one. w.mu must be held.
+func (w *Writer) rotate() error {
+	w.f.Close()
+	w.f = nil
+	for i := w.opts.Backups - 1; i >= 1; i-- {
+		// Backups that do not exist yet are skipped.
+		os.Rename(w.backup(i), w.backup(i+1))
+	}
+	err := os.Rename(w.path, w.backup(1))
+	if oerr := w.open(); oerr != nil {
+		return oerr
+	}
+	w.prune()
+	return err
+}
+
+// backup returns the path of the nth newest rotated log.
+func (w *Writer) backup(n int) string {
+	return w.path + "." + strconv.Itoa(n)
+}
+
+// prune deletes rotated logs beyond Backups or older than MaxAge.
+func (w *Writer) prune() {
+	matches, _ := filepath.Glob(w.path + ".*")
+	for _, m := range matches {
+		n, err := strconv.Atoi(strings.TrimPrefix(m, w.path+"."))
+		if err != nil {
+			continue
+		}
+		if info, err := os.Stat(m); err == nil && (n > w.opts.Backups || time.Since(info.ModTime()) > w.opts.MaxAge) {
+			os.Remove(m)
+		}
+	}
+}
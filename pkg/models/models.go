@@ -0,0 +1,218 @@
+// Package models downloads and manages the offline whisper.cpp models used
+// by the whisper backend.
+package models
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const baseURL = "https://huggingface.co/ggerganov/whisper.cpp/resolve/main/"
+
+// Names lists the models that can be pulled. The .en variants are English
+// only and more accurate for it at the same size.
+var Names = []string{
+	"tiny", "tiny.en",
+	"base", "base.en",
+	"small", "small.en",
+	"medium", "medium.en",
+	"large-v3", "large-v3-turbo",
+}
+
+// Model is a model known to the cache.
+type Model struct {
+	Name      string
+	Path      string
+	Installed bool
+	Size      int64 // Bytes on disk; zero when not installed
+	// Checksum is the SHA-256 recorded when the model was pulled, or ""
+	// for files placed in the cache by hand.
+	Checksum string
+}
+
+// IsName reports whether s names a known model rather than a file path.
+func IsName(s string) bool {
+	return slices.Contains(Names, s)
+}
+
+// Path returns where model name is stored under dir.
+func Path(dir, name string) string {
+	return filepath.Join(dir, "whisper", "ggml-"+name+".bin")
+}
+
+// checksumPath is the file holding the SHA-256 of the model at path.
+func checksumPath(path string) string {
+	return path + ".sha256"
+}
+
+// List reports every known model and whether it is installed under dir.
+func List(dir string) ([]Model, error) {
+	var list []Model
+	for _, name := range Names {
+		m := Model{Name: name, Path: Path(dir, name)}
+		info, err := os.Stat(m.Path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if err == nil {
+			m.Installed = true
+			m.Size = info.Size()
+			if sum, err := os.ReadFile(checksumPath(m.Path)); err == nil {
+				m.Checksum = strings.TrimSpace(string(sum))
+			}
+		}
+		list = append(list, m)
+	}
+	return list, nil
+}
+
+// Pull downloads model name into dir and returns its path. The download is
+// checked against the SHA-256 published by the server, and fails if there
+// is none. A model that is
+// already installed is verified against its recorded checksum instead of
+// being downloaded again. progress, if set, is called as data arrives;
+// total is -1 when the size is unknown.
+func Pull(ctx context.Context, dir, name string, progress func(done, total int64)) (string, error) {
+	if !IsName(name) {
+		return "", fmt.Errorf("unknown model %q (available: %s)", name, strings.Join(Names, ", "))
+	}
+	path := Path(dir, name)
+	if want, err := os.ReadFile(checksumPath(path)); err == nil {
+		if got, err := fileChecksum(path); err == nil && got == strings.TrimSpace(string(want)) {
+			return path, nil
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", baseURL+filepath.Base(path), nil)
+	if err != nil {
+		return "", err
+	}
+	// Hugging Face serves the LFS object hash, the file's SHA-256, as the
+	// linked ETag of the redirect to its CDN, which does not repeat it.
+	var want string
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		if etag := linkedETag(req.Response); etag != "" {
+			want = etag
+		}
+		return nil
+	}}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("download failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("download failed: %s", resp.Status)
+	}
+	if etag := linkedETag(resp); etag != "" {
+		want = etag
+	}
+	if want == "" {
+		return "", fmt.Errorf("download failed: the server published no checksum for %s", name)
+	}
+
+	// Download next to the destination so a partial file never looks like
+	// a usable model.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".download-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	var body io.Reader = resp.Body
+	if progress != nil {
+		body = &progressReader{r: resp.Body, total: resp.ContentLength, fn: progress}
+	}
+	if _, err := io.Copy(io.MultiWriter(tmp, hash), body); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("download failed: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	sum := hex.EncodeToString(hash.Sum(nil))
+	if want != sum {
+		return "", fmt.Errorf("checksum mismatch for %s: got %s, want %s", name, sum, want)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(checksumPath(path), []byte(sum+"\n"), 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// linkedETag returns the SHA-256 in the X-Linked-Etag header of resp, or
+// "" if it has none.
+func linkedETag(resp *http.Response) string {
+	if resp == nil {
+		return ""
+	}
+	etag := strings.ToLower(strings.Trim(resp.Header.Get("X-Linked-Etag"), `"`))
+	if _, err := hex.DecodeString(etag); err != nil || len(etag) != sha256.Size*2 {
+		return ""
+	}
+	return etag
+}
+
+// Remove deletes model name from dir.
+func Remove(dir, name string) error {
+	if !IsName(name) {
+		return fmt.Errorf("unknown model %q", name)
+	}
+	path := Path(dir, name)
+	if err := os.Remove(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("model %s is not installed", name)
+		}
+		return err
+	}
+	os.Remove(checksumPath(path))
+	return nil
+}
+
+func fileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+type progressReader struct {
+	r     io.Reader
+	done  int64
+	total int64
+	fn    func(done, total int64)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.done += int64(n)
+	p.fn(p.done, p.total)
+	return n, err
+}
@@ -0,0 +1,89 @@
+// Package paths locates the files Chrisper keeps in the directories each
+// platform sets aside for them, so it also works sandboxed, where little
+// else is writable.
+package paths
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// Home returns the directory for settings and user data such as notes
+// and history, ~/.chrisper. In the macOS sandbox, home is the app's
+// container.
+func Home() string {
+	return filepath.Join(home(), ".chrisper")
+}
+
+// Models returns where offline models are kept. On macOS it is
+// ~/Library/Application Support/Chrisper/Models, which unlike Caches is
+// never purged, so models stay available offline; elsewhere it is
+// $XDG_CACHE_HOME/chrisper/models. Models downloaded to ~/.chrisper/models
+// by earlier versions are used where they are.
+func Models() string {
+	if legacy := filepath.Join(Home(), "models"); exists(legacy) {
+		return legacy
+	}
+	if runtime.GOOS == "darwin" {
+		return filepath.Join(home(), "Library", "Application Support", "Chrisper", "Models")
+	}
+	return filepath.Join(Cache(), "models")
+}
+
+// Cache returns the directory for files that can be made again:
+// ~/Library/Caches/Chrisper on macOS and $XDG_CACHE_HOME/chrisper
+// elsewhere.
+func Cache() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "chrisper")
+	}
+	if runtime.GOOS == "darwin" {
+		return filepath.Join(dir, "Chrisper")
+	}
+	return filepath.Join(dir, "chrisper")
+}
+
+// Logs returns the directory for log files: ~/Library/Logs/Chrisper on
+// macOS, where Console finds them, and $XDG_STATE_HOME/chrisper
+// elsewhere.
+func Logs() string {
+	if runtime.GOOS == "darwin" {
+		return filepath.Join(home(), "Library", "Logs", "Chrisper")
+	}
+	state := os.Getenv("XDG_STATE_HOME")
+	if state == "" {
+		state = filepath.Join(home(), ".local", "state")
+	}
+	return filepath.Join(state, "chrisper")
+}
+
+// Temp returns the directory for temporary audio, in Cache, creating it
+// if needed. Only the user can read it.
+func Temp() (string, error) {
+	dir := filepath.Join(Cache(), "tmp")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// CreateTemp creates a temporary file in Temp, like os.CreateTemp.
+func CreateTemp(pattern string) (*os.File, error) {
+	dir, err := Temp()
+	if err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(dir, pattern)
+}
+
+func home() string {
+	home, _ := os.UserHomeDir()
+	return home
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
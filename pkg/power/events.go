@@ -0,0 +1,53 @@
+package power
+
+import "sync"
+
+// Event is a change of the system's sleep or screen lock state.
+type Event int
+
+const (
+	Sleep          Event = iota // The system is about to sleep
+	Wake                        // The system has woken up
+	ScreenLocked                // The screen was locked
+	ScreenUnlocked              // The screen was unlocked
+)
+
+func (e Event) String() string {
+	switch e {
+	case Sleep:
+		return "system going to sleep"
+	case Wake:
+		return "system woke up"
+	case ScreenLocked:
+		return "screen locked"
+	case ScreenUnlocked:
+		return "screen unlocked"
+	}
+	return "unknown power event"
+}
+
+var (
+	watchMu   sync.Mutex
+	watchers  []func(Event)
+	watchOnce sync.Once
+)
+
+// Watch calls fn for every sleep, wake and screen lock event until the
+// process exits. fn runs before the system goes to sleep, which waits for
+// it, so it must return quickly. On macOS all events are reported;
+// elsewhere only Wake is, once the machine has resumed.
+func Watch(fn func(Event)) {
+	watchMu.Lock()
+	watchers = append(watchers, fn)
+	watchMu.Unlock()
+	watchOnce.Do(func() { go watch() })
+}
+
+func dispatch(e Event) {
+	watchMu.Lock()
+	fns := watchers
+	watchMu.Unlock()
+	for _, fn := range fns {
+		fn(e)
+	}
+}
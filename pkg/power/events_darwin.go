@@ -0,0 +1,59 @@
+//go:build darwin
+
+package power
+
+/*
+#cgo LDFLAGS: -framework CoreFoundation -framework IOKit
+
+#include <CoreFoundation/CoreFoundation.h>
+#include <IOKit/pwr_mgt/IOPMLib.h>
+#include <IOKit/IOMessage.h>
+
+extern void chrisperPowerEvent(int event);
+
+static io_connect_t chrisperRootPort;
+
+static void chrisperSleepCallback(void *refcon, io_service_t service, natural_t type, void *arg) {
+	switch (type) {
+	case kIOMessageCanSystemSleep:
+		IOAllowPowerChange(chrisperRootPort, (long)arg);
+		break;
+	case kIOMessageSystemWillSleep:
+		chrisperPowerEvent(0);
+		IOAllowPowerChange(chrisperRootPort, (long)arg);
+		break;
+	case kIOMessageSystemHasPoweredOn:
+		chrisperPowerEvent(1);
+		break;
+	}
+}
+
+static void chrisperScreenCallback(CFNotificationCenterRef center, void *observer, CFStringRef name, const void *object, CFDictionaryRef info) {
+	chrisperPowerEvent(CFStringCompare(name, CFSTR("com.apple.screenIsLocked"), 0) == kCFCompareEqualTo ? 2 : 3);
+}
+
+// chrisperWatchPower registers for sleep and screen lock notifications and
+// runs the calling thread's run loop to deliver them. It never returns.
+static void chrisperWatchPower(void) {
+	IONotificationPortRef port;
+	io_object_t notifier;
+	chrisperRootPort = IORegisterForSystemPower(NULL, &port, chrisperSleepCallback, &notifier);
+	if (chrisperRootPort != MACH_PORT_NULL) {
+		CFRunLoopAddSource(CFRunLoopGetCurrent(), IONotificationPortGetRunLoopSource(port), kCFRunLoopCommonModes);
+	}
+	CFNotificationCenterRef center = CFNotificationCenterGetDistributedCenter();
+	CFNotificationCenterAddObserver(center, NULL, chrisperScreenCallback, CFSTR("com.apple.screenIsLocked"), NULL, CFNotificationSuspensionBehaviorDeliverImmediately);
+	CFNotificationCenterAddObserver(center, NULL, chrisperScreenCallback, CFSTR("com.apple.screenIsUnlocked"), NULL, CFNotificationSuspensionBehaviorDeliverImmediately);
+	CFRunLoopRun();
+}
+*/
+import "C"
+
+import "runtime"
+
+// watch delivers IOKit power notifications and the screen lock
+// distributed notifications on a thread of its own.
+func watch() {
+	runtime.LockOSThread()
+	C.chrisperWatchPower()
+}
@@ -0,0 +1,13 @@
+//go:build darwin
+
+package power
+
+// The export lives in its own file: cgo forbids C definitions in the
+// preamble of a file with //export.
+
+import "C"
+
+//export chrisperPowerEvent
+func chrisperPowerEvent(event C.int) {
+	dispatch(Event(event))
+}
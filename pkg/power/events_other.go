@@ -0,0 +1,21 @@
+//go:build !darwin
+
+package power
+
+import "time"
+
+// wakeCheckInterval is how often the clocks are compared.
+const wakeCheckInterval = 5 * time.Second
+
+// watch reports Wake when the wall clock has moved on further than the
+// monotonic clock, which stops while the machine is suspended.
+func watch() {
+	last := time.Now()
+	for range time.Tick(wakeCheckInterval) {
+		now := time.Now()
+		if now.Round(0).Sub(last.Round(0))-now.Sub(last) > wakeCheckInterval {
+			dispatch(Wake)
+		}
+		last = now
+	}
+}
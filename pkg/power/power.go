@@ -0,0 +1,75 @@
+// Package power reports whether the machine is running on battery or in a
+// low power mode, so features can be scaled back to save energy.
+package power
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// State is a snapshot of the power source.
+type State struct {
+	// OnBattery is true when no external power is connected.
+	OnBattery bool
+	// LowPower is true when the OS low power mode is on (macOS).
+	LowPower bool
+}
+
+// Saving reports whether energy should be saved.
+func (s State) Saving() bool {
+	return s.OnBattery || s.LowPower
+}
+
+// Read returns the current power state. Machines without a battery, and
+// platforms where it cannot be determined, report mains power.
+func Read() State {
+	switch runtime.GOOS {
+	case "darwin":
+		return readDarwin()
+	case "linux":
+		return readLinux()
+	default:
+		return State{}
+	}
+}
+
+func readDarwin() State {
+	var s State
+	if out, err := exec.Command("pmset", "-g", "batt").Output(); err == nil {
+		s.OnBattery = strings.Contains(string(out), "'Battery Power'")
+	}
+	if out, err := exec.Command("pmset", "-g").Output(); err == nil {
+		for _, line := range strings.Split(string(out), "\n") {
+			if f := strings.Fields(line); len(f) == 2 && f[0] == "lowpowermode" {
+				s.LowPower = f[1] == "1"
+			}
+		}
+	}
+	return s
+}
+
+func readLinux() State {
+	supplies, _ := filepath.Glob("/sys/class/power_supply/*")
+	online, haveMains := false, false
+	for _, dir := range supplies {
+		kind := readFile(filepath.Join(dir, "type"))
+		if kind == "Mains" || kind == "USB" {
+			haveMains = true
+			if readFile(filepath.Join(dir, "online")) == "1" {
+				online = true
+			}
+		}
+		if kind == "Battery" && readFile(filepath.Join(dir, "status")) == "Discharging" {
+			return State{OnBattery: true}
+		}
+	}
+	return State{OnBattery: haveMains && !online}
+}
+
+func readFile(path string) string {
+	data, _ := os.ReadFile(path)
+	return strings.TrimSpace(string(data))
+}
@@ -0,0 +1,82 @@
+package presets
+
+import "chrisper/pkg/dictation"
+
+// builtin are the packs that ship with Chrisper.
+var builtin = []Pack{
+	{
+		Name:        "medical",
+		Description: "Clinical notes: drugs, anatomy, abbreviations and doses",
+		Prompt: "The speaker is a clinician dictating medical notes. Use standard medical spelling " +
+			"and abbreviations, write doses and vital signs with digits and units, and keep drug names exact.",
+		Vocabulary: []string{
+			"acetaminophen", "amoxicillin", "atorvastatin", "metformin", "lisinopril",
+			"levothyroxine", "omeprazole", "warfarin", "apixaban", "furosemide",
+			"hypertension", "tachycardia", "bradycardia", "dyspnea", "edema",
+			"myocardial infarction", "atrial fibrillation", "COPD", "CBC", "BMP",
+			"HbA1c", "ECG", "MRI", "CT", "PRN", "BID", "TID", "QID", "NPO", "SOAP",
+		},
+		Rules: []dictation.Rule{
+			{Match: `(?i)\b(\d+(?:\.\d+)?) milligrams?\b`, Replace: "$1 mg"},
+			{Match: `(?i)\b(\d+(?:\.\d+)?) micrograms?\b`, Replace: "$1 mcg"},
+			{Match: `(?i)\b(\d+(?:\.\d+)?) milliliters?\b`, Replace: "$1 mL"},
+			{Match: `(?i)\b(\d+) over (\d+)\b`, Replace: "$1/$2"},
+		},
+	},
+	{
+		Name:        "legal",
+		Description: "Legal drafting: case citations, sections and Latin terms",
+		Prompt: "The speaker is a lawyer dictating legal text. Use formal legal spelling, " +
+			"standard citation forms and capitalized defined terms.",
+		Vocabulary: []string{
+			"plaintiff", "defendant", "appellant", "appellee", "respondent",
+			"affidavit", "subpoena", "indemnification", "estoppel", "tort",
+			"habeas corpus", "amicus curiae", "certiorari", "res judicata", "voir dire",
+			"prima facie", "pro bono", "stare decisis", "inter alia", "mutatis mutandis",
+			"force majeure", "hereinafter", "notwithstanding", "whereas", "LLC",
+		},
+		Rules: []dictation.Rule{
+			{Match: `(?i)\bversus\b`, Replace: "v."},
+			{Match: `(?i)\bsection sign\b\s*`, Replace: "§ "},
+			{Match: `(?i)\bparagraph sign\b\s*`, Replace: "¶ "},
+			{Match: `(?i)\bet cetera\b`, Replace: "etc."},
+		},
+	},
+	{
+		Name:        "devops",
+		Description: "Infrastructure and operations: tools, commands and file names",
+		Prompt: "The speaker is a software engineer talking about infrastructure. Write tool, " +
+			"command and file names as they are typed, in their usual case.",
+		Vocabulary: []string{
+			"Kubernetes", "kubectl", "Helm", "Terraform", "Ansible",
+			"Docker", "Dockerfile", "Prometheus", "Grafana", "Nginx",
+			"PostgreSQL", "Redis", "Kafka", "etcd", "systemd",
+			"GitHub Actions", "CI/CD", "YAML", "JSON", "SSH",
+			"DNS", "TLS", "AWS", "GCP", "Azure", "IAM", "VPC", "EC2", "S3", "SRE",
+		},
+		Rules: []dictation.Rule{
+			{Match: `(?i)\bkube ?(?:control|cuddle|c t l)\b`, Replace: "kubectl"},
+			{Match: `(?i)\bk eights\b`, Replace: "k8s"},
+			{Match: `(?i)\s*\bdot (yaml|yml|json|toml|sh|py|go|md)\b`, Replace: ".$1"},
+			{Match: `(?i)\bpostgres q l\b`, Replace: "PostgreSQL"},
+			{Match: `(?i)\bsee eye see dee\b`, Replace: "CI/CD"},
+		},
+	},
+	{
+		Name:        "academic",
+		Description: "Academic writing: citations, statistics and Latin abbreviations",
+		Prompt: "The speaker is a researcher dictating academic writing. Use formal spelling, " +
+			"write statistics with digits and symbols, and punctuate citations conventionally.",
+		Vocabulary: []string{
+			"hypothesis", "methodology", "epistemology", "ontology", "heuristic",
+			"meta-analysis", "regression", "heteroscedasticity", "covariance", "ANOVA",
+			"Bayesian", "confidence interval", "statistically significant", "peer review", "corpus",
+			"ibid.", "et al.", "cf.", "e.g.", "i.e.",
+		},
+		Rules: []dictation.Rule{
+			{Match: `(?i)\bet al\b\.?`, Replace: "et al."},
+			{Match: `(?i)\bp value\b`, Replace: "p-value"},
+			{Match: `(?i)\bp (?:less than|is less than|<) (0?\.\d+)\b`, Replace: "p < $1"},
+		},
+	},
+}
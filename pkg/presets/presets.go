@@ -0,0 +1,99 @@
+// Package presets provides domain preset packs: a prompt, a vocabulary
+// seed list and rewrite rules for dictating in a field such as medicine,
+// bundled so they can be turned on by name.
+package presets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"chrisper/pkg/dictation"
+)
+
+// Pack is a domain preset. Packs are JSON files in a presets directory,
+// named after the pack, e.g. medical.json; a file there replaces the
+// built-in pack of the same name.
+type Pack struct {
+	Name        string `json:"-"`
+	Description string `json:"description,omitempty"`
+	// Prompt is added to the transcription prompt; see
+	// dictation.Request.Instructions.
+	Prompt     string           `json:"prompt,omitempty"`
+	Vocabulary []string         `json:"vocabulary,omitempty"`
+	Rules      []dictation.Rule `json:"rules,omitempty"`
+}
+
+// Load returns the pack called name: dir/name.json if it exists, otherwise
+// the built-in pack.
+func Load(dir, name string) (Pack, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return Pack{}, fmt.Errorf("invalid preset name %q", name)
+	}
+	if dir != "" {
+		p, err := loadFile(filepath.Join(dir, name+".json"))
+		if err == nil || !errors.Is(err, fs.ErrNotExist) {
+			return p, err
+		}
+	}
+	for _, p := range builtin {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return Pack{}, fmt.Errorf("unknown preset %q", name)
+}
+
+// List returns the built-in packs and those in dir, sorted by name.
+func List(dir string) ([]Pack, error) {
+	packs := slices.Clone(builtin)
+	if dir != "" {
+		paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			p, err := loadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			packs = slices.DeleteFunc(packs, func(b Pack) bool { return b.Name == p.Name })
+			packs = append(packs, p)
+		}
+	}
+	slices.SortFunc(packs, func(a, b Pack) int { return strings.Compare(a.Name, b.Name) })
+	return packs, nil
+}
+
+func loadFile(path string) (Pack, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Pack{}, err
+	}
+	var p Pack
+	if err := json.Unmarshal(data, &p); err != nil {
+		return Pack{}, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	p.Name = strings.TrimSuffix(filepath.Base(path), ".json")
+	return p, nil
+}
+
+// Apply adds the pack to s: its vocabulary, its prompt after any
+// instructions already set, and its rules after any already set.
+func (p Pack) Apply(s *dictation.Service) error {
+	rules, err := dictation.CompileRules(p.Rules)
+	if err != nil {
+		return err
+	}
+	s.Vocabulary = append(s.Vocabulary, p.Vocabulary...)
+	if p.Prompt != "" {
+		s.Instructions = strings.TrimSpace(s.Instructions + " " + p.Prompt)
+	}
+	s.Rules = append(s.Rules, rules...)
+	return nil
+}
@@ -0,0 +1,257 @@
+package schedule
+
+import (
+	"bufio"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxOccurrences bounds the expansion of a recurring event, which may have
+// no end.
+const maxOccurrences = 5000
+
+// event is a calendar event, possibly recurring.
+type event struct {
+	summary    string
+	start, end time.Time
+	// Recurrence, from RRULE. freq is "" for a single event.
+	freq     string
+	interval int
+	count    int
+	until    time.Time
+	byDay    []time.Weekday
+	exdates  map[int64]bool // Unix times of skipped occurrences
+}
+
+// during reports whether any occurrence of e covers t.
+func (e event) during(t time.Time) bool {
+	length := e.end.Sub(e.start)
+	if e.freq == "" {
+		return !t.Before(e.start) && t.Before(e.end)
+	}
+	if t.Before(e.start) || (!e.until.IsZero() && t.After(e.until.Add(length))) {
+		return false
+	}
+
+	n := 0
+	for week := e.start; n < maxOccurrences; {
+		// The occurrences of one period, in order.
+		var starts []time.Time
+		switch e.freq {
+		case "DAILY":
+			starts = []time.Time{week}
+		case "WEEKLY":
+			if len(e.byDay) == 0 {
+				starts = []time.Time{week}
+				break
+			}
+			monday := week.AddDate(0, 0, -((int(week.Weekday()) + 6) % 7))
+			for _, d := range e.byDay {
+				s := monday.AddDate(0, 0, (int(d)+6)%7)
+				if !s.Before(e.start) {
+					starts = append(starts, s)
+				}
+			}
+		default:
+			return false // Unsupported recurrence
+		}
+		for _, s := range starts {
+			if !e.until.IsZero() && s.After(e.until) {
+				return false
+			}
+			if n++; e.count > 0 && n > e.count {
+				return false
+			}
+			if s.After(t) {
+				return false
+			}
+			if !e.exdates[s.Unix()] && t.Before(s.Add(length)) {
+				return true
+			}
+		}
+		if e.freq == "DAILY" {
+			week = week.AddDate(0, 0, e.interval)
+		} else {
+			week = week.AddDate(0, 0, 7*e.interval)
+		}
+	}
+	return false
+}
+
+// parseICS reads the events of an iCalendar feed. Of recurring events,
+// only the DAILY and WEEKLY rules meetings use are supported.
+func parseICS(r io.Reader) ([]event, error) {
+	var lines []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		// Long lines are folded onto lines starting with whitespace.
+		if len(lines) > 0 && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	var events []event
+	var e *event
+	var allDay bool
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		name, params, _ := strings.Cut(name, ";")
+		switch strings.ToUpper(name) {
+		case "BEGIN":
+			if value == "VEVENT" {
+				e = &event{interval: 1}
+				allDay = false
+			}
+		case "END":
+			if value == "VEVENT" && e != nil {
+				if e.end.IsZero() {
+					e.end = e.start
+					if allDay {
+						e.end = e.start.AddDate(0, 0, 1)
+					}
+				}
+				if !e.start.IsZero() {
+					events = append(events, *e)
+				}
+				e = nil
+			}
+		}
+		if e == nil {
+			continue
+		}
+		switch strings.ToUpper(name) {
+		case "SUMMARY":
+			e.summary = unescapeText(value)
+		case "DTSTART":
+			e.start, allDay = parseTime(value, params)
+		case "DTEND":
+			e.end, _ = parseTime(value, params)
+		case "DURATION":
+			if d, ok := parseDuration(value); ok {
+				e.end = e.start.Add(d)
+			}
+		case "RRULE":
+			parseRRule(e, value)
+		case "EXDATE":
+			for _, v := range strings.Split(value, ",") {
+				if t, _ := parseTime(v, params); !t.IsZero() {
+					if e.exdates == nil {
+						e.exdates = make(map[int64]bool)
+					}
+					e.exdates[t.Unix()] = true
+				}
+			}
+		}
+	}
+	return events, nil
+}
+
+// parseTime reads a DATE or DATE-TIME value, in UTC, the TZID parameter's
+// zone or local time. It reports whether the value was a whole day.
+func parseTime(value, params string) (time.Time, bool) {
+	loc := time.Local
+	for _, p := range strings.Split(params, ";") {
+		if k, v, _ := strings.Cut(p, "="); strings.EqualFold(k, "TZID") {
+			if l, err := time.LoadLocation(strings.Trim(v, `"`)); err == nil {
+				loc = l
+			}
+		}
+	}
+	if t, err := time.ParseInLocation("20060102T150405Z", value, time.UTC); err == nil {
+		return t, false
+	}
+	if t, err := time.ParseInLocation("20060102T150405", value, loc); err == nil {
+		return t, false
+	}
+	if t, err := time.ParseInLocation("20060102", value, time.Local); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// parseDuration reads an iCalendar duration such as PT1H30M or P1D.
+func parseDuration(s string) (time.Duration, bool) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "+"), "P")
+	var d time.Duration
+	var num string
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			num += string(c)
+			continue
+		case c == 'T':
+			continue
+		}
+		n, err := strconv.Atoi(num)
+		if err != nil {
+			return 0, false
+		}
+		num = ""
+		switch c {
+		case 'W':
+			d += time.Duration(n) * 7 * 24 * time.Hour
+		case 'D':
+			d += time.Duration(n) * 24 * time.Hour
+		case 'H':
+			d += time.Duration(n) * time.Hour
+		case 'M':
+			d += time.Duration(n) * time.Minute
+		case 'S':
+			d += time.Duration(n) * time.Second
+		default:
+			return 0, false
+		}
+	}
+	return d, true
+}
+
+var icsDays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday,
+	"TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+func parseRRule(e *event, value string) {
+	for _, part := range strings.Split(value, ";") {
+		k, v, _ := strings.Cut(part, "=")
+		switch strings.ToUpper(k) {
+		case "FREQ":
+			e.freq = strings.ToUpper(v)
+		case "INTERVAL":
+			if n, err := strconv.Atoi(v); err == nil && n > 0 {
+				e.interval = n
+			}
+		case "COUNT":
+			e.count, _ = strconv.Atoi(v)
+		case "UNTIL":
+			e.until, _ = parseTime(v, "")
+		case "BYDAY":
+			for _, d := range strings.Split(v, ",") {
+				if wd, ok := icsDays[strings.ToUpper(d)]; ok {
+					e.byDay = append(e.byDay, wd)
+				}
+			}
+			// In week order, Monday first.
+			slices.SortFunc(e.byDay, func(a, b time.Weekday) int {
+				return (int(a)+6)%7 - (int(b)+6)%7
+			})
+		}
+	}
+}
+
+// unescapeText undoes iCalendar TEXT escaping.
+func unescapeText(s string) string {
+	return strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(s)
+}
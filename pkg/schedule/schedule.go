@@ -0,0 +1,231 @@
+// Package schedule picks the default dictation profile by time of day,
+// weekday or calendar events, e.g. a meeting notes profile whenever the
+// calendar has a meeting.
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// refreshInterval is how often calendars are fetched again.
+	refreshInterval = 15 * time.Minute
+	// fetchTimeout bounds each calendar download.
+	fetchTimeout = 30 * time.Second
+)
+
+// Rule selects Profile while all of its conditions hold.
+type Rule struct {
+	Profile string `json:"profile"`
+	// Days limits the rule to weekdays, e.g. ["mon", "tue"]. Empty means
+	// every day.
+	Days []string `json:"days,omitempty"`
+	// From and To limit the rule to a time of day, e.g. "09:00" to
+	// "17:30". A To before From spans midnight.
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+	// Calendar is an ICS feed URL or file. The rule then only applies
+	// during its events, or only those whose title contains Match (ignoring
+	// case) if set.
+	Calendar string `json:"calendar,omitempty"`
+	Match    string `json:"match,omitempty"`
+}
+
+// rule is a parsed Rule.
+type rule struct {
+	Rule
+	days     map[time.Weekday]bool
+	from, to time.Duration // Since midnight; both zero for all day
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Schedule evaluates rules in order; the first that applies wins.
+type Schedule struct {
+	rules []rule
+
+	mu        sync.Mutex
+	calendars map[string]*calendar
+}
+
+// calendar is a cached ICS feed.
+type calendar struct {
+	events   []event
+	fetched  time.Time
+	fetching bool
+}
+
+// New parses rules and starts fetching their calendars.
+func New(rules []Rule) (*Schedule, error) {
+	s := &Schedule{calendars: make(map[string]*calendar)}
+	for i, r := range rules {
+		if r.Profile == "" {
+			return nil, fmt.Errorf("schedule rule %d has no profile", i+1)
+		}
+		p := rule{Rule: r}
+		if len(r.Days) > 0 {
+			p.days = make(map[time.Weekday]bool)
+			for _, d := range r.Days {
+				wd, ok := weekdays[strings.ToLower(d)[:min(3, len(d))]]
+				if !ok {
+					return nil, fmt.Errorf("schedule rule %d: unknown day %q", i+1, d)
+				}
+				p.days[wd] = true
+			}
+		}
+		if r.From != "" || r.To != "" {
+			var err error
+			if p.from, err = parseClock(r.From); err != nil {
+				return nil, fmt.Errorf("schedule rule %d: %w", i+1, err)
+			}
+			if p.to, err = parseClock(r.To); err != nil {
+				return nil, fmt.Errorf("schedule rule %d: %w", i+1, err)
+			}
+		}
+		if r.Calendar != "" {
+			s.calendars[r.Calendar] = &calendar{}
+		}
+		s.rules = append(s.rules, p)
+	}
+	for source := range s.calendars {
+		s.refresh(source)
+	}
+	return s, nil
+}
+
+// parseClock reads a time of day such as "09:00".
+func parseClock(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q (want HH:MM)", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Profile returns the profile scheduled at now, or "" if no rule applies.
+// Calendars are refreshed in the background, so it never waits for the
+// network.
+func (s *Schedule) Profile(now time.Time) string {
+	for _, r := range s.rules {
+		if s.applies(r, now) {
+			return r.Profile
+		}
+	}
+	return ""
+}
+
+func (s *Schedule) applies(r rule, now time.Time) bool {
+	clock := now.Sub(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()))
+	day := now.Weekday()
+	if r.from != r.to {
+		in := clock >= r.from && clock < r.to
+		if r.to < r.from {
+			in = clock >= r.from || clock < r.to
+			if clock < r.to {
+				day = now.AddDate(0, 0, -1).Weekday() // Started yesterday
+			}
+		}
+		if !in {
+			return false
+		}
+	}
+	if r.days != nil && !r.days[day] {
+		return false
+	}
+	if r.Calendar == "" {
+		return true
+	}
+
+	events := s.events(r.Calendar)
+	match := strings.ToLower(r.Match)
+	for _, e := range events {
+		if e.during(now) && strings.Contains(strings.ToLower(e.summary), match) {
+			return true
+		}
+	}
+	return false
+}
+
+// events returns the cached events of source, refreshing them if they are
+// stale.
+func (s *Schedule) events(source string) []event {
+	s.mu.Lock()
+	c := s.calendars[source]
+	stale := time.Since(c.fetched) > refreshInterval
+	events := c.events
+	s.mu.Unlock()
+	if stale {
+		s.refresh(source)
+	}
+	return events
+}
+
+// refresh fetches source in the background unless that is already
+// happening.
+func (s *Schedule) refresh(source string) {
+	s.mu.Lock()
+	c := s.calendars[source]
+	if c.fetching {
+		s.mu.Unlock()
+		return
+	}
+	c.fetching = true
+	s.mu.Unlock()
+
+	go func() {
+		events, err := fetch(source)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		c.fetching = false
+		c.fetched = time.Now()
+		if err != nil {
+			log.Printf("Calendar %s: %v", source, err)
+			return
+		}
+		c.events = events
+	}()
+}
+
+// fetch reads and parses an ICS feed from a URL or file.
+func fetch(source string) ([]event, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") && !strings.HasPrefix(source, "webcal://") {
+		f, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return parseICS(f)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+	url := strings.Replace(source, "webcal://", "https://", 1)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return parseICS(resp.Body)
+}
@@ -0,0 +1,199 @@
+// Package server serves transcription over HTTP in the form of OpenAI's
+// /v1/audio/transcriptions API, backed by whatever backend Chrisper is
+// configured with, so tools written for that API or for a local Whisper
+// server can use Chrisper instead.
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"chrisper/pkg/dictation"
+	"chrisper/pkg/paths"
+)
+
+const (
+	// TranscriptionsPath is where the transcription endpoint is served.
+	TranscriptionsPath = "/v1/audio/transcriptions"
+	// maxUpload is the largest audio file accepted, OpenAI's limit.
+	maxUpload = 25 << 20
+	// maxMemory is how much of an upload is held in memory; the rest goes
+	// to a temporary file.
+	maxMemory = 1 << 20
+)
+
+// Options configure the server.
+type Options struct {
+	// Token, if set, must be sent as a bearer token, which OpenAI clients
+	// do with their API key.
+	Token string
+	// Profile overrides service settings for every request. A request's
+	// language replaces the profile's.
+	Profile dictation.Profile
+}
+
+type handler struct {
+	s    *dictation.Service
+	opts Options
+}
+
+// New returns a handler that transcribes audio posted to
+// TranscriptionsPath with s. The model and prompt fields of a request are
+// accepted and ignored: the service's backend and settings are used.
+func New(s *dictation.Service, opts Options) http.Handler {
+	h := &handler{s: s, opts: opts}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST "+TranscriptionsPath, h.transcriptions)
+	return mux
+}
+
+func (h *handler) transcriptions(w http.ResponseWriter, r *http.Request) {
+	if h.opts.Token != "" && !h.authorized(r) {
+		writeError(w, http.StatusUnauthorized, "invalid_api_key", "Incorrect API key provided")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxUpload)
+	if err := r.ParseMultipartForm(maxMemory); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("Could not parse multipart form: %v", err))
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	format := r.FormValue("response_format")
+	switch format {
+	case "":
+		format = "json"
+	case "json", "text", "verbose_json", "srt", "vtt":
+	default:
+		writeError(w, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("Unsupported response_format %q", format))
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "An audio file is required")
+		return
+	}
+	defer file.Close()
+
+	// The decoder, and ffmpeg, read files.
+	path, err := saveUpload(file)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "server_error", fmt.Sprintf("Failed to save upload: %v", err))
+		return
+	}
+	defer os.Remove(path)
+
+	p := h.opts.Profile
+	if lang := r.FormValue("language"); lang != "" {
+		p.Language = lang
+	}
+	res, err := h.s.TranscribeFile(r.Context(), path, p)
+	if err != nil {
+		log.Printf("Transcription request failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	log.Printf("Transcribed %s of audio for %s", res.Duration.Round(time.Second), r.RemoteAddr)
+	writeResult(w, format, res, p.Language)
+}
+
+// authorized reports whether r carries the token, compared in constant
+// time so response times do not give it away.
+func (h *handler) authorized(r *http.Request) bool {
+	got := []byte(r.Header.Get("Authorization"))
+	want := []byte("Bearer " + h.opts.Token)
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+// saveUpload copies an uploaded file to a temporary file and returns its
+// path.
+func saveUpload(file io.Reader) (string, error) {
+	f, err := paths.CreateTemp("upload-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, file); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// verboseResult is the verbose_json response, with the whole transcript
+// as one segment.
+type verboseResult struct {
+	Task     string           `json:"task"`
+	Language string           `json:"language,omitempty"`
+	Duration float64          `json:"duration"`
+	Text     string           `json:"text"`
+	Segments []verboseSegment `json:"segments"`
+}
+
+type verboseSegment struct {
+	ID    int     `json:"id"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
+
+// writeResult writes res in format. language is the one asked for, if the
+// backend did not detect one.
+func writeResult(w http.ResponseWriter, format string, res dictation.Result, language string) {
+	text := strings.TrimSpace(res.Text)
+	switch format {
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, text)
+	case "srt":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintf(w, "1\n%s --> %s\n%s\n", cueTime(0, ","), cueTime(res.Duration, ","), text)
+	case "vtt":
+		w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+		fmt.Fprintf(w, "WEBVTT\n\n%s --> %s\n%s\n", cueTime(0, "."), cueTime(res.Duration, "."), text)
+	case "verbose_json":
+		if res.Language != "" {
+			language = res.Language
+		}
+		writeJSON(w, http.StatusOK, verboseResult{
+			Task:     "transcribe",
+			Language: language,
+			Duration: res.Duration.Seconds(),
+			Text:     text,
+			Segments: []verboseSegment{{End: res.Duration.Seconds(), Text: text}},
+		})
+	default:
+		writeJSON(w, http.StatusOK, map[string]string{"text": text})
+	}
+}
+
+// cueTime formats an offset as a subtitle timestamp, hh:mm:ss,mmm for SRT
+// and hh:mm:ss.mmm for WebVTT.
+func cueTime(d time.Duration, sep string) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
+
+// writeError writes an error in the shape OpenAI clients expect.
+func writeError(w http.ResponseWriter, status int, kind, message string) {
+	writeJSON(w, status, map[string]any{
+		"error": map[string]any{"message": message, "type": kind},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,174 @@
+// Package tutorial walks a new user through their first dictations:
+// starting and stopping a recording, punctuation, and correcting a
+// mistake. Each step is checked against what the dictation service
+// actually reported, so a tutorial that passes means dictation works.
+package tutorial
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"unicode"
+
+	"chrisper/pkg/dictation"
+)
+
+// Step is one lesson.
+type Step struct {
+	Title string
+	// Instruction says what to do and what to say.
+	Instruction string
+	// Hint is shown when an attempt does not pass.
+	Hint string
+	// check reports whether a transcript passes the step.
+	check func(text string) bool
+}
+
+// Steps are the lessons in order.
+var Steps = []Step{
+	{
+		Title:       "Your first dictation",
+		Instruction: "Start recording with the hotkey, say \"Hello world, this is my first dictation\", then press the hotkey again to stop.",
+		Hint:        "Nothing matching was heard. Check that the right microphone is selected, speak close to it and wait for the recording to start before talking.",
+		check:       similar("hello world this is my first dictation"),
+	},
+	{
+		Title:       "Punctuation",
+		Instruction: "Punctuation comes from how you speak, or you can say it. Record \"Can you hear me question mark\".",
+		Hint:        "No question mark came out. Ask it as a question, or say \"question mark\" clearly at the end.",
+		check: func(text string) bool {
+			return strings.Contains(text, "?") && similar("can you hear me")(text)
+		},
+	},
+	{
+		Title:       "Correcting a mistake",
+		Instruction: "If something comes out wrong, undo it in the app (Cmd+Z or Ctrl+Z) and simply dictate it again. Try it: record \"The meeting is on Thursday\".",
+		Hint:        "That was not quite it. Undo it and dictate the sentence again.",
+		check: func(text string) bool {
+			return similar("the meeting is on thursday")(text) && strings.Contains(strings.ToLower(text), "thursday")
+		},
+	},
+}
+
+// Attempt is the outcome of one recording.
+type Attempt struct {
+	Text string // Everything transcribed; "" if nothing was heard
+	Err  error  // The first error reported, if any
+}
+
+// UI presents the tutorial.
+type UI interface {
+	// Step introduces step n of total.
+	Step(n, total int, s Step)
+	// Result reports an attempt at s and whether it passed.
+	Result(s Step, a Attempt, passed bool)
+}
+
+// Tutorial follows a dictation service's recordings.
+type Tutorial struct {
+	attempts chan Attempt
+}
+
+// Attach wraps the service callbacks so the tutorial sees every recording.
+// Call it after setting the callbacks.
+func Attach(s *dictation.Service) *Tutorial {
+	t := &Tutorial{attempts: make(chan Attempt, 1)}
+	var mu sync.Mutex
+	var current Attempt
+	onStart := s.OnStart
+	s.OnStart = func() {
+		if onStart != nil {
+			onStart()
+		}
+		mu.Lock()
+		current = Attempt{}
+		mu.Unlock()
+	}
+	onResult := s.OnResult
+	s.OnResult = func(r dictation.Result) {
+		if onResult != nil {
+			onResult(r)
+		}
+		mu.Lock()
+		current.Text = strings.TrimSpace(current.Text + " " + r.Text)
+		mu.Unlock()
+	}
+	onError := s.OnError
+	s.OnError = func(err error) {
+		if onError != nil {
+			onError(err)
+		}
+		mu.Lock()
+		if current.Err == nil {
+			current.Err = err
+		}
+		mu.Unlock()
+	}
+	onFinish := s.OnFinish
+	s.OnFinish = func() {
+		if onFinish != nil {
+			onFinish()
+		}
+		mu.Lock()
+		a := current
+		mu.Unlock()
+		select {
+		case t.attempts <- a:
+		default: // The tutorial is not waiting
+		}
+	}
+	return t
+}
+
+// Run goes through Steps, repeating each until an attempt passes. It
+// returns early with the context's error if ctx is cancelled.
+func (t *Tutorial) Run(ctx context.Context, ui UI) error {
+	// Forget recordings made before the tutorial started.
+	select {
+	case <-t.attempts:
+	default:
+	}
+	for i, step := range Steps {
+		ui.Step(i+1, len(Steps), step)
+		for {
+			var a Attempt
+			select {
+			case a = <-t.attempts:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			passed := a.Err == nil && step.check(a.Text)
+			ui.Result(step, a, passed)
+			if passed {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// similar returns a check that passes transcripts containing at least
+// three quarters of the words of want, in any order, ignoring case and
+// punctuation.
+func similar(want string) func(string) bool {
+	return func(text string) bool {
+		have := make(map[string]bool)
+		for _, w := range words(text) {
+			have[w] = true
+		}
+		want := words(want)
+		found := 0
+		for _, w := range want {
+			if have[w] {
+				found++
+			}
+		}
+		return found*4 >= len(want)*3
+	}
+}
+
+func words(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '\''
+	})
+}
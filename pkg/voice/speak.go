@@ -0,0 +1,49 @@
+package voice
+
+import (
+	"errors"
+	"log"
+	"os/exec"
+	"runtime"
+)
+
+// speak reads text aloud and returns once it has been spoken, so the
+// microphone is not reopened while the answer is still playing.
+func (c *Controller) speak(text string) {
+	log.Printf("Accessibility mode: saying %q", text)
+	if err := Say(c.voice, text); err != nil {
+		log.Printf("Text to speech failed: %v", err)
+	}
+}
+
+// Say speaks text with the system text-to-speech, say on macOS and
+// speech-dispatcher or eSpeak elsewhere, and returns once it has been
+// spoken. voice picks a voice; empty uses the default.
+func Say(voice, text string) error {
+	if runtime.GOOS == "darwin" {
+		args := []string{text}
+		if voice != "" {
+			args = []string{"-v", voice, text}
+		}
+		return exec.Command("say", args...).Run()
+	}
+
+	if _, err := exec.LookPath("spd-say"); err == nil {
+		args := []string{"-w", text}
+		if voice != "" {
+			args = []string{"-w", "-y", voice, text}
+		}
+		return exec.Command("spd-say", args...).Run()
+	}
+	for _, name := range []string{"espeak-ng", "espeak"} {
+		if _, err := exec.LookPath(name); err != nil {
+			continue
+		}
+		args := []string{text}
+		if voice != "" {
+			args = []string{"-v", voice, text}
+		}
+		return exec.Command(name, args...).Run()
+	}
+	return errors.New("no text-to-speech program found, install speech-dispatcher or espeak-ng")
+}
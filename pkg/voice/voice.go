@@ -0,0 +1,386 @@
+// Package voice makes Chrisper fully operable by voice, for users who
+// cannot use a keyboard: it listens for a wake word followed by a command,
+// starts dictations and notes on request and answers with speech instead
+// of notifications.
+package voice
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"chrisper/pkg/dictation"
+)
+
+const (
+	// DefaultWakeWord starts every command unless WakeWord is set.
+	DefaultWakeWord = "computer"
+	// defaultAutoStop ends dictations started by voice when the service
+	// has no AutoStopAfter, since there may be no hotkey to stop them.
+	defaultAutoStop = 2 * time.Second
+	// awakeWindow is how long after a bare wake word the next utterance is
+	// taken as a command without repeating it.
+	awakeWindow = 10 * time.Second
+	// retryDelay keeps a failing microphone or backend from being retried
+	// in a tight loop.
+	retryDelay = 5 * time.Second
+)
+
+// Config configures accessibility mode.
+type Config struct {
+	// Enabled listens for the wake word whenever nothing else is being
+	// recorded. The wake word is found by transcribing every utterance
+	// heard, so this needs a local backend unless AllowCloud is set.
+	Enabled bool `json:"enabled,omitempty"`
+	// AllowCloud listens even with a backend that sends audio off the
+	// machine, such as Gemini: one request, paid for and seen by the
+	// provider, for everything said near the microphone.
+	AllowCloud bool `json:"allow_cloud,omitempty"`
+	// WakeWord starts every command, e.g. "computer, dictate". Defaults to
+	// "computer".
+	WakeWord string `json:"wake_word,omitempty"`
+	// Voice is the text-to-speech voice, e.g. "Samantha" for say on macOS
+	// or "female1" for spd-say. Empty uses the system default.
+	Voice string `json:"voice,omitempty"`
+}
+
+// role says who started a recording.
+type role int
+
+const (
+	external  role = iota // The hotkey, the menu or another caller
+	listening             // Waiting for a command
+	dictating             // A dictation or note asked for by voice
+)
+
+// Controller runs accessibility mode on a dictation service.
+type Controller struct {
+	s     *dictation.Service
+	wake  []string
+	voice string
+
+	mu       sync.Mutex
+	starting role // Role of the recording being started
+	current  role // Role of the running recording
+	stopped  bool
+	heard    bool      // The current recording produced a transcript
+	last     string    // Most recent transcript, for "read back"
+	awake    time.Time // Until then no wake word is needed
+	say      string    // Spoken once the current recording has finished
+	next     func()    // Run after say instead of listening again
+	failed   bool      // An error was reported; wait before listening again
+	saving   bool      // Listening is paused to save power
+}
+
+// New wraps the service callbacks for accessibility mode. Call it after
+// setting the callbacks, then Start.
+func New(s *dictation.Service, cfg Config) *Controller {
+	wake := cfg.WakeWord
+	if wake == "" {
+		wake = DefaultWakeWord
+	}
+	c := &Controller{s: s, wake: words(wake), voice: cfg.Voice}
+
+	onStart := s.OnStart
+	s.OnStart = func() {
+		if onStart != nil {
+			onStart()
+		}
+		c.mu.Lock()
+		c.current, c.starting = c.starting, external
+		c.heard = false
+		c.mu.Unlock()
+	}
+	onResult := s.OnResult
+	s.OnResult = func(r dictation.Result) {
+		if onResult != nil {
+			onResult(r)
+		}
+		c.mu.Lock()
+		c.last = r.Text
+		c.heard = true
+		c.mu.Unlock()
+	}
+	onNote := s.OnNote
+	s.OnNote = func(path string) {
+		if onNote != nil {
+			onNote(path)
+		}
+		c.mu.Lock()
+		c.say = "Note saved."
+		c.mu.Unlock()
+	}
+	onError := s.OnError
+	s.OnError = func(err error) {
+		if onError != nil {
+			onError(err)
+		}
+		c.mu.Lock()
+		if c.say == "" {
+			c.say = fmt.Sprintf("Error: %v", err)
+		}
+		c.failed = true
+		stop := c.current == listening
+		c.mu.Unlock()
+		if stop {
+			s.StopRecording(context.Background())
+		}
+	}
+	onCommand := s.OnCommand
+	s.OnCommand = func(r dictation.Result) {
+		if onCommand != nil {
+			onCommand(r)
+		}
+		c.command(r.Text)
+	}
+	onFinish := s.OnFinish
+	s.OnFinish = func() {
+		if onFinish != nil {
+			onFinish()
+		}
+		c.finished()
+	}
+	onPowerSaving := s.OnPowerSaving
+	s.OnPowerSaving = func(saving bool) {
+		if onPowerSaving != nil {
+			onPowerSaving(saving)
+		}
+		c.powerSaving()
+	}
+	return c
+}
+
+// Start announces accessibility mode and begins listening for the wake
+// word. It returns once the announcement has been spoken.
+func (c *Controller) Start() {
+	log.Printf("Accessibility mode: listening for %q", strings.Join(c.wake, " "))
+	c.speak(fmt.Sprintf("Chrisper is listening. Say %s, help, for commands.", strings.Join(c.wake, " ")))
+	c.listen()
+}
+
+// Stop stops listening for good, e.g. before closing the service.
+func (c *Controller) Stop() {
+	c.mu.Lock()
+	c.stopped = true
+	listening := c.current == listening
+	c.mu.Unlock()
+	if listening {
+		c.s.StopRecording(context.Background())
+	}
+}
+
+// start starts a recording in role r. Nothing happens if another
+// recording is already running.
+func (c *Controller) start(r role, mode dictation.Mode, p dictation.Profile) {
+	c.mu.Lock()
+	if c.stopped {
+		c.mu.Unlock()
+		return
+	}
+	c.starting = r
+	c.mu.Unlock()
+
+	c.s.Start(context.Background(), mode, p)
+
+	c.mu.Lock()
+	c.starting = external
+	c.mu.Unlock()
+}
+
+// dictation returns the profile of a dictation or note asked for by voice,
+// which ends when the speaker pauses.
+func (c *Controller) dictation() dictation.Profile {
+	if c.s.AutoStopAfter > 0 {
+		return dictation.Profile{}
+	}
+	return dictation.Profile{AutoStopAfter: defaultAutoStop}
+}
+
+func (c *Controller) listen() {
+	if c.s.SavingPower(dictation.FeatureWakeWord) {
+		c.mu.Lock()
+		c.saving = true
+		c.mu.Unlock()
+		log.Printf("Accessibility mode: listening paused to save power")
+		return
+	}
+	c.start(listening, dictation.ModeCommand, dictation.Profile{Continuous: true})
+}
+
+// powerSaving stops listening when saving power starts, and listens again
+// once it ends.
+func (c *Controller) powerSaving() {
+	saving := c.s.SavingPower(dictation.FeatureWakeWord)
+	c.mu.Lock()
+	stop := saving && c.current == listening
+	resume := !saving && c.saving && !c.stopped
+	c.saving = saving && (c.saving || stop)
+	c.mu.Unlock()
+	switch {
+	case stop:
+		log.Printf("Accessibility mode: listening paused to save power")
+		c.s.StopRecording(context.Background())
+	case resume:
+		c.listen()
+	}
+}
+
+// finished decides what follows a recording: a spoken reply, the action
+// a command asked for, or listening again.
+func (c *Controller) finished() {
+	c.mu.Lock()
+	r, heard := c.current, c.heard
+	say, next, failed := c.say, c.next, c.failed
+	c.current, c.say, c.next, c.failed = external, "", nil, false
+	stopped := c.stopped
+	c.mu.Unlock()
+	if stopped {
+		return
+	}
+
+	switch {
+	case r == listening && say == "" && !failed:
+		// Stopped from outside, e.g. by the hotkey. Leave the microphone
+		// to whatever is recorded next; listening resumes after it.
+		log.Printf("Accessibility mode: listening paused")
+		return
+	case r == dictating && say == "" && !failed:
+		switch {
+		case !heard:
+			say = "Nothing was heard."
+		case c.s.Locked():
+			say = "Locked, nothing was typed."
+		default:
+			say = "Done."
+		}
+	}
+
+	go func() {
+		if say != "" {
+			c.speak(say)
+		}
+		if next != nil {
+			next()
+			return
+		}
+		if failed {
+			time.Sleep(retryDelay)
+		}
+		c.listen()
+	}()
+}
+
+// command handles an utterance heard while listening.
+func (c *Controller) command(text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.current != listening || c.say != "" || c.next != nil {
+		return // Already answering an earlier utterance
+	}
+
+	w := words(text)
+	rest, ok := cutPrefix(w, c.wake)
+	if !ok && time.Now().After(c.awake) {
+		return
+	}
+	if !ok {
+		rest = w
+	}
+	c.awake = time.Time{}
+
+	switch cmd := strings.Join(rest, " "); {
+	case cmd == "":
+		c.reply("Yes?", func() {
+			c.mu.Lock()
+			c.awake = time.Now().Add(awakeWindow)
+			c.mu.Unlock()
+			c.listen()
+		})
+	case oneOf(cmd, "dictate", "dictation", "start dictation", "type", "take dictation"):
+		c.reply("Dictating. Pause when you are done.", func() {
+			c.start(dictating, dictation.ModeDictate, c.dictation())
+		})
+	case oneOf(cmd, "note", "take a note", "new note", "voice note"):
+		c.reply("Taking a note.", func() {
+			c.start(dictating, dictation.ModeNote, c.dictation())
+		})
+	case oneOf(cmd, "read back", "read that back", "read it back", "repeat", "what did i say"):
+		if c.last == "" {
+			c.reply("Nothing has been dictated yet.", nil)
+		} else {
+			c.reply(c.last, nil)
+		}
+	case oneOf(cmd, "lock", "lock dictation"):
+		c.s.Lock()
+		c.reply("Locked. Dictations will not be typed.", nil)
+	case rest[0] == "unlock":
+		if c.s.Unlock(pin(rest[1:])) {
+			c.reply("Unlocked.", nil)
+		} else {
+			c.reply("Wrong PIN.", nil)
+		}
+	case oneOf(cmd, "help", "what can i say", "commands"):
+		c.reply(help, nil)
+	default:
+		c.reply(fmt.Sprintf("Sorry, I did not understand %s. Say help for commands.", cmd), nil)
+	}
+}
+
+// help lists the commands, spoken.
+const help = "Say the wake word, then: dictate, to type what you say next. " +
+	"Note, to save a voice note. Read back, to hear your last dictation. " +
+	"Lock, or unlock followed by your PIN. Dictations end when you pause."
+
+// reply stops listening so the answer is not recorded, then speaks it and
+// runs next, or listens again if next is nil. c.mu must be held.
+func (c *Controller) reply(say string, next func()) {
+	c.say, c.next = say, next
+	go c.s.StopRecording(context.Background())
+}
+
+// words splits text into lower case words without punctuation.
+func words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '\''
+	})
+}
+
+// cutPrefix returns w without prefix, and whether w started with it.
+func cutPrefix(w, prefix []string) ([]string, bool) {
+	if len(w) < len(prefix) {
+		return w, false
+	}
+	for i, p := range prefix {
+		if w[i] != p {
+			return w, false
+		}
+	}
+	return w[len(prefix):], true
+}
+
+func oneOf(cmd string, phrases ...string) bool {
+	return slices.Contains(phrases, cmd)
+}
+
+// digits maps spoken digits to numerals, for PINs transcribed as words.
+var digits = map[string]string{
+	"zero": "0", "oh": "0", "one": "1", "two": "2", "three": "3", "four": "4",
+	"five": "5", "six": "6", "seven": "7", "eight": "8", "nine": "9",
+}
+
+// pin joins the words of a spoken PIN, e.g. ["one", "2", "34"] is "1234".
+func pin(w []string) string {
+	var b strings.Builder
+	for _, word := range w {
+		if d, ok := digits[word]; ok {
+			word = d
+		}
+		b.WriteString(word)
+	}
+	return b.String()
+}